@@ -0,0 +1,182 @@
+"use strict";
+
+// The dashboard polls the API served below its page with the admin token of the session.
+const refreshInterval = 2000;
+const states = ["RECEIVED", "PROCESSING", "DONE", "CANCELLED"];
+
+const $ = (id) => document.getElementById(id);
+let timer;
+
+function token() {
+  return sessionStorage.getItem("token") || "";
+}
+
+async function api(path, options = {}) {
+  const response = await fetch("api/" + path, {
+    ...options,
+    headers: {Authorization: "Bearer " + token()},
+  });
+  const body = await response.json();
+  if (!response.ok) {
+    throw new Error(body.code + ": " + body.message);
+  }
+  return body;
+}
+
+function cell(row, text, className) {
+  const td = row.insertCell();
+  td.textContent = text === undefined || text === null ? "" : text;
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function time(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+function fill(id, items, render) {
+  const body = $(id);
+  body.replaceChildren();
+  for (const item of items) {
+    render(body.insertRow(), item);
+  }
+}
+
+function renderStats(stats) {
+  const counts = $("counts");
+  counts.replaceChildren();
+  for (const state of states) {
+    const card = document.createElement("div");
+    card.className = "card";
+    const count = document.createElement("strong");
+    count.textContent = Number(stats.counts[state] || 0);
+    card.append(count, state);
+    counts.append(card);
+  }
+
+  const types = Object.keys({...stats.type_counts, ...stats.value_sums}).map(Number).sort((a, b) => a - b);
+  fill("types", types, (row, type) => {
+    cell(row, type);
+    cell(row, Number(stats.type_counts[type] || 0));
+    cell(row, Number(stats.value_sums[type] || 0));
+  });
+}
+
+function renderSettings(settings) {
+  fill("settings", [
+    ["Processing", settings.paused ? "paused" : "running"],
+    ["Rate limit", settings.rate_limit + " tasks/s"],
+    ["Burst", settings.burst],
+    ["Workers", settings.workers],
+    ["Version", settings.version],
+  ], (row, [name, value]) => {
+    cell(row, name);
+    cell(row, value);
+  });
+}
+
+function renderWorkers(inFlight) {
+  $("replica").textContent = inFlight.replica;
+  fill("workers", inFlight.workers, (row, worker) => {
+    cell(row, worker.worker);
+    if (worker.task) {
+      cell(row, "#" + worker.task.id + " (" + worker.task.namespace + ")");
+    } else {
+      cell(row, "idle", "idle");
+    }
+    cell(row, Number(worker.processed));
+    cell(row, Number(worker.failed));
+    cell(row, time(worker.last_active_at));
+  });
+}
+
+function renderDeadLetters(deadLetters) {
+  fill("dead-letters", deadLetters.dead_letters, (row, letter) => {
+    cell(row, "#" + letter.task.id);
+    cell(row, letter.task.namespace);
+    cell(row, letter.task.type);
+    cell(row, letter.task.value);
+    cell(row, letter.reason, "reason");
+    cell(row, time(letter.failed_at));
+    const button = document.createElement("button");
+    button.textContent = "Requeue";
+    button.addEventListener("click", () => requeue(letter.task.id, button));
+    row.insertCell().append(button);
+  });
+}
+
+function renderTasks(page) {
+  fill("tasks", page.tasks, (row, task) => {
+    cell(row, "#" + task.id);
+    cell(row, task.namespace);
+    cell(row, task.type);
+    cell(row, task.value);
+    cell(row, task.state);
+    cell(row, time(task.creation_time));
+    cell(row, time(task.last_update_time));
+  });
+}
+
+async function requeue(id, button) {
+  button.disabled = true;
+  try {
+    await api("dead-letters/" + id + "/requeue", {method: "POST"});
+    await refresh();
+  } catch (err) {
+    showStatus(err.message, true);
+    button.disabled = false;
+  }
+}
+
+function showStatus(message, error) {
+  const status = $("status");
+  status.textContent = message;
+  status.classList.toggle("error", error);
+}
+
+async function refresh() {
+  const filter = new URLSearchParams();
+  if ($("namespace").value) {
+    filter.set("namespace", $("namespace").value);
+  }
+  const scoped = "?" + filter;
+  if ($("state").value) {
+    filter.set("state", $("state").value);
+  }
+  try {
+    const [statsBody, settings, workers, deadLetters, tasks] = await Promise.all([
+      api("stats" + scoped), api("settings"), api("workers" + scoped), api("dead-letters" + scoped), api("tasks?" + filter),
+    ]);
+    renderStats(statsBody);
+    renderSettings(settings);
+    renderWorkers(workers);
+    renderDeadLetters(deadLetters);
+    renderTasks(tasks);
+    showStatus("Updated " + new Date().toLocaleTimeString(), false);
+  } catch (err) {
+    showStatus(err.message, true);
+  }
+}
+
+function start() {
+  clearInterval(timer);
+  refresh();
+  timer = setInterval(refresh, refreshInterval);
+}
+
+$("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  sessionStorage.setItem("token", $("token").value);
+  $("token").value = "";
+  start();
+});
+$("namespace").addEventListener("change", refresh);
+$("state").addEventListener("change", refresh);
+
+if (token()) {
+  start();
+} else {
+  showStatus("Enter an admin token", false);
+}
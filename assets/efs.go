@@ -4,3 +4,8 @@ import "embed"
 
 //go:embed "migrations"
 var EmbeddedFiles embed.FS
+
+// DashboardFiles holds the page of the consumer dashboard and its script and styles.
+//
+//go:embed "dashboard"
+var DashboardFiles embed.FS
@@ -1 +1 @@
-DROP TABLE if EXISTS yqapp_demo_schema.tasks;
+DROP TABLE IF EXISTS tasks;
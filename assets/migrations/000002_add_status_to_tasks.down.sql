@@ -1,7 +1,6 @@
-
 BEGIN;
 
-ALTER TABLE yqapp_demo_schema.tasks DROP COLUMN state;
+ALTER TABLE tasks DROP COLUMN state;
 DROP TYPE state_enum;
 
-COMMIT;
\ No newline at end of file
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Runtime overrides applied by every consumer replica, NULL columns fall back to the configuration
+CREATE TABLE IF NOT EXISTS consumer_settings (
+                                     id INT PRIMARY KEY CHECK (id = 1),   -- Single row shared by every replica
+                                     paused BOOLEAN NOT NULL DEFAULT FALSE,
+                                     rate_limit DOUBLE PRECISION CHECK (rate_limit > 0),
+                                     burst INT CHECK (burst > 0),
+                                     workers INT CHECK (workers > 0),
+                                     version BIGINT NOT NULL DEFAULT 1,  -- Incremented on every change
+                                     updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE tasks
+    ALTER COLUMN type DROP NOT NULL,
+    ALTER COLUMN value DROP NOT NULL,
+    ALTER COLUMN state DROP NOT NULL;
+
+ALTER TYPE state RENAME TO state_enum;
+
+COMMIT;
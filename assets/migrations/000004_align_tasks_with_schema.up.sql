@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Align the tasks table with sql/schema.sql, which sqlc generates the queries from
+ALTER TYPE state_enum RENAME TO state;
+
+UPDATE tasks SET state = 'RECEIVED' WHERE state IS NULL;
+
+ALTER TABLE tasks
+    ALTER COLUMN type SET NOT NULL,
+    ALTER COLUMN value SET NOT NULL,
+    ALTER COLUMN state SET NOT NULL;
+
+COMMIT;
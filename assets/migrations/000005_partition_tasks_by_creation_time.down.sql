@@ -0,0 +1,30 @@
+BEGIN;
+
+ALTER TABLE tasks RENAME TO tasks_partitioned;
+ALTER TABLE tasks_partitioned RENAME CONSTRAINT tasks_pkey TO tasks_partitioned_pkey;
+ALTER SEQUENCE tasks_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_task_state;
+DROP INDEX IF EXISTS idx_task_type;
+
+CREATE TABLE tasks (
+                                     id INT PRIMARY KEY DEFAULT nextval('tasks_id_seq'),
+                                     type INT NOT NULL CHECK (type BETWEEN 0 AND 9),
+                                     value INT NOT NULL CHECK (value BETWEEN 0 AND 99),
+                                     state STATE NOT NULL,
+                                     creation_time FLOAT NOT NULL,
+                                     last_update_time FLOAT NOT NULL
+);
+
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+CREATE INDEX IF NOT EXISTS idx_task_state ON tasks(state);
+
+CREATE INDEX IF NOT EXISTS idx_task_type ON tasks(type);
+
+INSERT INTO tasks (id, type, value, state, creation_time, last_update_time)
+SELECT id, type, value, state, creation_time, last_update_time FROM tasks_partitioned;
+
+-- Drops every partition as well
+DROP TABLE tasks_partitioned;
+
+COMMIT;
@@ -0,0 +1,36 @@
+BEGIN;
+
+-- Partition the tasks by creation time, the partitions are created and retired by the consumer.
+-- The primary key of a partitioned table must include the partition key.
+ALTER TABLE tasks RENAME TO tasks_unpartitioned;
+ALTER TABLE tasks_unpartitioned RENAME CONSTRAINT tasks_pkey TO tasks_unpartitioned_pkey;
+ALTER TABLE tasks_unpartitioned ALTER COLUMN id DROP DEFAULT;
+ALTER SEQUENCE tasks_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_task_state;
+DROP INDEX IF EXISTS idx_task_type;
+
+CREATE TABLE tasks (
+                                     id INT NOT NULL DEFAULT nextval('tasks_id_seq'),
+                                     type INT NOT NULL CHECK (type BETWEEN 0 AND 9),
+                                     value INT NOT NULL CHECK (value BETWEEN 0 AND 99),
+                                     state STATE NOT NULL,
+                                     creation_time FLOAT NOT NULL,
+                                     last_update_time FLOAT NOT NULL,
+                                     PRIMARY KEY (id, creation_time)
+) PARTITION BY RANGE (creation_time);
+
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+CREATE INDEX IF NOT EXISTS idx_task_state ON tasks(state);
+
+CREATE INDEX IF NOT EXISTS idx_task_type ON tasks(type);
+
+-- Holds the tasks outside of every partition until the consumer moves them to their partition
+CREATE TABLE tasks_default PARTITION OF tasks DEFAULT;
+
+INSERT INTO tasks (id, type, value, state, creation_time, last_update_time)
+SELECT id, type, value, state, creation_time, last_update_time FROM tasks_unpartitioned;
+
+DROP TABLE tasks_unpartitioned;
+
+COMMIT;
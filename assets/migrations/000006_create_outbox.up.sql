@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Task lifecycle events written with each state change, removed once published by the relay
+CREATE TABLE IF NOT EXISTS outbox (
+                                     id BIGSERIAL PRIMARY KEY,            -- Publication order of the events
+                                     event_type TEXT NOT NULL,            -- CloudEvents type, e.g. yqapp.task.done
+                                     task_id INT NOT NULL,
+                                     data JSONB NOT NULL,                 -- Snapshot of the task after the change
+                                     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                     attempts INT NOT NULL DEFAULT 0,     -- Failed attempts to publish the event
+                                     last_error TEXT
+);
+
+COMMIT;
@@ -0,0 +1,37 @@
+BEGIN;
+
+ALTER TABLE tasks RENAME TO tasks_timestamptz;
+ALTER TABLE tasks_timestamptz RENAME CONSTRAINT tasks_pkey TO tasks_timestamptz_pkey;
+ALTER TABLE tasks_default RENAME TO tasks_timestamptz_default;
+ALTER INDEX tasks_default_pkey RENAME TO tasks_timestamptz_default_pkey;
+ALTER TABLE tasks_timestamptz ALTER COLUMN id DROP DEFAULT;
+ALTER SEQUENCE tasks_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_task_state;
+DROP INDEX IF EXISTS idx_task_type;
+
+CREATE TABLE tasks (
+                                     id INT NOT NULL DEFAULT nextval('tasks_id_seq'),
+                                     type INT NOT NULL CHECK (type BETWEEN 0 AND 9),
+                                     value INT NOT NULL CHECK (value BETWEEN 0 AND 99),
+                                     state STATE NOT NULL,
+                                     creation_time FLOAT NOT NULL,
+                                     last_update_time FLOAT NOT NULL,
+                                     PRIMARY KEY (id, creation_time)
+) PARTITION BY RANGE (creation_time);
+
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+CREATE INDEX IF NOT EXISTS idx_task_state ON tasks(state);
+
+CREATE INDEX IF NOT EXISTS idx_task_type ON tasks(type);
+
+CREATE TABLE tasks_default PARTITION OF tasks DEFAULT;
+
+INSERT INTO tasks (id, type, value, state, creation_time, last_update_time)
+SELECT id, type, value, state, extract(EPOCH FROM creation_time), extract(EPOCH FROM last_update_time)
+FROM tasks_timestamptz;
+
+-- Drops every partition as well
+DROP TABLE tasks_timestamptz;
+
+COMMIT;
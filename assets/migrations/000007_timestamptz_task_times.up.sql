@@ -0,0 +1,46 @@
+BEGIN;
+
+-- The type of the partition key cannot be altered, the tasks are copied to a new partitioned table.
+-- They land in the default partition and are moved to their partition by the consumer.
+ALTER TABLE tasks RENAME TO tasks_float;
+ALTER TABLE tasks_float RENAME CONSTRAINT tasks_pkey TO tasks_float_pkey;
+ALTER TABLE tasks_default RENAME TO tasks_float_default;
+ALTER INDEX tasks_default_pkey RENAME TO tasks_float_default_pkey;
+ALTER TABLE tasks_float ALTER COLUMN id DROP DEFAULT;
+ALTER SEQUENCE tasks_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS idx_task_state;
+DROP INDEX IF EXISTS idx_task_type;
+
+CREATE TABLE tasks (
+                                     id INT NOT NULL DEFAULT nextval('tasks_id_seq'),
+                                     type INT NOT NULL CHECK (type BETWEEN 0 AND 9),
+                                     value INT NOT NULL CHECK (value BETWEEN 0 AND 99),
+                                     state STATE NOT NULL,
+                                     creation_time TIMESTAMPTZ NOT NULL,
+                                     last_update_time TIMESTAMPTZ NOT NULL,
+                                     started_at TIMESTAMPTZ,
+                                     finished_at TIMESTAMPTZ,
+                                     PRIMARY KEY (id, creation_time)
+) PARTITION BY RANGE (creation_time);
+
+ALTER SEQUENCE tasks_id_seq OWNED BY tasks.id;
+
+CREATE INDEX IF NOT EXISTS idx_task_state ON tasks(state);
+
+CREATE INDEX IF NOT EXISTS idx_task_type ON tasks(type);
+
+CREATE TABLE tasks_default PARTITION OF tasks DEFAULT;
+
+-- A zero last_update_time means the task was never updated, the start of processing was not recorded
+INSERT INTO tasks (id, type, value, state, creation_time, last_update_time, started_at, finished_at)
+SELECT id, type, value, state,
+       to_timestamp(creation_time),
+       to_timestamp(CASE WHEN last_update_time = 0 THEN creation_time ELSE last_update_time END),
+       NULL,
+       CASE WHEN state = 'DONE' THEN to_timestamp(last_update_time) END
+FROM tasks_float;
+
+-- Drops every partition as well
+DROP TABLE tasks_float;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_task_namespace_state;
+
+ALTER TABLE tasks DROP COLUMN IF EXISTS namespace;
+
+COMMIT;
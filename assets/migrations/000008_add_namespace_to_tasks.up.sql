@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Tenant owning the task, the existing tasks belong to the default namespace
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS namespace TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_task_namespace_state ON tasks(namespace, state);
+
+COMMIT;
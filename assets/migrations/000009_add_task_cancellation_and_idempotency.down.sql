@@ -0,0 +1,16 @@
+BEGIN;
+
+DROP TABLE IF EXISTS idempotency_keys;
+
+-- Enum values cannot be removed, the type is recreated without CANCELLED and the cancelled tasks are kept as DONE
+UPDATE tasks SET state = 'DONE' WHERE state = 'CANCELLED';
+
+ALTER TYPE state RENAME TO state_old;
+
+CREATE TYPE state AS ENUM('RECEIVED','PROCESSING','DONE');
+
+ALTER TABLE tasks ALTER COLUMN state TYPE state USING state::text::state;
+
+DROP TYPE state_old;
+
+COMMIT;
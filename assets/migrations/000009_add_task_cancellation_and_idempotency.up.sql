@@ -0,0 +1,11 @@
+-- Adding an enum value cannot be combined with other statements using it, the migration only declares it
+ALTER TYPE state ADD VALUE IF NOT EXISTS 'CANCELLED';
+
+-- Task created for each idempotency key of a namespace, removed along with the expired partitions
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+                                     namespace TEXT NOT NULL,
+                                     key TEXT NOT NULL,
+                                     task_id INT NOT NULL,
+                                     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                     PRIMARY KEY (namespace, key)
+);
@@ -32,6 +32,19 @@ func main() {
 	if err != nil {
 		log.Fatalln("reading config failed", err)
 	}
+
+	// Run the subcommand instead of the consumer, e.g. `consumer migrate status`
+	subcommands := map[string]func(conf.Configuration, []string) error{
+		"migrate": runMigrate,
+		"export":  runExport,
+		"import":  runImport,
+	}
+	if run, ok := subcommands[flag.Arg(0)]; ok {
+		if err = run(*cfg, flag.Args()[1:]); err != nil {
+			log.Fatalln(flag.Arg(0), "failed:", err)
+		}
+		return
+	}
 	s, err := server.Setup(*cfg)
 	if err != nil {
 		log.Fatalln("setup consumer failed", err)
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/database"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: consumer migrate <command>
+
+commands:
+  up          apply every pending migration
+  down N      roll back the last N migrations
+  status      print the applied version and the embedded migrations
+  force V     set the version to V without running migrations, -1 for none`
+
+// runMigrate manages the migrations embedded in the consumer binary.
+func runMigrate(cfg conf.Configuration, args []string) error {
+	if cfg.Database.Engine != "" && cfg.Database.Engine != "postgres" {
+		return fmt.Errorf("migrations are only supported by the postgres engine, got %q", cfg.Database.Engine)
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	// Check the arguments before connecting to the database
+	var n int
+	var err error
+	switch args[0] {
+	case "up", "status":
+	case "down":
+		n, err = intArg(args, "N")
+	case "force":
+		n, err = intArg(args, "V")
+	default:
+		err = fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	poolConfig, err := database.NewPoolConfig(cfg.Database)
+	if err != nil {
+		return err
+	}
+	migrator, err := database.NewMigrator(poolConfig.ConnConfig)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down(n)
+	case "force":
+		err = migrator.Force(n)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(migrator)
+}
+
+func intArg(args []string, name string) (int, error) {
+	if len(args) != 2 {
+		return 0, fmt.Errorf("migrate %s requires %s\n%s", args[0], name, migrateUsage)
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, args[1], err)
+	}
+	return n, nil
+}
+
+func printMigrationStatus(migrator *database.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Version: %d\n", status.Version)
+	if status.Dirty {
+		fmt.Println("Dirty: the last migration failed, fix the schema and run `consumer migrate force V`")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range status.Migrations {
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%t\n", m.Version, m.Name, m.Applied)
+	}
+	return w.Flush()
+}
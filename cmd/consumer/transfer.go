@@ -0,0 +1,311 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/database"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const exportUsage = `usage: consumer export [flags] FILE
+
+Writes the tasks ordered by id to FILE, - for the standard output.`
+
+const importUsage = `usage: consumer import [flags] FILE
+
+Inserts the tasks of FILE, - for the standard input, in a single transaction.`
+
+const transferFormats = `
+The format is read from the extension of FILE unless -format is set: .ndjson or .jsonl, .csv,
+.yaml or .yml and .json, followed by .gz for gzip compressed files. - is read and written as ndjson.
+
+flags:`
+
+// formatAliases are the file extensions naming a format other than their own.
+var formatAliases = map[string]serializer.Format{
+	"jsonl": serializer.FormatNDJSON,
+	"yml":   serializer.FormatYAML,
+}
+
+// runExport writes the tasks matching the flags to a file.
+func runExport(cfg conf.Configuration, args []string) error {
+	if err := checkTransferEngine(cfg, "export"); err != nil {
+		return err
+	}
+	flags := newTransferFlagSet("export", exportUsage)
+	format := flags.String("format", "", "Format of the file, read from its extension when empty")
+	ns := flags.String("namespace", "", "Export the tasks of the namespace only")
+	states := flags.String("state", "", "Export the tasks in the comma separated states only, e.g. DONE,CANCELLED")
+	since := flags.String("since", "", "Export the tasks created at or after the RFC 3339 time only")
+	until := flags.String("until", "", "Export the tasks created before the RFC 3339 time only")
+	batch := flags.Int("batch", 1000, "Number of tasks fetched from the database at a time")
+	path, err := parseTransferFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	// Check the arguments before connecting to the database
+	filter := database.ExportFilter{Namespace: *ns}
+	if *states != "" {
+		for _, s := range strings.Split(*states, ",") {
+			state := domain.State(strings.ToUpper(strings.TrimSpace(s)))
+			if !state.Valid() {
+				return fmt.Errorf("unknown state %q", s)
+			}
+			filter.States = append(filter.States, database.State(state))
+		}
+	}
+	if filter.Since, err = parseTimeFlag("since", *since); err != nil {
+		return err
+	}
+	if filter.Until, err = parseTimeFlag("until", *until); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("invalid batch %d, expected a positive number", *batch)
+	}
+	codec, compressed, err := transferCodec(path, *format)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := database.NewPool(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	file, err := createExportFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.abort()
+
+	w := io.Writer(file.w)
+	var zw *gzip.Writer
+	if compressed {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	encoder := codec.NewEncoder(w)
+	exported, err := database.ExportTasks(ctx, pool, filter, *batch, func(task database.Task) error {
+		return encoder.Encode(domain.FromDBToDomain(&task))
+	})
+	if err != nil {
+		return err
+	}
+	if err = encoder.Close(); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err = zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err = file.close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d tasks to %s\n", exported, path)
+	return nil
+}
+
+// runImport inserts the tasks of a file, written by export or found in the partition archives.
+func runImport(cfg conf.Configuration, args []string) error {
+	if err := checkTransferEngine(cfg, "import"); err != nil {
+		return err
+	}
+	flags := newTransferFlagSet("import", importUsage)
+	format := flags.String("format", "", "Format of the file, read from its extension when empty")
+	keepIDs := flags.Bool("keep-ids", false, "Keep the ids of the tasks, which must not be taken, instead of assigning new ones")
+	resetStates := flags.Bool("reset-states", false, "Import the tasks as RECEIVED, without their start and finish times")
+	path, err := parseTransferFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	codec, compressed, err := transferCodec(path, *format)
+	if err != nil {
+		return err
+	}
+
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	if compressed {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := database.NewPool(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	decoder := codec.NewDecoder(r)
+	now := time.Now()
+	var read int
+	next := func() (database.Task, error) {
+		task := new(domain.Task)
+		if err := decoder.Decode(task); err != nil {
+			if errors.Is(err, io.EOF) {
+				return database.Task{}, io.EOF
+			}
+			return database.Task{}, fmt.Errorf("reading task %d of %s: %w", read+1, path, err)
+		}
+		read++
+		// The fields missing from the file get the values of a task created by the import
+		if task.Namespace == "" {
+			task.Namespace = namespace.Default
+		}
+		if task.CreationTime.IsZero() {
+			task.CreationTime = now
+		}
+		if task.LastUpdateTime.IsZero() {
+			task.LastUpdateTime = task.CreationTime
+		}
+		return domain.FromDomainToDB(task), nil
+	}
+	opts := database.ImportOptions{KeepIDs: *keepIDs, ResetStates: *resetStates}
+	if cfg.Outbox.Enabled {
+		opts.CreatedEvent = store.EventTaskCreated
+	}
+	imported, err := database.ImportTasks(ctx, pool, next, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d tasks from %s\n", imported, path)
+	return nil
+}
+
+func checkTransferEngine(cfg conf.Configuration, command string) error {
+	if cfg.Database.Engine != "" && cfg.Database.Engine != "postgres" {
+		return fmt.Errorf("%s is only supported by the postgres engine, got %q", command, cfg.Database.Engine)
+	}
+	return nil
+}
+
+func newTransferFlagSet(command, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), usage+"\n"+transferFormats)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseTransferFlags parses the flags and returns the FILE argument.
+func parseTransferFlags(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", fmt.Errorf("%s requires a FILE", flags.Name())
+	}
+	return flags.Arg(0), nil
+}
+
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s %q, expected an RFC 3339 time: %w", name, value, err)
+	}
+	return t, nil
+}
+
+// transferCodec returns the codec of the format, read from the extension of path when empty,
+// and whether the file is gzip compressed.
+func transferCodec(path, format string) (serializer.Codec, bool, error) {
+	compressed := strings.HasSuffix(path, ".gz")
+	if format == "" {
+		if path == "-" {
+			format = string(serializer.FormatNDJSON)
+		} else {
+			format = strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(path, ".gz")), ".")
+			if alias, ok := formatAliases[strings.ToLower(format)]; ok {
+				format = string(alias)
+			}
+		}
+		if format == "" {
+			return serializer.Codec{}, false, fmt.Errorf("the format of %s cannot be read from its extension, set -format", path)
+		}
+	}
+	codec, err := serializer.Lookup(format)
+	return codec, compressed, err
+}
+
+// exportFile is written next to its final path and only renamed to it by close, like the partition archives,
+// so that an interrupted export never replaces a complete file.
+type exportFile struct {
+	path string
+	w    io.Writer
+	file *os.File
+	done bool
+}
+
+func createExportFile(path string) (*exportFile, error) {
+	if path == "-" {
+		return &exportFile{path: path, w: os.Stdout}, nil
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &exportFile{path: path, w: file, file: file}, nil
+}
+
+func (f *exportFile) close() error {
+	f.done = true
+	if f.file == nil {
+		return nil
+	}
+	if err := f.file.Close(); err != nil {
+		_ = os.Remove(f.file.Name())
+		return err
+	}
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		_ = os.Remove(f.file.Name())
+		return err
+	}
+	return nil
+}
+
+// abort removes the temporary file unless the export is complete.
+func (f *exportFile) abort() {
+	if f.done || f.file == nil {
+		return
+	}
+	_ = f.file.Close()
+	_ = os.Remove(f.file.Name())
+}
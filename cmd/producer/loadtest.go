@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/client"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runLoadTest sends the producer workload at the load test rates, writes the report and
+// fails when the run misses one of its SLO thresholds.
+func runLoadTest(cfg conf.Configuration) error {
+	if err := cfg.ValidateLoadTest(); err != nil {
+		return err
+	}
+	c, err := client.Setup(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := c.LoadTest(ctx)
+	err = errors.Join(err, c.Shutdown(context.Background()))
+	if report == nil {
+		return err
+	}
+	sloErr := report.Check(cfg.ProducerService.LoadTest.SLO)
+
+	out := os.Stdout
+	if path := cfg.ProducerService.LoadTest.ReportPath; path != "" {
+		file, createErr := os.Create(path)
+		if createErr != nil {
+			return errors.Join(err, createErr)
+		}
+		defer file.Close()
+		out = file
+	}
+	return errors.Join(err, report.Write(out), sloErr)
+}
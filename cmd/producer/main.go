@@ -32,6 +32,13 @@ func main() {
 	if err != nil {
 		log.Fatalln("reading config failed", err)
 	}
+	// Run a load test instead of the producer, e.g. `producer loadtest`
+	if flag.Arg(0) == "loadtest" {
+		if err = runLoadTest(*cfg); err != nil {
+			log.Fatalln("load test failed:", err)
+		}
+		return
+	}
 	c, err := client.Setup(*cfg)
 	if err != nil {
 		log.Fatalln("setup producer failed", err)
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+)
+
+const adminUsage = `usage: taskctl admin <command>
+
+commands:
+  pause       stop picking up tasks on every consumer replica
+  resume      resume picking up tasks on every consumer replica
+  settings    print the settings applied by the consumers
+
+The calls require a token with admin: true.`
+
+// runAdmin calls the AdminService, the settings it returns are shared by every replica.
+func (a *app) runAdmin(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		_, _ = fmt.Fprintln(a.stderr, adminUsage)
+		return errUsage
+	}
+
+	var settings *v1.ConsumerSettings
+	var err error
+	switch args[0] {
+	case "pause":
+		settings, err = a.admin.PauseProcessing(ctx, &v1.PauseProcessingRequest{}, a.callOpts...)
+	case "resume":
+		settings, err = a.admin.ResumeProcessing(ctx, &v1.ResumeProcessingRequest{}, a.callOpts...)
+	case "settings":
+		settings, err = a.admin.GetSettings(ctx, &v1.GetSettingsRequest{}, a.callOpts...)
+	case "-h", "-help", "--help":
+		_, _ = fmt.Fprintln(a.stderr, adminUsage)
+		return flag.ErrHelp
+	default:
+		_, _ = fmt.Fprintf(a.stderr, "unknown admin command %q\n%s\n", args[0], adminUsage)
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	return a.printer.settings(settings)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"strconv"
+	"strings"
+)
+
+// errUsage is returned for invalid arguments, once the usage of the command has been printed.
+var errUsage = errors.New("invalid arguments")
+
+// command holds the flags and the positional arguments of a command.
+type command struct {
+	*flag.FlagSet
+	positional []string
+}
+
+// newCommand returns the flags of a command, the usage is printed to the standard error of the app on
+// invalid arguments and the errors are returned instead of exiting.
+func (a *app) newCommand(name string, positional ...string) *command {
+	flags := flag.NewFlagSet("taskctl "+name, flag.ContinueOnError)
+	flags.SetOutput(a.stderr)
+	c := &command{FlagSet: flags, positional: positional}
+	flags.Usage = c.usage
+	return c
+}
+
+func (c *command) usage() {
+	out := c.Output()
+	_, _ = fmt.Fprintf(out, "usage: %s", c.Name())
+	var hasFlags bool
+	c.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		_, _ = fmt.Fprint(out, " [flags]")
+	}
+	for _, arg := range c.positional {
+		_, _ = fmt.Fprint(out, " "+arg)
+	}
+	_, _ = fmt.Fprintln(out)
+	if hasFlags {
+		_, _ = fmt.Fprintln(out, "\nflags:")
+		c.PrintDefaults()
+	}
+}
+
+// parse parses the flags of the command and checks the number of its positional arguments. It returns
+// flag.ErrHelp when the usage was requested and errUsage for invalid arguments.
+func (c *command) parse(args []string) error {
+	if err := c.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		// The flag package has printed the error and the usage
+		return errUsage
+	}
+	if c.NArg() != len(c.positional) {
+		_, _ = fmt.Fprintf(c.Output(), "%s: expected %d argument(s), got %d\n", c.Name(), len(c.positional), c.NArg())
+		c.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func idArg(flags *command) (uint32, error) {
+	id, err := strconv.ParseUint(flags.Arg(0), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid task id %q", flags.Arg(0))
+	}
+	return uint32(id), nil
+}
+
+func (a *app) create(ctx context.Context, args []string) error {
+	flags := a.newCommand("create")
+	taskType := flags.Uint("type", 0, "Type of the task, between 0 and 9")
+	value := flags.Uint("value", 0, "Value of the task, between 0 and 99")
+	key := flags.String("key", "", "Idempotency key, a task is created once per key; a random key when empty")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+
+	task, err := a.tasks.Create(ctx, taskclient.NewTask{Type: uint32(*taskType), Value: uint32(*value), IdempotencyKey: *key})
+	if err != nil {
+		return err
+	}
+	return a.printer.task(task)
+}
+
+func (a *app) get(ctx context.Context, args []string) error {
+	flags := a.newCommand("get", "ID")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	id, err := idArg(flags)
+	if err != nil {
+		return err
+	}
+
+	task, err := a.tasks.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.printer.task(task)
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	flags := a.newCommand("list")
+	state := flags.String("state", "", "Only list the tasks in this state: RECEIVED, PROCESSING, DONE or CANCELLED")
+	limit := flags.Int("limit", 100, "Number of tasks listed, the size of every page with -all")
+	all := flags.Bool("all", false, "List the tasks of every page instead of the first one")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+
+	opts := taskclient.ListOptions{State: taskclient.State(strings.ToUpper(*state)), PageSize: *limit}
+	if !*all {
+		page, err := a.tasks.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return a.printer.tasks(page.Tasks)
+	}
+
+	var tasks []*taskclient.Task
+	err := a.tasks.ListAll(ctx, opts, func(task *taskclient.Task) error {
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return a.printer.tasks(tasks)
+}
+
+func (a *app) watch(ctx context.Context, args []string) error {
+	flags := a.newCommand("watch", "ID")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	id, err := idArg(flags)
+	if err != nil {
+		return err
+	}
+
+	return a.tasks.Watch(ctx, id, a.printer.update)
+}
+
+func (a *app) cancel(ctx context.Context, args []string) error {
+	flags := a.newCommand("cancel", "ID")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	id, err := idArg(flags)
+	if err != nil {
+		return err
+	}
+
+	task, err := a.tasks.Cancel(ctx, id)
+	if errors.Is(err, taskclient.ErrFinished) {
+		return fmt.Errorf("task %d is already finished", id)
+	}
+	if err != nil {
+		return err
+	}
+	return a.printer.task(task)
+}
+
+// retry creates a new task with the type and value of a finished task, the original task is kept.
+func (a *app) retry(ctx context.Context, args []string) error {
+	flags := a.newCommand("retry", "ID")
+	key := flags.String("key", "", "Idempotency key of the new task, a random key when empty")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	id, err := idArg(flags)
+	if err != nil {
+		return err
+	}
+
+	task, err := a.tasks.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !task.State.Final() {
+		return fmt.Errorf("task %d is %s, only DONE or CANCELLED tasks are retried", id, task.State)
+	}
+	retried, err := a.tasks.Create(ctx, taskclient.NewTask{Type: task.Type, Value: task.Value, IdempotencyKey: *key})
+	if err != nil {
+		return err
+	}
+	return a.printer.task(retried)
+}
+
+func (a *app) stats(ctx context.Context, args []string) error {
+	flags := a.newCommand("stats")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+
+	stats, err := a.tasks.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	return a.printer.stats(stats)
+}
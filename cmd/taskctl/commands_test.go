@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient/taskclienttest"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandsSuite(t *testing.T) {
+	suite.Run(t, new(CommandsTestSuite))
+}
+
+// CommandsTestSuite runs the commands against an in-memory TaskService.
+type CommandsTestSuite struct {
+	suite.Suite
+	server *taskclienttest.Server
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	app    *app
+}
+
+func (suite *CommandsTestSuite) SetupTest() {
+	suite.server = taskclienttest.NewServer()
+	tasks, err := suite.server.Client(taskclient.WithRetry(taskclient.NoRetry))
+	suite.Require().NoError(err)
+
+	suite.stdout.Reset()
+	suite.stderr.Reset()
+	p, err := newPrinter(&suite.stdout, serializer.FormatJSON)
+	suite.Require().NoError(err)
+	suite.app = &app{tasks: tasks, printer: p, stderr: &suite.stderr, timeout: time.Second}
+}
+
+func (suite *CommandsTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.app.tasks.Close())
+	suite.server.Close()
+}
+
+func (suite *CommandsTestSuite) run(args ...string) error {
+	return suite.app.run(context.Background(), args[0], args[1:])
+}
+
+func (suite *CommandsTestSuite) TestCreateAndGet() {
+	suite.Require().NoError(suite.run("create", "-type", "3", "-value", "42", "-key", "k1"))
+	suite.Require().NoError(suite.run("create", "-type", "3", "-value", "42", "-key", "k1"))
+	suite.Require().Len(suite.server.Tasks(), 1, "the key creates the task once")
+	suite.Assert().Equal(uint32(3), suite.server.Tasks()[0].GetType())
+	suite.Assert().Equal(uint32(42), suite.server.Tasks()[0].GetValue())
+
+	suite.stdout.Reset()
+	suite.Require().NoError(suite.run("get", "1"))
+	suite.Assert().Contains(suite.stdout.String(), `"value": 42`)
+	suite.Assert().Empty(suite.stderr.String())
+}
+
+func (suite *CommandsTestSuite) TestList() {
+	for i := 0; i < 3; i++ {
+		suite.Require().NoError(suite.run("create", "-type", "1", "-value", "1"))
+	}
+	suite.Require().NoError(suite.server.SetState(2, taskclient.StateDone))
+
+	suite.stdout.Reset()
+	suite.Require().NoError(suite.run("list", "-state", "done"))
+	suite.Assert().Contains(suite.stdout.String(), `"id": 2`)
+	suite.Assert().NotContains(suite.stdout.String(), `"id": 1`)
+
+	suite.stdout.Reset()
+	suite.Require().NoError(suite.run("list", "-limit", "1", "-all"))
+	suite.Assert().Equal(3, strings.Count(suite.stdout.String(), `"id"`), "every page is listed")
+}
+
+func (suite *CommandsTestSuite) TestRetry() {
+	suite.Require().NoError(suite.run("create", "-type", "2", "-value", "7"))
+	suite.Assert().ErrorContains(suite.run("retry", "1"), "only DONE or CANCELLED tasks are retried")
+
+	suite.Require().NoError(suite.run("cancel", "1"))
+	suite.Require().NoError(suite.run("retry", "1"))
+	suite.Require().Len(suite.server.Tasks(), 2)
+	suite.Assert().Equal(uint32(7), suite.server.Tasks()[1].GetValue())
+	suite.Assert().ErrorContains(suite.run("cancel", "1"), "task 1 is already finished")
+}
+
+func (suite *CommandsTestSuite) TestParse_UnknownFlag() {
+	suite.Assert().ErrorIs(suite.run("create", "-typ", "1"), errUsage)
+	suite.Assert().Contains(suite.stderr.String(), "flag provided but not defined: -typ")
+	suite.Assert().Contains(suite.stderr.String(), "usage: taskctl create [flags]")
+	suite.Assert().Contains(suite.stderr.String(), "Type of the task, between 0 and 9")
+	suite.Assert().Empty(suite.server.Tasks())
+}
+
+func (suite *CommandsTestSuite) TestParse_InvalidValue() {
+	suite.Assert().ErrorIs(suite.run("list", "-limit", "ten"), errUsage)
+	suite.Assert().Contains(suite.stderr.String(), `invalid value "ten" for flag -limit`)
+	suite.Assert().Contains(suite.stderr.String(), "usage: taskctl list [flags]")
+}
+
+func (suite *CommandsTestSuite) TestParse_PositionalArguments() {
+	suite.Assert().ErrorIs(suite.run("get"), errUsage)
+	suite.Assert().Contains(suite.stderr.String(), "taskctl get: expected 1 argument(s), got 0")
+	suite.Assert().Contains(suite.stderr.String(), "usage: taskctl get ID")
+	suite.Assert().NotContains(suite.stderr.String(), "flags:", "get has no flags")
+
+	suite.stderr.Reset()
+	suite.Assert().ErrorIs(suite.run("stats", "extra"), errUsage)
+	suite.Assert().Contains(suite.stderr.String(), "usage: taskctl stats\n")
+
+	suite.Assert().ErrorContains(suite.run("get", "abc"), `invalid task id "abc"`)
+}
+
+func (suite *CommandsTestSuite) TestParse_Help() {
+	suite.Assert().ErrorIs(suite.run("retry", "-h"), flag.ErrHelp)
+	suite.Assert().Contains(suite.stderr.String(), "usage: taskctl retry [flags] ID")
+	suite.Assert().Contains(suite.stderr.String(), "Idempotency key of the new task")
+	suite.Assert().Empty(suite.stdout.String())
+
+	suite.stderr.Reset()
+	suite.Assert().ErrorIs(suite.run("admin", "-h"), flag.ErrHelp)
+	suite.Assert().Contains(suite.stderr.String(), "usage: taskctl admin <command>")
+}
+
+func (suite *CommandsTestSuite) TestParse_UnknownCommand() {
+	suite.Assert().ErrorContains(suite.run("delete", "1"), `unknown command "delete"`)
+
+	suite.Assert().ErrorIs(suite.run("admin", "drain"), errUsage)
+	suite.Assert().Contains(suite.stderr.String(), `unknown admin command "drain"`)
+	suite.Assert().ErrorIs(suite.run("admin"), errUsage)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/loadbalancer"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"github.com/hasanhakkaev/yqapp-demo/internal/tlsconfig"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	Version   string
+	BuildTime string
+)
+
+const usage = `usage: taskctl [flags] <command> [arguments]
+
+commands:
+  create -type T -value V [-key K]    create a task
+  get ID                              print a task
+  list [-state S] [-limit N] [-all]   list the tasks ordered by id
+  watch ID                            print the task whenever it changes until it is DONE or CANCELLED
+  cancel ID                           cancel a RECEIVED or PROCESSING task
+  retry [-key K] ID                   create a new task with the type and value of a DONE or CANCELLED task
+  stats                               count the tasks per state and type and sum their values per type
+  admin pause|resume|settings         pause or resume the processing on every consumer replica
+
+The consumers, token and namespace are read from the client section of the configuration.
+
+flags:`
+
+// app holds the clients shared by the commands.
+type app struct {
+	tasks   *taskclient.Client
+	admin   v1.AdminServiceClient
+	printer *printer
+	// stderr receives the usage of the commands.
+	stderr io.Writer
+	// callOpts authenticate the admin calls.
+	callOpts []grpc.CallOption
+	// timeout bounds every command but watch.
+	timeout time.Duration
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("taskctl: ")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	versionFlag := flag.Bool("version", false, "Print the version of the tool")
+	output := flag.String("o", string(formatTable), "Output format: table, json, yaml, csv or ndjson")
+	ns := flag.String("namespace", "", "Namespace of the tasks, client.namespace when empty")
+	token := flag.String("token", "", "Bearer token of the calls, client.token when empty")
+	timeout := flag.Duration("timeout", 10*time.Second, "Deadline of every command but watch")
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Printf("Version: %s\n", Version)
+		fmt.Printf("Build Time: %s\n", BuildTime)
+		os.Exit(0)
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, err := newPrinter(os.Stdout, serializer.Format(*output))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	cfg, err := conf.Read()
+	if err != nil {
+		log.Fatalln("reading config failed", err)
+	}
+	if *ns != "" {
+		cfg.Client.Namespace = *ns
+	}
+	if *token != "" {
+		cfg.Client.Token = *token
+	}
+
+	a, closeConn, err := newApp(*cfg, p, *timeout)
+	if err != nil {
+		log.Fatalln("connecting to the consumers failed", err)
+	}
+	defer closeConn()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = errors.Join(a.run(ctx, flag.Arg(0), flag.Args()[1:]), p.Close())
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		stop()
+		closeConn()
+		os.Exit(2)
+	default:
+		stop()
+		closeConn()
+		log.Fatalln(describe(err))
+	}
+}
+
+// newApp connects to the consumers of the client configuration.
+func newApp(cfg conf.Configuration, p *printer, timeout time.Duration) (*app, func(), error) {
+	transport, err := tlsconfig.TransportCredentials(cfg.Client.TLS)
+	if err != nil {
+		return nil, nil, err
+	}
+	pool, err := loadbalancer.Dial(cfg.Client, cfg.Server.URI(), grpc.WithTransportCredentials(transport))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The admin calls are not bound to a namespace
+	var opts []taskclient.Option
+	var callOpts []grpc.CallOption
+	if cfg.Client.Token != "" {
+		opts = append(opts, taskclient.WithToken(cfg.Client.Token))
+		callOpts = append(callOpts, grpc.PerRPCCredentials(auth.NewTokenCredentials(cfg.Client.Token)))
+	}
+	if cfg.Client.Namespace != "" {
+		opts = append(opts, taskclient.WithNamespace(cfg.Client.Namespace))
+	}
+	tasks, err := taskclient.NewFromConn(pool, opts...)
+	if err != nil {
+		_ = pool.Close()
+		return nil, nil, err
+	}
+
+	a := &app{
+		tasks:    tasks,
+		admin:    v1.NewAdminServiceClient(pool),
+		printer:  p,
+		stderr:   os.Stderr,
+		callOpts: callOpts,
+		timeout:  timeout,
+	}
+	return a, func() { _ = pool.Close() }, nil
+}
+
+// run runs a command, watch is the only one without a deadline.
+func (a *app) run(ctx context.Context, command string, args []string) error {
+	if command != "watch" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+
+	switch command {
+	case "create":
+		return a.create(ctx, args)
+	case "get":
+		return a.get(ctx, args)
+	case "list":
+		return a.list(ctx, args)
+	case "watch":
+		return a.watch(ctx, args)
+	case "cancel":
+		return a.cancel(ctx, args)
+	case "retry":
+		return a.retry(ctx, args)
+	case "stats":
+		return a.stats(ctx, args)
+	case "admin":
+		return a.runAdmin(ctx, args)
+	default:
+		return fmt.Errorf("unknown command %q, see taskctl -h", command)
+	}
+}
+
+// describe shortens the errors of the consumers to their status.
+func describe(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "interrupted"
+	}
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		s := grpcErr.GRPCStatus()
+		return fmt.Sprintf("%s: %s", s.Code(), s.Message())
+	}
+	return err.Error()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"gopkg.in/yaml.v3"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// formatTable prints aligned columns for people, the other formats are meant for scripts.
+const formatTable serializer.Format = "table"
+
+// printer writes the results of the commands in the output format.
+type printer struct {
+	out    io.Writer
+	encode func(v any) error
+	// records writes every task as a record of its own, e.g. a CSV row.
+	records serializer.Encoder
+	// header is set once the header of the watched task is printed.
+	header bool
+}
+
+func newPrinter(out io.Writer, format serializer.Format) (*printer, error) {
+	p := &printer{out: out}
+	// JSON and YAML print every result as an indented document, the other formats of the
+	// serializer package print the tasks as records
+	switch format {
+	case formatTable:
+	case serializer.FormatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		p.encode = encoder.Encode
+	case serializer.FormatYAML:
+		// Every value is a document of its own, e.g. the updates of a watched task
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		p.encode = encoder.Encode
+	default:
+		codec, err := serializer.Lookup(string(format))
+		if err != nil {
+			return nil, fmt.Errorf("%w or table", err)
+		}
+		p.records = codec.NewEncoder(out)
+		p.encode = p.records.Encode
+	}
+	return p, nil
+}
+
+// Close completes the output.
+func (p *printer) Close() error {
+	if p.records == nil {
+		return nil
+	}
+	return p.records.Close()
+}
+
+// toDomain converts a task for the codecs of the serializer package.
+func toDomain(task *taskclient.Task) *domain.Task {
+	return &domain.Task{
+		ID:             task.ID,
+		Type:           task.Type,
+		Value:          task.Value,
+		State:          domain.State(task.State),
+		CreationTime:   task.CreatedAt,
+		LastUpdateTime: task.UpdatedAt,
+		StartedAt:      task.StartedAt,
+		FinishedAt:     task.FinishedAt,
+		Namespace:      task.Namespace,
+	}
+}
+
+func (p *printer) task(task *taskclient.Task) error {
+	if p.records != nil {
+		return p.records.Encode(toDomain(task))
+	}
+	if p.encode != nil {
+		return p.encode(task)
+	}
+	return p.tasks([]*taskclient.Task{task})
+}
+
+func (p *printer) tasks(tasks []*taskclient.Task) error {
+	if p.records != nil {
+		for _, task := range tasks {
+			if err := p.records.Encode(toDomain(task)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if p.encode != nil {
+		if tasks == nil {
+			tasks = []*taskclient.Task{}
+		}
+		return p.encode(tasks)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tTYPE\tVALUE\tSTATE\tNAMESPACE\tCREATED\tUPDATED")
+	for _, task := range tasks {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\t%s\t%s\n", task.ID, task.Type, task.Value, task.State,
+			task.Namespace, task.CreatedAt.Local().Format(time.DateTime), task.UpdatedAt.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+// update prints a change of a watched task, a row per change for the table format.
+func (p *printer) update(task *taskclient.Task) error {
+	if p.records != nil {
+		return p.records.Encode(toDomain(task))
+	}
+	if p.encode != nil {
+		return p.encode(task)
+	}
+
+	// The rows are flushed one by one, the minimum width keeps the columns aligned
+	w := tabwriter.NewWriter(p.out, 12, 0, 2, ' ', 0)
+	if !p.header {
+		_, _ = fmt.Fprintln(w, "ID\tSTATE\tUPDATED")
+		p.header = true
+	}
+	_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", task.ID, task.State, task.UpdatedAt.Local().Format(time.StampMilli))
+	return w.Flush()
+}
+
+func (p *printer) stats(stats *taskclient.Stats) error {
+	if p.encode != nil {
+		return p.encode(stats)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "STATE\tTASKS")
+	for _, state := range []taskclient.State{taskclient.StateReceived, taskclient.StateProcessing, taskclient.StateDone, taskclient.StateCancelled} {
+		_, _ = fmt.Fprintf(w, "%s\t%d\n", state, stats.Counts[state])
+	}
+	_, _ = fmt.Fprintln(w, "\nTYPE\tTASKS\tVALUE SUM")
+	types := make([]uint32, 0, len(stats.ValueSums))
+	for taskType := range stats.ValueSums {
+		types = append(types, taskType)
+	}
+	slices.Sort(types)
+	for _, taskType := range types {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\n", taskType, stats.TypeCounts[taskType], stats.ValueSums[taskType])
+	}
+	return w.Flush()
+}
+
+// settings mirrors v1.ConsumerSettings with the names of the configuration.
+type settings struct {
+	Paused    bool    `json:"paused" yaml:"paused"`
+	RateLimit float64 `json:"rateLimit" yaml:"rateLimit"`
+	Burst     uint32  `json:"burst" yaml:"burst"`
+	Workers   uint32  `json:"workers" yaml:"workers"`
+	Version   int64   `json:"version" yaml:"version"`
+}
+
+func (p *printer) settings(pbSettings *v1.ConsumerSettings) error {
+	s := settings{
+		Paused:    pbSettings.GetPaused(),
+		RateLimit: pbSettings.GetRateLimit(),
+		Burst:     pbSettings.GetBurst(),
+		Workers:   pbSettings.GetWorkers(),
+		Version:   pbSettings.GetVersion(),
+	}
+	if p.encode != nil {
+		return p.encode(s)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PAUSED\tRATE LIMIT\tBURST\tWORKERS\tVERSION")
+	_, _ = fmt.Fprintf(w, "%t\t%g\t%d\t%d\t%d\n", s.Paused, s.RateLimit, s.Burst, s.Workers, s.Version)
+	return w.Flush()
+}
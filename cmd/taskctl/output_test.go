@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputSuite(t *testing.T) {
+	suite.Run(t, new(OutputTestSuite))
+}
+
+type OutputTestSuite struct {
+	suite.Suite
+	out   bytes.Buffer
+	tasks []*taskclient.Task
+}
+
+func (suite *OutputTestSuite) SetupTest() {
+	suite.out.Reset()
+	created := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	suite.tasks = []*taskclient.Task{
+		{ID: 1, Type: 3, Value: 42, State: taskclient.StateDone, Namespace: "team-a", CreatedAt: created, UpdatedAt: created},
+		{ID: 12, Type: 0, Value: 7, State: taskclient.StateReceived, Namespace: "default", CreatedAt: created, UpdatedAt: created},
+	}
+}
+
+func (suite *OutputTestSuite) printer(format serializer.Format) *printer {
+	p, err := newPrinter(&suite.out, format)
+	suite.Require().NoError(err)
+	return p
+}
+
+func (suite *OutputTestSuite) lines() []string {
+	return strings.Split(strings.TrimRight(suite.out.String(), "\n"), "\n")
+}
+
+func (suite *OutputTestSuite) TestUnknownFormat() {
+	_, err := newPrinter(&suite.out, "xml")
+	suite.Assert().ErrorContains(err, "or table")
+}
+
+func (suite *OutputTestSuite) TestTasks_Table() {
+	suite.Require().NoError(suite.printer(formatTable).tasks(suite.tasks))
+
+	lines := suite.lines()
+	suite.Require().Len(lines, 3)
+	suite.Assert().Equal([]string{"ID", "TYPE", "VALUE", "STATE", "NAMESPACE", "CREATED", "UPDATED"}, strings.Fields(lines[0]))
+	suite.Assert().Equal([]string{"12", "0", "7", "RECEIVED", "default"}, strings.Fields(lines[2])[:5])
+	suite.Assert().Equal(strings.Index(lines[0], "STATE"), strings.Index(lines[1], "DONE"), "the columns are aligned")
+}
+
+func (suite *OutputTestSuite) TestTasks_JSON() {
+	p := suite.printer(serializer.FormatJSON)
+	suite.Require().NoError(p.tasks(nil))
+	suite.Assert().Equal("[]\n", suite.out.String(), "no task is an empty array")
+
+	suite.out.Reset()
+	suite.Require().NoError(p.task(suite.tasks[0]))
+	suite.Assert().Contains(suite.out.String(), "  \"id\": 1,\n")
+	suite.Assert().Contains(suite.out.String(), `"state": "DONE"`)
+}
+
+func (suite *OutputTestSuite) TestTasks_CSV() {
+	p := suite.printer(serializer.FormatCSV)
+	suite.Require().NoError(p.tasks(suite.tasks))
+	suite.Require().NoError(p.Close())
+
+	lines := suite.lines()
+	suite.Require().Len(lines, 3, "a header row and a row per task")
+	suite.Assert().True(strings.HasPrefix(lines[0], "id,type,value,state"))
+	suite.Assert().True(strings.HasPrefix(lines[1], "1,3,42,DONE"))
+}
+
+func (suite *OutputTestSuite) TestUpdate_Table() {
+	p := suite.printer(formatTable)
+	suite.Require().NoError(p.update(suite.tasks[1]))
+	suite.Require().NoError(p.update(suite.tasks[0]))
+
+	lines := suite.lines()
+	suite.Require().Len(lines, 3, "the header is printed once")
+	suite.Assert().Equal([]string{"ID", "STATE", "UPDATED"}, strings.Fields(lines[0]))
+	suite.Assert().Equal(strings.Index(lines[1], "RECEIVED"), strings.Index(lines[2], "DONE"), "the rows flushed one by one are aligned")
+}
+
+func (suite *OutputTestSuite) TestStats_Table() {
+	stats := &taskclient.Stats{
+		Counts:     map[taskclient.State]int64{taskclient.StateDone: 2, taskclient.StateReceived: 1},
+		ValueSums:  map[uint32]int64{3: 84, 0: 7},
+		TypeCounts: map[uint32]int64{3: 2, 0: 1},
+	}
+	suite.Require().NoError(suite.printer(formatTable).stats(stats))
+
+	lines := suite.lines()
+	suite.Require().Len(lines, 9)
+	suite.Assert().Equal([]string{"RECEIVED", "1"}, strings.Fields(lines[1]))
+	suite.Assert().Equal([]string{"PROCESSING", "0"}, strings.Fields(lines[2]), "every state is listed")
+	suite.Assert().Equal([]string{"0", "1", "7"}, strings.Fields(lines[7]), "the types are sorted")
+	suite.Assert().Equal([]string{"3", "2", "84"}, strings.Fields(lines[8]))
+}
+
+func (suite *OutputTestSuite) TestSettings_YAML() {
+	settings := &v1.ConsumerSettings{Paused: true, RateLimit: 12.5, Burst: 3, Workers: 4, Version: 7}
+	suite.Require().NoError(suite.printer(serializer.FormatYAML).settings(settings))
+	suite.Assert().Equal("paused: true\nrateLimit: 12.5\nburst: 3\nworkers: 4\nversion: 7\n", suite.out.String())
+}
+
+func (suite *OutputTestSuite) TestSettings_Table() {
+	settings := &v1.ConsumerSettings{RateLimit: 100, Burst: 1, Workers: 2}
+	suite.Require().NoError(suite.printer(formatTable).settings(settings))
+	lines := suite.lines()
+	suite.Require().Len(lines, 2)
+	suite.Assert().Equal([]string{"false", "100", "1", "2", "0"}, strings.Fields(lines[1]))
+}
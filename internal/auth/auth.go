@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const scheme = "bearer"
+
+// Identity holds the caller authenticated by a bearer token.
+type Identity struct {
+	Name  string
+	Admin bool
+	// Namespace binds the identity to a single namespace, empty for identities allowed to request any namespace.
+	Namespace string
+}
+
+type identityKey struct{}
+
+// FromContext returns the Identity authenticated for the current request.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// NewContext returns a copy of ctx holding the given Identity.
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Authenticator validates the bearer tokens sent in the request metadata.
+type Authenticator struct {
+	required bool
+	tokens   []conf.Token
+}
+
+// NewAuthenticator initializes a new Authenticator accepting the tokens in the given configuration.
+func NewAuthenticator(cfg conf.Auth) *Authenticator {
+	return &Authenticator{
+		required: cfg.Enabled,
+		tokens:   cfg.Tokens,
+	}
+}
+
+// Authenticate implements grpcauth.AuthFunc. Requests without a token are only
+// accepted when authentication is not required, requests with an unknown token are always rejected.
+func (a *Authenticator) Authenticate(ctx context.Context) (context.Context, error) {
+	if !a.required && !hasAuthorization(ctx) {
+		return ctx, nil
+	}
+
+	token, err := grpcauth.AuthFromMD(ctx, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, ok := a.lookup(token)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid auth token")
+	}
+	return NewContext(ctx, identity), nil
+}
+
+// RequireAdmin authenticates the request and rejects callers without the admin flag.
+func (a *Authenticator) RequireAdmin(ctx context.Context) (context.Context, error) {
+	token, err := grpcauth.AuthFromMD(ctx, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, ok := a.lookup(token)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid auth token")
+	}
+	if !identity.Admin {
+		return nil, status.Error(codes.PermissionDenied, "admin permission required")
+	}
+	return NewContext(ctx, identity), nil
+}
+
+func (a *Authenticator) lookup(token string) (Identity, bool) {
+	for _, t := range a.tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return Identity{Name: t.Name, Admin: t.Admin, Namespace: t.Namespace}, true
+		}
+	}
+	return Identity{}, false
+}
+
+func hasAuthorization(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md.Get("authorization")) > 0
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestAuthSuite(t *testing.T) {
+	suite.Run(t, new(AuthTestSuite))
+}
+
+type AuthTestSuite struct {
+	suite.Suite
+	cfg conf.Auth
+}
+
+func (suite *AuthTestSuite) SetupTest() {
+	suite.cfg = conf.Auth{
+		Enabled: true,
+		Tokens: []conf.Token{
+			{Name: "producer", Token: "producer-token"},
+			{Name: "operator", Token: "operator-token", Admin: true},
+		},
+	}
+}
+
+func (suite *AuthTestSuite) withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func (suite *AuthTestSuite) TestAuthenticate_ValidToken() {
+	ctx, err := NewAuthenticator(suite.cfg).Authenticate(suite.withToken("producer-token"))
+	suite.Require().NoError(err)
+
+	identity, ok := FromContext(ctx)
+	suite.Assert().True(ok)
+	suite.Assert().Equal(Identity{Name: "producer"}, identity)
+}
+
+func (suite *AuthTestSuite) TestAuthenticate_InvalidToken() {
+	_, err := NewAuthenticator(suite.cfg).Authenticate(suite.withToken("unknown"))
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *AuthTestSuite) TestAuthenticate_MissingToken() {
+	_, err := NewAuthenticator(suite.cfg).Authenticate(context.Background())
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+
+	suite.cfg.Enabled = false
+	ctx, err := NewAuthenticator(suite.cfg).Authenticate(context.Background())
+	suite.Require().NoError(err)
+	_, ok := FromContext(ctx)
+	suite.Assert().False(ok)
+}
+
+func (suite *AuthTestSuite) TestRequireAdmin() {
+	suite.cfg.Enabled = false
+	authenticator := NewAuthenticator(suite.cfg)
+
+	_, err := authenticator.RequireAdmin(context.Background())
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+
+	_, err = authenticator.RequireAdmin(suite.withToken("producer-token"))
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+
+	ctx, err := authenticator.RequireAdmin(suite.withToken("operator-token"))
+	suite.Require().NoError(err)
+	identity, _ := FromContext(ctx)
+	suite.Assert().Equal("operator", identity.Name)
+}
+
+func (suite *AuthTestSuite) TestTokenCredentials() {
+	md, err := NewTokenCredentials("producer-token").GetRequestMetadata(context.Background())
+	suite.Require().NoError(err)
+	suite.Assert().Equal("bearer producer-token", md["authorization"])
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"context"
+	"google.golang.org/grpc/credentials"
+)
+
+// tokenCredentials attaches a bearer token to every outgoing RPC.
+type tokenCredentials struct {
+	token string
+}
+
+// NewTokenCredentials returns credentials.PerRPCCredentials sending the given bearer token.
+func NewTokenCredentials(token string) credentials.PerRPCCredentials {
+	return tokenCredentials{token: token}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": scheme + " " + c.token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+// The demo stack runs without TLS, so tokens are allowed over plaintext connections.
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,212 @@
+package breaker
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// Closed lets every RPC through.
+	Closed State = iota
+	// HalfOpen lets a limited number of probe RPCs through.
+	HalfOpen
+	// Open rejects every RPC until the open timeout has elapsed.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrOpen is returned for the RPCs rejected by an open breaker.
+var ErrOpen = status.Error(codes.Unavailable, "circuit breaker is open")
+
+// Breaker is a circuit breaker with closed, open and half-open states. It opens after consecutive
+// failed RPCs, lets probe RPCs through once the open timeout has elapsed and closes again after
+// enough of them succeeded.
+type Breaker struct {
+	cfg conf.CircuitBreaker
+	// onTransition is called on every state change, with the mutex held.
+	onTransition func(from, to State)
+	now          func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	// probes counts the probe RPCs in progress, successes the ones that succeeded.
+	probes    int
+	successes int
+	openedAt  time.Time
+	// generation is increased on every state change, the outcome of an RPC started in an older
+	// generation is ignored.
+	generation uint64
+	// changed is closed and replaced whenever a waiting RPC may be let through.
+	changed chan struct{}
+}
+
+// New returns a closed breaker, onTransition is called on every state change.
+func New(cfg conf.CircuitBreaker, onTransition func(from, to State)) *Breaker {
+	if onTransition == nil {
+		onTransition = func(State, State) {}
+	}
+	return &Breaker{cfg: cfg, onTransition: onTransition, now: time.Now, changed: make(chan struct{})}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireLocked()
+	return b.state
+}
+
+// Allow reports whether an RPC may be sent, done must then be called with its outcome.
+// ErrOpen is returned while the breaker is open or its probe RPCs are all in progress.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireLocked()
+
+	switch b.state {
+	case Open:
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.cfg.GetHalfOpenRequests() {
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(err error) { b.record(generation, err) }, nil
+}
+
+// Wait blocks until an RPC would be let through or ctx is done.
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		b.expireLocked()
+		if b.state == Closed || (b.state == HalfOpen && b.probes < b.cfg.GetHalfOpenRequests()) {
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if b.state == Open {
+			timer = time.NewTimer(b.openedAt.Add(b.cfg.GetOpenTimeout()).Sub(b.now()))
+			expired = timer.C
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-expired:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// UnaryClientInterceptor rejects the RPCs with ErrOpen while the breaker is open and records the
+// outcome of the others.
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, err := b.Allow()
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(err)
+		return err
+	}
+}
+
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+
+	failed := isFailure(err)
+	switch b.state {
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.GetConsecutiveFailures() {
+			b.transitionLocked(Open)
+		}
+	case HalfOpen:
+		b.probes--
+		switch {
+		case failed:
+			b.transitionLocked(Open)
+		case b.successes+1 >= b.cfg.GetSuccessThreshold():
+			b.transitionLocked(Closed)
+		default:
+			b.successes++
+			b.notifyLocked()
+		}
+	}
+}
+
+// expireLocked moves an open breaker to half-open once the open timeout has elapsed.
+func (b *Breaker) expireLocked() {
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.cfg.GetOpenTimeout())) {
+		b.transitionLocked(HalfOpen)
+	}
+}
+
+func (b *Breaker) transitionLocked(to State) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.failures, b.probes, b.successes = 0, 0, 0
+	if to == Open {
+		b.openedAt = b.now()
+	}
+	b.onTransition(from, to)
+	b.notifyLocked()
+}
+
+func (b *Breaker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// isFailure reports whether err means that the consumer is unhealthy, the client errors and the
+// cancelled RPCs do not count.
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
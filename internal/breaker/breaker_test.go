@@ -0,0 +1,109 @@
+package breaker
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestBreakerSuite(t *testing.T) {
+	suite.Run(t, new(BreakerTestSuite))
+}
+
+type BreakerTestSuite struct {
+	suite.Suite
+	breaker     *Breaker
+	now         time.Time
+	transitions []string
+}
+
+func (suite *BreakerTestSuite) SetupTest() {
+	suite.now = time.Unix(0, 0)
+	suite.transitions = nil
+	suite.breaker = New(conf.CircuitBreaker{ConsecutiveFailures: 3, OpenTimeout: time.Second, HalfOpenRequests: 1, SuccessThreshold: 2},
+		func(from, to State) { suite.transitions = append(suite.transitions, from.String()+"->"+to.String()) })
+	suite.breaker.now = func() time.Time { return suite.now }
+}
+
+// call sends an RPC completed with err through the breaker.
+func (suite *BreakerTestSuite) call(err error) error {
+	done, allowErr := suite.breaker.Allow()
+	if allowErr != nil {
+		return allowErr
+	}
+	done(err)
+	return nil
+}
+
+func (suite *BreakerTestSuite) TestOpens() {
+	failure := status.Error(codes.Unavailable, "down")
+
+	suite.Require().NoError(suite.call(failure))
+	suite.Require().NoError(suite.call(failure))
+	suite.Require().NoError(suite.call(nil))
+	suite.Require().NoError(suite.call(status.Error(codes.InvalidArgument, "bad request")))
+	suite.Require().NoError(suite.call(failure))
+	suite.Require().NoError(suite.call(failure))
+	suite.Assert().Equal(Closed, suite.breaker.State(), "the successes reset the consecutive failures, the client errors do not count")
+
+	suite.Require().NoError(suite.call(failure))
+	suite.Assert().Equal(Open, suite.breaker.State())
+	suite.Assert().ErrorIs(suite.call(nil), ErrOpen)
+	suite.Assert().Equal(codes.Unavailable, status.Code(ErrOpen))
+}
+
+func (suite *BreakerTestSuite) TestHalfOpen() {
+	for i := 0; i < 3; i++ {
+		suite.Require().NoError(suite.call(status.Error(codes.Internal, "boom")))
+	}
+	suite.now = suite.now.Add(time.Second)
+	suite.Assert().Equal(HalfOpen, suite.breaker.State())
+
+	done, err := suite.breaker.Allow()
+	suite.Require().NoError(err)
+	suite.Assert().ErrorIs(suite.call(nil), ErrOpen, "a single probe is let through at once")
+	done(status.Error(codes.Unavailable, "still down"))
+	suite.Assert().Equal(Open, suite.breaker.State(), "a failed probe reopens the breaker")
+
+	suite.now = suite.now.Add(time.Second)
+	suite.Require().NoError(suite.call(nil))
+	suite.Assert().Equal(HalfOpen, suite.breaker.State())
+	suite.Require().NoError(suite.call(nil))
+	suite.Assert().Equal(Closed, suite.breaker.State())
+
+	suite.Assert().Equal([]string{"closed->open", "open->half_open", "half_open->open", "open->half_open", "half_open->closed"}, suite.transitions)
+}
+
+func (suite *BreakerTestSuite) TestStaleOutcome() {
+	done, err := suite.breaker.Allow()
+	suite.Require().NoError(err)
+	for i := 0; i < 3; i++ {
+		suite.Require().NoError(suite.call(status.Error(codes.Unavailable, "down")))
+	}
+	suite.now = suite.now.Add(time.Second)
+	suite.Require().Equal(HalfOpen, suite.breaker.State())
+
+	done(nil)
+	suite.Assert().Equal(HalfOpen, suite.breaker.State(), "the RPCs started before the breaker opened are ignored")
+}
+
+func (suite *BreakerTestSuite) TestWait() {
+	suite.breaker.now = time.Now
+	for i := 0; i < 3; i++ {
+		suite.Require().NoError(suite.call(status.Error(codes.Unavailable, "down")))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	suite.Assert().ErrorIs(suite.breaker.Wait(ctx), context.DeadlineExceeded, "the breaker is open")
+
+	suite.breaker.cfg.OpenTimeout = 50 * time.Millisecond
+	started := time.Now()
+	suite.Require().NoError(suite.breaker.Wait(context.Background()))
+	suite.Assert().Less(time.Since(started), time.Second)
+	suite.Assert().Equal(HalfOpen, suite.breaker.State())
+}
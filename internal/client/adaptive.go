@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// rateController adapts the production rate to the consumer with an additive increase, multiplicative
+// decrease policy. The RPCs are observed during a window, the rate is then raised when they all succeeded
+// within the latency target and cut when the consumer was overloaded or slow.
+type rateController struct {
+	cfg     conf.Adaptive
+	limiter *rate.Limiter
+	gauge   metric.Float64Gauge
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	current float64
+	// successes, overloads and latency describe the RPCs of the current window.
+	successes int
+	overloads int
+	latency   time.Duration
+}
+
+func newRateController(cfg conf.Adaptive, initial float64, limiter *rate.Limiter, gauge metric.Float64Gauge, logger *zap.Logger) *rateController {
+	r := &rateController{cfg: cfg, limiter: limiter, gauge: gauge, logger: logger}
+	r.reset(context.Background(), initial)
+	return r
+}
+
+// observe records the outcome of an RPC.
+func (r *rateController) observe(latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch status.Code(err) {
+	case codes.OK:
+		r.successes++
+		r.latency += latency
+	case codes.ResourceExhausted, codes.Unavailable:
+		r.overloads++
+	}
+}
+
+// adjust ends the window and returns the new rate. A window without any RPC keeps the rate.
+func (r *rateController) adjust(ctx context.Context) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := r.current
+	switch {
+	case r.overloads > 0:
+		r.current *= r.cfg.GetDecreaseFactor()
+	case r.successes > 0 && r.latency/time.Duration(r.successes) > r.cfg.GetLatencyTarget():
+		r.current *= r.cfg.GetDecreaseFactor()
+	case r.successes > 0:
+		r.current += r.cfg.Increase
+	}
+	r.successes, r.overloads, r.latency = 0, 0, 0
+
+	r.applyLocked(ctx)
+	if r.current != previous {
+		r.logger.Debug("Production rate adjusted", zap.Float64("from", previous), zap.Float64("to", r.current))
+	}
+	return r.current
+}
+
+// reset sets the rate, e.g. when the configured production rate changes.
+func (r *rateController) reset(ctx context.Context, current float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = current
+	r.applyLocked(ctx)
+}
+
+func (r *rateController) applyLocked(ctx context.Context) {
+	r.current = max(r.current, r.cfg.GetMinRate())
+	if r.cfg.MaxRate > 0 {
+		r.current = min(r.current, r.cfg.MaxRate)
+	}
+	r.limiter.SetLimit(rate.Limit(r.current))
+	r.gauge.Record(ctx, r.current)
+}
+
+// run adjusts the rate at the end of every window until ctx is done.
+func (r *rateController) run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.GetWindow())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.adjust(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestRateControllerSuite(t *testing.T) {
+	suite.Run(t, new(RateControllerTestSuite))
+}
+
+type RateControllerTestSuite struct {
+	suite.Suite
+	limiter    *rate.Limiter
+	controller *rateController
+}
+
+func (suite *RateControllerTestSuite) SetupTest() {
+	gauge, err := noop.NewMeterProvider().Meter("test").Float64Gauge("production_rate")
+	suite.Require().NoError(err)
+
+	cfg := conf.Adaptive{Enabled: true, MinRate: 10, MaxRate: 120, Increase: 10, LatencyTarget: 50 * time.Millisecond}
+	suite.limiter = rate.NewLimiter(100, 1)
+	suite.controller = newRateController(cfg, 100, suite.limiter, gauge, zap.NewNop())
+}
+
+func (suite *RateControllerTestSuite) TestAdditiveIncrease() {
+	suite.controller.observe(10*time.Millisecond, nil)
+	suite.Assert().Equal(110.0, suite.controller.adjust(context.Background()))
+	suite.Assert().Equal(rate.Limit(110), suite.limiter.Limit())
+
+	suite.Assert().Equal(110.0, suite.controller.adjust(context.Background()), "an idle window keeps the rate")
+
+	for i := 0; i < 3; i++ {
+		suite.controller.observe(10*time.Millisecond, nil)
+		suite.controller.adjust(context.Background())
+	}
+	suite.Assert().Equal(rate.Limit(120), suite.limiter.Limit(), "the rate is bounded by maxRate")
+}
+
+func (suite *RateControllerTestSuite) TestMultiplicativeDecrease() {
+	suite.controller.observe(10*time.Millisecond, nil)
+	suite.controller.observe(0, status.Error(codes.ResourceExhausted, "busy"))
+	suite.Assert().Equal(50.0, suite.controller.adjust(context.Background()), "an overloaded consumer halves the rate")
+
+	suite.controller.observe(80*time.Millisecond, nil)
+	suite.controller.observe(40*time.Millisecond, nil)
+	suite.Assert().Equal(25.0, suite.controller.adjust(context.Background()), "a latency above the target halves the rate")
+
+	suite.controller.observe(0, status.Error(codes.Unavailable, "down"))
+	suite.controller.adjust(context.Background())
+	suite.Assert().Equal(rate.Limit(12.5), suite.limiter.Limit())
+	suite.controller.observe(0, status.Error(codes.Unavailable, "down"))
+	suite.Assert().Equal(10.0, suite.controller.adjust(context.Background()), "the rate is bounded by minRate")
+
+	suite.controller.observe(0, status.Error(codes.InvalidArgument, "bad task"))
+	suite.Assert().Equal(10.0, suite.controller.adjust(context.Background()), "other errors do not change the rate")
+}
+
+func (suite *RateControllerTestSuite) TestReset() {
+	suite.controller.reset(context.Background(), 500)
+	suite.Assert().Equal(rate.Limit(120), suite.limiter.Limit())
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/spool"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+)
+
+// backlog holds the produced tasks until they are sent to the consumer.
+type backlog interface {
+	// Push adds a task, waiting while the backlog is full.
+	Push(ctx context.Context, task *domain.Task) error
+	// Pop returns the next task, waiting for one to be pushed.
+	Pop(ctx context.Context) (spool.Entry, error)
+	// TryPop returns the next task, ok is false when the backlog is empty.
+	TryPop() (entry spool.Entry, ok bool, err error)
+	// Ack removes a task once the consumer has accepted it.
+	Ack(entry spool.Entry) error
+	// Durable reports whether the tasks left in the backlog survive a restart.
+	Durable() bool
+	Close() error
+}
+
+// memoryBacklog is a buffered channel, the tasks it holds are lost on exit.
+type memoryBacklog chan *domain.Task
+
+func (b memoryBacklog) Push(ctx context.Context, task *domain.Task) error {
+	select {
+	case b <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b memoryBacklog) Pop(ctx context.Context) (spool.Entry, error) {
+	select {
+	case task := <-b:
+		return spool.Entry{Task: task}, nil
+	case <-ctx.Done():
+		return spool.Entry{}, ctx.Err()
+	}
+}
+
+func (b memoryBacklog) TryPop() (spool.Entry, bool, error) {
+	select {
+	case task := <-b:
+		return spool.Entry{Task: task}, true, nil
+	default:
+		return spool.Entry{}, false, nil
+	}
+}
+
+func (b memoryBacklog) Ack(spool.Entry) error {
+	return nil
+}
+
+func (b memoryBacklog) Durable() bool {
+	return false
+}
+
+func (b memoryBacklog) Close() error {
+	return nil
+}
+
+// spoolBacklog persists the tasks in a spool until they are acknowledged.
+type spoolBacklog struct {
+	*spool.Spool
+}
+
+// Push spools the task with a new idempotency key, reused by every attempt to send it.
+func (b spoolBacklog) Push(ctx context.Context, task *domain.Task) error {
+	_, err := b.Append(ctx, task, taskclient.NewIdempotencyKey())
+	return err
+}
+
+func (b spoolBacklog) Pop(ctx context.Context) (spool.Entry, error) {
+	return b.Next(ctx)
+}
+
+func (b spoolBacklog) TryPop() (spool.Entry, bool, error) {
+	return b.TryNext()
+}
+
+func (b spoolBacklog) Ack(entry spool.Entry) error {
+	return b.Spool.Ack(entry.Seq)
+}
+
+func (b spoolBacklog) Durable() bool {
+	return true
+}
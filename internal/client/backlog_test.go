@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/spool"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient/taskclienttest"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"testing"
+	"time"
+)
+
+func TestSpoolBacklogSuite(t *testing.T) {
+	suite.Run(t, new(SpoolBacklogTestSuite))
+}
+
+// SpoolBacklogTestSuite sends the tasks of a spool to an in-memory TaskService.
+type SpoolBacklogTestSuite struct {
+	suite.Suite
+	server *taskclienttest.Server
+	spool  *spool.Spool
+	client *Client
+}
+
+func (suite *SpoolBacklogTestSuite) SetupTest() {
+	suite.server = taskclienttest.NewServer()
+	tasks, err := suite.server.Client(taskclient.WithRetry(taskclient.NoRetry))
+	suite.Require().NoError(err)
+
+	cfg := conf.Spool{Dir: suite.T().TempDir(), RetryBackoff: time.Millisecond, MaxRetryBackoff: time.Millisecond}
+	suite.spool, _, err = spool.Open(cfg, 0)
+	suite.Require().NoError(err)
+
+	producedTasks, err := noop.NewMeterProvider().Meter("test").Int64Counter("tasks_produced")
+	suite.Require().NoError(err)
+	suite.client = &Client{
+		tasks:         tasks,
+		logger:        zap.NewNop(),
+		producedTasks: producedTasks,
+		cfg:           conf.Configuration{ProducerService: conf.Producer{Spool: cfg}},
+		backlog:       spoolBacklog{suite.spool},
+	}
+}
+
+func (suite *SpoolBacklogTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.client.tasks.Close())
+	suite.Require().NoError(suite.spool.Close())
+	suite.server.Close()
+}
+
+func (suite *SpoolBacklogTestSuite) push(values ...uint32) {
+	for _, value := range values {
+		suite.Require().NoError(suite.client.backlog.Push(context.Background(), &domain.Task{Type: 1, Value: value}))
+	}
+}
+
+func (suite *SpoolBacklogTestSuite) deliverNext() error {
+	entry, ok, err := suite.client.backlog.TryPop()
+	suite.Require().NoError(err)
+	suite.Require().True(ok)
+	return suite.client.deliver(context.Background(), entry)
+}
+
+func (suite *SpoolBacklogTestSuite) values() []uint32 {
+	var values []uint32
+	for _, task := range suite.server.Tasks() {
+		values = append(values, task.GetValue())
+	}
+	return values
+}
+
+func (suite *SpoolBacklogTestSuite) TestDeliver_RetriesTransientErrors() {
+	suite.push(10)
+	suite.server.FailNext(codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded)
+
+	suite.Require().NoError(suite.deliverNext())
+	suite.Assert().Equal([]uint32{10}, suite.values())
+	suite.Assert().Zero(suite.spool.Pending())
+}
+
+func (suite *SpoolBacklogTestSuite) TestDeliver_DropsRejectedTask() {
+	suite.push(10, 20)
+	suite.server.FailNext(codes.InvalidArgument)
+
+	suite.Assert().ErrorContains(suite.deliverNext(), "dropped from the spool")
+	suite.Require().NoError(suite.deliverNext(), "the rejected task does not hold back the next one")
+	suite.Assert().Equal([]uint32{20}, suite.values())
+	suite.Assert().Zero(suite.spool.Pending())
+}
+
+func (suite *SpoolBacklogTestSuite) TestDeliver_ReusesSpooledKey() {
+	suite.push(10)
+	entry, ok, err := suite.client.backlog.TryPop()
+	suite.Require().NoError(err)
+	suite.Require().True(ok)
+	suite.Require().NotEmpty(entry.Key)
+
+	// A previous attempt was accepted by the consumer but its response was lost
+	_, err = suite.client.tasks.Create(context.Background(), taskclient.NewTask{Type: 1, Value: 10, IdempotencyKey: entry.Key})
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.client.deliver(context.Background(), entry))
+	suite.Assert().Equal([]uint32{10}, suite.values(), "the task is created once")
+}
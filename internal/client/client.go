@@ -3,22 +3,27 @@ package client
 import (
 	"context"
 	"errors"
-	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/internal/breaker"
 	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
 	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/loadtest"
+	"github.com/hasanhakkaev/yqapp-demo/internal/spool"
+	"github.com/hasanhakkaev/yqapp-demo/internal/workload"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // shutDowner holds a method to gracefully shut down a service or integration.
@@ -27,36 +32,36 @@ type shutDowner interface {
 	Shutdown(ctx context.Context) error
 }
 
-var (
-	serviceStatus = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "service_up",                                // Metric name
-		Help: "Whether the service is up (1) or down (0)", // Metric description
-	})
-	producerTasks = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "tasks_produced_total",
-		Help: "The total number of produced tasks",
-	})
-)
-
 // Client abstracts all the functional components to be run by the server.
 type Client struct {
-	task          v1.TaskServiceClient
+	tasks         *taskclient.Client
 	logger        *zap.Logger
+	logLevel      zap.AtomicLevel
 	meterProvider metric.MeterProvider
+	serviceStatus metric.Int64Gauge
+	producedTasks metric.Int64Counter
 	shutdown      []shutDowner
 	closer        []io.Closer
 	cfg           conf.Configuration
 	metricsServer *http.Server
-	taskQueue     chan *domain.Task // This is the backlog (buffered channel)
+	backlog       backlog
 	rateLimiter   *rate.Limiter
 	pprofServer   *http.Server
+	workload      workload.Generator
+	recorder      *loadtest.Recorder
+	// productionRate reports the current limit of rateLimiter.
+	productionRate metric.Float64Gauge
+	// rateControl adapts rateLimiter to the consumer, nil when the rate is fixed.
+	rateControl *rateController
+	// breaker stops the RPCs to unhealthy consumers, nil when disabled.
+	breaker *breaker.Breaker
 }
 
 // Run serves the application services.
 func (c *Client) Run(ctx context.Context) error {
 
 	// Mark the service as up when starting
-	markServiceUp()
+	c.markServiceUp(ctx)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -67,9 +72,20 @@ func (c *Client) Run(ctx context.Context) error {
 	c.logger.Log(c.logger.Level(), "Starting Pprof endpoint /metrics", zap.String("port", c.cfg.GetProducerProfilingPort()))
 	go c.servePprof(ctx)
 
+	// Apply the changes made to the configuration files
+	c.watchConfig()
+
 	c.logger.Log(c.logger.Level(), "Running Client")
 
-	go c.StartSending(ctx)
+	if c.rateControl != nil {
+		go c.rateControl.run(ctx)
+	}
+
+	sendingDone := make(chan struct{})
+	go func() {
+		defer close(sendingDone)
+		c.StartSending(ctx)
+	}()
 
 	// Start producing tasks at the specified rate
 	productionDone := make(chan error, 1)
@@ -102,7 +118,11 @@ func (c *Client) Run(ctx context.Context) error {
 		}
 	}
 
-	markServiceDown()
+	// Let the sender drain the backlog before shutting down
+	cancel()
+	<-sendingDone
+
+	c.markServiceDown(ctx)
 
 	err := c.Shutdown(ctx)
 	if err != nil {
@@ -170,97 +190,171 @@ func (c *Client) servePprof(ctx context.Context) {
 	}
 }
 
-// NewTaskClient returns a new task client
-func NewTaskClient(cc *grpc.ClientConn) *v1.TaskServiceClient {
-	client := v1.NewTaskServiceClient(cc)
-	return &client
-}
-
-// ProduceTasks produces tasks at a controlled rate and enqueues them into the taskQueue.
+// ProduceTasks produces tasks at a controlled rate and pushes them into the backlog.
 func (c *Client) ProduceTasks(ctx context.Context, totalMessages int) error {
 	for i := 0; i < totalMessages; i++ {
-		// Wait until the rate limiter allows the next message to be produced
-		if err := c.rateLimiter.Wait(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				c.logger.Warn("Task production stopped due to context cancellation")
-				return nil // Gracefully stop without logging an error
+		// Wait until the rate limiter allows the next message to be produced, unless the workload keeps its own pace
+		if !c.workload.Paced() {
+			if err := c.rateLimiter.Wait(ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					c.logger.Warn("Task production stopped due to context cancellation")
+					return nil // Gracefully stop without logging an error
+				}
+
+				c.logger.Error("Rate limiter error", zap.Error(err))
+				return err
 			}
+		}
 
-			c.logger.Error("Rate limiter error", zap.Error(err))
+		// Generate the next task of the workload
+		task, err := c.workload.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			c.logger.Info("Workload exhausted, stopping task production", zap.Int("tasks", i))
+			return nil
+		}
+		if errors.Is(err, context.Canceled) {
+			c.logger.Warn("Task production stopped due to context cancellation")
+			return nil
+		}
+		if err != nil {
+			c.logger.Error("Workload error", zap.Error(err))
 			return err
 		}
 
-		// Generate a new random task
-		task := domain.RandomTask()
-
-		// Attempt to enqueue the task into the backlog (taskQueue)
-		select {
-		case c.taskQueue <- task:
-			c.logger.Log(c.logger.Level(), "Task produced and enqueued", zap.Int("task number", i+1))
-		case <-ctx.Done():
-			c.logger.Warn("Context cancelled, stopping task production")
-			return ctx.Err()
+		// Attempt to push the task into the backlog
+		if err := c.backlog.Push(ctx, task); err != nil {
+			if errors.Is(err, context.Canceled) {
+				c.logger.Warn("Context cancelled, stopping task production")
+				return ctx.Err()
+			}
+			c.logger.Error("Failed to push task into the backlog", zap.Error(err))
+			return err
 		}
+		c.logger.Log(c.logger.Level(), "Task produced and enqueued", zap.Int("task number", i+1))
 	}
 
 	return nil
 }
 
-// StartSending starts sending tasks from the taskQueue to the server.
+// StartSending starts sending tasks from the backlog to the server. Once ctx is done, the
+// remaining tasks are sent for up to the drain timeout, the tasks of a durable backlog that
+// are still unsent are kept for the next run.
 func (c *Client) StartSending(ctx context.Context) {
 	for {
-		select {
-		case task := <-c.taskQueue:
-			// Send the task to the server
-			err := c.sendTask(ctx, task)
-			if err != nil {
-				c.logger.Error("Failed to send task", zap.Error(err))
-			} else {
-				c.logger.Log(c.logger.Level(), "Task sent successfully")
-			}
-		case <-ctx.Done():
-			// Context canceled, initiate graceful shutdown
-			c.logger.Warn("Context cancelled, stopping task sending. Draining remaining tasks...")
-
-			// Drain the task queue to process remaining tasks
-			for len(c.taskQueue) > 0 {
-				task := <-c.taskQueue
-				err := c.sendTask(ctx, task)
-				if err != nil {
-					c.logger.Error("Failed to send task during draining", zap.Error(err))
-				} else {
-					c.logger.Log(c.logger.Level(), "Task sent successfully during draining")
-				}
+		entry, err := c.backlog.Pop(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.Error("Failed to read the backlog", zap.Error(err))
 			}
+			break
+		}
+		if err := c.deliver(ctx, entry); err != nil {
+			c.logger.Error("Failed to send task", zap.Error(err))
+		} else {
+			c.logger.Log(c.logger.Level(), "Task sent successfully")
+		}
+	}
 
+	// The context of the run is cancelled, the draining gets a fresh one
+	c.logger.Warn("Context cancelled, stopping task sending. Draining remaining tasks...")
+	drainCtx, cancel := context.WithTimeout(context.Background(), c.cfg.GetProducerDrainTimeout())
+	defer cancel()
+
+	for drainCtx.Err() == nil {
+		entry, ok, err := c.backlog.TryPop()
+		if err != nil {
+			c.logger.Error("Failed to read the backlog during draining", zap.Error(err))
+			break
+		}
+		if !ok {
 			c.logger.Warn("All remaining tasks processed, task sending stopped")
 			return
 		}
+		if err := c.deliver(drainCtx, entry); err != nil {
+			c.logger.Error("Failed to send task during draining", zap.Error(err))
+		} else {
+			c.logger.Log(c.logger.Level(), "Task sent successfully during draining")
+		}
+	}
+	if c.backlog.Durable() {
+		c.logger.Warn("Drain timeout reached, the unsent tasks are kept in the spool")
+	} else {
+		c.logger.Error("Drain timeout reached, the unsent tasks are lost")
 	}
 }
 
-// sendTask sends a task to the server using gRPC
-func (c *Client) sendTask(ctx context.Context, task *domain.Task) error {
-	// Convert domain task to protobuf task
-	protoTask := domain.FromDomainToProto(task)
+// deliver sends a task of the backlog and acknowledges it. The tasks of a durable backlog are
+// sent again with a growing backoff while the consumer fails with a transient error, until they
+// are accepted or ctx is done. A task rejected for good is acknowledged and dropped, so that it does
+// not hold back the tasks spooled after it. While the circuit breaker is open, the task is held
+// until the breaker lets it through. Every attempt carries the idempotency key spooled with the
+// task, so that a task accepted by a consumer whose response was lost is not created twice, even
+// when it is sent again after a restart.
+func (c *Client) deliver(ctx context.Context, entry spool.Entry) error {
+	backoff := c.cfg.ProducerService.Spool.GetRetryBackoff()
+	key := entry.Key
+	if key == "" {
+		key = taskclient.NewIdempotencyKey()
+	}
+	for {
+		if c.breaker != nil {
+			if err := c.breaker.Wait(ctx); err != nil {
+				return fmt.Errorf("circuit breaker is open: %w", err)
+			}
+		}
+		err := c.sendTask(ctx, entry.Task, key)
+		if err == nil {
+			return c.backlog.Ack(entry)
+		}
+		if errors.Is(err, breaker.ErrOpen) {
+			// Another RPC took the probe slot or reopened the breaker
+			continue
+		}
+		if !c.backlog.Durable() || ctx.Err() != nil {
+			return err
+		}
+		if !transient(err) {
+			return errors.Join(fmt.Errorf("task %d rejected, dropped from the spool: %w", entry.Seq, err), c.backlog.Ack(entry))
+		}
+
+		c.logger.Warn("Failed to send spooled task, retrying", zap.Uint64("seq", entry.Seq), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff = min(2*backoff, c.cfg.ProducerService.Spool.GetMaxRetryBackoff())
+	}
+}
 
-	// Create the gRPC request
-	req := &v1.CreateTaskRequest{
-		Task: protoTask,
+// transient reports whether a failed send may succeed when the task is sent again.
+func transient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
 	}
+}
 
-	// Call the gRPC CreateTask method
-	_, err := c.task.CreateTask(ctx, req)
+// sendTask sends a task to the server with the given idempotency key, a random one when empty
+func (c *Client) sendTask(ctx context.Context, task *domain.Task, key string) error {
+	started := time.Now()
+	_, err := c.tasks.Create(ctx, taskclient.NewTask{Type: task.Type, Value: task.Value, IdempotencyKey: key})
+	// The RPCs rejected by the breaker never reached the consumer
+	if c.rateControl != nil && !errors.Is(err, breaker.ErrOpen) {
+		c.rateControl.observe(time.Since(started), err)
+	}
 
-	producerTasks.Inc()
+	c.producedTasks.Add(ctx, 1)
 
 	return err
 }
 
-func markServiceUp() {
-	serviceStatus.Set(1) // Set to 1 when the service is up
+func (c *Client) markServiceUp(ctx context.Context) {
+	c.serviceStatus.Record(ctx, 1) // Set to 1 when the service is up
 }
 
-func markServiceDown() {
-	serviceStatus.Set(0) // Set to 0 when the service is down
+func (c *Client) markServiceDown(ctx context.Context) {
+	c.serviceStatus.Record(ctx, 0) // Set to 0 when the service is down
 }
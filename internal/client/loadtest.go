@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/loadtest"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"io"
+	"sync"
+	"time"
+)
+
+// LoadTest sends the tasks of the workload at the load test rates and returns the report of the
+// requests started after the warm-up. It stops after the configured duration or once ctx is done.
+func (c *Client) LoadTest(ctx context.Context) (*loadtest.Report, error) {
+	cfg := c.cfg.ProducerService.LoadTest
+
+	measureStart := time.Now().Add(cfg.WarmUp)
+	c.recorder.Start(measureStart)
+	ctx, cancel := context.WithDeadline(ctx, measureStart.Add(cfg.Duration))
+	defer cancel()
+
+	c.logger.Info("Starting load test",
+		zap.Duration("warmUp", cfg.WarmUp),
+		zap.Duration("duration", cfg.Duration),
+		zap.Float64("startRate", cfg.GetStartRate()),
+		zap.Float64("rate", cfg.Rate),
+		zap.Int("concurrency", cfg.GetConcurrency()))
+
+	limiter := rate.NewLimiter(loadtest.RateAt(cfg, -1), 1)
+	slots := make(chan struct{}, cfg.GetConcurrency())
+	var inFlight sync.WaitGroup
+
+send:
+	for {
+		// Replayed workloads keep their own pace
+		if !c.workload.Paced() {
+			limiter.SetLimit(loadtest.RateAt(cfg, time.Since(measureStart)))
+			if err := limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
+
+		task, err := c.workload.Next(ctx)
+		if errors.Is(err, io.EOF) || ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			inFlight.Wait()
+			return nil, err
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			break send
+		}
+		inFlight.Add(1)
+		go func() {
+			defer inFlight.Done()
+			defer func() { <-slots }()
+
+			rpcCtx, cancel := context.WithTimeout(context.Background(), cfg.GetTimeout())
+			defer cancel()
+			if err := c.sendTask(rpcCtx, task, ""); err != nil {
+				c.logger.Debug("Failed to send task", zap.Error(err))
+			}
+		}()
+	}
+
+	// The requests in flight are part of the measurement
+	inFlight.Wait()
+	c.logger.Info("Load test finished")
+	return c.recorder.Report(cfg.Duration), nil
+}
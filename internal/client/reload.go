@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+)
+
+// reloadable lists the configuration keys applied by a running producer and the sections it does not use.
+// Every other producer setting requires a restart.
+var reloadable = conf.Reloadable{
+	Live: []string{
+		"producerService.messageProductionRate",
+		"producerService.logLevel",
+	},
+	Ignored: []string{"consumerService.", "database.", "auth.", "namespaces.", "server.name", "server.environment", "server.drainTimeout", "server.keepaliveMinTime"},
+}
+
+// watchConfig applies the configuration changes made while the producer is running.
+func (c *Client) watchConfig() {
+	current := c.cfg
+	conf.Watch(func(cfg *conf.Configuration, err error) {
+		if err != nil {
+			c.logger.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+			return
+		}
+		c.applyConfig(current, *cfg)
+		current = *cfg
+	})
+}
+
+func (c *Client) applyConfig(old, new conf.Configuration) {
+	applied, restart := reloadable.Split(old, new)
+
+	for _, key := range applied {
+		switch key {
+		case "producerService.messageProductionRate":
+			// The adaptive rate restarts from the new production rate
+			if c.rateControl != nil {
+				c.rateControl.reset(context.Background(), float64(new.ProducerService.MessageProductionRate))
+				break
+			}
+			c.rateLimiter.SetLimit(rate.Limit(new.ProducerService.MessageProductionRate))
+			c.productionRate.Record(context.Background(), float64(new.ProducerService.MessageProductionRate))
+		case "producerService.logLevel":
+			level, _ := zapcore.ParseLevel(new.GetProducerLogLevel())
+			c.logLevel.SetLevel(level)
+		}
+	}
+
+	if len(applied) > 0 {
+		c.logger.Log(c.logger.Level(), "Configuration reloaded", zap.Strings("config.applied", applied))
+	}
+	if len(restart) > 0 {
+		c.logger.Warn("Configuration changes require a restart to take effect", zap.Strings("config.restart", restart))
+	}
+}
@@ -1,18 +1,24 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/hasanhakkaev/yqapp-demo/internal/breaker"
 	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
-	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/loadbalancer"
+	"github.com/hasanhakkaev/yqapp-demo/internal/loadtest"
+	"github.com/hasanhakkaev/yqapp-demo/internal/spool"
 	"github.com/hasanhakkaev/yqapp-demo/internal/telemetry"
+	"github.com/hasanhakkaev/yqapp-demo/internal/tlsconfig"
+	"github.com/hasanhakkaev/yqapp-demo/internal/workload"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"io"
 	"net/http"
 	_ "net/http/pprof" // Import pprof
@@ -28,18 +34,66 @@ func Setup(cfg conf.Configuration) (Client, error) {
 
 	telemeter.Logger.Debug("Initializing client", zap.String("client.name", cfg.Client.Name), zap.String("client.environment", cfg.Server.Environment))
 
-	cc, err := grpc.NewClient(cfg.Server.URI(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	transport, err := tlsconfig.TransportCredentials(cfg.Client.TLS)
 	if err != nil {
-		panic(err)
+		return Client{}, err
+	}
+
+	// The recorder only measures the RPCs of a load test
+	recorder := loadtest.NewRecorder()
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(transport),
+		grpc.WithChainUnaryInterceptor(recorder.UnaryClientInterceptor()),
 	}
+	meter := telemeter.MeterProvider.Meter("producer")
 
-	taskClient := NewTaskClient(cc)
+	// The breaker stops the RPCs to unhealthy consumers, the tasks wait in the backlog meanwhile
+	var circuitBreaker *breaker.Breaker
+	if cfg.Client.CircuitBreaker.Enabled {
+		circuitBreaker, err = newCircuitBreaker(cfg.Client.CircuitBreaker, meter, telemeter.Logger)
+		if err != nil {
+			return Client{}, err
+		}
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(circuitBreaker.UnaryClientInterceptor()))
+	}
 
-	prometheus.MustRegister(serviceStatus)
+	// The RPCs are balanced across the configured consumer replicas
+	cc, err := loadbalancer.Dial(cfg.Client, cfg.Server.URI(), dialOpts...)
+	if err != nil {
+		return Client{}, err
+	}
+
+	// The producer retries through its backlog, the SDK sends every call once
+	clientOpts := []taskclient.Option{taskclient.WithRetry(taskclient.NoRetry)}
+	if cfg.Client.Token != "" {
+		clientOpts = append(clientOpts, taskclient.WithToken(cfg.Client.Token))
+	}
+	if cfg.Client.Namespace != "" {
+		clientOpts = append(clientOpts, taskclient.WithNamespace(cfg.Client.Namespace))
+	}
+	taskClient, err := taskclient.NewFromConn(cc, clientOpts...)
+	if err != nil {
+		return Client{}, err
+	}
+
+	serviceStatus, err := meter.Int64Gauge("service_up",
+		metric.WithDescription("Whether the service is up (1) or down (0)"))
+	if err != nil {
+		return Client{}, err
+	}
+
+	producedTasks, err := meter.Int64Counter("tasks_produced",
+		metric.WithDescription("The total number of produced tasks"))
+	if err != nil {
+		return Client{}, err
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle(cfg.GetMetricsEndpoint(), telemetry.NewMetricsHandler(telemeter.Registry))
 
 	metricsServer := &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.GetProducerMetricsPort()),
-		Handler: promhttp.Handler(),
+		Handler: metricsMux,
 	}
 
 	pprofServer := &http.Server{
@@ -47,26 +101,95 @@ func Setup(cfg conf.Configuration) (Client, error) {
 		Handler: http.DefaultServeMux,
 	}
 
+	generator, seed, err := workload.New(cfg.ProducerService.Workload)
+	if err != nil {
+		return Client{}, err
+	}
+	telemeter.Logger.Info("Workload ready", zap.String("mode", cfg.ProducerService.Workload.GetMode()), zap.Int64("seed", seed))
+
 	limiter := rate.NewLimiter(rate.Limit(cfg.ProducerService.MessageProductionRate), 1)
 
-	taskQueue := make(chan *domain.Task, cfg.ProducerService.MaxBacklog)
+	productionRate, err := meter.Float64Gauge("production_rate",
+		metric.WithDescription("The current limit of the task production rate, in tasks per second"))
+	if err != nil {
+		return Client{}, err
+	}
+	productionRate.Record(context.Background(), float64(cfg.ProducerService.MessageProductionRate))
+
+	var rateControl *rateController
+	if cfg.ProducerService.Adaptive.Enabled {
+		rateControl = newRateController(cfg.ProducerService.Adaptive, float64(cfg.ProducerService.MessageProductionRate), limiter, productionRate, telemeter.Logger)
+	}
+
+	var tasks backlog = make(memoryBacklog, cfg.ProducerService.MaxBacklog)
+	if cfg.ProducerService.Spool.Enabled {
+		spooled, recovery, err := spool.Open(cfg.ProducerService.Spool, int(cfg.ProducerService.MaxBacklog))
+		if err != nil {
+			return Client{}, err
+		}
+		telemeter.Logger.Info("Spool opened",
+			zap.String("dir", cfg.ProducerService.Spool.GetDir()),
+			zap.Int("pending", recovery.Pending),
+			zap.Int64("lostBytes", recovery.Lost))
+		tasks = spoolBacklog{spooled}
+	}
 
 	return Client{
-		task:          *taskClient,
+		tasks:         taskClient,
 		logger:        telemeter.Logger,
+		logLevel:      telemeter.LogLevel,
 		meterProvider: telemeter.MeterProvider,
+		serviceStatus: serviceStatus,
+		producedTasks: producedTasks,
 		shutdown: []shutDowner{
-			telemeter.MeterExporter,
+			telemeter,
 			pprofServer,
 			metricsServer,
 		},
 		closer: []io.Closer{
 			metricsServer,
+			cc,
+			generator,
+			tasks,
 		},
-		cfg:           cfg,
-		metricsServer: metricsServer,
-		taskQueue:     taskQueue,
-		pprofServer:   pprofServer,
-		rateLimiter:   limiter,
+		cfg:            cfg,
+		metricsServer:  metricsServer,
+		backlog:        tasks,
+		pprofServer:    pprofServer,
+		rateLimiter:    limiter,
+		workload:       generator,
+		recorder:       recorder,
+		productionRate: productionRate,
+		rateControl:    rateControl,
+		breaker:        circuitBreaker,
 	}, nil
 }
+
+// newCircuitBreaker creates the breaker of the consumer RPCs, its state transitions are logged and
+// exported as metrics.
+func newCircuitBreaker(cfg conf.CircuitBreaker, meter metric.Meter, logger *zap.Logger) (*breaker.Breaker, error) {
+	state, err := meter.Int64Gauge("circuit_breaker_state",
+		metric.WithDescription("The state of the circuit breaker: closed (0), half-open (1) or open (2)"))
+	if err != nil {
+		return nil, err
+	}
+	transitions, err := meter.Int64Counter("circuit_breaker_transitions",
+		metric.WithDescription("The total number of state transitions of the circuit breaker"))
+	if err != nil {
+		return nil, err
+	}
+	state.Record(context.Background(), int64(breaker.Closed))
+
+	return breaker.New(cfg, func(from, to breaker.State) {
+		ctx := context.Background()
+		state.Record(ctx, int64(to))
+		transitions.Add(ctx, 1, metric.WithAttributes(attribute.String("from", from.String()), attribute.String("to", to.String())))
+
+		fields := []zap.Field{zap.Stringer("from", from), zap.Stringer("to", to)}
+		if to == breaker.Open {
+			logger.Warn("Circuit breaker opened, holding the tasks in the backlog", append(fields, zap.Duration("openTimeout", cfg.GetOpenTimeout()))...)
+		} else {
+			logger.Info("Circuit breaker state changed", fields...)
+		}
+	}), nil
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	_ "github.com/lib/pq"
 	"github.com/spf13/viper"
+	"os"
 	"strings"
+	"time"
 )
 
 func Read() (*Configuration, error) {
@@ -30,11 +32,14 @@ func Read() (*Configuration, error) {
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading base configuration: %w", err)
 	}
+	files := []string{viper.ConfigFileUsed()}
 
 	// Load environment-specific configuration (e.g., configuration.dev.yaml)
 	viper.SetConfigName(fmt.Sprintf("configuration.%s", env))
 	if err := viper.MergeInConfig(); err != nil {
-		fmt.Printf("No environment-specific configuration found for '%s', continuing with base config.\n", env)
+		fmt.Fprintf(os.Stderr, "No environment-specific configuration found for '%s', continuing with base config.\n", env)
+	} else {
+		files = append(files, viper.ConfigFileUsed())
 	}
 
 	// Unmarshal the configuration
@@ -42,19 +47,35 @@ func Read() (*Configuration, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	setConfigFiles(files)
 	return &config, nil
 }
 
 type Metrics struct {
-	Enabled     bool   `env:"ENABLED" envDefault:"true" yaml:"enabled"`
-	Endpoint    string `env:"ENDPOINT" envDefault:"/metrics" yaml:"endpoint"`
-	Environment string `env:"ENVIRONMENT" envDefault:"development" yaml:"environment"`
+	Enabled     bool      `env:"ENABLED" envDefault:"true" yaml:"enabled"`
+	Endpoint    string    `env:"ENDPOINT" envDefault:"/metrics" yaml:"endpoint"`
+	Environment string    `env:"ENVIRONMENT" envDefault:"development" yaml:"environment"`
+	Collector   Collector `envPrefix:"COLLECTOR_" yaml:"collector"`
+}
+
+// Collector configures the OTLP exporter. Metrics are only pushed when Endpoint is set.
+type Collector struct {
+	Endpoint string        `env:"ENDPOINT" yaml:"endpoint"`
+	Insecure bool          `env:"INSECURE" envDefault:"true" yaml:"insecure"`
+	Interval time.Duration `env:"INTERVAL" envDefault:"15s" yaml:"interval"`
 }
 
 type Logger struct {
 	Enabled     bool   `env:"ENABLED" envDefault:"true" yaml:"enabled"`
 	Environment string `env:"ENVIRONMENT" envDefault:"development" yaml:"environment"`
 }
+
+// Database configures the connection to the database. For the postgres engine, DSN takes
+// precedence over the individual fields, and fields left empty fall back to the PG* environment variables.
 type Database struct {
 	Host     string `env:"HOST" envDefault:"localhost" yaml:"host"`
 	Port     uint16 `env:"PORT" envDefault:"5432" yaml:"port"`
@@ -62,44 +83,388 @@ type Database struct {
 	Username string `env:"USERNAME" envDefault:"postgres" yaml:"username"`
 	Password string `env:"PASSWORD" envDefault:"postgres" yaml:"password"`
 	Database string `env:"DATABASE" envDefault:"postgres" yaml:"database"`
+	// DSN is a full connection string, either a postgres:// URL or keyword/value pairs.
+	DSN         string `env:"DSN" yaml:"dsn"`
+	SSLMode     string `env:"SSL_MODE" envDefault:"disable" yaml:"sslMode"`
+	SSLRootCert string `env:"SSL_ROOT_CERT" yaml:"sslRootCert"`
+	SSLCert     string `env:"SSL_CERT" yaml:"sslCert"`
+	SSLKey      string `env:"SSL_KEY" yaml:"sslKey"`
+	// Pool limits, zero keeps the pgxpool defaults.
+	MaxConns        int32         `env:"MAX_CONNS" yaml:"maxConns"`
+	MinConns        int32         `env:"MIN_CONNS" yaml:"minConns"`
+	MaxConnLifetime time.Duration `env:"MAX_CONN_LIFETIME" yaml:"maxConnLifetime"`
+	MaxConnIdleTime time.Duration `env:"MAX_CONN_IDLE_TIME" yaml:"maxConnIdleTime"`
+	// Timeouts, zero disables them.
+	ConnectTimeout   time.Duration `env:"CONNECT_TIMEOUT" envDefault:"5s" yaml:"connectTimeout"`
+	StatementTimeout time.Duration `env:"STATEMENT_TIMEOUT" yaml:"statementTimeout"`
+	// ConnectAttempts bounds the attempts to establish the first connection, waiting
+	// ConnectBackoff after the first failure and doubling the wait after each one.
+	ConnectAttempts uint          `env:"CONNECT_ATTEMPTS" envDefault:"5" yaml:"connectAttempts"`
+	ConnectBackoff  time.Duration `env:"CONNECT_BACKOFF" envDefault:"1s" yaml:"connectBackoff"`
+	// Replicas lists the read replicas serving the read-only queries of the postgres engine.
+	Replicas []Replica `yaml:"replicas"`
+	// MaxReplicaLag is the replication lag above which the reads fall back to the primary.
+	MaxReplicaLag time.Duration `env:"MAX_REPLICA_LAG" envDefault:"5s" yaml:"maxReplicaLag"`
+	// ReplicaCheckInterval is the interval between two checks of the replicas health and lag.
+	ReplicaCheckInterval time.Duration `env:"REPLICA_CHECK_INTERVAL" envDefault:"2s" yaml:"replicaCheckInterval"`
+	// Partitions configures the time partitions of the tasks table of the postgres engine.
+	Partitions Partitions `envPrefix:"PARTITIONS_" yaml:"partitions"`
+	// SkipMigrations disables applying the pending migrations on start, see `consumer migrate`.
+	SkipMigrations bool `env:"SKIP_MIGRATIONS" envDefault:"false" yaml:"skipMigrations"`
+	// Path is the SQLite database file used by the sqlite engine.
+	Path string `env:"PATH" envDefault:"yqapp-demo.db" yaml:"path"`
+}
+
+// Replica is a read replica of the primary database. It uses the credentials, TLS and pool
+// settings of the primary with its own host and port, or its own DSN when set.
+type Replica struct {
+	Host string `yaml:"host"`
+	Port uint16 `yaml:"port"`
+	DSN  string `yaml:"dsn"`
+}
+
+// Partitions configures how the tasks table is partitioned by creation time and how long
+// the partitions are kept.
+type Partitions struct {
+	// Enabled runs the background job creating and retiring the partitions.
+	Enabled bool `env:"ENABLED" envDefault:"true" yaml:"enabled"`
+	// Interval is the time range covered by each partition.
+	Interval time.Duration `env:"INTERVAL" envDefault:"24h" yaml:"interval"`
+	// Premake is the number of partitions created ahead of the current one.
+	Premake uint `env:"PREMAKE" envDefault:"7" yaml:"premake"`
+	// CheckInterval is the time between two runs of the background job.
+	CheckInterval time.Duration `env:"CHECK_INTERVAL" envDefault:"1h" yaml:"checkInterval"`
+	// Retention is the age after which a partition is retired, zero keeps the partitions forever.
+	Retention time.Duration `env:"RETENTION" envDefault:"0s" yaml:"retention"`
+	// RetentionMode is drop to drop the retired partitions, or archive to write their
+	// DONE tasks to ArchiveDir first.
+	RetentionMode string `env:"RETENTION_MODE" envDefault:"drop" yaml:"retentionMode"`
+	ArchiveDir    string `env:"ARCHIVE_DIR" envDefault:"archive" yaml:"archiveDir"`
+	// ArchiveFormat is jsonl or csv, the archives are gzip compressed.
+	ArchiveFormat string `env:"ARCHIVE_FORMAT" envDefault:"jsonl" yaml:"archiveFormat"`
 }
 
 type Consumer struct {
-	MessageConsumptionRate uint   `env:"MESSAGE_CONSUMPTION_RATE" envDefault:"1000" yaml:"messageConsumptionRate"`
-	LogLevel               string `env:"LOG_LEVEL" envDefault:"info" yaml:"logLevel"`
-	LogEncoding            string `env:"LOG_ENCODING" yaml:"logEncoding"`
-	MetricsPort            uint16 `env:"METRICS_PORT" envDefault:"5000" yaml:"metricsPort"`
-	ProfilingPort          uint16 `env:"PROFILING_PORT" envDefault:"8080" yaml:"profilingPort"`
+	MessageConsumptionRate uint          `env:"MESSAGE_CONSUMPTION_RATE" envDefault:"1000" yaml:"messageConsumptionRate"`
+	Workers                uint          `env:"WORKERS" envDefault:"1" yaml:"workers"`
+	SettingsSyncInterval   time.Duration `env:"SETTINGS_SYNC_INTERVAL" envDefault:"5s" yaml:"settingsSyncInterval"`
+	HandlerTimeout         time.Duration `env:"HANDLER_TIMEOUT" envDefault:"0s" yaml:"handlerTimeout"`
+	// RecoveryInterval is the interval at which the RECEIVED tasks missing from every backlog are claimed,
+	// e.g. the tasks returned by a drain, RecoveryAge the time a task stays RECEIVED before it is claimed.
+	RecoveryInterval time.Duration `env:"RECOVERY_INTERVAL" envDefault:"30s" yaml:"recoveryInterval"`
+	RecoveryAge      time.Duration `env:"RECOVERY_AGE" envDefault:"5m" yaml:"recoveryAge"`
+	LogLevel         string        `env:"LOG_LEVEL" envDefault:"info" yaml:"logLevel"`
+	LogEncoding      string        `env:"LOG_ENCODING" yaml:"logEncoding"`
+	MetricsPort      uint16        `env:"METRICS_PORT" envDefault:"5000" yaml:"metricsPort"`
+	ProfilingPort    uint16        `env:"PROFILING_PORT" envDefault:"8080" yaml:"profilingPort"`
+	// Dashboard configures the web dashboard served on the metrics port.
+	Dashboard Dashboard `envPrefix:"DASHBOARD_" yaml:"dashboard"`
+}
+
+// Dashboard configures the web dashboard of the consumer replica.
+type Dashboard struct {
+	Enabled bool `env:"ENABLED" envDefault:"true" yaml:"enabled"`
+	// Endpoint is the path of the dashboard page, its API is served below it.
+	Endpoint string `env:"ENDPOINT" envDefault:"/dashboard/" yaml:"endpoint"`
 }
 
 type Producer struct {
-	MessageProductionRate uint   `env:"MESSAGE_PRODUCTION_RATE" envDefault:"1000/s" yaml:"messageProductionRate"`
-	MaxBacklog            uint   `env:"MAX_BACKLOG" envDefault:"10" yaml:"maxBacklog"`
-	LogLevel              string `env:"LOG_LEVEL" envDefault:"info" yaml:"logLevel"`
-	LogEncoding           string `env:"LOG_ENCODING" yaml:"logEncoding"`
-	MetricsPort           uint16 `env:"METRICS_PORT" envDefault:"5000" yaml:"metricsPort"`
-	ProfilingPort         uint16 `env:"PROFILING_PORT" envDefault:"8080" yaml:"profilingPort"`
+	MessageProductionRate uint     `env:"MESSAGE_PRODUCTION_RATE" envDefault:"1000/s" yaml:"messageProductionRate"`
+	MaxBacklog            uint     `env:"MAX_BACKLOG" envDefault:"10" yaml:"maxBacklog"`
+	LogLevel              string   `env:"LOG_LEVEL" envDefault:"info" yaml:"logLevel"`
+	LogEncoding           string   `env:"LOG_ENCODING" yaml:"logEncoding"`
+	MetricsPort           uint16   `env:"METRICS_PORT" envDefault:"5000" yaml:"metricsPort"`
+	ProfilingPort         uint16   `env:"PROFILING_PORT" envDefault:"8080" yaml:"profilingPort"`
+	Workload              Workload `envPrefix:"WORKLOAD_" yaml:"workload"`
+	LoadTest              LoadTest `envPrefix:"LOAD_TEST_" yaml:"loadTest"`
+	Spool                 Spool    `envPrefix:"SPOOL_" yaml:"spool"`
+	Adaptive              Adaptive `envPrefix:"ADAPTIVE_" yaml:"adaptive"`
+	// DrainTimeout bounds the time spent sending the backlog on shutdown.
+	DrainTimeout time.Duration `env:"DRAIN_TIMEOUT" envDefault:"30s" yaml:"drainTimeout"`
+}
+
+// Adaptive configures the adaptive production rate. Starting from MessageProductionRate, the rate is raised
+// by Increase after every window in which the RPCs succeed within LatencyTarget and multiplied by
+// DecreaseFactor after a window with an overloaded consumer or a latency above the target.
+type Adaptive struct {
+	Enabled bool    `env:"ENABLED" envDefault:"false" yaml:"enabled"`
+	MinRate float64 `env:"MIN_RATE" envDefault:"1" yaml:"minRate"`
+	// MaxRate bounds the rate, zero for no bound.
+	MaxRate        float64       `env:"MAX_RATE" yaml:"maxRate"`
+	Increase       float64       `env:"INCREASE" envDefault:"10" yaml:"increase"`
+	DecreaseFactor float64       `env:"DECREASE_FACTOR" envDefault:"0.5" yaml:"decreaseFactor"`
+	LatencyTarget  time.Duration `env:"LATENCY_TARGET" envDefault:"100ms" yaml:"latencyTarget"`
+	Window         time.Duration `env:"WINDOW" envDefault:"1s" yaml:"window"`
+}
+
+// Spool configures the on-disk spool persisting the producer backlog. With the spool, the tasks are
+// only removed once the consumer has accepted them and the backlog survives restarts.
+type Spool struct {
+	Enabled bool   `env:"ENABLED" envDefault:"false" yaml:"enabled"`
+	Dir     string `env:"DIR" envDefault:"spool" yaml:"dir"`
+	// SegmentSize is the size in bytes above which a new segment file is started.
+	SegmentSize int64 `env:"SEGMENT_SIZE" envDefault:"67108864" yaml:"segmentSize"`
+	// SyncInterval is the time between two fsyncs of the segments, every task is synced when zero.
+	SyncInterval time.Duration `env:"SYNC_INTERVAL" yaml:"syncInterval"`
+	// RetryBackoff is the wait after the first failed send of a spooled task, doubled after each
+	// failure up to MaxRetryBackoff.
+	RetryBackoff    time.Duration `env:"RETRY_BACKOFF" envDefault:"500ms" yaml:"retryBackoff"`
+	MaxRetryBackoff time.Duration `env:"MAX_RETRY_BACKOFF" envDefault:"30s" yaml:"maxRetryBackoff"`
+}
+
+// LoadTest configures the `producer loadtest` runs.
+type LoadTest struct {
+	// Rate is the number of tasks sent per second once the ramp is over.
+	Rate float64 `env:"RATE" envDefault:"100" yaml:"rate"`
+	// StartRate is the rate of the warm-up and the start of the ramp, Rate when zero.
+	StartRate float64 `env:"START_RATE" yaml:"startRate"`
+	// RampUp is the time taken to move from StartRate to Rate once the warm-up is over.
+	RampUp time.Duration `env:"RAMP_UP" yaml:"rampUp"`
+	// WarmUp is sent before the measurement starts, its requests are left out of the report.
+	WarmUp   time.Duration `env:"WARM_UP" envDefault:"10s" yaml:"warmUp"`
+	Duration time.Duration `env:"DURATION" envDefault:"1m" yaml:"duration"`
+	// Concurrency bounds the requests in flight, the arrivals wait for a free slot beyond it.
+	Concurrency uint          `env:"CONCURRENCY" envDefault:"64" yaml:"concurrency"`
+	Timeout     time.Duration `env:"TIMEOUT" envDefault:"5s" yaml:"timeout"`
+	// ReportPath is the file the JSON report is written to, stdout when empty.
+	ReportPath string `env:"REPORT_PATH" yaml:"reportPath"`
+	SLO        SLO    `envPrefix:"SLO_" yaml:"slo"`
+}
+
+// SLO lists the thresholds failing a load test, zero disables a threshold.
+type SLO struct {
+	P50  time.Duration `env:"P50" yaml:"p50"`
+	P90  time.Duration `env:"P90" yaml:"p90"`
+	P99  time.Duration `env:"P99" yaml:"p99"`
+	P999 time.Duration `env:"P999" yaml:"p999"`
+	// MaxErrorRate is the largest fraction of failed requests.
+	MaxErrorRate float64 `env:"MAX_ERROR_RATE" yaml:"maxErrorRate"`
+}
+
+// Workload configures the tasks produced by the producer.
+type Workload struct {
+	// Mode is random, drawing the tasks from the distributions below, or replay.
+	Mode string `env:"MODE" envDefault:"random" yaml:"mode"`
+	// Seed makes the random tasks reproducible, a seed based on the current time is used when zero.
+	Seed  int64        `env:"SEED" yaml:"seed"`
+	Type  Distribution `envPrefix:"TYPE_" yaml:"type"`
+	Value Distribution `envPrefix:"VALUE_" yaml:"value"`
+	// TypeMix draws the task types from the given weights instead of the type distribution.
+	TypeMix []TypeWeight `yaml:"typeMix"`
+	Replay  Replay       `envPrefix:"REPLAY_" yaml:"replay"`
+}
+
+// MaxTaskType and MaxTaskValue bound the task types and values, as checked by the database.
+const (
+	MaxTaskType  = 9
+	MaxTaskValue = 99
+)
+
+// Distribution configures the random values of a task field.
+type Distribution struct {
+	// Kind is uniform, zipf, normal or constant.
+	Kind string `env:"KIND" yaml:"kind"`
+	// Min and Max bound the drawn values.
+	Min uint32 `env:"MIN" yaml:"min"`
+	Max uint32 `env:"MAX" yaml:"max"`
+	// Skew is the zipf exponent, the larger the skew the more the values near Min dominate.
+	Skew float64 `env:"SKEW" yaml:"skew"`
+	// Mean and StdDev configure the normal distribution.
+	Mean   float64 `env:"MEAN" yaml:"mean"`
+	StdDev float64 `env:"STD_DEV" yaml:"stdDev"`
+	// Constant is the value of the constant distribution.
+	Constant uint32 `env:"CONSTANT" yaml:"constant"`
+}
+
+// TypeWeight is the relative share of a task type in a type mix.
+type TypeWeight struct {
+	Type   uint32  `yaml:"type"`
+	Weight float64 `yaml:"weight"`
+}
+
+// Replay configures the file replayed by the replay workload.
+type Replay struct {
+	// Path is a JSONL or CSV file, e.g. a task archive, gzip compressed when ending in .gz.
+	Path string `env:"PATH" yaml:"path"`
+	// Format is jsonl or csv, inferred from the file extension when empty.
+	Format string `env:"FORMAT" yaml:"format"`
+	// Speed divides the original inter-arrival times, 2 replays the tasks twice as fast.
+	Speed float64 `env:"SPEED" envDefault:"1" yaml:"speed"`
+	// Loop restarts the replay at the end of the file.
+	Loop bool `env:"LOOP" yaml:"loop"`
 }
 
 type Server struct {
-	Name        string `env:"NAME" envDefault:"yqapp-demo-server" yaml:"name"`
-	Environment string `env:"ENVIRONMENT" envDefault:"development" yaml:"environment"`
-	Host        string `env:"HOST" envDefault:"localhost" yaml:"host"`
-	Port        uint16 `env:"PORT" envDefault:"8080" yaml:"port"`
+	Name         string        `env:"NAME" envDefault:"yqapp-demo-server" yaml:"name"`
+	Environment  string        `env:"ENVIRONMENT" envDefault:"development" yaml:"environment"`
+	Host         string        `env:"HOST" envDefault:"localhost" yaml:"host"`
+	Port         uint16        `env:"PORT" envDefault:"8080" yaml:"port"`
+	DrainTimeout time.Duration `env:"DRAIN_TIMEOUT" envDefault:"30s" yaml:"drainTimeout"`
+	// KeepaliveMinTime is the shortest interval between two pings accepted from a client,
+	// the connections of the clients pinging more often are closed.
+	KeepaliveMinTime time.Duration `env:"KEEPALIVE_MIN_TIME" envDefault:"10s" yaml:"keepaliveMinTime"`
+	Health           Health        `envPrefix:"HEALTH_" yaml:"health"`
+}
+
+// Health configures the liveness and readiness checks of the consumer.
+type Health struct {
+	// CheckInterval is the interval between two runs of the checks.
+	CheckInterval time.Duration `env:"CHECK_INTERVAL" envDefault:"10s" yaml:"checkInterval"`
+	// CheckTimeout bounds every check, a check still running after it fails.
+	CheckTimeout time.Duration `env:"CHECK_TIMEOUT" envDefault:"2s" yaml:"checkTimeout"`
+	// BacklogSaturation is the share of the task backlog from which the consumer reports it is not ready.
+	BacklogSaturation float64 `env:"BACKLOG_SATURATION" envDefault:"0.9" yaml:"backlogSaturation"`
 }
 
 type Client struct {
 	Name        string `env:"NAME" envDefault:"yqapp-demo-client" yaml:"name"`
 	Environment string `env:"ENVIRONMENT" envDefault:"development" yaml:"environment"`
+	Token       string `env:"TOKEN" yaml:"token"`
+	// Namespace names the namespace of the produced tasks, the consumer default is used when empty.
+	Namespace string `env:"NAMESPACE" yaml:"namespace"`
+	// Endpoints lists the consumer replicas as host:port, the RPCs are balanced across them.
+	Endpoints []string `yaml:"endpoints"`
+	// Target is a gRPC target such as dns:///consumer:50051 used instead of the endpoints,
+	// every address it resolves to is balanced. The server host and port are used when both are empty.
+	Target        string        `env:"TARGET" yaml:"target"`
+	LoadBalancing LoadBalancing `envPrefix:"LOAD_BALANCING_" yaml:"loadBalancing"`
+	Keepalive     Keepalive     `envPrefix:"KEEPALIVE_" yaml:"keepalive"`
+	// PoolSize is the number of connections opened to every consumer, the RPCs are spread over them.
+	PoolSize       uint           `env:"POOL_SIZE" envDefault:"1" yaml:"poolSize"`
+	CircuitBreaker CircuitBreaker `envPrefix:"CIRCUIT_BREAKER_" yaml:"circuitBreaker"`
+	TLS            TLS            `envPrefix:"TLS_" yaml:"tls"`
+}
+
+// TLS secures the connections to the consumers, e.g. through a TLS terminating proxy.
+type TLS struct {
+	Enabled bool `env:"ENABLED" envDefault:"false" yaml:"enabled"`
+	// CAFile is the PEM file of the CA of the consumers, the system roots are trusted when empty.
+	CAFile string `env:"CA_FILE" yaml:"caFile"`
+	// CertFile and KeyFile are the PEM files of a client certificate for mutual TLS.
+	CertFile string `env:"CERT_FILE" yaml:"certFile"`
+	KeyFile  string `env:"KEY_FILE" yaml:"keyFile"`
+	// ServerName is verified in the certificate of the consumers instead of the dialed host.
+	ServerName string `env:"SERVER_NAME" yaml:"serverName"`
+}
+
+// CircuitBreaker stops the RPCs to the consumers after consecutive failures. Once OpenTimeout has
+// elapsed, HalfOpenRequests probe RPCs are let through and SuccessThreshold successes close the breaker.
+type CircuitBreaker struct {
+	Enabled             bool          `env:"ENABLED" envDefault:"false" yaml:"enabled"`
+	ConsecutiveFailures uint          `env:"CONSECUTIVE_FAILURES" envDefault:"5" yaml:"consecutiveFailures"`
+	OpenTimeout         time.Duration `env:"OPEN_TIMEOUT" envDefault:"10s" yaml:"openTimeout"`
+	HalfOpenRequests    uint          `env:"HALF_OPEN_REQUESTS" envDefault:"1" yaml:"halfOpenRequests"`
+	SuccessThreshold    uint          `env:"SUCCESS_THRESHOLD" envDefault:"1" yaml:"successThreshold"`
+}
+
+// LoadBalancing configures how the RPCs are balanced across the consumer replicas.
+type LoadBalancing struct {
+	// Policy is round_robin or least_request.
+	Policy string `env:"POLICY" envDefault:"round_robin" yaml:"policy"`
+	// HealthCheck watches the grpc_health_v1 status of every replica, the replicas not serving are skipped.
+	HealthCheck bool `env:"HEALTH_CHECK" envDefault:"true" yaml:"healthCheck"`
+	// HealthService is the service whose status is watched, the overall server status when empty.
+	HealthService    string           `env:"HEALTH_SERVICE" yaml:"healthService"`
+	OutlierDetection OutlierDetection `envPrefix:"OUTLIER_DETECTION_" yaml:"outlierDetection"`
+}
+
+// OutlierDetection ejects the replicas failing consecutive RPCs from the balancing for a while.
+type OutlierDetection struct {
+	Enabled bool `env:"ENABLED" envDefault:"true" yaml:"enabled"`
+	// ConsecutiveErrors is the number of failed RPCs in a row ejecting a replica.
+	ConsecutiveErrors uint `env:"CONSECUTIVE_ERRORS" envDefault:"5" yaml:"consecutiveErrors"`
+	// BaseEjectionTime is the first ejection time of a replica, multiplied by the number of times it was ejected.
+	BaseEjectionTime time.Duration `env:"BASE_EJECTION_TIME" envDefault:"30s" yaml:"baseEjectionTime"`
+	MaxEjectionTime  time.Duration `env:"MAX_EJECTION_TIME" envDefault:"5m" yaml:"maxEjectionTime"`
+	// MaxEjectionPercent bounds the share of the replicas ejected at once.
+	MaxEjectionPercent uint `env:"MAX_EJECTION_PERCENT" envDefault:"50" yaml:"maxEjectionPercent"`
+}
+
+// Keepalive configures the pings keeping the idle connections to the consumers open.
+type Keepalive struct {
+	// Time is the idle time after which the connection is pinged, no pings are sent when zero.
+	Time                time.Duration `env:"TIME" yaml:"time"`
+	Timeout             time.Duration `env:"TIMEOUT" envDefault:"20s" yaml:"timeout"`
+	PermitWithoutStream bool          `env:"PERMIT_WITHOUT_STREAM" yaml:"permitWithoutStream"`
+}
+
+// Auth configures the bearer tokens accepted by the consumer.
+// The AdminService always requires a token with the admin flag set.
+type Auth struct {
+	Enabled bool    `env:"ENABLED" envDefault:"false" yaml:"enabled"`
+	Tokens  []Token `yaml:"tokens"`
+}
+
+// Outbox configures the task lifecycle events and the relay publishing them to a sink.
+type Outbox struct {
+	// Enabled writes an event to the outbox on every task state change and runs the relay.
+	Enabled bool `env:"ENABLED" envDefault:"false" yaml:"enabled"`
+	// Sink is webhook or file.
+	Sink string `env:"SINK" envDefault:"file" yaml:"sink"`
+	// Source is the CloudEvents source attribute of the published events.
+	Source       string        `env:"SOURCE" envDefault:"/yqapp-demo/consumer" yaml:"source"`
+	BatchSize    uint          `env:"BATCH_SIZE" envDefault:"100" yaml:"batchSize"`
+	PollInterval time.Duration `env:"POLL_INTERVAL" envDefault:"1s" yaml:"pollInterval"`
+	Webhook      Webhook       `envPrefix:"WEBHOOK_" yaml:"webhook"`
+	// FilePath is the JSONL file the events are appended to by the file sink.
+	FilePath string `env:"FILE_PATH" envDefault:"events.jsonl" yaml:"filePath"`
+}
+
+// Webhook configures the HTTP endpoint the webhook sink posts the events to.
+type Webhook struct {
+	URL string `env:"URL" yaml:"url"`
+	// Secret signs the request bodies with HMAC-SHA256, no signature is sent when empty.
+	Secret  string        `env:"SECRET" yaml:"secret"`
+	Timeout time.Duration `env:"TIMEOUT" envDefault:"5s" yaml:"timeout"`
+	// MaxAttempts bounds the deliveries of an event, waiting Backoff after the first failure
+	// and doubling the wait after each one.
+	MaxAttempts uint          `env:"MAX_ATTEMPTS" envDefault:"5" yaml:"maxAttempts"`
+	Backoff     time.Duration `env:"BACKOFF" envDefault:"500ms" yaml:"backoff"`
+}
+
+// Namespaces configures the limits applied to the tasks of each namespace.
+type Namespaces struct {
+	// Limits lists the namespaces with limits of their own, the tasks of the other
+	// namespaces are only bound by the consumer wide limits.
+	Limits []NamespaceLimit `yaml:"limits"`
+}
+
+// NamespaceLimit bounds the processing of the tasks of a namespace, on top of the consumer wide limits.
+type NamespaceLimit struct {
+	Name string `yaml:"name"`
+	// RateLimit is the number of tasks processed per second, zero for no limit of its own.
+	RateLimit float64 `yaml:"rateLimit"`
+	Burst     uint    `yaml:"burst"`
+	// WorkerShare is the fraction of the worker pool the tasks of the namespace may occupy at once,
+	// zero for the whole pool. A namespace always gets at least one worker.
+	WorkerShare float64 `yaml:"workerShare"`
+}
+
+type Token struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Admin bool   `yaml:"admin"`
+	// Namespace restricts the token to a single namespace, empty allows the callers to name theirs.
+	Namespace string `yaml:"namespace"`
 }
 type Configuration struct {
-	Server          Server   `env:"SERVER" yaml:"server"`
-	ConsumerService Consumer `env:"CONSUMER" yaml:"consumer"`
-	ProducerService Producer `env:"PRODUCER" yaml:"producer"`
-	Database        Database `envPrefix:"DATABASE_" yaml:"database"`
-	Metrics         Metrics  `envPrefix:"METRICS_" yaml:"metrics"`
-	Logger          Logger   `envPrefix:"LOGGER_" yaml:"logger"`
-	Client          Client   `envPrefix:"CLIENT" yaml:"client"`
+	Server          Server     `env:"SERVER" yaml:"server"`
+	ConsumerService Consumer   `env:"CONSUMER" yaml:"consumer"`
+	ProducerService Producer   `env:"PRODUCER" yaml:"producer"`
+	Database        Database   `envPrefix:"DATABASE_" yaml:"database"`
+	Metrics         Metrics    `envPrefix:"METRICS_" yaml:"metrics"`
+	Logger          Logger     `envPrefix:"LOGGER_" yaml:"logger"`
+	Client          Client     `envPrefix:"CLIENT" yaml:"client"`
+	Auth            Auth       `envPrefix:"AUTH_" yaml:"auth"`
+	Outbox          Outbox     `envPrefix:"OUTBOX_" yaml:"outbox"`
+	Namespaces      Namespaces `envPrefix:"NAMESPACES_" yaml:"namespaces"`
+}
+
+func (c Configuration) GetMetricsEndpoint() string {
+	if c.Metrics.Endpoint == "" {
+		return "/metrics"
+	}
+	return c.Metrics.Endpoint
 }
 
 func (c Configuration) GetProducerMetricsPort() string {
@@ -118,10 +483,51 @@ func (c Configuration) GetProducerLogEncoding() string {
 	return c.ProducerService.LogEncoding
 }
 
+func (c Configuration) GetConsumerWorkers() int {
+	if c.ConsumerService.Workers == 0 {
+		return 1
+	}
+	return int(c.ConsumerService.Workers)
+}
+
+func (c Configuration) GetConsumerSettingsSyncInterval() time.Duration {
+	if c.ConsumerService.SettingsSyncInterval <= 0 {
+		return 5 * time.Second
+	}
+	return c.ConsumerService.SettingsSyncInterval
+}
+
+// GetConsumerRecoveryInterval returns the interval at which the orphaned RECEIVED tasks are claimed.
+func (c Configuration) GetConsumerRecoveryInterval() time.Duration {
+	if c.ConsumerService.RecoveryInterval <= 0 {
+		return 30 * time.Second
+	}
+	return c.ConsumerService.RecoveryInterval
+}
+
+// GetConsumerRecoveryAge returns the time a task stays RECEIVED before it is claimed by the recovery.
+func (c Configuration) GetConsumerRecoveryAge() time.Duration {
+	if c.ConsumerService.RecoveryAge <= 0 {
+		return 5 * time.Minute
+	}
+	return c.ConsumerService.RecoveryAge
+}
+
 func (c Configuration) GetConsumerMetricsPort() string {
 	return fmt.Sprintf("%d", c.ConsumerService.MetricsPort)
 }
 
+// GetEndpoint returns the path of the dashboard page, ending with a slash.
+func (d Dashboard) GetEndpoint() string {
+	if d.Endpoint == "" {
+		return "/dashboard/"
+	}
+	if !strings.HasSuffix(d.Endpoint, "/") {
+		return d.Endpoint + "/"
+	}
+	return d.Endpoint
+}
+
 func (c Configuration) GetConsumerProfilingPort() string {
 	return fmt.Sprintf("%d", c.ConsumerService.ProfilingPort)
 }
@@ -134,11 +540,406 @@ func (c Configuration) GetConsumerLogEncoding() string {
 	return c.ConsumerService.LogEncoding
 }
 
+// GetConnectAttempts returns the number of attempts to establish the first connection.
+func (d Database) GetConnectAttempts() int {
+	if d.ConnectAttempts == 0 {
+		return 5
+	}
+	return int(d.ConnectAttempts)
+}
+
+// GetConnectBackoff returns the wait after the first failed connection attempt.
+func (d Database) GetConnectBackoff() time.Duration {
+	if d.ConnectBackoff <= 0 {
+		return time.Second
+	}
+	return d.ConnectBackoff
+}
+
+// ForReplica returns the settings used to connect to the given read replica.
+func (d Database) ForReplica(r Replica) Database {
+	replica := d
+	replica.Replicas = nil
+	if r.DSN != "" {
+		replica.DSN = r.DSN
+		return replica
+	}
+	replica.DSN = ""
+	replica.Host = r.Host
+	if r.Port != 0 {
+		replica.Port = r.Port
+	}
+	return replica
+}
+
+// GetMaxReplicaLag returns the replication lag above which the reads fall back to the primary.
+func (d Database) GetMaxReplicaLag() time.Duration {
+	if d.MaxReplicaLag <= 0 {
+		return 5 * time.Second
+	}
+	return d.MaxReplicaLag
+}
+
+// GetReplicaCheckInterval returns the interval between two checks of the replicas.
+func (d Database) GetReplicaCheckInterval() time.Duration {
+	if d.ReplicaCheckInterval <= 0 {
+		return 2 * time.Second
+	}
+	return d.ReplicaCheckInterval
+}
+
+// GetInterval returns the time range covered by each partition.
+func (p Partitions) GetInterval() time.Duration {
+	if p.Interval <= 0 {
+		return 24 * time.Hour
+	}
+	return p.Interval
+}
+
+// GetCheckInterval returns the time between two runs of the partitions job.
+func (p Partitions) GetCheckInterval() time.Duration {
+	if p.CheckInterval <= 0 {
+		return time.Hour
+	}
+	return p.CheckInterval
+}
+
+// GetRetentionMode returns the way the retired partitions are handled.
+func (p Partitions) GetRetentionMode() string {
+	if p.RetentionMode == "" {
+		return "drop"
+	}
+	return p.RetentionMode
+}
+
+// GetArchiveFormat returns the format of the archived tasks.
+func (p Partitions) GetArchiveFormat() string {
+	if p.ArchiveFormat == "" {
+		return "jsonl"
+	}
+	return p.ArchiveFormat
+}
+
+// GetPath returns the SQLite database file used by the sqlite engine.
+func (d Database) GetPath() string {
+	if d.Path == "" {
+		return "yqapp-demo.db"
+	}
+	return d.Path
+}
+
+// GetBatchSize returns the maximum number of events published by a single relay run.
+func (o Outbox) GetBatchSize() int {
+	if o.BatchSize == 0 {
+		return 100
+	}
+	return int(o.BatchSize)
+}
+
+// GetPollInterval returns the time between two relay runs when the outbox is empty.
+func (o Outbox) GetPollInterval() time.Duration {
+	if o.PollInterval <= 0 {
+		return time.Second
+	}
+	return o.PollInterval
+}
+
+// GetTimeout returns the timeout of a single webhook request.
+func (w Webhook) GetTimeout() time.Duration {
+	if w.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return w.Timeout
+}
+
+// GetMaxAttempts returns the maximum number of deliveries of an event.
+func (w Webhook) GetMaxAttempts() int {
+	if w.MaxAttempts == 0 {
+		return 1
+	}
+	return int(w.MaxAttempts)
+}
+
 // Address returns the configuration needed to initialize a net.Listener instance.
 func (s Server) Address() (network string, address string) {
 	return "tcp", fmt.Sprintf(":%d", s.Port)
 }
 
+// GetDrainTimeout returns the deadline for draining in-flight work on shutdown.
+func (s Server) GetDrainTimeout() time.Duration {
+	if s.DrainTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return s.DrainTimeout
+}
+
+// GetKeepaliveMinTime returns the shortest interval between two pings accepted from a client.
+func (s Server) GetKeepaliveMinTime() time.Duration {
+	if s.KeepaliveMinTime <= 0 {
+		return 10 * time.Second
+	}
+	return s.KeepaliveMinTime
+}
+
+// GetCheckInterval returns the interval between two runs of the health checks.
+func (h Health) GetCheckInterval() time.Duration {
+	if h.CheckInterval <= 0 {
+		return 10 * time.Second
+	}
+	return h.CheckInterval
+}
+
+// GetCheckTimeout returns the deadline of a single health check.
+func (h Health) GetCheckTimeout() time.Duration {
+	if h.CheckTimeout <= 0 {
+		return 2 * time.Second
+	}
+	return h.CheckTimeout
+}
+
+// GetBacklogSaturation returns the share of the task backlog from which the consumer is not ready.
+func (h Health) GetBacklogSaturation() float64 {
+	if h.BacklogSaturation <= 0 {
+		return 0.9
+	}
+	return h.BacklogSaturation
+}
+
 func (s Server) URI() string {
 	return fmt.Sprintf("%s:%d", s.Host, s.Port)
 }
+
+// GetPolicy returns the load balancing policy.
+func (l LoadBalancing) GetPolicy() string {
+	if l.Policy == "" {
+		return "round_robin"
+	}
+	return l.Policy
+}
+
+// GetConsecutiveErrors returns the number of failed RPCs in a row ejecting a replica.
+func (o OutlierDetection) GetConsecutiveErrors() uint {
+	if o.ConsecutiveErrors == 0 {
+		return 5
+	}
+	return o.ConsecutiveErrors
+}
+
+// GetBaseEjectionTime returns the first ejection time of a replica.
+func (o OutlierDetection) GetBaseEjectionTime() time.Duration {
+	if o.BaseEjectionTime <= 0 {
+		return 30 * time.Second
+	}
+	return o.BaseEjectionTime
+}
+
+// GetMaxEjectionTime returns the longest ejection time of a replica.
+func (o OutlierDetection) GetMaxEjectionTime() time.Duration {
+	if o.MaxEjectionTime <= 0 {
+		return 5 * time.Minute
+	}
+	return o.MaxEjectionTime
+}
+
+// GetMaxEjectionPercent returns the largest share of the replicas ejected at once.
+func (o OutlierDetection) GetMaxEjectionPercent() uint {
+	if o.MaxEjectionPercent == 0 {
+		return 50
+	}
+	return min(o.MaxEjectionPercent, 100)
+}
+
+// GetTimeout returns the time waited for a ping acknowledgement before closing the connection.
+func (k Keepalive) GetTimeout() time.Duration {
+	if k.Timeout <= 0 {
+		return 20 * time.Second
+	}
+	return k.Timeout
+}
+
+// GetConsecutiveFailures returns the number of failed RPCs in a row opening the breaker.
+func (c CircuitBreaker) GetConsecutiveFailures() int {
+	if c.ConsecutiveFailures == 0 {
+		return 5
+	}
+	return int(c.ConsecutiveFailures)
+}
+
+// GetOpenTimeout returns the time the breaker stays open before letting probe RPCs through.
+func (c CircuitBreaker) GetOpenTimeout() time.Duration {
+	if c.OpenTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return c.OpenTimeout
+}
+
+// GetHalfOpenRequests returns the number of probe RPCs let through at once by a half-open breaker.
+func (c CircuitBreaker) GetHalfOpenRequests() int {
+	if c.HalfOpenRequests == 0 {
+		return 1
+	}
+	return int(c.HalfOpenRequests)
+}
+
+// GetSuccessThreshold returns the number of successful probe RPCs closing the breaker.
+func (c CircuitBreaker) GetSuccessThreshold() int {
+	if c.SuccessThreshold == 0 {
+		return 1
+	}
+	return int(c.SuccessThreshold)
+}
+
+// GetPoolSize returns the number of connections opened to every consumer.
+func (c Client) GetPoolSize() int {
+	if c.PoolSize == 0 {
+		return 1
+	}
+	return int(c.PoolSize)
+}
+
+// GetMode returns the way the producer generates its tasks.
+func (w Workload) GetMode() string {
+	if w.Mode == "" {
+		return "random"
+	}
+	return w.Mode
+}
+
+// GetType returns the distribution of the task types, uniform over 0..9 when not configured.
+func (w Workload) GetType() Distribution {
+	if w.Type.Kind == "" {
+		return Distribution{Kind: "uniform", Min: 0, Max: MaxTaskType}
+	}
+	return w.Type
+}
+
+// GetValue returns the distribution of the task values, uniform over 0..99 when not configured.
+func (w Workload) GetValue() Distribution {
+	if w.Value.Kind == "" {
+		return Distribution{Kind: "uniform", Min: 0, Max: MaxTaskValue}
+	}
+	return w.Value
+}
+
+// GetMinRate returns the lowest adaptive rate.
+func (a Adaptive) GetMinRate() float64 {
+	if a.MinRate <= 0 {
+		return 1
+	}
+	return a.MinRate
+}
+
+// GetDecreaseFactor returns the factor applied to the rate after an overloaded window.
+func (a Adaptive) GetDecreaseFactor() float64 {
+	if a.DecreaseFactor <= 0 || a.DecreaseFactor >= 1 {
+		return 0.5
+	}
+	return a.DecreaseFactor
+}
+
+// GetLatencyTarget returns the average latency above which the rate is decreased.
+func (a Adaptive) GetLatencyTarget() time.Duration {
+	if a.LatencyTarget <= 0 {
+		return 100 * time.Millisecond
+	}
+	return a.LatencyTarget
+}
+
+// GetWindow returns the interval between two adjustments of the rate.
+func (a Adaptive) GetWindow() time.Duration {
+	if a.Window <= 0 {
+		return time.Second
+	}
+	return a.Window
+}
+
+// GetDir returns the directory of the spool segments.
+func (s Spool) GetDir() string {
+	if s.Dir == "" {
+		return "spool"
+	}
+	return s.Dir
+}
+
+// GetSegmentSize returns the size in bytes above which a new segment file is started.
+func (s Spool) GetSegmentSize() int64 {
+	if s.SegmentSize <= 0 {
+		return 64 << 20
+	}
+	return s.SegmentSize
+}
+
+// GetRetryBackoff returns the wait after the first failed send of a spooled task.
+func (s Spool) GetRetryBackoff() time.Duration {
+	if s.RetryBackoff <= 0 {
+		return 500 * time.Millisecond
+	}
+	return s.RetryBackoff
+}
+
+// GetMaxRetryBackoff returns the longest wait between two sends of a spooled task.
+func (s Spool) GetMaxRetryBackoff() time.Duration {
+	if s.MaxRetryBackoff <= 0 {
+		return 30 * time.Second
+	}
+	return s.MaxRetryBackoff
+}
+
+// GetProducerDrainTimeout returns the time spent sending the backlog on shutdown.
+func (c Configuration) GetProducerDrainTimeout() time.Duration {
+	if c.ProducerService.DrainTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return c.ProducerService.DrainTimeout
+}
+
+// GetStartRate returns the rate of the warm-up and the start of the ramp.
+func (l LoadTest) GetStartRate() float64 {
+	if l.StartRate <= 0 {
+		return l.Rate
+	}
+	return l.StartRate
+}
+
+// GetConcurrency returns the maximum number of requests in flight.
+func (l LoadTest) GetConcurrency() int {
+	if l.Concurrency == 0 {
+		return 64
+	}
+	return int(l.Concurrency)
+}
+
+// GetTimeout returns the deadline of each request.
+func (l LoadTest) GetTimeout() time.Duration {
+	if l.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return l.Timeout
+}
+
+// GetFormat returns the format of the replayed file.
+func (r Replay) GetFormat() string {
+	if r.Format != "" {
+		return r.Format
+	}
+	if strings.HasSuffix(strings.TrimSuffix(r.Path, ".gz"), ".csv") {
+		return "csv"
+	}
+	return "jsonl"
+}
+
+// GetSpeed returns the factor dividing the original inter-arrival times.
+func (r Replay) GetSpeed() float64 {
+	if r.Speed <= 0 {
+		return 1
+	}
+	return r.Speed
+}
+
+// GetBurst returns the burst of the namespace rate limiter.
+func (n NamespaceLimit) GetBurst() int {
+	if n.Burst == 0 {
+		return 1
+	}
+	return int(n.Burst)
+}
@@ -0,0 +1,463 @@
+package conf
+
+import (
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"go.uber.org/zap/zapcore"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldError describes a single invalid configuration value.
+type FieldError struct {
+	Field  string
+	Value  any
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s (got %v)", e.Field, e.Reason, e.Value)
+}
+
+// ValidationError holds every problem found by Configuration.Validate.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		problems = append(problems, fe.Error())
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+func (e *ValidationError) add(field string, value any, reason string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Value: value, Reason: reason})
+}
+
+// Validate checks the configuration and reports every problem found as a *ValidationError.
+func (c Configuration) Validate() error {
+	var v ValidationError
+
+	if c.ConsumerService.MessageConsumptionRate == 0 {
+		v.add("consumerService.messageConsumptionRate", c.ConsumerService.MessageConsumptionRate, "must be greater than zero")
+	}
+	if c.ConsumerService.HandlerTimeout < 0 {
+		v.add("consumerService.handlerTimeout", c.ConsumerService.HandlerTimeout, "must not be negative")
+	}
+	if c.ConsumerService.RecoveryInterval < 0 {
+		v.add("consumerService.recoveryInterval", c.ConsumerService.RecoveryInterval, "must not be negative")
+	}
+	if c.ConsumerService.RecoveryAge < 0 {
+		v.add("consumerService.recoveryAge", c.ConsumerService.RecoveryAge, "must not be negative")
+	}
+	validateLogging(&v, "consumerService", c.ConsumerService.LogLevel, c.ConsumerService.LogEncoding)
+	if dashboard := c.ConsumerService.Dashboard; dashboard.Enabled {
+		switch endpoint := dashboard.GetEndpoint(); {
+		case !strings.HasPrefix(endpoint, "/"):
+			v.add("consumerService.dashboard.endpoint", dashboard.Endpoint, "must start with /")
+		case strings.TrimSuffix(endpoint, "/") == strings.TrimSuffix(c.GetMetricsEndpoint(), "/"):
+			v.add("consumerService.dashboard.endpoint", dashboard.Endpoint, "must differ from metrics.endpoint")
+		}
+	}
+
+	if c.ProducerService.MessageProductionRate == 0 {
+		v.add("producerService.messageProductionRate", c.ProducerService.MessageProductionRate, "must be greater than zero")
+	}
+	if c.ProducerService.MaxBacklog == 0 {
+		v.add("producerService.maxBacklog", c.ProducerService.MaxBacklog, "must be greater than zero")
+	}
+	validateLogging(&v, "producerService", c.ProducerService.LogLevel, c.ProducerService.LogEncoding)
+	validateWorkload(&v, c.ProducerService.Workload)
+	validateLoadTest(&v, c.ProducerService.LoadTest)
+	if c.ProducerService.Adaptive.Enabled {
+		validateAdaptive(&v, c.ProducerService.Adaptive)
+	}
+	if c.ProducerService.Spool.SegmentSize < 0 {
+		v.add("producerService.spool.segmentSize", c.ProducerService.Spool.SegmentSize, "must not be negative")
+	}
+	if c.ProducerService.Spool.SyncInterval < 0 {
+		v.add("producerService.spool.syncInterval", c.ProducerService.Spool.SyncInterval, "must not be negative")
+	}
+
+	if c.Server.DrainTimeout < 0 {
+		v.add("server.drainTimeout", c.Server.DrainTimeout, "must not be negative")
+	}
+	validateHealth(&v, c.Server.Health)
+	validatePorts(&v, map[string]uint16{
+		"server.port":                   c.Server.Port,
+		"consumerService.metricsPort":   c.ConsumerService.MetricsPort,
+		"consumerService.profilingPort": c.ConsumerService.ProfilingPort,
+	})
+	validatePorts(&v, map[string]uint16{
+		"producerService.metricsPort":   c.ProducerService.MetricsPort,
+		"producerService.profilingPort": c.ProducerService.ProfilingPort,
+	})
+
+	switch c.Database.Engine {
+	case "", "postgres":
+		validatePostgres(&v, c.Database)
+	case "sqlite", "memory":
+	default:
+		v.add("database.engine", c.Database.Engine, "must be postgres, sqlite or memory")
+	}
+
+	switch {
+	case c.Metrics.Endpoint != "" && !strings.HasPrefix(c.Metrics.Endpoint, "/"):
+		v.add("metrics.endpoint", c.Metrics.Endpoint, "must start with /")
+	case c.Metrics.Endpoint == "/livez" || c.Metrics.Endpoint == "/readyz":
+		v.add("metrics.endpoint", c.Metrics.Endpoint, "must differ from the /livez and /readyz probes")
+	}
+
+	if c.Auth.Enabled && len(c.Auth.Tokens) == 0 {
+		v.add("auth.tokens", len(c.Auth.Tokens), "must not be empty when auth is enabled")
+	}
+	seen := make(map[string]bool, len(c.Auth.Tokens))
+	for i, token := range c.Auth.Tokens {
+		field := fmt.Sprintf("auth.tokens[%d]", i)
+		if token.Name == "" {
+			v.add(field+".name", token.Name, "must not be empty")
+		}
+		if token.Namespace != "" && !namespace.Valid(token.Namespace) {
+			v.add(field+".namespace", token.Namespace, "must be a valid namespace")
+		}
+		if token.Token == "" {
+			v.add(field+".token", "", "must not be empty")
+		} else if seen[token.Token] {
+			v.add(field+".token", "***", "must be unique")
+		}
+		seen[token.Token] = true
+	}
+
+	if c.Outbox.Enabled {
+		validateOutbox(&v, c.Outbox)
+	}
+	validateNamespaces(&v, c.Namespaces)
+	if c.Client.Namespace != "" && !namespace.Valid(c.Client.Namespace) {
+		v.add("client.namespace", c.Client.Namespace, "must be a valid namespace")
+	}
+	validateClient(&v, c.Client)
+
+	if len(v.Errors) > 0 {
+		return &v
+	}
+	return nil
+}
+
+// ValidateLoadTest checks the settings a `producer loadtest` run requires on top of the ones checked
+// by Validate, and reports every problem found as a *ValidationError.
+func (c Configuration) ValidateLoadTest() error {
+	var v ValidationError
+
+	if c.ProducerService.LoadTest.Duration <= 0 {
+		v.add("producerService.loadTest.duration", c.ProducerService.LoadTest.Duration, "must be greater than zero when running a load test")
+	}
+
+	if len(v.Errors) > 0 {
+		return &v
+	}
+	return nil
+}
+
+func validateOutbox(v *ValidationError, o Outbox) {
+	switch o.Sink {
+	case "webhook":
+		if u, err := url.Parse(o.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("outbox.webhook.url", o.Webhook.URL, "must be an http or https URL")
+		}
+	case "file":
+		if o.FilePath == "" {
+			v.add("outbox.filePath", o.FilePath, "must be set when the sink is file")
+		}
+	default:
+		v.add("outbox.sink", o.Sink, "must be webhook or file")
+	}
+	if o.Source == "" {
+		v.add("outbox.source", o.Source, "must not be empty")
+	}
+	for _, timeout := range []struct {
+		field string
+		value time.Duration
+	}{
+		{"outbox.pollInterval", o.PollInterval},
+		{"outbox.webhook.timeout", o.Webhook.Timeout},
+		{"outbox.webhook.backoff", o.Webhook.Backoff},
+	} {
+		if timeout.value < 0 {
+			v.add(timeout.field, timeout.value, "must not be negative")
+		}
+	}
+}
+
+func validateClient(v *ValidationError, c Client) {
+	if c.Target != "" && len(c.Endpoints) > 0 {
+		v.add("client.target", c.Target, "must not be set with client.endpoints")
+	}
+	for i, endpoint := range c.Endpoints {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			v.add(fmt.Sprintf("client.endpoints[%d]", i), endpoint, "must be a host:port address")
+		}
+	}
+	if policy := c.LoadBalancing.GetPolicy(); policy != "round_robin" && policy != "least_request" {
+		v.add("client.loadBalancing.policy", policy, "must be round_robin or least_request")
+	}
+	if c.LoadBalancing.OutlierDetection.MaxEjectionPercent > 100 {
+		v.add("client.loadBalancing.outlierDetection.maxEjectionPercent", c.LoadBalancing.OutlierDetection.MaxEjectionPercent, "must not exceed 100")
+	}
+	if c.Keepalive.Time != 0 && c.Keepalive.Time < 10*time.Second {
+		v.add("client.keepalive.time", c.Keepalive.Time, "must be at least 10s")
+	}
+	if c.CircuitBreaker.OpenTimeout < 0 {
+		v.add("client.circuitBreaker.openTimeout", c.CircuitBreaker.OpenTimeout, "must not be negative")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		v.add("client.tls.certFile", c.TLS.CertFile, "must be set together with client.tls.keyFile")
+	}
+}
+
+func validateWorkload(v *ValidationError, w Workload) {
+	switch w.GetMode() {
+	case "random":
+		validateDistribution(v, "producerService.workload.type", w.Type, MaxTaskType)
+		validateDistribution(v, "producerService.workload.value", w.Value, MaxTaskValue)
+		for i, mix := range w.TypeMix {
+			if mix.Type > MaxTaskType {
+				v.add(fmt.Sprintf("producerService.workload.typeMix[%d].type", i), mix.Type, fmt.Sprintf("must be between 0 and %d", MaxTaskType))
+			}
+			if mix.Weight <= 0 {
+				v.add(fmt.Sprintf("producerService.workload.typeMix[%d].weight", i), mix.Weight, "must be greater than zero")
+			}
+		}
+	case "replay":
+		if w.Replay.Path == "" {
+			v.add("producerService.workload.replay.path", w.Replay.Path, "must be set when the mode is replay")
+		}
+		if format := w.Replay.GetFormat(); format != "jsonl" && format != "csv" {
+			v.add("producerService.workload.replay.format", format, "must be jsonl or csv")
+		}
+		if w.Replay.Speed < 0 {
+			v.add("producerService.workload.replay.speed", w.Replay.Speed, "must not be negative")
+		}
+	default:
+		v.add("producerService.workload.mode", w.Mode, "must be random or replay")
+	}
+}
+
+func validateLoadTest(v *ValidationError, l LoadTest) {
+	if l.Rate < 0 {
+		v.add("producerService.loadTest.rate", l.Rate, "must not be negative")
+	}
+	if l.StartRate < 0 {
+		v.add("producerService.loadTest.startRate", l.StartRate, "must not be negative")
+	}
+	if l.SLO.MaxErrorRate < 0 || l.SLO.MaxErrorRate > 1 {
+		v.add("producerService.loadTest.slo.maxErrorRate", l.SLO.MaxErrorRate, "must be between 0 and 1")
+	}
+	for _, duration := range []struct {
+		field string
+		value time.Duration
+	}{
+		{"producerService.loadTest.rampUp", l.RampUp},
+		{"producerService.loadTest.warmUp", l.WarmUp},
+		{"producerService.loadTest.duration", l.Duration},
+		{"producerService.loadTest.timeout", l.Timeout},
+		{"producerService.loadTest.slo.p50", l.SLO.P50},
+		{"producerService.loadTest.slo.p90", l.SLO.P90},
+		{"producerService.loadTest.slo.p99", l.SLO.P99},
+		{"producerService.loadTest.slo.p999", l.SLO.P999},
+	} {
+		if duration.value < 0 {
+			v.add(duration.field, duration.value, "must not be negative")
+		}
+	}
+}
+
+func validateAdaptive(v *ValidationError, a Adaptive) {
+	if a.MinRate < 0 {
+		v.add("producerService.adaptive.minRate", a.MinRate, "must not be negative")
+	}
+	if a.MaxRate != 0 && a.MaxRate < a.GetMinRate() {
+		v.add("producerService.adaptive.maxRate", a.MaxRate, "must not be lower than minRate")
+	}
+	if a.Increase < 0 {
+		v.add("producerService.adaptive.increase", a.Increase, "must not be negative")
+	}
+	if a.DecreaseFactor < 0 || a.DecreaseFactor >= 1 {
+		v.add("producerService.adaptive.decreaseFactor", a.DecreaseFactor, "must be between 0 and 1")
+	}
+	if a.LatencyTarget < 0 {
+		v.add("producerService.adaptive.latencyTarget", a.LatencyTarget, "must not be negative")
+	}
+	if a.Window < 0 {
+		v.add("producerService.adaptive.window", a.Window, "must not be negative")
+	}
+}
+
+func validateHealth(v *ValidationError, h Health) {
+	if h.CheckInterval < 0 {
+		v.add("server.health.checkInterval", h.CheckInterval, "must not be negative")
+	}
+	if h.CheckTimeout < 0 {
+		v.add("server.health.checkTimeout", h.CheckTimeout, "must not be negative")
+	}
+	if h.CheckTimeout > h.GetCheckInterval() {
+		v.add("server.health.checkTimeout", h.CheckTimeout, "must not exceed checkInterval")
+	}
+	if h.BacklogSaturation < 0 || h.BacklogSaturation > 1 {
+		v.add("server.health.backlogSaturation", h.BacklogSaturation, "must be between 0 and 1")
+	}
+}
+
+// validateDistribution checks that the drawn values stay within 0 and limit, the bounds enforced by the database.
+func validateDistribution(v *ValidationError, field string, d Distribution, limit uint32) {
+	switch d.Kind {
+	case "":
+		return
+	case "constant":
+		if d.Constant > limit {
+			v.add(field+".constant", d.Constant, fmt.Sprintf("must be between 0 and %d", limit))
+		}
+		return
+	case "uniform":
+	case "zipf":
+		if d.Skew <= 1 {
+			v.add(field+".skew", d.Skew, "must be greater than one")
+		}
+	case "normal":
+		if d.StdDev < 0 {
+			v.add(field+".stdDev", d.StdDev, "must not be negative")
+		}
+	default:
+		v.add(field+".kind", d.Kind, "must be uniform, zipf, normal or constant")
+		return
+	}
+	if d.Min > limit {
+		v.add(field+".min", d.Min, fmt.Sprintf("must be between 0 and %d", limit))
+	}
+	if d.Max > limit {
+		v.add(field+".max", d.Max, fmt.Sprintf("must be between 0 and %d", limit))
+	} else if d.Max < d.Min {
+		v.add(field+".max", d.Max, "must not be lower than min")
+	}
+}
+
+func validateNamespaces(v *ValidationError, n Namespaces) {
+	seen := make(map[string]bool, len(n.Limits))
+	for i, limit := range n.Limits {
+		field := fmt.Sprintf("namespaces.limits[%d]", i)
+		if !namespace.Valid(limit.Name) {
+			v.add(field+".name", limit.Name, "must be a valid namespace")
+		} else if seen[limit.Name] {
+			v.add(field+".name", limit.Name, "must be unique")
+		}
+		seen[limit.Name] = true
+		if limit.RateLimit < 0 {
+			v.add(field+".rateLimit", limit.RateLimit, "must not be negative")
+		}
+		if limit.WorkerShare < 0 || limit.WorkerShare > 1 {
+			v.add(field+".workerShare", limit.WorkerShare, "must be between 0 and 1")
+		}
+	}
+}
+
+func validateLogging(v *ValidationError, service, level, encoding string) {
+	if _, err := zapcore.ParseLevel(level); err != nil {
+		v.add(service+".logLevel", level, "must be one of debug, info, warn, error, dpanic, panic or fatal")
+	}
+	if encoding != "json" && encoding != "console" {
+		v.add(service+".logEncoding", encoding, "must be json or console")
+	}
+}
+
+// validatePorts checks that the ports bound by a single process are set and do not conflict.
+func validatePorts(v *ValidationError, ports map[string]uint16) {
+	fields := make([]string, 0, len(ports))
+	for field := range ports {
+		fields = append(fields, field)
+	}
+	// Sort for stable error messages
+	sort.Strings(fields)
+
+	used := make(map[uint16]string, len(ports))
+	for _, field := range fields {
+		port := ports[field]
+		if port == 0 {
+			v.add(field, port, "must be set")
+			continue
+		}
+		if other, ok := used[port]; ok {
+			v.add(field, port, "conflicts with "+other)
+			continue
+		}
+		used[port] = field
+	}
+}
+
+func validatePostgres(v *ValidationError, db Database) {
+	switch db.SSLMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		v.add("database.sslMode", db.SSLMode, "must be disable, allow, prefer, require, verify-ca or verify-full")
+	}
+	for i, replica := range db.Replicas {
+		if replica.Host == "" && replica.DSN == "" {
+			v.add(fmt.Sprintf("database.replicas[%d].host", i), replica.Host, "must be set unless dsn is set")
+		}
+	}
+	if (db.SSLCert == "") != (db.SSLKey == "") {
+		v.add("database.sslKey", db.SSLKey != "", "must be set together with database.sslCert")
+	}
+	if db.MaxConns < 0 {
+		v.add("database.maxConns", db.MaxConns, "must not be negative")
+	}
+	if db.MinConns < 0 || (db.MaxConns > 0 && db.MinConns > db.MaxConns) {
+		v.add("database.minConns", db.MinConns, "must be between zero and database.maxConns")
+	}
+	for _, timeout := range []struct {
+		field string
+		value time.Duration
+	}{
+		{"database.maxConnLifetime", db.MaxConnLifetime},
+		{"database.maxConnIdleTime", db.MaxConnIdleTime},
+		{"database.connectTimeout", db.ConnectTimeout},
+		{"database.statementTimeout", db.StatementTimeout},
+		{"database.connectBackoff", db.ConnectBackoff},
+		{"database.maxReplicaLag", db.MaxReplicaLag},
+		{"database.replicaCheckInterval", db.ReplicaCheckInterval},
+		{"database.partitions.interval", db.Partitions.Interval},
+		{"database.partitions.checkInterval", db.Partitions.CheckInterval},
+		{"database.partitions.retention", db.Partitions.Retention},
+	} {
+		if timeout.value < 0 {
+			v.add(timeout.field, timeout.value, "must not be negative")
+		}
+	}
+	validatePartitions(v, db.Partitions)
+}
+
+func validatePartitions(v *ValidationError, p Partitions) {
+	if p.Interval%time.Second != 0 {
+		v.add("database.partitions.interval", p.Interval, "must be a whole number of seconds")
+	}
+	if p.Retention > 0 && p.Retention < p.GetInterval() {
+		v.add("database.partitions.retention", p.Retention, "must be zero or at least database.partitions.interval")
+	}
+	switch p.GetRetentionMode() {
+	case "drop":
+	case "archive":
+		if p.ArchiveDir == "" {
+			v.add("database.partitions.archiveDir", p.ArchiveDir, "must be set when retentionMode is archive")
+		}
+	default:
+		v.add("database.partitions.retentionMode", p.RetentionMode, "must be drop or archive")
+	}
+	switch p.GetArchiveFormat() {
+	case "jsonl", "csv":
+	default:
+		v.add("database.partitions.archiveFormat", p.ArchiveFormat, "must be jsonl or csv")
+	}
+}
@@ -0,0 +1,160 @@
+package conf
+
+import (
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+func TestConfigurationSuite(t *testing.T) {
+	suite.Run(t, new(ConfigurationTestSuite))
+}
+
+type ConfigurationTestSuite struct {
+	suite.Suite
+	cfg Configuration
+}
+
+func (suite *ConfigurationTestSuite) SetupTest() {
+	suite.cfg = Configuration{
+		Server:   Server{Port: 50051, DrainTimeout: 30 * time.Second},
+		Database: Database{Host: "localhost", Engine: "postgres"},
+		Metrics:  Metrics{Endpoint: "/metrics"},
+		ConsumerService: Consumer{
+			MessageConsumptionRate: 200,
+			LogLevel:               "info",
+			LogEncoding:            "json",
+			MetricsPort:            4040,
+			ProfilingPort:          6060,
+		},
+		ProducerService: Producer{
+			MessageProductionRate: 400,
+			MaxBacklog:            100,
+			LogLevel:              "debug",
+			LogEncoding:           "console",
+			MetricsPort:           4041,
+			ProfilingPort:         6061,
+		},
+		Auth: Auth{
+			Enabled: true,
+			Tokens:  []Token{{Name: "producer", Token: "producer-token"}},
+		},
+	}
+}
+
+func (suite *ConfigurationTestSuite) TestValidate_Valid() {
+	suite.Assert().NoError(suite.cfg.Validate())
+}
+
+func (suite *ConfigurationTestSuite) TestValidate_ReportsEveryProblem() {
+	suite.cfg.ConsumerService.MessageConsumptionRate = 0
+	suite.cfg.ConsumerService.LogLevel = "verbose"
+	suite.cfg.ConsumerService.MetricsPort = 50051
+	suite.cfg.Auth.Tokens = append(suite.cfg.Auth.Tokens, Token{Name: "copy", Token: "producer-token"})
+
+	err := suite.cfg.Validate()
+
+	var validationErr *ValidationError
+	suite.Require().True(errors.As(err, &validationErr))
+
+	fields := make([]string, 0, len(validationErr.Errors))
+	for _, fe := range validationErr.Errors {
+		fields = append(fields, fe.Field)
+	}
+	suite.Assert().ElementsMatch([]string{
+		"consumerService.messageConsumptionRate",
+		"consumerService.logLevel",
+		"server.port",
+		"auth.tokens[1].token",
+	}, fields)
+	suite.Assert().NotContains(err.Error(), "producer-token")
+}
+
+func (suite *ConfigurationTestSuite) TestValidate_Health() {
+	suite.cfg.Server.Health = Health{CheckInterval: time.Second, CheckTimeout: 5 * time.Second, BacklogSaturation: 1.5}
+
+	var validationErr *ValidationError
+	suite.Require().True(errors.As(suite.cfg.Validate(), &validationErr))
+	suite.Assert().Len(validationErr.Errors, 2)
+	suite.Assert().Equal("server.health.checkTimeout", validationErr.Errors[0].Field)
+	suite.Assert().Equal("server.health.backlogSaturation", validationErr.Errors[1].Field)
+}
+
+func (suite *ConfigurationTestSuite) TestValidate_Workload() {
+	suite.cfg.ProducerService.Workload = Workload{
+		Type:    Distribution{Kind: "zipf", Min: 0, Max: 9, Skew: 1},
+		Value:   Distribution{Kind: "uniform", Min: 10, Max: 1},
+		TypeMix: []TypeWeight{{Type: 1, Weight: 0}, {Type: 10, Weight: 1}},
+	}
+
+	err := suite.cfg.Validate()
+
+	var validationErr *ValidationError
+	suite.Require().True(errors.As(err, &validationErr))
+	fields := make([]string, 0, len(validationErr.Errors))
+	for _, fe := range validationErr.Errors {
+		fields = append(fields, fe.Field)
+	}
+	suite.Assert().ElementsMatch([]string{
+		"producerService.workload.type.skew",
+		"producerService.workload.value.max",
+		"producerService.workload.typeMix[0].weight",
+		"producerService.workload.typeMix[1].type",
+	}, fields)
+
+	// The drawn values must satisfy the bounds checked by the database
+	suite.cfg.ProducerService.Workload = Workload{
+		Type:  Distribution{Kind: "uniform", Min: 10, Max: 12},
+		Value: Distribution{Kind: "constant", Constant: 100},
+	}
+	err = suite.cfg.Validate()
+	suite.Require().True(errors.As(err, &validationErr))
+	suite.Assert().Len(validationErr.Errors, 3)
+	suite.Assert().ErrorContains(err, "producerService.workload.type.min")
+	suite.Assert().ErrorContains(err, "producerService.workload.type.max")
+	suite.Assert().ErrorContains(err, "producerService.workload.value.constant")
+
+	suite.cfg.ProducerService.Workload = Workload{Mode: "replay"}
+	suite.Assert().ErrorContains(suite.cfg.Validate(), "producerService.workload.replay.path")
+}
+
+func (suite *ConfigurationTestSuite) TestValidateLoadTest() {
+	suite.cfg.ProducerService.LoadTest = LoadTest{Rate: 100, Duration: time.Minute}
+	suite.Assert().NoError(suite.cfg.ValidateLoadTest())
+
+	// A load test without a duration is only rejected when it is run
+	suite.cfg.ProducerService.LoadTest.Duration = 0
+	suite.Assert().NoError(suite.cfg.Validate())
+	err := suite.cfg.ValidateLoadTest()
+	var validationErr *ValidationError
+	suite.Require().True(errors.As(err, &validationErr))
+	suite.Require().Len(validationErr.Errors, 1)
+	suite.Assert().Equal("producerService.loadTest.duration", validationErr.Errors[0].Field)
+}
+
+func (suite *ConfigurationTestSuite) TestChanges() {
+	updated := suite.cfg
+	updated.ConsumerService.LogLevel = "debug"
+	updated.Metrics.Collector.Interval = time.Minute
+	updated.Auth.Tokens = []Token{{Name: "producer", Token: "rotated"}}
+
+	suite.Assert().Empty(Changes(suite.cfg, suite.cfg))
+	suite.Assert().Equal([]string{
+		"consumerService.logLevel",
+		"metrics.collector.interval",
+		"auth.tokens",
+	}, Changes(suite.cfg, updated))
+}
+
+func (suite *ConfigurationTestSuite) TestReloadable_Split() {
+	reloadable := Reloadable{Live: []string{"consumerService.logLevel"}, Ignored: []string{"producerService."}}
+	updated := suite.cfg
+	updated.ConsumerService.LogLevel = "debug"
+	updated.ConsumerService.Workers = 4
+	updated.ProducerService.LogLevel = "info"
+
+	applied, restart := reloadable.Split(suite.cfg, updated)
+	suite.Assert().Equal([]string{"consumerService.logLevel"}, applied)
+	suite.Assert().Equal([]string{"consumerService.workers"}, restart)
+}
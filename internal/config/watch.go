@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	filesMu     sync.Mutex
+	configFiles []string
+	reloadMu    sync.Mutex
+)
+
+func setConfigFiles(files []string) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	configFiles = files
+}
+
+// Watch reloads the configuration whenever one of the files loaded by Read changes.
+// onChange is called with the reloaded and validated configuration, or with the error
+// that prevented it from being loaded. The previous configuration stays in effect on error.
+func Watch(onChange func(*Configuration, error)) {
+	filesMu.Lock()
+	files := configFiles
+	filesMu.Unlock()
+
+	for _, file := range files {
+		// Each file gets its own watcher, the reload itself merges every file through Read
+		w := viper.New()
+		w.SetConfigFile(file)
+		w.OnConfigChange(func(fsnotify.Event) {
+			reloadMu.Lock()
+			defer reloadMu.Unlock()
+			onChange(Read())
+		})
+		w.WatchConfig()
+	}
+}
+
+// Changes returns the keys of the settings that differ between old and new, e.g. "consumerService.logLevel".
+func Changes(old, new Configuration) []string {
+	return diff("", reflect.ValueOf(old), reflect.ValueOf(new), nil)
+}
+
+// Reloadable lists the settings applied by a running service. Changing any other setting requires
+// a restart, except for the settings under the Ignored prefixes, which the service does not use.
+type Reloadable struct {
+	Live    []string
+	Ignored []string
+}
+
+// Split returns the keys of the settings that differ between old and new, split between the ones
+// applied by the running service and the ones that require a restart.
+func (r Reloadable) Split(old, new Configuration) (applied, restart []string) {
+	for _, key := range Changes(old, new) {
+		switch {
+		case slices.Contains(r.Live, key):
+			applied = append(applied, key)
+		case !hasAnyPrefix(key, r.Ignored):
+			restart = append(restart, key)
+		}
+	}
+	return applied, restart
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func diff(prefix string, old, new reflect.Value, changes []string) []string {
+	if old.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			changes = append(changes, prefix)
+		}
+		return changes
+	}
+
+	for i := 0; i < old.NumField(); i++ {
+		key := lowerFirst(old.Type().Field(i).Name)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		changes = diff(key, old.Field(i), new.Field(i), changes)
+	}
+	return changes
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
@@ -0,0 +1,191 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/assets"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"github.com/hasanhakkaev/yqapp-demo/internal/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io/fs"
+	"net/http"
+	"strconv"
+)
+
+// recentTasks is the number of tasks listed by the dashboard.
+const recentTasks = 20
+
+var marshalOptions = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// Handler serves the dashboard page and the JSON API it polls. The API calls the task and admin
+// services like their gRPC RPCs and requires an admin token in the Authorization header.
+type Handler struct {
+	tasks  *service.TaskService
+	admin  *service.AdminService
+	logger *zap.Logger
+	mux    *http.ServeMux
+}
+
+// NewHandler initializes a new Handler serving the dashboard from its root path.
+func NewHandler(tasks *service.TaskService, admin *service.AdminService, logger *zap.Logger) *Handler {
+	static, err := fs.Sub(assets.DashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+
+	h := &Handler{tasks: tasks, admin: admin, logger: logger, mux: http.NewServeMux()}
+	h.mux.Handle("GET /", http.FileServerFS(static))
+	h.mux.HandleFunc("GET /api/stats", h.api(h.stats))
+	h.mux.HandleFunc("GET /api/tasks", h.api(h.listTasks))
+	h.mux.HandleFunc("GET /api/workers", h.api(h.workers))
+	h.mux.HandleFunc("GET /api/settings", h.api(h.settings))
+	h.mux.HandleFunc("GET /api/dead-letters", h.api(h.deadLetters))
+	h.mux.HandleFunc("POST /api/dead-letters/{id}/requeue", h.api(h.requeue))
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// api authenticates the request with the admin token and writes the message returned by call as JSON.
+func (h *Handler) api(call func(ctx context.Context, r *http.Request) (proto.Message, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := metadata.NewIncomingContext(r.Context(), metadata.Pairs("authorization", r.Header.Get("Authorization")))
+		ctx, err := h.admin.AuthFuncOverride(ctx, "")
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+
+		message, err := call(ctx, r)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		body, err := marshalOptions.Marshal(message)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// withNamespace scopes ctx to the namespace query parameter, every namespace when it is empty.
+// Admins bound to a namespace always see their own. The identity is bound to the namespace too,
+// which scopes the dead letters and in-flight tasks of the admin service.
+func withNamespace(ctx context.Context, r *http.Request) (context.Context, error) {
+	ns := r.URL.Query().Get("namespace")
+	if ns != "" && !namespace.Valid(ns) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid namespace %q", ns)
+	}
+	if identity, ok := auth.FromContext(ctx); ok {
+		if identity.Namespace != "" {
+			if ns != "" && ns != identity.Namespace {
+				return nil, status.Errorf(codes.PermissionDenied, "access to namespace %q denied", ns)
+			}
+			ns = identity.Namespace
+		}
+		identity.Namespace = ns
+		ctx = auth.NewContext(ctx, identity)
+	}
+	return namespace.NewContext(ctx, ns), nil
+}
+
+func (h *Handler) stats(ctx context.Context, r *http.Request) (proto.Message, error) {
+	ctx, err := withNamespace(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return h.tasks.GetTaskStats(ctx, &v1.GetTaskStatsRequest{})
+}
+
+func (h *Handler) listTasks(ctx context.Context, r *http.Request) (proto.Message, error) {
+	ctx, err := withNamespace(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	request := &v1.ListTasksRequest{PageSize: recentTasks, NewestFirst: true}
+	if state := r.URL.Query().Get("state"); state != "" {
+		value, ok := v1.TaskState_value[state]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown task state %q", state)
+		}
+		request.State = v1.TaskState(value).Enum()
+	}
+	return h.tasks.ListTasks(ctx, request)
+}
+
+func (h *Handler) workers(ctx context.Context, r *http.Request) (proto.Message, error) {
+	ctx, err := withNamespace(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return h.admin.ListInFlightTasks(ctx, &v1.ListInFlightTasksRequest{})
+}
+
+func (h *Handler) settings(ctx context.Context, _ *http.Request) (proto.Message, error) {
+	return h.admin.GetSettings(ctx, &v1.GetSettingsRequest{})
+}
+
+func (h *Handler) deadLetters(ctx context.Context, r *http.Request) (proto.Message, error) {
+	ctx, err := withNamespace(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	return h.admin.ListDeadLetters(ctx, &v1.ListDeadLettersRequest{})
+}
+
+func (h *Handler) requeue(ctx context.Context, r *http.Request) (proto.Message, error) {
+	ctx, err := withNamespace(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid task id")
+	}
+	return h.admin.RequeueDeadLetter(ctx, &v1.RequeueDeadLetterRequest{Id: uint32(id)})
+}
+
+// writeError writes the gRPC status of err as JSON with the matching HTTP status code.
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code := httpStatus(st.Code())
+	if code == http.StatusInternalServerError {
+		h.logger.Error("Dashboard request failed", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"code": st.Code().String(), "message": st.Message()})
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,139 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/service"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDashboardSuite(t *testing.T) {
+	suite.Run(t, new(DashboardTestSuite))
+}
+
+type DashboardTestSuite struct {
+	suite.Suite
+	store  *store.Memory
+	server *httptest.Server
+}
+
+func (suite *DashboardTestSuite) SetupTest() {
+	logger := zap.NewNop()
+	suite.store = store.NewMemory()
+
+	tasks, err := service.NewTaskService(logger, suite.store, noop.NewMeterProvider().Meter(""), make(chan *domain.Task, 10), nil)
+	suite.Require().NoError(err)
+	authenticator := auth.NewAuthenticator(conf.Auth{Tokens: []conf.Token{
+		{Name: "operator", Token: "admin-token", Admin: true},
+		{Name: "team-a-operator", Token: "team-a-admin-token", Admin: true, Namespace: "team-a"},
+		{Name: "producer", Token: "producer-token"},
+	}})
+	admin := service.NewAdminService(logger, suite.store, tasks, authenticator, "replica-1", service.Settings{Workers: 1})
+
+	suite.server = httptest.NewServer(NewHandler(tasks, admin, logger))
+}
+
+func (suite *DashboardTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.Require().NoError(suite.store.Close())
+}
+
+func (suite *DashboardTestSuite) get(path, token string) *http.Response {
+	request, err := http.NewRequest(http.MethodGet, suite.server.URL+path, nil)
+	suite.Require().NoError(err)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := suite.server.Client().Do(request)
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = response.Body.Close() })
+	return response
+}
+
+func (suite *DashboardTestSuite) TestIndex() {
+	response := suite.get("/", "")
+	suite.Assert().Equal(http.StatusOK, response.StatusCode)
+	body, err := io.ReadAll(response.Body)
+	suite.Require().NoError(err)
+	suite.Assert().Contains(string(body), "app.js")
+}
+
+func (suite *DashboardTestSuite) TestAPI_RequiresAdmin() {
+	suite.Assert().Equal(http.StatusUnauthorized, suite.get("/api/stats", "").StatusCode)
+	suite.Assert().Equal(http.StatusUnauthorized, suite.get("/api/stats", "unknown").StatusCode)
+	suite.Assert().Equal(http.StatusForbidden, suite.get("/api/stats", "producer-token").StatusCode)
+}
+
+func (suite *DashboardTestSuite) TestStats() {
+	now := time.Now()
+	for _, task := range []*domain.Task{
+		{Namespace: "team-a", Type: 1, Value: 2, State: domain.StateRECEIVED, CreationTime: now, LastUpdateTime: now},
+		{Namespace: "team-b", Type: 1, Value: 3, State: domain.StateDONE, CreationTime: now, LastUpdateTime: now},
+	} {
+		_, err := suite.store.CreateTask(context.Background(), task)
+		suite.Require().NoError(err)
+	}
+
+	var stats struct {
+		Counts     map[string]string `json:"counts"`
+		TypeCounts map[string]string `json:"type_counts"`
+	}
+	response := suite.get("/api/stats", "admin-token")
+	suite.Require().Equal(http.StatusOK, response.StatusCode)
+	suite.Require().NoError(json.NewDecoder(response.Body).Decode(&stats))
+	suite.Assert().Equal("1", stats.Counts["RECEIVED"])
+	suite.Assert().Equal("1", stats.Counts["DONE"])
+	suite.Assert().Equal(map[string]string{"1": "2"}, stats.TypeCounts)
+
+	response = suite.get("/api/stats?namespace=team-b", "admin-token")
+	suite.Require().Equal(http.StatusOK, response.StatusCode)
+	suite.Require().NoError(json.NewDecoder(response.Body).Decode(&stats))
+	suite.Assert().Equal(map[string]string{"1": "1"}, stats.TypeCounts)
+
+	suite.Assert().Equal(http.StatusBadRequest, suite.get("/api/stats?namespace=Team_B", "admin-token").StatusCode)
+}
+
+func (suite *DashboardTestSuite) requeue(path, token string) *http.Response {
+	request, err := http.NewRequest(http.MethodPost, suite.server.URL+path, nil)
+	suite.Require().NoError(err)
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := suite.server.Client().Do(request)
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = response.Body.Close() })
+	return response
+}
+
+func (suite *DashboardTestSuite) TestRequeue_NotDeadLettered() {
+	suite.Assert().Equal(http.StatusNotFound, suite.requeue("/api/dead-letters/42/requeue", "admin-token").StatusCode)
+}
+
+func (suite *DashboardTestSuite) TestAdminAPI_Namespace() {
+	for _, path := range []string{"/api/workers", "/api/dead-letters"} {
+		suite.Assert().Equal(http.StatusOK, suite.get(path+"?namespace=team-b", "admin-token").StatusCode, path)
+		suite.Assert().Equal(http.StatusOK, suite.get(path, "team-a-admin-token").StatusCode, path)
+		suite.Assert().Equal(http.StatusForbidden, suite.get(path+"?namespace=team-b", "team-a-admin-token").StatusCode, path)
+		suite.Assert().Equal(http.StatusBadRequest, suite.get(path+"?namespace=Team_B", "admin-token").StatusCode, path)
+	}
+	suite.Assert().Equal(http.StatusForbidden, suite.requeue("/api/dead-letters/42/requeue?namespace=team-b", "team-a-admin-token").StatusCode)
+	suite.Assert().Equal(http.StatusNotFound, suite.requeue("/api/dead-letters/42/requeue", "team-a-admin-token").StatusCode)
+}
+
+func (suite *DashboardTestSuite) TestWithNamespace_BindsIdentity() {
+	request := httptest.NewRequest(http.MethodGet, "/api/dead-letters?namespace=team-b", nil)
+	ctx, err := withNamespace(auth.NewContext(context.Background(), auth.Identity{Name: "operator", Admin: true}), request)
+	suite.Require().NoError(err)
+	identity, ok := auth.FromContext(ctx)
+	suite.Require().True(ok)
+	suite.Assert().Equal(auth.Identity{Name: "operator", Admin: true, Namespace: "team-b"}, identity)
+}
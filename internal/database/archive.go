@@ -0,0 +1,124 @@
+package database
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// archivedTask is the JSON representation of an archived task.
+type archivedTask struct {
+	ID             int32      `json:"id"`
+	Type           uint32     `json:"type"`
+	Value          uint32     `json:"value"`
+	State          State      `json:"state"`
+	CreationTime   time.Time  `json:"creation_time"`
+	LastUpdateTime time.Time  `json:"last_update_time"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	Namespace      string     `json:"namespace"`
+}
+
+var archiveColumns = []string{"id", "type", "value", "state", "creation_time", "last_update_time", "started_at", "finished_at", "namespace"}
+
+// Archive writes tasks to a gzip compressed JSONL or CSV file. The file is written next to its
+// final path and only renamed to it by Close, so that an interrupted archive is never mistaken for a complete one.
+type Archive struct {
+	path   string
+	file   *os.File
+	gzip   *gzip.Writer
+	write  func(Task) error
+	flush  func() error
+	closed bool
+}
+
+// CreateArchive creates the archive at the given path in the jsonl or csv format,
+// creating its directory if needed.
+func CreateArchive(path, format string) (*Archive, error) {
+	if format != "jsonl" && format != "csv" {
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archive{path: path, file: file, gzip: gzip.NewWriter(file)}
+	switch format {
+	case "jsonl":
+		encoder := json.NewEncoder(a.gzip)
+		a.write = func(task Task) error {
+			return encoder.Encode(archivedTask(task))
+		}
+		a.flush = func() error { return nil }
+	case "csv":
+		writer := csv.NewWriter(a.gzip)
+		if err := writer.Write(archiveColumns); err != nil {
+			a.Abort()
+			return nil, err
+		}
+		a.write = func(task Task) error {
+			return writer.Write([]string{
+				strconv.FormatInt(int64(task.ID), 10),
+				strconv.FormatUint(uint64(task.Type), 10),
+				strconv.FormatUint(uint64(task.Value), 10),
+				string(task.State),
+				formatTime(&task.CreationTime),
+				formatTime(&task.LastUpdateTime),
+				formatTime(task.StartedAt),
+				formatTime(task.FinishedAt),
+				task.Namespace,
+			})
+		}
+		a.flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	}
+	return a, nil
+}
+
+// Write appends a task to the archive.
+func (a *Archive) Write(task Task) error {
+	return a.write(task)
+}
+
+// Close completes the archive and moves it to its final path.
+func (a *Archive) Close() error {
+	err := errors.Join(a.flush(), a.gzip.Close(), a.file.Sync(), a.file.Close())
+	a.closed = true
+	if err == nil {
+		err = os.Rename(a.file.Name(), a.path)
+	}
+	if err != nil {
+		_ = os.Remove(a.file.Name())
+	}
+	return err
+}
+
+// Abort discards an archive which has not been closed.
+func (a *Archive) Abort() {
+	if a.closed {
+		return
+	}
+	a.closed = true
+	_ = a.file.Close()
+	_ = os.Remove(a.file.Name())
+}
+
+// formatTime formats a time of a CSV archive in UTC, a missing time is left empty.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
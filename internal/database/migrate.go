@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/hasanhakkaev/yqapp-demo/assets"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"io/fs"
+)
+
+// Migration describes a single migration embedded in assets.EmbeddedFiles.
+type Migration struct {
+	Version uint
+	Name    string
+	Applied bool
+}
+
+// MigrationStatus describes the migration state of a database.
+type MigrationStatus struct {
+	// Version is the last applied migration, zero if none has been applied.
+	Version uint
+	// Dirty reports a migration that failed halfway and must be fixed with Force.
+	Dirty      bool
+	Migrations []Migration
+}
+
+// Migrator applies the migrations embedded in assets.EmbeddedFiles.
+type Migrator struct {
+	migrate *migrate.Migrate
+}
+
+// NewMigrator initializes a new Migrator for the database described by the given configuration,
+// e.g. the ConnConfig of NewPoolConfig.
+func NewMigrator(connConfig *pgx.ConnConfig) (*Migrator, error) {
+	fsDriver, err := iofs.New(assets.EmbeddedFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	db := stdlib.OpenDB(*connConfig)
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", fsDriver, "postgres", driver)
+	if err != nil {
+		_ = driver.Close()
+		return nil, err
+	}
+	return &Migrator{migrate: m}, nil
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up() error {
+	return ignoreNoChange(m.migrate.Up())
+}
+
+// Down rolls back the given number of applied migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be greater than zero, got %d", steps)
+	}
+	return ignoreNoChange(m.migrate.Steps(-steps))
+}
+
+// Force sets the migration version without running any migration and clears the dirty flag.
+// Use -1 to mark the database as not migrated.
+func (m *Migrator) Force(version int) error {
+	return m.migrate.Force(version)
+}
+
+// Status returns the applied version and every embedded migration.
+func (m *Migrator) Status() (MigrationStatus, error) {
+	var status MigrationStatus
+
+	version, dirty, err := m.migrate.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+	case err != nil:
+		return MigrationStatus{}, err
+	default:
+		status.Version, status.Dirty = version, dirty
+	}
+
+	status.Migrations, err = EmbeddedMigrations()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	for i := range status.Migrations {
+		status.Migrations[i].Applied = status.Migrations[i].Version <= status.Version
+	}
+	return status, nil
+}
+
+// Close releases the connections held by the Migrator.
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.migrate.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+// EmbeddedMigrations lists the migrations embedded in assets.EmbeddedFiles in order.
+func EmbeddedMigrations() ([]Migration, error) {
+	src, err := iofs.New(assets.EmbeddedFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var migrations []Migration
+	version, err := src.First()
+	for err == nil {
+		var name string
+		name, err = readUpIdentifier(src, version)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name})
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return migrations, nil
+}
+
+// AppliedMigration returns the last migration applied to the database of pool and whether it is dirty,
+// zero if none has been applied. Unlike Migrator.Status it reuses the connections of the pool.
+func AppliedMigration(ctx context.Context, pool *pgxpool.Pool) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(version), dirty, nil
+}
+
+func readUpIdentifier(src source.Driver, version uint) (string, error) {
+	r, identifier, err := src.ReadUp(version)
+	if err != nil {
+		return "", err
+	}
+	return identifier, r.Close()
+}
+
+// MigrateModels migrates the domain models using the given DB connection.
+func MigrateModels(connConfig *pgx.ConnConfig) error {
+	migrator, err := NewMigrator(connConfig)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	return migrator.Up()
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
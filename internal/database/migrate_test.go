@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMigrationsSuite(t *testing.T) {
+	suite.Run(t, new(MigrationsTestSuite))
+}
+
+type MigrationsTestSuite struct {
+	testServer
+}
+
+// testServer creates the databases of the tests on a PostgreSQL server, the tests requiring it are
+// skipped when it is not reachable.
+type testServer struct {
+	suite.Suite
+	server      string
+	admin       *pgxpool.Pool
+	unreachable error
+}
+
+// schemaQueries describe the parts of a schema compared between the migrations and sql/schema.sql.
+// Columns are compared by name, their position does not affect the generated code.
+var schemaQueries = map[string]string{
+	"columns": `SELECT table_name, column_name, data_type, udt_name, is_nullable, COALESCE(column_default, '')
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name <> 'schema_migrations'
+		ORDER BY table_name, column_name`,
+	"enums": `SELECT t.typname, e.enumlabel
+		FROM pg_type t JOIN pg_enum e ON e.enumtypid = t.oid
+		ORDER BY t.typname, e.enumsortorder`,
+	"indexes": `SELECT tablename, indexname, indexdef
+		FROM pg_indexes
+		WHERE schemaname = 'public' AND tablename <> 'schema_migrations'
+		ORDER BY tablename, indexname`,
+	"constraints": `SELECT conrelid::regclass::text, conname, pg_get_constraintdef(oid)
+		FROM pg_constraint
+		WHERE connamespace = 'public'::regnamespace AND conrelid::regclass::text <> 'schema_migrations'
+		ORDER BY 1, 2`,
+}
+
+func (suite *testServer) SetupSuite() {
+	// user:password@host:port of a PostgreSQL server allowed to create databases
+	suite.server = os.Getenv("TEST_DATABASE_SERVER")
+	if suite.server == "" {
+		suite.server = "postgres:postgres@localhost:5432"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var err error
+	suite.admin, err = pgxpool.New(ctx, suite.dsn("postgres"))
+	suite.Require().NoError(err)
+	suite.unreachable = suite.admin.Ping(ctx)
+}
+
+// requireServer skips the test when no PostgreSQL server is reachable.
+func (suite *testServer) requireServer() {
+	if suite.unreachable != nil {
+		suite.T().Skipf("PostgreSQL is not reachable at %s: %v", suite.server, suite.unreachable)
+	}
+}
+
+func (suite *testServer) TearDownSuite() {
+	suite.admin.Close()
+}
+
+func (suite *testServer) dsn(database string) string {
+	return "postgres://" + suite.server + "/" + database + "?sslmode=disable"
+}
+
+// createDatabase creates an empty database dropped at the end of the test.
+func (suite *testServer) createDatabase(name string) *pgxpool.Pool {
+	ctx := context.Background()
+	_, err := suite.admin.Exec(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", name))
+	suite.Require().NoError(err)
+	_, err = suite.admin.Exec(ctx, fmt.Sprintf("CREATE DATABASE %s", name))
+	suite.Require().NoError(err)
+
+	pool, err := pgxpool.New(ctx, suite.dsn(name))
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() {
+		pool.Close()
+		_, _ = suite.admin.Exec(context.Background(), fmt.Sprintf("DROP DATABASE IF EXISTS %s", name))
+	})
+	return pool
+}
+
+func (suite *testServer) newMigrator(database string) *Migrator {
+	connConfig, err := pgx.ParseConfig(suite.dsn(database))
+	suite.Require().NoError(err)
+	migrator, err := NewMigrator(connConfig)
+	suite.Require().NoError(err)
+	return migrator
+}
+
+func (suite *MigrationsTestSuite) describe(pool *pgxpool.Pool) map[string][][]any {
+	description := make(map[string][][]any, len(schemaQueries))
+	for name, query := range schemaQueries {
+		rows, err := pool.Query(context.Background(), query)
+		suite.Require().NoError(err)
+		for rows.Next() {
+			values, err := rows.Values()
+			suite.Require().NoError(err)
+			description[name] = append(description[name], values)
+		}
+		suite.Require().NoError(rows.Err())
+	}
+	return description
+}
+
+func (suite *MigrationsTestSuite) TestEmbeddedMigrations() {
+	migrations, err := EmbeddedMigrations()
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(migrations)
+	for i, m := range migrations {
+		suite.Assert().Equal(uint(i+1), m.Version)
+		suite.Assert().NotEmpty(m.Name)
+	}
+}
+
+func (suite *MigrationsTestSuite) TestMigrationsMatchSchema() {
+	suite.requireServer()
+	migrated := suite.createDatabase("yqapp_check_migrations")
+	generated := suite.createDatabase("yqapp_check_schema")
+
+	migrator := suite.newMigrator("yqapp_check_migrations")
+	defer migrator.Close()
+	suite.Require().NoError(migrator.Up())
+
+	schema, err := os.ReadFile("../../sql/schema.sql")
+	suite.Require().NoError(err)
+	_, err = generated.Exec(context.Background(), string(schema))
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(suite.describe(generated), suite.describe(migrated))
+}
+
+func (suite *MigrationsTestSuite) TestDownAndUp() {
+	suite.requireServer()
+	suite.createDatabase("yqapp_check_steps")
+
+	migrator := suite.newMigrator("yqapp_check_steps")
+	defer migrator.Close()
+
+	suite.Require().NoError(migrator.Up())
+	status, err := migrator.Status()
+	suite.Require().NoError(err)
+	latest := status.Migrations[len(status.Migrations)-1].Version
+	suite.Assert().Equal(latest, status.Version)
+
+	suite.Require().NoError(migrator.Down(len(status.Migrations)))
+	status, err = migrator.Status()
+	suite.Require().NoError(err)
+	suite.Assert().Zero(status.Version)
+
+	suite.Require().NoError(migrator.Up())
+}
@@ -7,6 +7,9 @@ package database
 import (
 	"database/sql/driver"
 	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type State string
@@ -15,6 +18,7 @@ const (
 	StateRECEIVED   State = "RECEIVED"
 	StatePROCESSING State = "PROCESSING"
 	StateDONE       State = "DONE"
+	StateCANCELLED  State = "CANCELLED"
 )
 
 func (e *State) Scan(src interface{}) error {
@@ -52,11 +56,41 @@ func (ns NullState) Value() (driver.Value, error) {
 	return string(ns.State), nil
 }
 
+type ConsumerSetting struct {
+	ID        int32
+	Paused    bool
+	RateLimit pgtype.Float8
+	Burst     pgtype.Int4
+	Workers   pgtype.Int4
+	Version   int64
+	UpdatedAt time.Time
+}
+
+type IdempotencyKey struct {
+	Namespace string
+	Key       string
+	TaskID    int32
+	CreatedAt time.Time
+}
+
+type Outbox struct {
+	ID        int64
+	EventType string
+	TaskID    int32
+	Data      []byte
+	CreatedAt time.Time
+	Attempts  int32
+	LastError pgtype.Text
+}
+
 type Task struct {
 	ID             int32
 	Type           uint32
 	Value          uint32
 	State          State
-	CreationTime   float64
-	LastUpdateTime float64
+	CreationTime   time.Time
+	LastUpdateTime time.Time
+	StartedAt      *time.Time
+	FinishedAt     *time.Time
+	Namespace      string
 }
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// partitionsLockKey is the advisory lock serializing the partition changes of the consumer replicas.
+const partitionsLockKey int64 = 0x7461736b73 // "tasks"
+
+// Partition is a partition of the tasks table holding the tasks created in [From, To).
+// From is zero and To is maxBound for unbounded ranges.
+type Partition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// maxBound stands for the MAXVALUE bound of a partition.
+var maxBound = time.Unix(1<<62, 0)
+
+// Partitioner creates the partitions of the tasks table ahead of time and retires
+// the partitions older than the retention.
+type Partitioner struct {
+	pool   *pgxpool.Pool
+	cfg    conf.Partitions
+	logger *zap.Logger
+}
+
+// NewPartitioner initializes a new Partitioner of the tasks table.
+func NewPartitioner(pool *pgxpool.Pool, cfg conf.Partitions, logger *zap.Logger) *Partitioner {
+	return &Partitioner{pool: pool, cfg: cfg, logger: logger}
+}
+
+// Run maintains the partitions every check interval until ctx is done.
+func (p *Partitioner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.GetCheckInterval())
+	defer ticker.Stop()
+	for {
+		if err := p.Maintain(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			p.logger.Error("Failed to maintain the tasks partitions", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Maintain creates the missing partitions and retires the expired ones.
+func (p *Partitioner) Maintain(ctx context.Context, now time.Time) error {
+	return errors.Join(p.CreatePartitions(ctx, now), p.RetirePartitions(ctx, now))
+}
+
+// CreatePartitions creates the current partition, the configured number of future partitions and
+// the partitions of the tasks held by the default partition, moving these tasks to their partition.
+func (p *Partitioner) CreatePartitions(ctx context.Context, now time.Time) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", partitionsLockKey); err != nil {
+			return err
+		}
+		existing, err := listPartitions(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		// Slots are numbered from the Unix epoch
+		step := int64(p.cfg.GetInterval() / time.Second)
+		current := now.Unix() / step
+		slots := make([]int64, 0, p.cfg.Premake+1)
+		for i := int64(0); i <= int64(p.cfg.Premake); i++ {
+			slots = append(slots, current+i)
+		}
+
+		rows, err := tx.Query(ctx, "SELECT DISTINCT floor(extract(EPOCH FROM creation_time) / $1)::bigint FROM tasks_default", step)
+		if err != nil {
+			return err
+		}
+		defaults, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return err
+		}
+		slots = append(slots, defaults...)
+		sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+
+		for _, slot := range slots {
+			slotEnd := time.Unix((slot+1)*step, 0).UTC()
+			for from := time.Unix(slot*step, 0).UTC(); from.Before(slotEnd); {
+				start, end := clipPartition(from, slotEnd, existing)
+				if !start.Before(end) {
+					break
+				}
+				partition := Partition{Name: partitionName(start), From: start, To: end}
+				moved, err := createPartition(ctx, tx, partition)
+				if err != nil {
+					return fmt.Errorf("creating partition %s: %w", partition.Name, err)
+				}
+				p.logger.Info("Created tasks partition",
+					zap.String("partition", partition.Name),
+					zap.Time("from", partition.From),
+					zap.Time("to", partition.To),
+					zap.Int64("moved_tasks", moved),
+				)
+				existing = insertPartition(existing, partition)
+				from = end
+			}
+		}
+		return nil
+	})
+}
+
+// createPartition creates the partition and moves the matching tasks of the default partition to it,
+// attaching a partition fails if the default partition holds tasks in its range.
+func createPartition(ctx context.Context, tx pgx.Tx, partition Partition) (int64, error) {
+	name := pgx.Identifier{partition.Name}.Sanitize()
+	if _, err := tx.Exec(ctx, "CREATE TABLE "+name+" (LIKE tasks INCLUDING DEFAULTS INCLUDING CONSTRAINTS)"); err != nil {
+		return 0, err
+	}
+	moved, err := tx.Exec(ctx,
+		"WITH moved AS (DELETE FROM tasks_default WHERE creation_time >= $1 AND creation_time < $2 RETURNING *) INSERT INTO "+name+" SELECT * FROM moved",
+		partition.From, partition.To,
+	)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf("ALTER TABLE tasks ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+		name, partition.From.UTC().Format(time.RFC3339Nano), partition.To.UTC().Format(time.RFC3339Nano)))
+	return moved.RowsAffected(), err
+}
+
+// RetirePartitions drops the partitions whose tasks are all older than the retention, archiving
+// their tasks first in archive mode. Partitions still holding unfinished tasks are kept. The
+// idempotency keys older than the retention are removed along.
+func (p *Partitioner) RetirePartitions(ctx context.Context, now time.Time) error {
+	if p.cfg.Retention <= 0 {
+		return nil
+	}
+	partitions, err := p.Partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-p.cfg.Retention)
+	var errs []error
+	if _, err := p.pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", cutoff); err != nil {
+		errs = append(errs, fmt.Errorf("removing expired idempotency keys: %w", err))
+	}
+	for _, partition := range partitions {
+		if partition.To.After(cutoff) {
+			break
+		}
+		if err := p.retirePartition(ctx, partition); err != nil {
+			errs = append(errs, fmt.Errorf("retiring partition %s: %w", partition.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Partitioner) retirePartition(ctx context.Context, partition Partition) error {
+	name := pgx.Identifier{partition.Name}.Sanitize()
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", partitionsLockKey); err != nil {
+			return err
+		}
+		// Block the changes to the tasks of the partition until it is dropped
+		if _, err := tx.Exec(ctx, "LOCK TABLE "+name+" IN SHARE MODE"); err != nil {
+			return err
+		}
+
+		var unfinished int64
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM "+name+" WHERE state NOT IN ('DONE', 'CANCELLED')").Scan(&unfinished); err != nil {
+			return err
+		}
+		if unfinished > 0 {
+			p.logger.Warn("Keeping expired tasks partition holding unfinished tasks",
+				zap.String("partition", partition.Name), zap.Int64("unfinished_tasks", unfinished))
+			return nil
+		}
+
+		var archived int64
+		if p.cfg.GetRetentionMode() == "archive" {
+			var err error
+			if archived, err = p.archivePartition(ctx, tx, partition); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(ctx, "DROP TABLE "+name); err != nil {
+			return err
+		}
+		p.logger.Info("Dropped expired tasks partition",
+			zap.String("partition", partition.Name),
+			zap.Time("to", partition.To),
+			zap.Int64("archived_tasks", archived),
+		)
+		return nil
+	})
+}
+
+// archivePartition writes the DONE and CANCELLED tasks of the partition to a compressed file of the archive directory.
+func (p *Partitioner) archivePartition(ctx context.Context, tx pgx.Tx, partition Partition) (int64, error) {
+	format := p.cfg.GetArchiveFormat()
+	path := filepath.Join(p.cfg.ArchiveDir, partition.Name+"."+format+".gz")
+	archive, err := CreateArchive(path, format)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Abort()
+
+	rows, err := tx.Query(ctx, "SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace FROM "+
+		pgx.Identifier{partition.Name}.Sanitize()+" WHERE state IN ('DONE', 'CANCELLED') ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var archived int64
+	for rows.Next() {
+		var task Task
+		if err := rows.Scan(&task.ID, &task.Type, &task.Value, &task.State, &task.CreationTime, &task.LastUpdateTime, &task.StartedAt, &task.FinishedAt, &task.Namespace); err != nil {
+			return 0, err
+		}
+		if err := archive.Write(task); err != nil {
+			return 0, err
+		}
+		archived++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return archived, archive.Close()
+}
+
+// Partitions returns the partitions of the tasks table ordered by range, without the default partition.
+func (p *Partitioner) Partitions(ctx context.Context) ([]Partition, error) {
+	return listPartitions(ctx, p.pool)
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// listPartitions reads the partitions bounds through the catalog. The bounds are cast by the server,
+// so that they do not depend on the TimeZone and DateStyle of the session, MINVALUE and MAXVALUE are NULL.
+func listPartitions(ctx context.Context, db querier) ([]Partition, error) {
+	rows, err := db.Query(ctx, `
+SELECT c.relname,
+       (regexp_match(b.bound, 'FROM \(''([^'']*)''\)'))[1]::timestamptz,
+       (regexp_match(b.bound, 'TO \(''([^'']*)''\)'))[1]::timestamptz
+FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+CROSS JOIN LATERAL (SELECT pg_get_expr(c.relpartbound, c.oid) AS bound) b
+WHERE i.inhparent = 'tasks'::regclass AND b.bound <> 'DEFAULT'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var name string
+		var from, to *time.Time
+		if err := rows.Scan(&name, &from, &to); err != nil {
+			return nil, err
+		}
+		partition := Partition{Name: name, To: maxBound}
+		if from != nil {
+			partition.From = *from
+		}
+		if to != nil {
+			partition.To = *to
+		}
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions, rows.Err()
+}
+
+// clipPartition shrinks [from, to) so that it starts after and ends before the existing partitions
+// overlapping it, the range is empty when from is not before to. The existing partitions are ordered by range.
+func clipPartition(from, to time.Time, existing []Partition) (time.Time, time.Time) {
+	for _, partition := range existing {
+		if !partition.To.After(from) || !partition.From.Before(to) {
+			continue
+		}
+		if !partition.From.After(from) {
+			from = partition.To
+			continue
+		}
+		return from, partition.From
+	}
+	return from, to
+}
+
+func insertPartition(partitions []Partition, partition Partition) []Partition {
+	i := sort.Search(len(partitions), func(i int) bool { return partitions[i].From.After(partition.From) })
+	return append(partitions[:i], append([]Partition{partition}, partitions[i:]...)...)
+}
+
+// partitionName names a partition after the start of its range, e.g. tasks_p20240131.
+func partitionName(from time.Time) string {
+	start := from.UTC()
+	name := "tasks_p" + start.Format("20060102")
+	if !start.Equal(start.Truncate(24 * time.Hour)) {
+		name += start.Format("_150405")
+	}
+	return name
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPartitionsSuite(t *testing.T) {
+	suite.Run(t, new(PartitionsTestSuite))
+}
+
+type PartitionsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *PartitionsTestSuite) TestClipPartition() {
+	at := func(seconds int64) time.Time { return time.Unix(seconds, 0).UTC() }
+	existing := []Partition{
+		{Name: "a", From: time.Time{}, To: at(100)},
+		{Name: "b", From: at(150), To: at(200)},
+	}
+
+	from, to := clipPartition(at(50), at(300), existing)
+	suite.Assert().Equal([]time.Time{at(100), at(150)}, []time.Time{from, to})
+
+	from, to = clipPartition(at(150), at(200), existing)
+	suite.Assert().False(from.Before(to), "the range is already covered")
+
+	from, to = clipPartition(at(200), at(300), existing)
+	suite.Assert().Equal([]time.Time{at(200), at(300)}, []time.Time{from, to})
+
+	from, to = clipPartition(at(300), at(400), append(existing, Partition{Name: "c", From: at(250), To: maxBound}))
+	suite.Assert().False(from.Before(to), "the range is covered by an unbounded partition")
+}
+
+func (suite *PartitionsTestSuite) TestPartitionName() {
+	suite.Assert().Equal("tasks_p20240101", partitionName(time.Unix(1704067200, 0)))
+	suite.Assert().Equal("tasks_p20240101_060000", partitionName(time.Unix(1704067200+6*3600, 0)))
+}
+
+func (suite *PartitionsTestSuite) TestArchive() {
+	started := time.Unix(1704067201, 0).UTC()
+	finished := time.Unix(1704067203, 0).UTC()
+	tasks := []Task{
+		{ID: 1, Type: 2, Value: 30, State: StateDONE, CreationTime: time.UnixMilli(1704067200500).UTC(), LastUpdateTime: time.Unix(1704067201, 0).UTC(), Namespace: "default"},
+		{ID: 2, Type: 9, Value: 99, State: StateDONE, CreationTime: time.Unix(1704067202, 0).UTC(), LastUpdateTime: finished, StartedAt: &started, FinishedAt: &finished, Namespace: "team-a"},
+	}
+	expected := map[string]string{
+		"jsonl": `{"id":1,"type":2,"value":30,"state":"DONE","creation_time":"2024-01-01T00:00:00.5Z","last_update_time":"2024-01-01T00:00:01Z","namespace":"default"}` + "\n" +
+			`{"id":2,"type":9,"value":99,"state":"DONE","creation_time":"2024-01-01T00:00:02Z","last_update_time":"2024-01-01T00:00:03Z","started_at":"2024-01-01T00:00:01Z","finished_at":"2024-01-01T00:00:03Z","namespace":"team-a"}` + "\n",
+		"csv": "id,type,value,state,creation_time,last_update_time,started_at,finished_at,namespace\n" +
+			"1,2,30,DONE,2024-01-01T00:00:00.5Z,2024-01-01T00:00:01Z,,,default\n" +
+			"2,9,99,DONE,2024-01-01T00:00:02Z,2024-01-01T00:00:03Z,2024-01-01T00:00:01Z,2024-01-01T00:00:03Z,team-a\n",
+	}
+
+	for format, content := range expected {
+		path := filepath.Join(suite.T().TempDir(), "archive", "tasks_p20240101."+format+".gz")
+		archive, err := CreateArchive(path, format)
+		suite.Require().NoError(err)
+		for _, task := range tasks {
+			suite.Require().NoError(archive.Write(task))
+		}
+		suite.Require().NoError(archive.Close())
+
+		file, err := os.Open(path)
+		suite.Require().NoError(err)
+		reader, err := gzip.NewReader(file)
+		suite.Require().NoError(err)
+		data, err := io.ReadAll(reader)
+		suite.Require().NoError(err)
+		suite.Require().NoError(file.Close())
+		suite.Assert().Equal(content, string(data), format)
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		suite.Require().NoError(err)
+		suite.Assert().Len(entries, 1, "the temporary file is renamed")
+	}
+
+	_, err := CreateArchive(filepath.Join(suite.T().TempDir(), "tasks.xml.gz"), "xml")
+	suite.Assert().Error(err)
+}
@@ -2,56 +2,155 @@ package database
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/source/iofs"
-	"github.com/hasanhakkaev/yqapp-demo/assets"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
-	"os"
+	"go.uber.org/zap"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// maxConnectBackoff caps the wait between two attempts to establish the first connection.
+const maxConnectBackoff = 30 * time.Second
+
 type Postgres struct {
 	DB *pgxpool.Pool
 }
 
-var ctx = context.Background()
+// NewPostgres connects to PostgreSQL with the given settings. The first connection is
+// retried with an exponential backoff so that the consumer can start before the database.
+func NewPostgres(ctx context.Context, cfg conf.Database, logger *zap.Logger) (*Postgres, error) {
+	config, err := NewPoolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := cfg.GetConnectAttempts()
+	backoff := cfg.GetConnectBackoff()
+	for attempt := 1; ; attempt++ {
+		pool, err := connect(ctx, config)
+		if err == nil {
+			return &Postgres{DB: pool}, nil
+		}
+		if attempt >= attempts {
+			return nil, fmt.Errorf("unable to connect to database after %d attempts: %w", attempt, err)
+		}
+
+		logger.Warn("Failed to connect to database, retrying", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
 
-func NewPostgres(dsn string) (*Postgres, error) {
-	config, _ := pgxpool.ParseConfig("postgres://" + dsn + "?sslmode=disable")
-	//config.MaxConns = int32(10 * runtime.NumCPU())
+// NewPool creates a connection pool with the given settings without waiting for the database to be
+// reachable, e.g. for a read replica whose health is checked separately.
+func NewPool(ctx context.Context, cfg conf.Database) (*pgxpool.Pool, error) {
+	config, err := NewPoolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return pgxpool.NewWithConfig(ctx, config)
+}
 
+func connect(ctx context.Context, config *pgxpool.Config) (*pgxpool.Pool, error) {
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+	// The pool connects lazily, make sure the database can be reached
+	if err = pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// NewPoolConfig builds the connection pool configuration from the given settings.
+func NewPoolConfig(cfg conf.Database) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(ConnString(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("invalid database connection settings: %w", err)
 	}
 
-	return &Postgres{
-		DB: pool,
-	}, nil
+	if cfg.MaxConns > 0 {
+		config.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		config.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	}
+	if cfg.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	return config, nil
 }
 
-// MigrateModels migrates the domain models using the given DB connection.
-func MigrateModels(dsn string) error {
+// ConnString returns the connection string for the given settings. The DSN is used as is when set,
+// otherwise the settings are converted to keyword/value pairs. Settings left empty are omitted
+// so that they fall back to the PG* environment variables.
+func ConnString(cfg conf.Database) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
 
-	fsDriver, err := iofs.New(assets.EmbeddedFiles, "migrations")
-	if err != nil {
-		return err
+	var pairs []string
+	add := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, key+"="+quoteConnValue(value))
+		}
 	}
+	add("host", cfg.Host)
+	if cfg.Port != 0 {
+		add("port", strconv.Itoa(int(cfg.Port)))
+	}
+	add("user", cfg.Username)
+	add("password", cfg.Password)
+	add("dbname", cfg.Database)
+	add("sslmode", cfg.SSLMode)
+	add("sslrootcert", cfg.SSLRootCert)
+	add("sslcert", cfg.SSLCert)
+	add("sslkey", cfg.SSLKey)
+	return strings.Join(pairs, " ")
+}
 
-	migrator, err := migrate.NewWithSourceInstance("iofs", fsDriver, "postgres://"+dsn+"?sslmode=disable")
-	if err != nil {
-		return err
+// quoteConnValue quotes a keyword/value connection string value when needed.
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
 	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+var passwordPair = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S+)`)
 
-	err = migrator.Up()
-	switch {
-	case errors.Is(err, migrate.ErrNoChange):
-		break
-	case err != nil:
-		return err
+// RedactConnString masks the password of a connection string so that it can be logged.
+func RedactConnString(connString string) string {
+	if u, err := url.Parse(connString); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", "xxxxx")
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
 	}
-	return nil
+	return passwordPair.ReplaceAllString(connString, "password=xxxxx")
 }
@@ -7,11 +7,148 @@ package database
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cancelTask = `-- name: CancelTask :one
+UPDATE tasks
+SET state = 'CANCELLED', last_update_time = $1, finished_at = $1
+WHERE id = $2
+  AND ($3::text IS NULL OR namespace = $3::text)
+  AND state IN ('RECEIVED', 'PROCESSING')
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+`
+
+type CancelTaskParams struct {
+	LastUpdateTime time.Time
+	ID             int32
+	Namespace      pgtype.Text
+}
+
+func (q *Queries) CancelTask(ctx context.Context, arg CancelTaskParams) (Task, error) {
+	row := q.db.QueryRow(ctx, cancelTask, arg.LastUpdateTime, arg.ID, arg.Namespace)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.Value,
+		&i.State,
+		&i.CreationTime,
+		&i.LastUpdateTime,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Namespace,
+	)
+	return i, err
+}
+
+const claimOutboxEvents = `-- name: ClaimOutboxEvents :many
+SELECT id, event_type, task_id, data, created_at, attempts, last_error
+FROM outbox
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED
+`
+
+func (q *Queries) ClaimOutboxEvents(ctx context.Context, rowLimit int32) ([]Outbox, error) {
+	rows, err := q.db.Query(ctx, claimOutboxEvents, rowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Outbox
+	for rows.Next() {
+		var i Outbox
+		if err := rows.Scan(
+			&i.ID,
+			&i.EventType,
+			&i.TaskID,
+			&i.Data,
+			&i.CreatedAt,
+			&i.Attempts,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimReceivedTasks = `-- name: ClaimReceivedTasks :many
+UPDATE tasks
+SET last_update_time = $1
+WHERE id IN (
+    SELECT id
+    FROM tasks
+    WHERE state = 'RECEIVED' AND last_update_time < $2
+    ORDER BY id
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+`
+
+type ClaimReceivedTasksParams struct {
+	LastUpdateTime time.Time
+	UpdatedBefore  time.Time
+	RowLimit       int32
+}
+
+func (q *Queries) ClaimReceivedTasks(ctx context.Context, arg ClaimReceivedTasksParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, claimReceivedTasks, arg.LastUpdateTime, arg.UpdatedBefore, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createIdempotencyKey = `-- name: CreateIdempotencyKey :exec
+INSERT INTO idempotency_keys (namespace, key, task_id)
+VALUES ($1, $2, $3)
+`
+
+type CreateIdempotencyKeyParams struct {
+	Namespace string
+	Key       string
+	TaskID    int32
+}
+
+func (q *Queries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) error {
+	_, err := q.db.Exec(ctx, createIdempotencyKey, arg.Namespace, arg.Key, arg.TaskID)
+	return err
+}
+
 const createTask = `-- name: CreateTask :one
-INSERT INTO tasks (type, value, state, creation_time, last_update_time)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO tasks (type, value, state, creation_time, last_update_time, namespace)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING id
 `
 
@@ -19,8 +156,9 @@ type CreateTaskParams struct {
 	Type           uint32
 	Value          uint32
 	State          State
-	CreationTime   float64
-	LastUpdateTime float64
+	CreationTime   time.Time
+	LastUpdateTime time.Time
+	Namespace      string
 }
 
 func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (int32, error) {
@@ -30,15 +168,72 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (int32,
 		arg.State,
 		arg.CreationTime,
 		arg.LastUpdateTime,
+		arg.Namespace,
 	)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
 
+const deleteOutboxEvents = `-- name: DeleteOutboxEvents :exec
+DELETE FROM outbox
+WHERE id = ANY($1::bigint[])
+`
+
+func (q *Queries) DeleteOutboxEvents(ctx context.Context, ids []int64) error {
+	_, err := q.db.Exec(ctx, deleteOutboxEvents, ids)
+	return err
+}
+
+const getConsumerSettings = `-- name: GetConsumerSettings :one
+SELECT paused, rate_limit, burst, workers, version
+FROM consumer_settings
+WHERE id = 1
+`
+
+type GetConsumerSettingsRow struct {
+	Paused    bool
+	RateLimit pgtype.Float8
+	Burst     pgtype.Int4
+	Workers   pgtype.Int4
+	Version   int64
+}
+
+func (q *Queries) GetConsumerSettings(ctx context.Context) (GetConsumerSettingsRow, error) {
+	row := q.db.QueryRow(ctx, getConsumerSettings)
+	var i GetConsumerSettingsRow
+	err := row.Scan(
+		&i.Paused,
+		&i.RateLimit,
+		&i.Burst,
+		&i.Workers,
+		&i.Version,
+	)
+	return i, err
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT task_id
+FROM idempotency_keys
+WHERE namespace = $1 AND key = $2
+`
+
+type GetIdempotencyKeyParams struct {
+	Namespace string
+	Key       string
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getIdempotencyKey, arg.Namespace, arg.Key)
+	var task_id int32
+	err := row.Scan(&task_id)
+	return task_id, err
+}
+
 const getSumOfTasksByState = `-- name: GetSumOfTasksByState :many
 SELECT state, COUNT(*) AS task_count
 FROM tasks
+WHERE $1::text IS NULL OR namespace = $1::text
 GROUP BY state
 `
 
@@ -47,8 +242,8 @@ type GetSumOfTasksByStateRow struct {
 	TaskCount int64
 }
 
-func (q *Queries) GetSumOfTasksByState(ctx context.Context) ([]GetSumOfTasksByStateRow, error) {
-	rows, err := q.db.Query(ctx, getSumOfTasksByState)
+func (q *Queries) GetSumOfTasksByState(ctx context.Context, namespace pgtype.Text) ([]GetSumOfTasksByStateRow, error) {
+	rows, err := q.db.Query(ctx, getSumOfTasksByState, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -67,9 +262,42 @@ func (q *Queries) GetSumOfTasksByState(ctx context.Context) ([]GetSumOfTasksBySt
 	return items, nil
 }
 
+const getSumOfTasksByType = `-- name: GetSumOfTasksByType :many
+SELECT type, COUNT(*) AS task_count
+FROM tasks
+WHERE $1::text IS NULL OR namespace = $1::text
+GROUP BY type
+`
+
+type GetSumOfTasksByTypeRow struct {
+	Type      uint32
+	TaskCount int64
+}
+
+func (q *Queries) GetSumOfTasksByType(ctx context.Context, namespace pgtype.Text) ([]GetSumOfTasksByTypeRow, error) {
+	rows, err := q.db.Query(ctx, getSumOfTasksByType, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSumOfTasksByTypeRow
+	for rows.Next() {
+		var i GetSumOfTasksByTypeRow
+		if err := rows.Scan(&i.Type, &i.TaskCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSumOfValues = `-- name: GetSumOfValues :many
 SELECT type, SUM(value) AS total_value
 FROM tasks
+WHERE $1::text IS NULL OR namespace = $1::text
 GROUP BY type
 `
 
@@ -78,8 +306,8 @@ type GetSumOfValuesRow struct {
 	TotalValue int64
 }
 
-func (q *Queries) GetSumOfValues(ctx context.Context) ([]GetSumOfValuesRow, error) {
-	rows, err := q.db.Query(ctx, getSumOfValues)
+func (q *Queries) GetSumOfValues(ctx context.Context, namespace pgtype.Text) ([]GetSumOfValuesRow, error) {
+	rows, err := q.db.Query(ctx, getSumOfValues, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +326,36 @@ func (q *Queries) GetSumOfValues(ctx context.Context) ([]GetSumOfValuesRow, erro
 	return items, nil
 }
 
+const getTask = `-- name: GetTask :one
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+FROM tasks
+WHERE id = $1 AND ($2::text IS NULL OR namespace = $2::text)
+`
+
+type GetTaskParams struct {
+	ID        int32
+	Namespace pgtype.Text
+}
+
+func (q *Queries) GetTask(ctx context.Context, arg GetTaskParams) (Task, error) {
+	row := q.db.QueryRow(ctx, getTask, arg.ID, arg.Namespace)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.Value,
+		&i.State,
+		&i.CreationTime,
+		&i.LastUpdateTime,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Namespace,
+	)
+	return i, err
+}
+
 const getTasksByState = `-- name: GetTasksByState :many
-SELECT id, type, value, state, creation_time, last_update_time
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
 FROM tasks
 WHERE state = $1
 `
@@ -120,6 +376,185 @@ func (q *Queries) GetTasksByState(ctx context.Context, state State) ([]Task, err
 			&i.State,
 			&i.CreationTime,
 			&i.LastUpdateTime,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertOutboxEvent = `-- name: InsertOutboxEvent :exec
+INSERT INTO outbox (event_type, task_id, data)
+VALUES ($1, $2, $3)
+`
+
+type InsertOutboxEventParams struct {
+	EventType string
+	TaskID    int32
+	Data      []byte
+}
+
+func (q *Queries) InsertOutboxEvent(ctx context.Context, arg InsertOutboxEventParams) error {
+	_, err := q.db.Exec(ctx, insertOutboxEvent, arg.EventType, arg.TaskID, arg.Data)
+	return err
+}
+
+const listRecentTasks = `-- name: ListRecentTasks :many
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+FROM tasks
+WHERE ($1::text IS NULL OR state::text = $1::text)
+  AND ($2::text IS NULL OR namespace = $2::text)
+ORDER BY id DESC
+LIMIT $3 OFFSET $4
+`
+
+type ListRecentTasksParams struct {
+	State     pgtype.Text
+	Namespace pgtype.Text
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) ListRecentTasks(ctx context.Context, arg ListRecentTasksParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, listRecentTasks,
+		arg.State,
+		arg.Namespace,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTasks = `-- name: ListTasks :many
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+FROM tasks
+WHERE ($1::text IS NULL OR state::text = $1::text)
+  AND ($2::text IS NULL OR namespace = $2::text)
+ORDER BY id
+LIMIT $3 OFFSET $4
+`
+
+type ListTasksParams struct {
+	State     pgtype.Text
+	Namespace pgtype.Text
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) ListTasks(ctx context.Context, arg ListTasksParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, listTasks,
+		arg.State,
+		arg.Namespace,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Namespace,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordOutboxFailure = `-- name: RecordOutboxFailure :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = $2
+WHERE id = $1
+`
+
+type RecordOutboxFailureParams struct {
+	ID        int64
+	LastError pgtype.Text
+}
+
+func (q *Queries) RecordOutboxFailure(ctx context.Context, arg RecordOutboxFailureParams) error {
+	_, err := q.db.Exec(ctx, recordOutboxFailure, arg.ID, arg.LastError)
+	return err
+}
+
+const requeueTasks = `-- name: RequeueTasks :many
+UPDATE tasks
+SET state = 'RECEIVED', last_update_time = $1, started_at = NULL
+WHERE id = ANY($2::int[]) AND state NOT IN ('DONE', 'CANCELLED')
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+`
+
+type RequeueTasksParams struct {
+	LastUpdateTime time.Time
+	Ids            []int32
+}
+
+func (q *Queries) RequeueTasks(ctx context.Context, arg RequeueTasksParams) ([]Task, error) {
+	rows, err := q.db.Query(ctx, requeueTasks, arg.LastUpdateTime, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Value,
+			&i.State,
+			&i.CreationTime,
+			&i.LastUpdateTime,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Namespace,
 		); err != nil {
 			return nil, err
 		}
@@ -133,14 +568,17 @@ func (q *Queries) GetTasksByState(ctx context.Context, state State) ([]Task, err
 
 const updateTaskState = `-- name: UpdateTaskState :one
 UPDATE tasks
-SET state = $1, last_update_time = $2
-WHERE id = $3
-RETURNING id, type, value, state, creation_time, last_update_time
+SET state            = $1,
+    last_update_time = $2,
+    started_at       = CASE WHEN $1 = 'PROCESSING' THEN $2 ELSE started_at END,
+    finished_at      = CASE WHEN $1 = 'DONE' THEN $2 ELSE finished_at END
+WHERE id = $3 AND state <> 'CANCELLED' AND ($1 <> 'PROCESSING' OR state = 'RECEIVED')
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
 `
 
 type UpdateTaskStateParams struct {
 	State          State
-	LastUpdateTime float64
+	LastUpdateTime time.Time
 	ID             int32
 }
 
@@ -154,6 +592,55 @@ func (q *Queries) UpdateTaskState(ctx context.Context, arg UpdateTaskStateParams
 		&i.State,
 		&i.CreationTime,
 		&i.LastUpdateTime,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Namespace,
+	)
+	return i, err
+}
+
+const updateConsumerSettings = `-- name: UpdateConsumerSettings :one
+INSERT INTO consumer_settings (id, paused, rate_limit, burst, workers)
+VALUES (1, COALESCE($1::boolean, FALSE), $2, $3, $4)
+ON CONFLICT (id) DO UPDATE
+SET paused     = COALESCE($1::boolean, consumer_settings.paused),
+    rate_limit = COALESCE($2, consumer_settings.rate_limit),
+    burst      = COALESCE($3, consumer_settings.burst),
+    workers    = COALESCE($4, consumer_settings.workers),
+    version    = consumer_settings.version + 1,
+    updated_at = now()
+RETURNING paused, rate_limit, burst, workers, version
+`
+
+type UpdateConsumerSettingsParams struct {
+	Paused    pgtype.Bool
+	RateLimit pgtype.Float8
+	Burst     pgtype.Int4
+	Workers   pgtype.Int4
+}
+
+type UpdateConsumerSettingsRow struct {
+	Paused    bool
+	RateLimit pgtype.Float8
+	Burst     pgtype.Int4
+	Workers   pgtype.Int4
+	Version   int64
+}
+
+func (q *Queries) UpdateConsumerSettings(ctx context.Context, arg UpdateConsumerSettingsParams) (UpdateConsumerSettingsRow, error) {
+	row := q.db.QueryRow(ctx, updateConsumerSettings,
+		arg.Paused,
+		arg.RateLimit,
+		arg.Burst,
+		arg.Workers,
+	)
+	var i UpdateConsumerSettingsRow
+	err := row.Scan(
+		&i.Paused,
+		&i.RateLimit,
+		&i.Burst,
+		&i.Workers,
+		&i.Version,
 	)
 	return i, err
 }
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"strings"
+	"time"
+)
+
+// transferColumns are the columns of the exported and imported tasks, in the order of the task archives.
+var transferColumns = []string{"id", "type", "value", "state", "creation_time", "last_update_time", "started_at", "finished_at", "namespace"}
+
+// ExportFilter selects the exported tasks, the zero fields match every task.
+type ExportFilter struct {
+	Namespace string
+	States    []State
+	// Since and Until bound the creation time of the tasks to [Since, Until).
+	Since time.Time
+	Until time.Time
+}
+
+// where returns the WHERE clause of the filter and its arguments.
+func (f ExportFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.Namespace != "" {
+		add("namespace = $%d", f.Namespace)
+	}
+	if len(f.States) > 0 {
+		states := make([]string, len(f.States))
+		for i, state := range f.States {
+			states[i] = string(state)
+		}
+		add("state = ANY($%d::state[])", states)
+	}
+	if !f.Since.IsZero() {
+		add("creation_time >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("creation_time < $%d", f.Until)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ExportTasks calls fn with the tasks matching the filter ordered by id and returns their count.
+// The tasks are read from a snapshot of the table through a server-side cursor, batchSize tasks
+// at a time, so that the memory used does not depend on the number of tasks.
+func ExportTasks(ctx context.Context, pool *pgxpool.Pool, filter ExportFilter, batchSize int, fn func(Task) error) (int64, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("invalid export batch size %d", batchSize)
+	}
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	where, args := filter.where()
+	if _, err = tx.Exec(ctx, "DECLARE export_tasks NO SCROLL CURSOR FOR SELECT "+strings.Join(transferColumns, ", ")+
+		" FROM tasks"+where+" ORDER BY id", args...); err != nil {
+		return 0, err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_tasks", batchSize)
+	var exported int64
+	for {
+		fetched, err := fetchTasks(ctx, tx, fetch, fn)
+		exported += fetched
+		if err != nil {
+			return exported, err
+		}
+		if fetched < int64(batchSize) {
+			break
+		}
+	}
+	return exported, tx.Commit(ctx)
+}
+
+func fetchTasks(ctx context.Context, tx pgx.Tx, fetch string, fn func(Task) error) (int64, error) {
+	rows, err := tx.Query(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var fetched int64
+	for rows.Next() {
+		var task Task
+		if err := rows.Scan(&task.ID, &task.Type, &task.Value, &task.State, &task.CreationTime, &task.LastUpdateTime, &task.StartedAt, &task.FinishedAt, &task.Namespace); err != nil {
+			return fetched, err
+		}
+		if err := fn(task); err != nil {
+			return fetched, err
+		}
+		fetched++
+	}
+	return fetched, rows.Err()
+}
+
+// ImportOptions change the imported tasks.
+type ImportOptions struct {
+	// KeepIDs inserts the tasks with their ids, which must not be taken, and moves the id sequence past them.
+	// The tasks get new ids in the order of their imported ids otherwise.
+	KeepIDs bool
+	// ResetStates imports the tasks as RECEIVED and last updated at the time of the import, without start and finish times.
+	ResetStates bool
+	// CreatedEvent is the type of the outbox event written for every imported task in the transaction
+	// of the import, like for the tasks created through the Task service. No event is written when empty.
+	CreatedEvent string
+}
+
+// ErrTakenIDs is returned by ImportTasks when the ids of the imported tasks are kept but some are
+// already taken or repeated.
+var ErrTakenIDs = errors.New("imported task ids are already taken")
+
+// ImportTasks inserts the tasks returned by next until it returns io.EOF and returns their count.
+// The tasks are streamed into a temporary table with the COPY protocol and inserted in a single
+// transaction with their outbox events, so that either every task is imported or none is. The
+// imported RECEIVED tasks are not queued, the consumers claim them through their task recovery.
+func ImportTasks(ctx context.Context, pool *pgxpool.Pool, next func() (Task, error), opts ImportOptions) (int64, error) {
+	var imported int64
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		// The state is copied as text, it is checked against the enum by the insert
+		if _, err := tx.Exec(ctx, `
+CREATE TEMPORARY TABLE import_tasks (
+    id               INT         NOT NULL,
+    type             INT         NOT NULL,
+    value            INT         NOT NULL,
+    state            TEXT        NOT NULL,
+    creation_time    TIMESTAMPTZ NOT NULL,
+    last_update_time TIMESTAMPTZ NOT NULL,
+    started_at       TIMESTAMPTZ,
+    finished_at      TIMESTAMPTZ,
+    namespace        TEXT        NOT NULL
+) ON COMMIT DROP`); err != nil {
+			return err
+		}
+
+		var err error
+		imported, err = tx.CopyFrom(ctx, pgx.Identifier{"import_tasks"}, transferColumns, pgx.CopyFromFunc(func() ([]any, error) {
+			task, err := next()
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return []any{task.ID, task.Type, task.Value, string(task.State), task.CreationTime, task.LastUpdateTime, task.StartedAt, task.FinishedAt, task.Namespace}, nil
+		}))
+		if err != nil {
+			return err
+		}
+
+		if opts.KeepIDs {
+			var taken int64
+			if err := tx.QueryRow(ctx, `
+SELECT (SELECT count(*) - count(DISTINCT id) FROM import_tasks) +
+       (SELECT count(*) FROM import_tasks i WHERE EXISTS (SELECT 1 FROM tasks t WHERE t.id = i.id))`).Scan(&taken); err != nil {
+				return err
+			}
+			if taken > 0 {
+				return fmt.Errorf("%w: %d tasks, import them without keeping their ids", ErrTakenIDs, taken)
+			}
+		}
+
+		var args []any
+		if opts.ResetStates {
+			args = append(args, time.Now())
+		}
+		if opts.CreatedEvent != "" {
+			args = append(args, opts.CreatedEvent)
+		}
+		if _, err := tx.Exec(ctx, importStatement(opts), args...); err != nil {
+			return err
+		}
+
+		if opts.KeepIDs {
+			// Move the sequence past the imported ids, it is never moved back
+			if _, err := tx.Exec(ctx, `
+SELECT setval(s.seq, s.max_id)
+FROM (SELECT pg_get_serial_sequence('tasks', 'id')::regclass AS seq, (SELECT max(id) FROM import_tasks) AS max_id) s
+WHERE s.max_id > coalesce(pg_sequence_last_value(s.seq), 0)`); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+// importStatement returns the insert of the copied tasks. Its parameters are the time of the import when
+// the states are reset, then the type of the created events, which are written with the task as data.
+func importStatement(opts ImportOptions) string {
+	columns := transferColumns
+	values := []string{"id", "type", "value", "state::state", "creation_time", "last_update_time", "started_at", "finished_at", "namespace"}
+	var params int
+	if opts.ResetStates {
+		params++
+		values[3], values[5], values[6], values[7] = "'RECEIVED'", fmt.Sprintf("$%d", params), "NULL", "NULL"
+	}
+	if !opts.KeepIDs {
+		columns, values = columns[1:], values[1:]
+	}
+	insert := "INSERT INTO tasks (" + strings.Join(columns, ", ") + ") SELECT " + strings.Join(values, ", ") +
+		" FROM import_tasks ORDER BY id"
+	if opts.CreatedEvent == "" {
+		return insert
+	}
+
+	// The row of an inserted task has the fields of its JSON encoding, the unset times are left out
+	params++
+	return "WITH imported AS (" + insert + " RETURNING " + strings.Join(transferColumns, ", ") + ") " +
+		fmt.Sprintf("INSERT INTO outbox (event_type, task_id, data) SELECT $%d, id, jsonb_strip_nulls(to_jsonb(imported)) FROM imported ORDER BY id", params)
+}
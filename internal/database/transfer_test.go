@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTransferSuite(t *testing.T) {
+	suite.Run(t, new(TransferTestSuite))
+}
+
+type TransferTestSuite struct {
+	testServer
+}
+
+func (suite *TransferTestSuite) TestExportFilter() {
+	where, args := ExportFilter{}.where()
+	suite.Assert().Empty(where)
+	suite.Assert().Empty(args)
+
+	since := time.Unix(1704067200, 0).UTC()
+	where, args = ExportFilter{Namespace: "team-a", States: []State{StateDONE, StateCANCELLED}, Since: since}.where()
+	suite.Assert().Equal(" WHERE namespace = $1 AND state = ANY($2::state[]) AND creation_time >= $3", where)
+	suite.Assert().Equal([]any{"team-a", []string{"DONE", "CANCELLED"}, since}, args)
+}
+
+func (suite *TransferTestSuite) TestImportStatement() {
+	suite.Assert().Equal("INSERT INTO tasks (type, value, state, creation_time, last_update_time, started_at, finished_at, namespace) "+
+		"SELECT type, value, state::state, creation_time, last_update_time, started_at, finished_at, namespace FROM import_tasks ORDER BY id",
+		importStatement(ImportOptions{}))
+	suite.Assert().Equal("INSERT INTO tasks (id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace) "+
+		"SELECT id, type, value, 'RECEIVED', creation_time, $1, NULL, NULL, namespace FROM import_tasks ORDER BY id",
+		importStatement(ImportOptions{KeepIDs: true, ResetStates: true}))
+	suite.Assert().Equal("WITH imported AS (INSERT INTO tasks (type, value, state, creation_time, last_update_time, started_at, finished_at, namespace) "+
+		"SELECT type, value, 'RECEIVED', creation_time, $1, NULL, NULL, namespace FROM import_tasks ORDER BY id "+
+		"RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace) "+
+		"INSERT INTO outbox (event_type, task_id, data) SELECT $2, id, jsonb_strip_nulls(to_jsonb(imported)) FROM imported ORDER BY id",
+		importStatement(ImportOptions{ResetStates: true, CreatedEvent: "yqapp.task.created"}))
+}
+
+// migrate creates a database with the schema of the migrations.
+func (suite *TransferTestSuite) migrate(name string) *pgxpool.Pool {
+	pool := suite.createDatabase(name)
+	migrator := suite.newMigrator(name)
+	defer migrator.Close()
+	suite.Require().NoError(migrator.Up())
+	return pool
+}
+
+func (suite *TransferTestSuite) export(pool *pgxpool.Pool) []Task {
+	var tasks []Task
+	exported, err := ExportTasks(context.Background(), pool, ExportFilter{}, 2, func(task Task) error {
+		tasks = append(tasks, task)
+		return nil
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(len(tasks)), exported)
+	return tasks
+}
+
+func (suite *TransferTestSuite) importTasks(pool *pgxpool.Pool, tasks []Task, opts ImportOptions) (int64, error) {
+	next := 0
+	return ImportTasks(context.Background(), pool, func() (Task, error) {
+		if next == len(tasks) {
+			return Task{}, io.EOF
+		}
+		next++
+		return tasks[next-1], nil
+	}, opts)
+}
+
+func (suite *TransferTestSuite) TestExportAndImport() {
+	suite.requireServer()
+	source := suite.migrate("yqapp_check_transfer")
+	target := suite.migrate("yqapp_check_import")
+
+	ctx := context.Background()
+	_, err := source.Exec(ctx, `
+INSERT INTO tasks (type, value, state, creation_time, last_update_time, started_at, finished_at, namespace) VALUES
+    (1, 10, 'DONE', '2024-01-01T10:00:00Z', '2024-01-01T10:00:05Z', '2024-01-01T10:00:01Z', '2024-01-01T10:00:05Z', 'team-a'),
+    (2, 20, 'RECEIVED', '2024-01-01T11:00:00Z', '2024-01-01T11:00:00Z', NULL, NULL, 'default'),
+    (3, 30, 'PROCESSING', '2024-01-01T12:00:00Z', '2024-01-01T12:00:01Z', '2024-01-01T12:00:01Z', NULL, 'team-a')`)
+	suite.Require().NoError(err)
+	tasks := suite.export(source)
+	suite.Require().Len(tasks, 3)
+
+	imported, err := suite.importTasks(target, tasks, ImportOptions{KeepIDs: true, CreatedEvent: "yqapp.task.created"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(3), imported)
+	suite.Assert().Equal(tasks, suite.export(target))
+
+	// Every imported task has a created event, the unset times are left out of its data
+	rows, err := target.Query(ctx, "SELECT event_type, task_id, data FROM outbox ORDER BY id")
+	suite.Require().NoError(err)
+	var events int
+	for rows.Next() {
+		var eventType string
+		var taskID int32
+		var data []byte
+		suite.Require().NoError(rows.Scan(&eventType, &taskID, &data))
+		var fields map[string]any
+		suite.Require().NoError(json.Unmarshal(data, &fields))
+
+		task := tasks[events]
+		suite.Assert().Equal("yqapp.task.created", eventType)
+		suite.Assert().Equal(task.ID, taskID)
+		suite.Assert().Equal(float64(task.ID), fields["id"])
+		suite.Assert().Equal(string(task.State), fields["state"])
+		suite.Assert().Equal(task.Namespace, fields["namespace"])
+		_, started := fields["started_at"]
+		suite.Assert().Equal(task.StartedAt != nil, started)
+		events++
+	}
+	suite.Require().NoError(rows.Err())
+	suite.Assert().Equal(len(tasks), events)
+
+	// The kept ids are taken by the first import, the failed import writes nothing
+	_, err = suite.importTasks(target, tasks, ImportOptions{KeepIDs: true, CreatedEvent: "yqapp.task.created"})
+	suite.Assert().ErrorIs(err, ErrTakenIDs)
+	suite.Assert().Len(suite.export(target), 3)
+
+	imported, err = suite.importTasks(target, tasks, ImportOptions{ResetStates: true})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(3), imported)
+	reset := suite.export(target)[3:]
+	suite.Require().Len(reset, 3)
+	for i, task := range reset {
+		suite.Assert().Greater(task.ID, tasks[len(tasks)-1].ID, "the ids are not kept")
+		suite.Assert().Equal(StateRECEIVED, task.State)
+		suite.Assert().True(tasks[i].CreationTime.Equal(task.CreationTime))
+		suite.Assert().Nil(task.StartedAt)
+		suite.Assert().Nil(task.FinishedAt)
+	}
+
+	var outbox int
+	suite.Require().NoError(target.QueryRow(ctx, "SELECT count(*) FROM outbox").Scan(&outbox))
+	suite.Assert().Equal(3, outbox, "no events are written without an event type")
+}
@@ -3,13 +3,10 @@ package domain
 import (
 	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
 	"math/rand"
-	"time"
 )
 
-func init() {
-	rand.NewSource(time.Now().UnixNano())
-}
-
+// RandomInt returns a random number between min and max, drawn from the automatically seeded global source.
+// The producer draws its tasks from the reproducible sources of the workload package instead.
 func RandomInt(min, max int) int {
 	return min + rand.Int()%(max-min+1)
 }
@@ -22,6 +19,8 @@ func MapGrpcStateToDomain(grpcState v1.TaskState) State {
 		return StatePROCESSING
 	case v1.TaskState_DONE:
 		return StateDONE
+	case v1.TaskState_CANCELLED:
+		return StateCANCELLED
 	default:
 		return ""
 	}
@@ -35,6 +34,8 @@ func MapDomainStateToGrpc(domainState State) v1.TaskState {
 		return v1.TaskState_PROCESSING
 	case StateDONE:
 		return v1.TaskState_DONE
+	case StateCANCELLED:
+		return v1.TaskState_CANCELLED
 	default:
 		return v1.TaskState_UNKNOWN
 	}
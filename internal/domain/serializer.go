@@ -0,0 +1,258 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"time"
+)
+
+// taskColumns are the CSV columns of a task, named and ordered like the JSON fields.
+var taskColumns = []string{"id", "type", "value", "state", "creation_time", "last_update_time", "started_at", "finished_at", "namespace"}
+
+// validate checks the fields decoded into a task.
+func (t *Task) validate() error {
+	if !t.State.Valid() {
+		return fmt.Errorf("task %d: unknown state %q", t.ID, t.State)
+	}
+	return nil
+}
+
+// JSON returns the task as a JSON object.
+func (t *Task) JSON() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// FromJSON replaces the task with the given JSON object.
+func (t *Task) FromJSON(data []byte) error {
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return err
+	}
+	if err := task.validate(); err != nil {
+		return err
+	}
+	*t = task
+	return nil
+}
+
+// YAML returns the task as a YAML mapping.
+func (t *Task) YAML() ([]byte, error) {
+	return yaml.Marshal(t)
+}
+
+// FromYAML replaces the task with the given YAML mapping.
+func (t *Task) FromYAML(data []byte) error {
+	var task Task
+	if err := yaml.Unmarshal(data, &task); err != nil {
+		return err
+	}
+	if err := task.validate(); err != nil {
+		return err
+	}
+	*t = task
+	return nil
+}
+
+// CSVHeader returns the names of the columns of CSV.
+func (t *Task) CSVHeader() []string {
+	return append([]string(nil), taskColumns...)
+}
+
+// CSV returns the task as a CSV row, the times are in RFC 3339 and empty when unset.
+func (t *Task) CSV() []string {
+	return []string{
+		strconv.FormatUint(uint64(t.ID), 10),
+		strconv.FormatUint(uint64(t.Type), 10),
+		strconv.FormatUint(uint64(t.Value), 10),
+		string(t.State),
+		formatTime(&t.CreationTime),
+		formatTime(&t.LastUpdateTime),
+		formatTime(t.StartedAt),
+		formatTime(t.FinishedAt),
+		t.Namespace,
+	}
+}
+
+// FromCSV replaces the task with a CSV row, the columns missing from header are left unset and
+// the unknown ones are ignored.
+func (t *Task) FromCSV(header, record []string) error {
+	if len(header) != len(record) {
+		return fmt.Errorf("task row has %d columns, the header %d", len(record), len(header))
+	}
+
+	var task Task
+	for i, column := range header {
+		var err error
+		value := record[i]
+		switch column {
+		case "id":
+			task.ID, err = parseUint32(value)
+		case "type":
+			task.Type, err = parseUint32(value)
+		case "value":
+			task.Value, err = parseUint32(value)
+		case "state":
+			task.State = State(value)
+		case "creation_time":
+			err = parseTime(value, &task.CreationTime)
+		case "last_update_time":
+			err = parseTime(value, &task.LastUpdateTime)
+		case "started_at":
+			task.StartedAt, err = parseOptionalTime(value)
+		case "finished_at":
+			task.FinishedAt, err = parseOptionalTime(value)
+		case "namespace":
+			task.Namespace = value
+		}
+		if err != nil {
+			return fmt.Errorf("task column %s: %w", column, err)
+		}
+	}
+	if err := task.validate(); err != nil {
+		return err
+	}
+	*t = task
+	return nil
+}
+
+// API returns the task as a v1.Task.
+func (t *Task) API() *v1.Task {
+	return FromDomainToProto(t)
+}
+
+// FromAPI replaces the task with a v1.Task, the unset times are left zero.
+func (t *Task) FromAPI(in *v1.Task) {
+	*t = Task{
+		ID:        in.GetId(),
+		Type:      in.GetType(),
+		Value:     in.GetValue(),
+		State:     MapGrpcStateToDomain(in.GetState()),
+		Namespace: in.GetNamespace(),
+	}
+	if in.GetCreationTime() != nil {
+		t.CreationTime = in.GetCreationTime().AsTime()
+	}
+	if in.GetLastUpdateTime() != nil {
+		t.LastUpdateTime = in.GetLastUpdateTime().AsTime()
+	}
+	if in.GetStartedAt() != nil {
+		startedAt := in.GetStartedAt().AsTime()
+		t.StartedAt = &startedAt
+	}
+	if in.GetFinishedAt() != nil {
+		finishedAt := in.GetFinishedAt().AsTime()
+		t.FinishedAt = &finishedAt
+	}
+}
+
+// JSON returns the tasks as a JSON array.
+func (ts *Tasks) JSON() ([]byte, error) {
+	if *ts == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(*ts)
+}
+
+// FromJSON replaces the tasks with the given JSON array.
+func (ts *Tasks) FromJSON(data []byte) error {
+	var tasks Tasks
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return err
+	}
+	if err := tasks.validate(); err != nil {
+		return err
+	}
+	*ts = tasks
+	return nil
+}
+
+// YAML returns the tasks as a YAML sequence.
+func (ts *Tasks) YAML() ([]byte, error) {
+	if *ts == nil {
+		return []byte("[]\n"), nil
+	}
+	return yaml.Marshal(*ts)
+}
+
+// FromYAML replaces the tasks with the given YAML sequence.
+func (ts *Tasks) FromYAML(data []byte) error {
+	var tasks Tasks
+	if err := yaml.Unmarshal(data, &tasks); err != nil {
+		return err
+	}
+	if err := tasks.validate(); err != nil {
+		return err
+	}
+	*ts = tasks
+	return nil
+}
+
+// API returns the tasks as v1.Tasks.
+func (ts Tasks) API() []*v1.Task {
+	pbTasks := make([]*v1.Task, len(ts))
+	for i, task := range ts {
+		pbTasks[i] = task.API()
+	}
+	return pbTasks
+}
+
+// FromAPI replaces the tasks with v1.Tasks.
+func (ts *Tasks) FromAPI(in []*v1.Task) {
+	tasks := make(Tasks, len(in))
+	for i, pbTask := range in {
+		tasks[i] = new(Task)
+		tasks[i].FromAPI(pbTask)
+	}
+	*ts = tasks
+}
+
+func (ts Tasks) validate() error {
+	for i, task := range ts {
+		if task == nil {
+			return fmt.Errorf("task %d of the collection is null", i)
+		}
+		if err := task.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value string, t *time.Time) error {
+	if value == "" {
+		*t = time.Time{}
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var t time.Time
+	if err := parseTime(value, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func parseUint32(value string) (uint32, error) {
+	n, err := strconv.ParseUint(value, 10, 32)
+	return uint32(n), err
+}
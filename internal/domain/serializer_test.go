@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"bytes"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSerializerSuite(t *testing.T) {
+	suite.Run(t, new(SerializerTestSuite))
+}
+
+type SerializerTestSuite struct {
+	suite.Suite
+	tasks Tasks
+}
+
+func (suite *SerializerTestSuite) SetupTest() {
+	created := time.Date(2024, 10, 1, 12, 0, 0, 123456000, time.UTC)
+	started := created.Add(time.Second)
+	finished := started.Add(time.Second)
+	suite.tasks = Tasks{
+		{ID: 1, Type: 3, Value: 42, State: StateRECEIVED, CreationTime: created, LastUpdateTime: created, Namespace: "default"},
+		{ID: 2, Type: 0, Value: 7, State: StateDONE, CreationTime: created, LastUpdateTime: finished, StartedAt: &started, FinishedAt: &finished, Namespace: "team-a"},
+	}
+}
+
+func (suite *SerializerTestSuite) TestTask() {
+	task := suite.tasks[1]
+	data, err := task.JSON()
+	suite.Require().NoError(err)
+	suite.Assert().JSONEq(`{"id":2,"type":0,"value":7,"state":"DONE","creation_time":"2024-10-01T12:00:00.123456Z",
+		"last_update_time":"2024-10-01T12:00:02.123456Z","started_at":"2024-10-01T12:00:01.123456Z",
+		"finished_at":"2024-10-01T12:00:02.123456Z","namespace":"team-a"}`, string(data), "the field names are stable")
+
+	var decoded Task
+	suite.Require().NoError(decoded.FromJSON(data))
+	suite.Assert().Equal(*task, decoded)
+
+	data, err = task.YAML()
+	suite.Require().NoError(err)
+	decoded = Task{}
+	suite.Require().NoError(decoded.FromYAML(data))
+	suite.Assert().Equal(*task, decoded)
+
+	decoded = Task{}
+	suite.Require().NoError(decoded.FromCSV(task.CSVHeader(), task.CSV()))
+	suite.Assert().Equal(*task, decoded)
+
+	decoded = Task{}
+	decoded.FromAPI(task.API())
+	suite.Assert().Equal(*task, decoded)
+
+	suite.Assert().Error(decoded.FromJSON([]byte(`{"id":3,"state":"LOST"}`)))
+	suite.Assert().Equal(*task, decoded, "a task is left unchanged by an invalid input")
+	suite.Assert().Error(decoded.FromCSV([]string{"id", "state"}, []string{"x", "DONE"}))
+}
+
+func (suite *SerializerTestSuite) TestTasks() {
+	data, err := suite.tasks.JSON()
+	suite.Require().NoError(err)
+	var decoded Tasks
+	suite.Require().NoError(decoded.FromJSON(data))
+	suite.Assert().Equal(suite.tasks, decoded)
+
+	data, err = suite.tasks.YAML()
+	suite.Require().NoError(err)
+	decoded = nil
+	suite.Require().NoError(decoded.FromYAML(data))
+	suite.Assert().Equal(suite.tasks, decoded)
+
+	decoded.FromAPI(suite.tasks.API())
+	suite.Assert().Equal(suite.tasks, decoded)
+
+	var empty Tasks
+	data, err = empty.JSON()
+	suite.Require().NoError(err)
+	suite.Assert().Equal("[]", string(data))
+}
+
+func (suite *SerializerTestSuite) TestFormats() {
+	suite.Assert().Equal([]serializer.Format{serializer.FormatCSV, serializer.FormatJSON, serializer.FormatNDJSON, serializer.FormatYAML}, serializer.Formats())
+	for _, format := range serializer.Formats() {
+		codec, err := serializer.Lookup(string(format))
+		suite.Require().NoError(err)
+
+		var buf bytes.Buffer
+		encoder := codec.NewEncoder(&buf)
+		for _, task := range suite.tasks {
+			suite.Require().NoError(encoder.Encode(task), format)
+		}
+		suite.Require().NoError(encoder.Close(), format)
+
+		var decoded Tasks
+		decoder := codec.NewDecoder(&buf)
+		for {
+			task := new(Task)
+			err := decoder.Decode(task)
+			if err == io.EOF {
+				break
+			}
+			suite.Require().NoError(err, format)
+			decoded = append(decoded, task)
+		}
+		suite.Assert().Equal(suite.tasks, decoded, format)
+	}
+
+	_, err := serializer.Lookup("xml")
+	suite.Assert().ErrorIs(err, serializer.ErrUnknownFormat)
+}
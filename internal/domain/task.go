@@ -3,9 +3,19 @@ package domain
 import (
 	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
 	"github.com/hasanhakkaev/yqapp-demo/internal/database"
+	"github.com/hasanhakkaev/yqapp-demo/internal/serializer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
 )
 
-//var _ serializer.API[*v1.Task] = (*Task)(nil)
+var (
+	_ serializer.API[*v1.Task] = (*Task)(nil)
+	_ serializer.JSON          = (*Task)(nil)
+	_ serializer.YAML          = (*Task)(nil)
+	_ serializer.CSV           = (*Task)(nil)
+	_ serializer.JSON          = (*Tasks)(nil)
+	_ serializer.YAML          = (*Tasks)(nil)
+)
 
 type State string
 
@@ -13,15 +23,54 @@ const (
 	StateRECEIVED   State = "RECEIVED"
 	StatePROCESSING State = "PROCESSING"
 	StateDONE       State = "DONE"
+	// StateCANCELLED is the final state of a task cancelled before it was DONE.
+	StateCANCELLED State = "CANCELLED"
 )
 
+// Valid reports whether s is one of the task states.
+func (s State) Valid() bool {
+	switch s {
+	case StateRECEIVED, StatePROCESSING, StateDONE, StateCANCELLED:
+		return true
+	default:
+		return false
+	}
+}
+
+// Task is encoded with the column names of the tasks table, in the same order as the task archives.
 type Task struct {
-	ID             uint32
-	Type           uint32
-	Value          uint32
-	State          State
-	CreationTime   float64
-	LastUpdateTime float64
+	ID             uint32    `json:"id" yaml:"id"`
+	Type           uint32    `json:"type" yaml:"type"`
+	Value          uint32    `json:"value" yaml:"value"`
+	State          State     `json:"state" yaml:"state"`
+	CreationTime   time.Time `json:"creation_time" yaml:"creation_time"`
+	LastUpdateTime time.Time `json:"last_update_time" yaml:"last_update_time"`
+	// StartedAt is set when a worker picks up the task and cleared when it is requeued.
+	StartedAt *time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	// FinishedAt is set when the task is DONE or CANCELLED.
+	FinishedAt *time.Time `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+	// Namespace is the tenant owning the task.
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// ReceivedAt is the moment the consumer accepted the task. It is not persisted
+	// and is only used to measure queue wait and end-to-end latency.
+	ReceivedAt time.Time `json:"-" yaml:"-"`
+}
+
+// Tasks is a collection of tasks, encoded as a JSON array or a YAML sequence.
+type Tasks []*Task
+
+// SetState moves the task to the given state at the given time, tracking when it was started and finished.
+func (t *Task) SetState(state State, at time.Time) {
+	t.State = state
+	t.LastUpdateTime = at
+	switch state {
+	case StateRECEIVED:
+		t.StartedAt = nil
+	case StatePROCESSING:
+		t.StartedAt = &at
+	case StateDONE, StateCANCELLED:
+		t.FinishedAt = &at
+	}
 }
 
 // ToTaskCreateParams converts this v1.Task to a database.CreateTaskParams.
@@ -33,6 +82,7 @@ func (t *Task) ToTaskCreateParams() *database.CreateTaskParams {
 		State:          database.State(t.State),
 		CreationTime:   t.CreationTime,
 		LastUpdateTime: t.LastUpdateTime,
+		Namespace:      t.Namespace,
 	}
 }
 
@@ -60,23 +110,45 @@ func FromDBToDomain(dbTask *database.Task) *Task {
 		State:          State(dbTask.State),
 		CreationTime:   dbTask.CreationTime,
 		LastUpdateTime: dbTask.LastUpdateTime,
+		StartedAt:      dbTask.StartedAt,
+		FinishedAt:     dbTask.FinishedAt,
+		Namespace:      dbTask.Namespace,
 	}
 }
 
-func FromDomainToProto(task *Task) *v1.Task {
-	return &v1.Task{
-		Id:    task.ID,
-		Type:  task.Type,
-		Value: task.Value,
-		State: MapDomainStateToGrpc(task.State),
+func FromDomainToDB(task *Task) database.Task {
+	return database.Task{
+		ID:             int32(task.ID),
+		Type:           task.Type,
+		Value:          task.Value,
+		State:          database.State(task.State),
+		CreationTime:   task.CreationTime,
+		LastUpdateTime: task.LastUpdateTime,
+		StartedAt:      task.StartedAt,
+		FinishedAt:     task.FinishedAt,
+		Namespace:      task.Namespace,
 	}
 }
 
-func RandomTask() *Task {
-	return &Task{
-		ID:    0,
-		Type:  uint32(RandomInt(0, 9)),
-		Value: uint32(RandomInt(0, 99)),
-		State: StateRECEIVED,
+func FromDomainToProto(task *Task) *v1.Task {
+	pbTask := &v1.Task{
+		Id:        task.ID,
+		Type:      task.Type,
+		Value:     task.Value,
+		State:     MapDomainStateToGrpc(task.State),
+		Namespace: task.Namespace,
+	}
+	if !task.CreationTime.IsZero() {
+		pbTask.CreationTime = timestamppb.New(task.CreationTime)
+	}
+	if !task.LastUpdateTime.IsZero() {
+		pbTask.LastUpdateTime = timestamppb.New(task.LastUpdateTime)
+	}
+	if task.StartedAt != nil {
+		pbTask.StartedAt = timestamppb.New(*task.StartedAt)
+	}
+	if task.FinishedAt != nil {
+		pbTask.FinishedAt = timestamppb.New(*task.FinishedAt)
 	}
+	return pbTask
 }
@@ -0,0 +1,37 @@
+package interceptors
+
+import (
+	"context"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"google.golang.org/grpc"
+)
+
+// resolveNamespace adds the namespace of the request to ctx, identities bound to a namespace are kept to it.
+func resolveNamespace(ctx context.Context) (context.Context, error) {
+	identity, _ := auth.FromContext(ctx)
+	ns, err := namespace.Resolve(ctx, identity.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return namespace.NewContext(ctx, ns), nil
+}
+
+func namespaceUnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := resolveNamespace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func namespaceStreamServerInterceptor(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := resolveNamespace(stream.Context())
+	if err != nil {
+		return err
+	}
+	wrapped := middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = ctx
+	return handler(srv, wrapped)
+}
@@ -0,0 +1,33 @@
+package interceptors
+
+import (
+	"context"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+// ReadYourWritesHeader is the metadata key a caller sets to "true" so that the reads of the request
+// are served by the primary database and observe every write made before them.
+const ReadYourWritesHeader = "x-read-your-writes"
+
+func readYourWrites(ctx context.Context) context.Context {
+	for _, value := range metadata.ValueFromIncomingContext(ctx, ReadYourWritesHeader) {
+		if strings.EqualFold(value, "true") {
+			return store.WithPrimary(ctx)
+		}
+	}
+	return ctx
+}
+
+func readYourWritesUnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(readYourWrites(ctx), req)
+}
+
+func readYourWritesStreamServerInterceptor(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	wrapped := middleware.WrapServerStream(stream)
+	wrapped.WrappedContext = readYourWrites(stream.Context())
+	return handler(srv, wrapped)
+}
@@ -1,18 +1,24 @@
 package interceptors
 
 import (
+	"context"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors"
+	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
 	grpclogging "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/selector"
 	"github.com/hasanhakkaev/yqapp-demo/internal/telemetry"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"strings"
 )
 
-func NewServerInterceptors(telemeter telemetry.Telemetry) []grpc.ServerOption {
+func NewServerInterceptors(telemeter telemetry.Telemetry, authFunc grpcauth.AuthFunc) []grpc.ServerOption {
 	var opts []grpc.ServerOption
 	return append(opts,
-		newServerUnaryInterceptors(telemeter),
-		newServerStreamInterceptors(telemeter),
+		newServerUnaryInterceptors(telemeter, authFunc),
+		newServerStreamInterceptors(telemeter, authFunc),
 		grpc.StatsHandler(
 			otelgrpc.NewServerHandler(
 				otelgrpc.WithMeterProvider(telemeter.MeterProvider),
@@ -22,8 +28,8 @@ func NewServerInterceptors(telemeter telemetry.Telemetry) []grpc.ServerOption {
 	)
 }
 
-func newServerUnaryInterceptors(telemeter telemetry.Telemetry) grpc.ServerOption {
-	var interceptors []grpc.UnaryServerInterceptor
+func newServerUnaryInterceptors(telemeter telemetry.Telemetry, authFunc grpcauth.AuthFunc) grpc.ServerOption {
+	interceptors := []grpc.UnaryServerInterceptor{readYourWritesUnaryServerInterceptor}
 
 	if telemeter.Logger != nil {
 		interceptors = append(interceptors,
@@ -32,11 +38,22 @@ func newServerUnaryInterceptors(telemeter telemetry.Telemetry) grpc.ServerOption
 		)
 	}
 
+	if authFunc != nil {
+		interceptors = append(interceptors,
+			selector.UnaryServerInterceptor(grpcauth.UnaryServerInterceptor(authFunc), selector.MatchFunc(requiresAuth)),
+		)
+	}
+
+	// The namespace depends on the identity authenticated above
+	interceptors = append(interceptors,
+		selector.UnaryServerInterceptor(namespaceUnaryServerInterceptor, selector.MatchFunc(requiresAuth)),
+	)
+
 	return grpc.ChainUnaryInterceptor(interceptors...)
 }
 
-func newServerStreamInterceptors(telemeter telemetry.Telemetry) grpc.ServerOption {
-	var interceptors []grpc.StreamServerInterceptor
+func newServerStreamInterceptors(telemeter telemetry.Telemetry, authFunc grpcauth.AuthFunc) grpc.ServerOption {
+	interceptors := []grpc.StreamServerInterceptor{readYourWritesStreamServerInterceptor}
 
 	if telemeter.Logger != nil {
 		interceptors = append(interceptors,
@@ -45,5 +62,23 @@ func newServerStreamInterceptors(telemeter telemetry.Telemetry) grpc.ServerOptio
 		)
 	}
 
+	if authFunc != nil {
+		interceptors = append(interceptors,
+			selector.StreamServerInterceptor(grpcauth.StreamServerInterceptor(authFunc), selector.MatchFunc(requiresAuth)),
+		)
+	}
+
+	// The namespace depends on the identity authenticated above
+	interceptors = append(interceptors,
+		selector.StreamServerInterceptor(namespaceStreamServerInterceptor, selector.MatchFunc(requiresAuth)),
+	)
+
 	return grpc.ChainStreamInterceptor(interceptors...)
 }
+
+// requiresAuth excludes the health and reflection services from authentication
+// so that probes and tooling keep working without a token.
+func requiresAuth(_ context.Context, callMeta interceptors.CallMeta) bool {
+	return callMeta.Service != healthv1.Health_ServiceDesc.ServiceName &&
+		!strings.HasPrefix(callMeta.Service, "grpc.reflection.")
+}
@@ -0,0 +1,108 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/serviceconfig"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Name is the name of the balancer in the gRPC service config.
+const Name = "yqapp_balancer"
+
+func init() {
+	balancer.Register(builder{})
+}
+
+// Config is the service config of the balancer.
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// Policy is round_robin or least_request.
+	Policy string `json:"policy"`
+	// ConsecutiveErrors is the number of failed RPCs in a row ejecting a replica, zero disables the ejections.
+	ConsecutiveErrors  uint32 `json:"consecutiveErrors,omitempty"`
+	BaseEjectionTimeMs int64  `json:"baseEjectionTimeMs,omitempty"`
+	MaxEjectionTimeMs  int64  `json:"maxEjectionTimeMs,omitempty"`
+	MaxEjectionPercent uint32 `json:"maxEjectionPercent,omitempty"`
+}
+
+type builder struct{}
+
+func (builder) Name() string {
+	return Name
+}
+
+func (builder) ParseConfig(raw json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &Config{Policy: "round_robin"}
+	if err := json.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("%s: invalid config: %w", Name, err)
+	}
+	if cfg.Policy != "round_robin" && cfg.Policy != "least_request" {
+		return nil, fmt.Errorf("%s: unknown policy %q", Name, cfg.Policy)
+	}
+	return cfg, nil
+}
+
+// Build creates a balancer keeping a SubConn per resolved address, health checked through
+// grpc_health_v1 when the service config enables it.
+func (builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	b := &lbBalancer{endpoints: make(map[balancer.SubConn]*endpoint), cfg: &Config{Policy: "round_robin"}}
+	b.Balancer = base.NewBalancerBuilder(Name, b, base.Config{HealthCheck: true}).Build(cc, opts)
+	return b
+}
+
+// lbBalancer intercepts the config updates of the base balancer and builds its pickers.
+type lbBalancer struct {
+	balancer.Balancer
+
+	mu  sync.Mutex
+	cfg *Config
+	// endpoints keeps the state of the SubConns across the pickers.
+	endpoints map[balancer.SubConn]*endpoint
+	// ejections guards the outlier state of the endpoints, shared by the pickers.
+	ejections sync.Mutex
+}
+
+func (b *lbBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	if cfg, ok := s.BalancerConfig.(*Config); ok {
+		b.mu.Lock()
+		b.cfg = cfg
+		b.mu.Unlock()
+	}
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+// Build implements base.PickerBuilder, it is called whenever the set of ready SubConns changes.
+func (b *lbBalancer) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sc := range b.endpoints {
+		if _, ok := info.ReadySCs[sc]; !ok {
+			delete(b.endpoints, sc)
+		}
+	}
+	p := &picker{
+		cfg:       b.cfg,
+		ejections: &b.ejections,
+		now:       time.Now,
+	}
+	for sc, scInfo := range info.ReadySCs {
+		ep, ok := b.endpoints[sc]
+		if !ok {
+			ep = &endpoint{subConn: sc, address: scInfo.Address.Addr}
+			b.endpoints[sc] = ep
+		}
+		p.endpoints = append(p.endpoints, ep)
+	}
+	sort.Slice(p.endpoints, func(i, j int) bool { return p.endpoints[i].address < p.endpoints[j].address })
+	return p
+}
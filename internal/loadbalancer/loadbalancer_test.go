@@ -0,0 +1,162 @@
+package loadbalancer
+
+import (
+	"context"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancerSuite(t *testing.T) {
+	suite.Run(t, new(LoadBalancerTestSuite))
+}
+
+type LoadBalancerTestSuite struct {
+	suite.Suite
+}
+
+type fakeSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func (suite *LoadBalancerTestSuite) picker(cfg *Config, names ...string) (*picker, *time.Time) {
+	now := time.Unix(0, 0)
+	p := &picker{cfg: cfg, ejections: &sync.Mutex{}, now: func() time.Time { return now }}
+	for _, name := range names {
+		p.endpoints = append(p.endpoints, &endpoint{subConn: &fakeSubConn{name: name}, address: name})
+	}
+	return p, &now
+}
+
+// pick picks an endpoint and completes its RPC with err.
+func (suite *LoadBalancerTestSuite) pick(p *picker, err error) string {
+	result, pickErr := p.Pick(balancer.PickInfo{})
+	suite.Require().NoError(pickErr)
+	result.Done(balancer.DoneInfo{Err: err})
+	return result.SubConn.(*fakeSubConn).name
+}
+
+func (suite *LoadBalancerTestSuite) TestRoundRobin() {
+	p, _ := suite.picker(&Config{Policy: "round_robin"}, "a", "b", "c")
+
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, suite.pick(p, nil))
+	}
+	suite.Assert().Equal([]string{"a", "b", "c", "a"}, picked)
+}
+
+func (suite *LoadBalancerTestSuite) TestLeastRequest() {
+	p, _ := suite.picker(&Config{Policy: "least_request"}, "a", "b")
+	p.endpoints[0].inFlight.Store(10)
+
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		counts[suite.pick(p, nil)]++
+	}
+	suite.Assert().Greater(counts["b"], 60, "the busy endpoint is only picked when it is drawn twice")
+}
+
+func (suite *LoadBalancerTestSuite) TestOutlierEjection() {
+	cfg := &Config{Policy: "round_robin", ConsecutiveErrors: 2, BaseEjectionTimeMs: 1000, MaxEjectionTimeMs: 1500, MaxEjectionPercent: 50}
+	p, now := suite.picker(cfg, "a", "b", "c", "d")
+	failure := status.Error(codes.Unavailable, "down")
+
+	p.record(p.endpoints[0], failure)
+	p.record(p.endpoints[0], status.Error(codes.InvalidArgument, "bad request"))
+	p.record(p.endpoints[0], failure)
+	suite.Assert().Len(p.available(), 4, "the client errors reset the consecutive errors")
+
+	p.record(p.endpoints[0], failure)
+	suite.Assert().Len(p.available(), 3)
+	for i := 0; i < 4; i++ {
+		p.record(p.endpoints[1], failure)
+		p.record(p.endpoints[2], failure)
+	}
+	suite.Assert().Len(p.available(), 2, "at most half of the endpoints are ejected")
+
+	*now = now.Add(time.Second)
+	suite.Assert().Len(p.available(), 4, "the ejection expires")
+
+	p.record(p.endpoints[0], failure)
+	p.record(p.endpoints[0], failure)
+	suite.Assert().Equal(now.Add(1500*time.Millisecond), p.endpoints[0].ejectedUntil, "the second ejection is longer, up to the maximum")
+}
+
+func (suite *LoadBalancerTestSuite) TestServiceConfig() {
+	sc, err := ServiceConfig(conf.LoadBalancing{Policy: "least_request", HealthCheck: true, OutlierDetection: conf.OutlierDetection{Enabled: true}})
+	suite.Require().NoError(err)
+	suite.Assert().JSONEq(`{
+		"loadBalancingConfig": [{"yqapp_balancer": {"policy": "least_request", "consecutiveErrors": 5, "baseEjectionTimeMs": 30000, "maxEjectionTimeMs": 300000, "maxEjectionPercent": 50}}],
+		"healthCheckConfig": {"serviceName": ""}
+	}`, sc)
+
+	_, err = builder{}.ParseConfig([]byte(`{"policy": "random"}`))
+	suite.Assert().Error(err)
+}
+
+type countingServer struct {
+	v1.UnimplementedTaskServiceServer
+	calls atomic.Int32
+}
+
+func (s *countingServer) CreateTask(context.Context, *v1.CreateTaskRequest) (*v1.Task, error) {
+	s.calls.Add(1)
+	return &v1.Task{}, nil
+}
+
+// serve starts a consumer replica reporting the given health status.
+func (suite *LoadBalancerTestSuite) serve(serving healthv1.HealthCheckResponse_ServingStatus) (*countingServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+
+	srv := grpc.NewServer()
+	tasks := &countingServer{}
+	v1.RegisterTaskServiceServer(srv, tasks)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", serving)
+	healthv1.RegisterHealthServer(srv, healthServer)
+	go func() { _ = srv.Serve(listener) }()
+	suite.T().Cleanup(srv.Stop)
+	return tasks, listener.Addr().String()
+}
+
+func (suite *LoadBalancerTestSuite) TestPool() {
+	first, firstAddr := suite.serve(healthv1.HealthCheckResponse_SERVING)
+	second, secondAddr := suite.serve(healthv1.HealthCheckResponse_SERVING)
+	down, downAddr := suite.serve(healthv1.HealthCheckResponse_NOT_SERVING)
+
+	pool, err := Dial(conf.Client{
+		Endpoints:     []string{firstAddr, secondAddr, downAddr},
+		LoadBalancing: conf.LoadBalancing{HealthCheck: true},
+		PoolSize:      2,
+	}, "", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	suite.Require().NoError(err)
+	defer pool.Close()
+
+	client := v1.NewTaskServiceClient(pool)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 20; i++ {
+		_, err := client.CreateTask(ctx, &v1.CreateTaskRequest{}, grpc.WaitForReady(true))
+		suite.Require().NoError(err)
+	}
+
+	suite.Assert().Positive(first.calls.Load())
+	suite.Assert().Positive(second.calls.Load())
+	suite.Assert().Zero(down.calls.Load(), "the replicas not serving are skipped")
+	suite.Assert().Equal(int32(20), first.calls.Load()+second.calls.Load())
+}
@@ -0,0 +1,129 @@
+package loadbalancer
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// endpoint is a ready SubConn and the state used to balance the RPCs and eject it.
+type endpoint struct {
+	subConn balancer.SubConn
+	address string
+	// inFlight counts the RPCs in progress, used by the least_request policy.
+	inFlight atomic.Int32
+
+	// The outlier state is guarded by the ejections mutex of the balancer.
+	consecutiveErrors uint32
+	// ejections is the number of times the endpoint was ejected, lengthening the next ejection.
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// picker picks the endpoint of every RPC among the ready ones that are not ejected.
+type picker struct {
+	cfg       *Config
+	endpoints []*endpoint
+	ejections *sync.Mutex
+	next      atomic.Uint32
+	now       func() time.Time
+}
+
+func (p *picker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	candidates := p.available()
+
+	var picked *endpoint
+	switch p.cfg.Policy {
+	case "least_request":
+		// The power of two choices: the least loaded of two random endpoints
+		picked = candidates[rand.IntN(len(candidates))]
+		if other := candidates[rand.IntN(len(candidates))]; other.inFlight.Load() < picked.inFlight.Load() {
+			picked = other
+		}
+	default:
+		picked = candidates[int(p.next.Add(1)-1)%len(candidates)]
+	}
+
+	picked.inFlight.Add(1)
+	return balancer.PickResult{
+		SubConn: picked.subConn,
+		Done: func(info balancer.DoneInfo) {
+			picked.inFlight.Add(-1)
+			p.record(picked, info.Err)
+		},
+	}, nil
+}
+
+// available returns the endpoints that are not ejected, every endpoint when they all are.
+func (p *picker) available() []*endpoint {
+	if p.cfg.ConsecutiveErrors == 0 {
+		return p.endpoints
+	}
+
+	p.ejections.Lock()
+	defer p.ejections.Unlock()
+	now := p.now()
+	candidates := make([]*endpoint, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		if !now.Before(ep.ejectedUntil) {
+			candidates = append(candidates, ep)
+		}
+	}
+	if len(candidates) == 0 {
+		return p.endpoints
+	}
+	return candidates
+}
+
+// isServerError reports whether the RPC failed because of the replica rather than the request.
+func isServerError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// record updates the outlier state of the endpoint with the outcome of an RPC. The endpoint is
+// ejected after the configured number of consecutive server errors, unless the maximum share of
+// ejected endpoints is reached. Each ejection lasts longer than the previous one.
+func (p *picker) record(ep *endpoint, err error) {
+	if p.cfg.ConsecutiveErrors == 0 {
+		return
+	}
+
+	p.ejections.Lock()
+	defer p.ejections.Unlock()
+	now := p.now()
+	if !isServerError(err) {
+		ep.consecutiveErrors = 0
+		// A healthy endpoint slowly recovers its short ejection times
+		if ep.ejections > 0 && !now.Before(ep.ejectedUntil) && err == nil {
+			ep.ejections--
+		}
+		return
+	}
+
+	if ep.consecutiveErrors++; ep.consecutiveErrors < p.cfg.ConsecutiveErrors || now.Before(ep.ejectedUntil) {
+		return
+	}
+	ejected := 0
+	for _, other := range p.endpoints {
+		if now.Before(other.ejectedUntil) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > int(p.cfg.MaxEjectionPercent)*len(p.endpoints) {
+		return
+	}
+
+	ep.consecutiveErrors = 0
+	ep.ejections++
+	ejection := time.Duration(p.cfg.BaseEjectionTimeMs) * time.Millisecond * time.Duration(ep.ejections)
+	ep.ejectedUntil = now.Add(min(ejection, time.Duration(p.cfg.MaxEjectionTimeMs)*time.Millisecond))
+}
@@ -0,0 +1,120 @@
+package loadbalancer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/health" // Enables the client side health checks
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"sync/atomic"
+)
+
+// endpointsScheme is the resolver scheme of the configured consumer endpoints.
+const endpointsScheme = "consumers"
+
+// Pool spreads the RPCs over several connections, each balancing its RPCs across the consumer replicas.
+// It implements grpc.ClientConnInterface so that it can back any generated client.
+type Pool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint32
+}
+
+var _ grpc.ClientConnInterface = (*Pool)(nil)
+
+// Dial connects to the consumers configured by cfg, fallback is the target used when neither the
+// endpoints nor a target are configured.
+func Dial(cfg conf.Client, fallback string, opts ...grpc.DialOption) (*Pool, error) {
+	serviceConfig, err := ServiceConfig(cfg.LoadBalancing)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, grpc.WithDefaultServiceConfig(serviceConfig))
+	if cfg.Keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.Keepalive.Time,
+			Timeout:             cfg.Keepalive.GetTimeout(),
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}))
+	}
+
+	target := cfg.Target
+	if target == "" {
+		target = fallback
+	}
+
+	pool := &Pool{}
+	for i := 0; i < cfg.GetPoolSize(); i++ {
+		connOpts := opts
+		connTarget := target
+		if len(cfg.Endpoints) > 0 {
+			// Every connection needs a resolver of its own
+			r := manual.NewBuilderWithScheme(endpointsScheme)
+			r.InitialState(endpointsState(cfg.Endpoints))
+			connOpts = append(connOpts[:len(connOpts):len(connOpts)], grpc.WithResolvers(r))
+			connTarget = endpointsScheme + ":///"
+		}
+
+		cc, err := grpc.NewClient(connTarget, connOpts...)
+		if err != nil {
+			return nil, errors.Join(err, pool.Close())
+		}
+		pool.conns = append(pool.conns, cc)
+	}
+	return pool, nil
+}
+
+func endpointsState(endpoints []string) resolver.State {
+	state := resolver.State{}
+	for _, endpoint := range endpoints {
+		state.Endpoints = append(state.Endpoints, resolver.Endpoint{Addresses: []resolver.Address{{Addr: endpoint}}})
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: endpoint})
+	}
+	return state
+}
+
+// ServiceConfig returns the gRPC service config selecting the balancer with the given settings.
+func ServiceConfig(cfg conf.LoadBalancing) (string, error) {
+	lbConfig := Config{Policy: cfg.GetPolicy()}
+	if od := cfg.OutlierDetection; od.Enabled {
+		lbConfig.ConsecutiveErrors = uint32(od.GetConsecutiveErrors())
+		lbConfig.BaseEjectionTimeMs = od.GetBaseEjectionTime().Milliseconds()
+		lbConfig.MaxEjectionTimeMs = od.GetMaxEjectionTime().Milliseconds()
+		lbConfig.MaxEjectionPercent = uint32(od.GetMaxEjectionPercent())
+	}
+
+	serviceConfig := map[string]any{
+		"loadBalancingConfig": []map[string]any{{Name: lbConfig}},
+	}
+	if cfg.HealthCheck {
+		serviceConfig["healthCheckConfig"] = map[string]string{"serviceName": cfg.HealthService}
+	}
+	encoded, err := json.Marshal(serviceConfig)
+	return string(encoded), err
+}
+
+func (p *Pool) conn() *grpc.ClientConn {
+	return p.conns[int(p.next.Add(1)-1)%len(p.conns)]
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (p *Pool) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	return p.conn().Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (p *Pool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return p.conn().NewStream(ctx, desc, method, opts...)
+}
+
+// Close closes every connection of the pool.
+func (p *Pool) Close() error {
+	var err error
+	for _, cc := range p.conns {
+		err = errors.Join(err, cc.Close())
+	}
+	return err
+}
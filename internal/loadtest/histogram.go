@@ -0,0 +1,107 @@
+package loadtest
+
+import (
+	"math/bits"
+	"time"
+)
+
+// subBucketBits sets the precision of the histogram: 2^11 sub-buckets keep 3 significant digits.
+const (
+	subBucketBits  = 11
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records latencies with a microsecond resolution and 3 significant digits, following the
+// layout of an HDR histogram: the values below subBucketCount are counted exactly, each following
+// power of two is split into subBucketHalf buckets of equal width.
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram returns an empty Histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, subBucketCount)}
+}
+
+// Record adds a latency to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	i := bucketIndex(uint64(max(d.Microseconds(), 0)))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i-len(h.counts)+1)...)
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+// Merge adds the values recorded by other to the histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(other.counts)-len(h.counts))...)
+	}
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	h.total += other.total
+	h.sum += other.sum
+	h.max = max(h.max, other.max)
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Mean returns the average of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Quantile returns the value below which the given fraction of the recorded values fall, rounded up to
+// the highest value of its bucket and never above the largest recorded value.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.total) + 0.5)
+	rank = min(max(rank, 1), h.total)
+
+	var seen int64
+	for i, count := range h.counts {
+		if seen += count; seen >= rank {
+			return min(time.Duration(bucketHighest(i))*time.Microsecond, h.max)
+		}
+	}
+	return h.max
+}
+
+func bucketIndex(v uint64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBucketBits
+	return subBucketCount + (shift-1)*subBucketHalf + int(v>>shift) - subBucketHalf
+}
+
+// bucketHighest returns the highest value counted by the bucket.
+func bucketHighest(i int) uint64 {
+	if i < subBucketCount {
+		return uint64(i)
+	}
+	shift := (i-subBucketCount)/subBucketHalf + 1
+	sub := uint64((i-subBucketCount)%subBucketHalf + subBucketHalf)
+	return (sub+1)<<shift - 1
+}
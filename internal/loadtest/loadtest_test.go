@@ -0,0 +1,88 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+const method = "/tasks.v1.TaskService/CreateTask"
+
+func TestLoadTestSuite(t *testing.T) {
+	suite.Run(t, new(LoadTestTestSuite))
+}
+
+type LoadTestTestSuite struct {
+	suite.Suite
+}
+
+func (suite *LoadTestTestSuite) TestHistogram() {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	suite.Assert().Equal(int64(10000), h.Count())
+	suite.Assert().Equal(10*time.Second, h.Max())
+	for q, expected := range map[float64]time.Duration{0.5: 5 * time.Second, 0.9: 9 * time.Second, 0.99: 9900 * time.Millisecond, 0.999: 9990 * time.Millisecond} {
+		suite.Assert().InEpsilon(expected.Seconds(), h.Quantile(q).Seconds(), 0.001, "quantile %v within 3 significant digits", q)
+	}
+
+	small := NewHistogram()
+	small.Record(1500 * time.Microsecond)
+	suite.Assert().Equal(1500*time.Microsecond, small.Quantile(0.5), "values below 2048µs are exact")
+
+	h.Merge(small)
+	suite.Assert().Equal(int64(10001), h.Count())
+}
+
+func (suite *LoadTestTestSuite) TestReport() {
+	start := time.Unix(100, 0)
+	recorder := NewRecorder()
+	recorder.Record(method, nil, start.Add(-time.Second), time.Millisecond)
+	suite.Assert().Empty(recorder.histograms, "the RPCs are not recorded before the start")
+
+	recorder.Start(start)
+	recorder.Record(method, nil, start.Add(-time.Second), time.Millisecond)
+	for i := 0; i < 8; i++ {
+		recorder.Record(method, nil, start.Add(time.Duration(i)*time.Second), 10*time.Millisecond)
+	}
+	recorder.Record(method, status.Error(codes.Unavailable, "down"), start, 100*time.Millisecond)
+	recorder.Record(method, status.Error(codes.DeadlineExceeded, "slow"), start, time.Second)
+
+	report := recorder.Report(5 * time.Second)
+	suite.Assert().Equal(int64(10), report.Requests, "the warm-up requests are left out")
+	suite.Assert().Equal(int64(2), report.Errors)
+	suite.Assert().Equal(0.2, report.ErrorRate)
+	suite.Assert().Equal(map[string]int64{"Unavailable": 1, "DeadlineExceeded": 1}, report.ErrorsByCode)
+	suite.Assert().InDelta(10/7.01, report.Throughput, 0.001, "the throughput covers the completion of the last request")
+	suite.Assert().Equal([]string{"DeadlineExceeded", "OK", "Unavailable"}, []string{report.RPCs[0].Code, report.RPCs[1].Code, report.RPCs[2].Code})
+	suite.Assert().Equal(10.0, report.RPCs[1].Latency.P99)
+	suite.Assert().Equal(1000.0, report.Latency.Max)
+
+	suite.Assert().NoError(report.Check(conf.SLO{P50: 20 * time.Millisecond, MaxErrorRate: 0.5}))
+	suite.Assert().True(report.Passed)
+	suite.Assert().ErrorIs(report.Check(conf.SLO{P99: 500 * time.Millisecond, MaxErrorRate: 0.1}), ErrSLOViolated)
+	suite.Assert().Len(report.Violations, 2)
+
+	var buf bytes.Buffer
+	suite.Require().NoError(report.Write(&buf))
+	var decoded map[string]any
+	suite.Require().NoError(json.Unmarshal(buf.Bytes(), &decoded))
+	suite.Assert().Equal(false, decoded["slo_passed"])
+	suite.Assert().Contains(decoded["latency"], "p999_ms")
+}
+
+func (suite *LoadTestTestSuite) TestRateAt() {
+	cfg := conf.LoadTest{StartRate: 10, Rate: 110, RampUp: 10 * time.Second}
+	suite.Assert().Equal(rate.Limit(10), RateAt(cfg, -time.Second), "the warm-up runs at the start rate")
+	suite.Assert().InDelta(60, float64(RateAt(cfg, 5*time.Second)), 0.001)
+	suite.Assert().Equal(rate.Limit(110), RateAt(cfg, time.Minute))
+	suite.Assert().Equal(rate.Inf, RateAt(conf.LoadTest{}, 0), "a zero rate is unlimited")
+}
@@ -0,0 +1,23 @@
+package loadtest
+
+import (
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+// RateAt returns the arrival rate of a load test the given time after the end of its warm-up, negative
+// during the warm-up. The rate moves linearly from the start rate to the final rate during the ramp.
+// A zero rate is unlimited, the requests are then only bound by the concurrency.
+func RateAt(cfg conf.LoadTest, elapsed time.Duration) rate.Limit {
+	current := cfg.Rate
+	if elapsed < 0 {
+		current = cfg.GetStartRate()
+	} else if elapsed < cfg.RampUp {
+		current = cfg.GetStartRate() + (cfg.Rate-cfg.GetStartRate())*elapsed.Seconds()/cfg.RampUp.Seconds()
+	}
+	if current <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(current)
+}
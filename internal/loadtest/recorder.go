@@ -0,0 +1,102 @@
+package loadtest
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// key identifies the histogram of an RPC method and status code.
+type key struct {
+	method string
+	code   string
+}
+
+// Recorder records the latency of the RPCs started after the beginning of the measurement.
+type Recorder struct {
+	mu         sync.Mutex
+	histograms map[key]*Histogram
+	// start is the beginning of the measurement in Unix nanoseconds, zero while it has not started.
+	start atomic.Int64
+	// end is the completion time of the last recorded RPC.
+	end time.Time
+}
+
+// NewRecorder returns a Recorder waiting for Start.
+func NewRecorder() *Recorder {
+	return &Recorder{histograms: make(map[key]*Histogram)}
+}
+
+// Start begins the measurement, the RPCs started before are not recorded.
+func (r *Recorder) Start(at time.Time) {
+	r.start.Store(at.UnixNano())
+}
+
+// Record adds the latency of an RPC started at the given time.
+func (r *Recorder) Record(method string, err error, started time.Time, latency time.Duration) {
+	start := r.start.Load()
+	if start == 0 || started.UnixNano() < start {
+		return
+	}
+
+	k := key{method: method, code: status.Code(err).String()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	histogram, ok := r.histograms[k]
+	if !ok {
+		histogram = NewHistogram()
+		r.histograms[k] = histogram
+	}
+	histogram.Record(latency)
+	if end := started.Add(latency); end.After(r.end) {
+		r.end = end
+	}
+}
+
+// UnaryClientInterceptor records the latency of every unary RPC.
+func (r *Recorder) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		started := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		r.Record(method, err, started, time.Since(started))
+		return err
+	}
+}
+
+// Report summarizes the recorded RPCs. The throughput is computed over the time elapsed between
+// the start of the measurement and the completion of the last RPC, at least the given duration.
+func (r *Recorder) Report(duration time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{ErrorsByCode: make(map[string]int64)}
+	if start := r.start.Load(); start != 0 {
+		report.StartedAt = time.Unix(0, start).UTC()
+		duration = max(duration, r.end.Sub(report.StartedAt))
+	}
+	report.DurationSeconds = duration.Seconds()
+
+	all := NewHistogram()
+	for k, histogram := range r.histograms {
+		all.Merge(histogram)
+		report.RPCs = append(report.RPCs, RPCReport{Method: k.method, Code: k.code, Requests: histogram.Count(), Latency: newLatency(histogram)})
+		if k.code != "OK" {
+			report.Errors += histogram.Count()
+			report.ErrorsByCode[k.code] += histogram.Count()
+		}
+	}
+	report.sortRPCs()
+
+	report.Requests = all.Count()
+	report.Latency = newLatency(all)
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+	if duration > 0 {
+		report.Throughput = float64(report.Requests) / duration.Seconds()
+	}
+	return report
+}
@@ -0,0 +1,109 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"io"
+	"sort"
+	"time"
+)
+
+// ErrSLOViolated is returned by Check when the run misses one of its SLO thresholds.
+var ErrSLOViolated = errors.New("load test missed its SLO")
+
+// Report is the JSON summary of a load test.
+type Report struct {
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Requests        int64     `json:"requests"`
+	Errors          int64     `json:"errors"`
+	ErrorRate       float64   `json:"error_rate"`
+	// Throughput is the number of completed requests per second.
+	Throughput   float64          `json:"throughput"`
+	Latency      Latency          `json:"latency"`
+	ErrorsByCode map[string]int64 `json:"errors_by_code"`
+	RPCs         []RPCReport      `json:"rpcs"`
+	// Violations lists the missed SLO thresholds, the run passed when empty.
+	Violations []string `json:"slo_violations"`
+	Passed     bool     `json:"slo_passed"`
+}
+
+// RPCReport summarizes the requests of an RPC method ending with a status code.
+type RPCReport struct {
+	Method   string  `json:"method"`
+	Code     string  `json:"code"`
+	Requests int64   `json:"requests"`
+	Latency  Latency `json:"latency"`
+}
+
+// Latency holds the latency percentiles in milliseconds.
+type Latency struct {
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	P999 float64 `json:"p999_ms"`
+	Mean float64 `json:"mean_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+func newLatency(h *Histogram) Latency {
+	return Latency{
+		P50:  milliseconds(h.Quantile(0.5)),
+		P90:  milliseconds(h.Quantile(0.9)),
+		P99:  milliseconds(h.Quantile(0.99)),
+		P999: milliseconds(h.Quantile(0.999)),
+		Mean: milliseconds(h.Mean()),
+		Max:  milliseconds(h.Max()),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r *Report) sortRPCs() {
+	sort.Slice(r.RPCs, func(i, j int) bool {
+		if r.RPCs[i].Method != r.RPCs[j].Method {
+			return r.RPCs[i].Method < r.RPCs[j].Method
+		}
+		return r.RPCs[i].Code < r.RPCs[j].Code
+	})
+}
+
+// Check compares the report with the SLO thresholds and records the violations.
+// It returns ErrSLOViolated when a threshold is missed.
+func (r *Report) Check(slo conf.SLO) error {
+	r.Violations = nil
+	for _, threshold := range []struct {
+		name   string
+		limit  time.Duration
+		actual float64
+	}{
+		{"p50", slo.P50, r.Latency.P50},
+		{"p90", slo.P90, r.Latency.P90},
+		{"p99", slo.P99, r.Latency.P99},
+		{"p999", slo.P999, r.Latency.P999},
+	} {
+		if threshold.limit > 0 && threshold.actual > milliseconds(threshold.limit) {
+			r.Violations = append(r.Violations, fmt.Sprintf("%s latency %.3fms exceeds %s", threshold.name, threshold.actual, threshold.limit))
+		}
+	}
+	if slo.MaxErrorRate > 0 && r.ErrorRate > slo.MaxErrorRate {
+		r.Violations = append(r.Violations, fmt.Sprintf("error rate %.4f exceeds %.4f", r.ErrorRate, slo.MaxErrorRate))
+	}
+
+	r.Passed = len(r.Violations) == 0
+	if !r.Passed {
+		return ErrSLOViolated
+	}
+	return nil
+}
+
+// Write encodes the report as indented JSON.
+func (r *Report) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
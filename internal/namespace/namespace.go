@@ -0,0 +1,83 @@
+package namespace
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"regexp"
+)
+
+// Header is the metadata key naming the namespace of a request.
+const Header = "x-namespace"
+
+// Default is the namespace of the requests naming none.
+const Default = "default"
+
+var validName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Valid reports whether name is a valid namespace: up to 63 lowercase alphanumeric characters
+// or dashes, starting and ending with an alphanumeric character.
+func Valid(name string) bool {
+	return validName.MatchString(name)
+}
+
+type namespaceKey struct{}
+
+// NewContext returns a copy of ctx holding the given namespace.
+func NewContext(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// FromContext returns the namespace of the current request, Default if none has been resolved.
+func FromContext(ctx context.Context) string {
+	if namespace, ok := ctx.Value(namespaceKey{}).(string); ok {
+		return namespace
+	}
+	return Default
+}
+
+// Resolve returns the namespace of the request. Callers bound to a namespace, e.g. by their token,
+// always use it and are denied access to any other one. Other callers name the namespace in the
+// Header metadata and fall back to Default.
+func Resolve(ctx context.Context, bound string) (string, error) {
+	requested := metadata.ValueFromIncomingContext(ctx, Header)
+	if len(requested) > 1 {
+		return "", status.Error(codes.InvalidArgument, "a single namespace must be requested")
+	}
+	if len(requested) == 1 && !Valid(requested[0]) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid namespace %q", requested[0])
+	}
+
+	if bound != "" {
+		if len(requested) == 1 && requested[0] != bound {
+			return "", status.Errorf(codes.PermissionDenied, "access to namespace %q denied", requested[0])
+		}
+		return bound, nil
+	}
+	if len(requested) == 1 {
+		return requested[0], nil
+	}
+	return Default, nil
+}
+
+// credentials names the namespace of every outgoing RPC.
+type credentials struct {
+	namespace string
+}
+
+// NewCredentials returns credentials.PerRPCCredentials sending the given namespace in the Header metadata.
+func NewCredentials(namespace string) grpccredentials.PerRPCCredentials {
+	return credentials{namespace: namespace}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c credentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{Header: c.namespace}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c credentials) RequireTransportSecurity() bool {
+	return false
+}
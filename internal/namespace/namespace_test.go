@@ -0,0 +1,60 @@
+package namespace
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestNamespaceSuite(t *testing.T) {
+	suite.Run(t, new(NamespaceTestSuite))
+}
+
+type NamespaceTestSuite struct {
+	suite.Suite
+}
+
+func (suite *NamespaceTestSuite) withHeader(values ...string) context.Context {
+	md := metadata.MD{}
+	for _, value := range values {
+		md.Append(Header, value)
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func (suite *NamespaceTestSuite) TestResolve() {
+	ns, err := Resolve(context.Background(), "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(Default, ns)
+
+	ns, err = Resolve(suite.withHeader("team-a"), "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("team-a", ns)
+
+	ns, err = Resolve(context.Background(), "team-b")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("team-b", ns, "bound callers use their namespace")
+
+	ns, err = Resolve(suite.withHeader("team-b"), "team-b")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("team-b", ns)
+}
+
+func (suite *NamespaceTestSuite) TestResolve_Denied() {
+	_, err := Resolve(suite.withHeader("team-a"), "team-b")
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = Resolve(suite.withHeader("Team A"), "")
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = Resolve(suite.withHeader("team-a", "team-b"), "")
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (suite *NamespaceTestSuite) TestFromContext() {
+	suite.Assert().Equal(Default, FromContext(context.Background()))
+	suite.Assert().Equal("team-a", FromContext(NewContext(context.Background(), "team-a")))
+}
@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"encoding/json"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"strconv"
+	"time"
+)
+
+// ContentType is the media type of a CloudEvent in the structured JSON mode.
+const ContentType = "application/cloudevents+json"
+
+// CloudEvent is a task lifecycle event in the CloudEvents 1.0 JSON format.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// NewCloudEvent converts an outbox event to a CloudEvent. Its id is the outbox id, unique
+// for a given source, so that the subscribers can discard the events delivered twice.
+func NewCloudEvent(source string, event store.OutboxEvent) CloudEvent {
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              strconv.FormatInt(event.ID, 10),
+		Source:          source,
+		Type:            event.Type,
+		Subject:         strconv.FormatUint(uint64(event.TaskID), 10),
+		Time:            event.Time.UTC(),
+		DataContentType: "application/json",
+		Data:            event.Data,
+	}
+}
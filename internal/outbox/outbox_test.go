@@ -0,0 +1,94 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOutboxSuite(t *testing.T) {
+	suite.Run(t, new(OutboxTestSuite))
+}
+
+type OutboxTestSuite struct {
+	suite.Suite
+}
+
+func (suite *OutboxTestSuite) TestRelay() {
+	st := store.NewMemory().WithOutbox()
+	created := time.Unix(1, 0).UTC()
+	id, err := st.CreateTask(context.Background(), &domain.Task{Type: 1, Value: 2, State: domain.StateRECEIVED, CreationTime: created, LastUpdateTime: created, Namespace: "default"})
+	suite.Require().NoError(err)
+	_, err = st.UpdateTaskState(context.Background(), id, domain.StateDONE, time.Unix(5, 0).UTC())
+	suite.Require().NoError(err)
+
+	sink := NewMemorySink()
+	relay := NewRelay(st, sink, conf.Outbox{Source: "/test", BatchSize: 10}, zap.NewNop())
+	n, err := relay.RelayOnce(context.Background())
+	suite.Require().NoError(err)
+	suite.Assert().Equal(2, n)
+
+	events := sink.Events()
+	suite.Require().Len(events, 2)
+	done := events[1]
+	suite.Assert().Equal("1.0", done.SpecVersion)
+	suite.Assert().Equal("2", done.ID)
+	suite.Assert().Equal("/test", done.Source)
+	suite.Assert().Equal(store.EventTaskDone, done.Type)
+	suite.Assert().Equal("1", done.Subject)
+	suite.Assert().Equal("application/json", done.DataContentType)
+	suite.Assert().JSONEq(`{"id":1,"type":1,"value":2,"state":"DONE","creation_time":"1970-01-01T00:00:01Z","last_update_time":"1970-01-01T00:00:05Z","finished_at":"1970-01-01T00:00:05Z","namespace":"default"}`, string(done.Data))
+
+	n, err = relay.RelayOnce(context.Background())
+	suite.Require().NoError(err)
+	suite.Assert().Zero(n, "published events are removed from the outbox")
+}
+
+func (suite *OutboxTestSuite) TestWebhook() {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		suite.Assert().Equal(ContentType, r.Header.Get("Content-Type"))
+		suite.Assert().Equal(Sign([]byte("secret"), body), r.Header.Get(SignatureHeader))
+
+		var event CloudEvent
+		suite.Assert().NoError(json.Unmarshal(body, &event))
+		suite.Assert().Equal("7", event.ID)
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(conf.Webhook{URL: server.URL, Secret: "secret", MaxAttempts: 3, Backoff: time.Millisecond})
+	defer sink.Close()
+	suite.Require().NoError(sink.Send(context.Background(), CloudEvent{ID: "7", Data: json.RawMessage(`{}`)}))
+	suite.Assert().Equal(int32(2), calls.Load(), "the unavailable endpoint is retried")
+}
+
+func (suite *OutboxTestSuite) TestWebhook_PermanentFailure() {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(conf.Webhook{URL: server.URL, MaxAttempts: 3, Backoff: time.Millisecond})
+	defer sink.Close()
+	suite.Assert().Error(sink.Send(context.Background(), CloudEvent{ID: "7", Data: json.RawMessage(`{}`)}))
+	suite.Assert().Equal(int32(1), calls.Load(), "a rejected event is not retried")
+}
@@ -0,0 +1,77 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Relay publishes the events of the outbox to a sink. The events are delivered at least once,
+// in the outbox order for a single relay, and removed from the outbox once published.
+type Relay struct {
+	outbox       store.OutboxStore
+	sink         Sink
+	source       string
+	batchSize    int
+	pollInterval time.Duration
+	logger       *zap.Logger
+}
+
+// NewRelay initializes a new Relay from the outbox to the sink.
+func NewRelay(outbox store.OutboxStore, sink Sink, cfg conf.Outbox, logger *zap.Logger) *Relay {
+	return &Relay{
+		outbox:       outbox,
+		sink:         sink,
+		source:       cfg.Source,
+		batchSize:    cfg.GetBatchSize(),
+		pollInterval: cfg.GetPollInterval(),
+		logger:       logger,
+	}
+}
+
+// NewSink initializes the sink selected by the configuration.
+func NewSink(cfg conf.Outbox) (Sink, error) {
+	switch cfg.Sink {
+	case "webhook":
+		return NewWebhookSink(cfg.Webhook), nil
+	case "file":
+		return NewFileSink(cfg.FilePath)
+	default:
+		return nil, fmt.Errorf("unsupported outbox sink %q", cfg.Sink)
+	}
+}
+
+// Run relays the events until ctx is done. The outbox is polled every poll interval
+// unless the previous run published a full batch.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Warn("Failed to publish outbox events", zap.Int("published", n), zap.Error(err))
+		}
+		if n == r.batchSize && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// RelayOnce publishes a single batch of events and returns the number of events published.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	return r.outbox.RelayEvents(ctx, r.batchSize, func(events []store.OutboxEvent) (int, error) {
+		for i, event := range events {
+			if err := r.sink.Send(ctx, NewCloudEvent(r.source, event)); err != nil {
+				return i, err
+			}
+		}
+		return len(events), nil
+	})
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Sink publishes the events relayed from the outbox.
+type Sink interface {
+	// Send publishes a single event, an error leaves the event in the outbox.
+	Send(ctx context.Context, event CloudEvent) error
+	// Close releases the resources held by the sink.
+	Close() error
+}
+
+// FileSink appends the events to a JSONL file, one event per line.
+type FileSink struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileSink opens the file at the given path for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (s *FileSink) Send(_ context.Context, event CloudEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(event)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// MemorySink keeps the events in memory. It is meant for tests.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []CloudEvent
+}
+
+// NewMemorySink initializes a new empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Send(_ context.Context, event CloudEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the events sent so far.
+func (s *MemorySink) Events() []CloudEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CloudEvent(nil), s.events...)
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body, prefixed with "sha256=".
+const SignatureHeader = "X-Yqapp-Signature"
+
+// maxWebhookBackoff caps the wait between two deliveries of an event.
+const maxWebhookBackoff = 30 * time.Second
+
+// WebhookSink posts each event to an HTTP endpoint, retrying the failed deliveries.
+type WebhookSink struct {
+	url         string
+	secret      []byte
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewWebhookSink initializes a new WebhookSink with the given settings.
+func NewWebhookSink(cfg conf.Webhook) *WebhookSink {
+	return &WebhookSink{
+		url:         cfg.URL,
+		secret:      []byte(cfg.Secret),
+		client:      &http.Client{Timeout: cfg.GetTimeout()},
+		maxAttempts: cfg.GetMaxAttempts(),
+		backoff:     cfg.Backoff,
+	}
+}
+
+// Sign returns the value of the SignatureHeader for the given body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts the event until the endpoint answers with a 2xx status. Network errors, 429 and
+// 5xx answers are retried with an exponential backoff, any other answer fails the delivery at once.
+func (s *WebhookSink) Send(ctx context.Context, event CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.maxAttempts {
+			return fmt.Errorf("delivering event %s after %d attempts: %w", event.ID, attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxWebhookBackoff)
+	}
+}
+
+// post sends a single request and reports whether a failure may be retried.
+func (s *WebhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", ContentType)
+	if len(s.secret) > 0 {
+		request.Header.Set(SignatureHeader, Sign(s.secret, body))
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer response.Body.Close()
+	// Drain the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return true, errors.New("webhook answered " + response.Status)
+	default:
+		return false, errors.New("webhook answered " + response.Status)
+	}
+}
+
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
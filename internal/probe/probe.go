@@ -0,0 +1,236 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LivenessSuffix is appended to the service name for its liveness status in the health service,
+// the readiness status is reported under the service name itself and as the overall server status.
+const LivenessSuffix = "/liveness"
+
+// Check verifies a single condition of the service, Run returns nil when it holds.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the outcome of a Check, Error is empty when it passed.
+type Result struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of the liveness or readiness checks.
+type Report struct {
+	OK        bool      `json:"ok"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Options configures a Prober.
+type Options struct {
+	// Service is the name reported in the health service, e.g. api.tasks.v1.TaskService.
+	Service string
+	// Interval is the interval between two runs of the checks.
+	Interval time.Duration
+	// Timeout bounds every check, a check still running after it fails.
+	Timeout   time.Duration
+	Liveness  []Check
+	Readiness []Check
+	// Health receives the statuses after every run, it is optional.
+	Health *health.Server
+	Logger *zap.Logger
+}
+
+// Prober runs the liveness and readiness checks of a service at a regular interval. The service is
+// live while the checks keep running and its liveness checks pass, and ready while its readiness checks
+// pass and it is not draining. The last reports are served by the HTTP handlers and published in the
+// gRPC health service.
+type Prober struct {
+	opts Options
+
+	mu        sync.Mutex
+	liveness  Report
+	readiness Report
+	lastRun   time.Time
+	draining  bool
+}
+
+// New initializes a new Prober, the service is not ready until the checks have run once.
+func New(opts Options) *Prober {
+	return &Prober{
+		opts:      opts,
+		liveness:  Report{OK: true},
+		readiness: Report{Checks: []Result{{Name: "checks", Error: "not run yet"}}},
+		lastRun:   time.Now(),
+	}
+}
+
+// Run runs the checks right away and then at every interval until ctx is done.
+func (p *Prober) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		p.Check(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check runs every check once and publishes the reports.
+func (p *Prober) Check(ctx context.Context) {
+	liveness := p.run(ctx, p.opts.Liveness)
+	readiness := p.run(ctx, p.opts.Readiness)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if readiness.OK != p.readiness.OK {
+		if readiness.OK {
+			p.opts.Logger.Info("Service ready", zap.String("service", p.opts.Service))
+		} else {
+			p.opts.Logger.Warn("Service not ready", zap.String("service", p.opts.Service), zap.Strings("health.failures", failures(readiness)))
+		}
+	}
+	if !liveness.OK && p.liveness.OK {
+		p.opts.Logger.Error("Service not live", zap.String("service", p.opts.Service), zap.Strings("health.failures", failures(liveness)))
+	}
+	p.liveness, p.readiness, p.lastRun = liveness, readiness, time.Now()
+	p.publishLocked()
+}
+
+// Shutdown reports the service as draining: it stops being ready but stays live until the process exits.
+func (p *Prober) Shutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draining = true
+	p.publishLocked()
+}
+
+// Liveness returns the last liveness report. It fails when the checks have not run for two intervals.
+func (p *Prober) Liveness() Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.livenessLocked()
+}
+
+// Readiness returns the last readiness report.
+func (p *Prober) Readiness() Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.readinessLocked()
+}
+
+// LivezHandler serves the liveness report as JSON, with a 503 status code when it fails.
+func (p *Prober) LivezHandler() http.Handler {
+	return reportHandler(p.Liveness)
+}
+
+// ReadyzHandler serves the readiness report as JSON, with a 503 status code when it fails.
+func (p *Prober) ReadyzHandler() http.Handler {
+	return reportHandler(p.Readiness)
+}
+
+func reportHandler(report func() Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		r := report()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !r.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(r)
+	})
+}
+
+// run runs the checks concurrently, a check not done within the timeout fails and is left running.
+func (p *Prober) run(ctx context.Context, checks []Check) Report {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	errs := make([]chan error, len(checks))
+	for i, check := range checks {
+		errs[i] = make(chan error, 1)
+		go func() { errs[i] <- check.Run(ctx) }()
+	}
+
+	report := Report{OK: true, CheckedAt: time.Now(), Checks: make([]Result, len(checks))}
+	for i, check := range checks {
+		var err error
+		select {
+		case err = <-errs[i]:
+		case <-ctx.Done():
+			select {
+			case err = <-errs[i]:
+			default:
+				err = fmt.Errorf("no answer within %s", p.opts.Timeout)
+			}
+		}
+		report.Checks[i] = Result{Name: check.Name}
+		if err != nil {
+			report.OK = false
+			report.Checks[i].Error = err.Error()
+		}
+	}
+	return report
+}
+
+func (p *Prober) livenessLocked() Report {
+	report := p.liveness
+	result := Result{Name: "checks"}
+	if since := time.Since(p.lastRun); since > 2*p.opts.Interval+p.opts.Timeout {
+		report.OK = false
+		result.Error = fmt.Sprintf("last run %s ago", since.Round(time.Second))
+	}
+	report.Checks = append(slices.Clip(report.Checks), result)
+	return report
+}
+
+func (p *Prober) readinessLocked() Report {
+	report := p.readiness
+	result := Result{Name: "drain"}
+	if p.draining {
+		report.OK = false
+		result.Error = "draining"
+	}
+	report.Checks = append(slices.Clip(report.Checks), result)
+	return report
+}
+
+func (p *Prober) publishLocked() {
+	if p.opts.Health == nil {
+		return
+	}
+	ready := servingStatus(p.readinessLocked().OK)
+	p.opts.Health.SetServingStatus(p.opts.Service+LivenessSuffix, servingStatus(p.livenessLocked().OK))
+	p.opts.Health.SetServingStatus(p.opts.Service, ready)
+	p.opts.Health.SetServingStatus("", ready)
+}
+
+func servingStatus(ok bool) healthv1.HealthCheckResponse_ServingStatus {
+	if ok {
+		return healthv1.HealthCheckResponse_SERVING
+	}
+	return healthv1.HealthCheckResponse_NOT_SERVING
+}
+
+func failures(report Report) []string {
+	var failed []string
+	for _, result := range report.Checks {
+		if result.Error != "" {
+			failed = append(failed, result.Name+": "+result.Error)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const service = "api.tasks.v1.TaskService"
+
+func TestProbeSuite(t *testing.T) {
+	suite.Run(t, new(ProbeTestSuite))
+}
+
+type ProbeTestSuite struct {
+	suite.Suite
+	health *health.Server
+	dbErr  atomic.Pointer[error]
+	prober *Prober
+}
+
+func (suite *ProbeTestSuite) SetupTest() {
+	suite.health = health.NewServer()
+	suite.dbErr.Store(new(error))
+	suite.prober = New(Options{
+		Service:  service,
+		Interval: time.Minute,
+		Timeout:  50 * time.Millisecond,
+		Readiness: []Check{
+			{Name: "database", Run: func(context.Context) error { return *suite.dbErr.Load() }},
+		},
+		Health: suite.health,
+		Logger: zap.NewNop(),
+	})
+}
+
+func (suite *ProbeTestSuite) status(name string) healthv1.HealthCheckResponse_ServingStatus {
+	response, err := suite.health.Check(context.Background(), &healthv1.HealthCheckRequest{Service: name})
+	suite.Require().NoError(err)
+	return response.GetStatus()
+}
+
+func (suite *ProbeTestSuite) serve(handler http.Handler) (int, Report) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	suite.Require().NoError(json.NewDecoder(recorder.Body).Decode(&report))
+	return recorder.Code, report
+}
+
+func (suite *ProbeTestSuite) TestNotReadyBeforeFirstRun() {
+	suite.Assert().False(suite.prober.Readiness().OK)
+	suite.Assert().True(suite.prober.Liveness().OK)
+}
+
+func (suite *ProbeTestSuite) TestReadiness() {
+	suite.prober.Check(context.Background())
+	suite.Assert().Equal(healthv1.HealthCheckResponse_SERVING, suite.status(service))
+	suite.Assert().Equal(healthv1.HealthCheckResponse_SERVING, suite.status(""))
+	code, report := suite.serve(suite.prober.ReadyzHandler())
+	suite.Assert().Equal(http.StatusOK, code)
+	suite.Assert().Equal([]Result{{Name: "database"}, {Name: "drain"}}, report.Checks)
+
+	dbErr := errors.New("connection refused")
+	suite.dbErr.Store(&dbErr)
+	suite.prober.Check(context.Background())
+	suite.Assert().Equal(healthv1.HealthCheckResponse_NOT_SERVING, suite.status(service))
+	suite.Assert().Equal(healthv1.HealthCheckResponse_NOT_SERVING, suite.status(""))
+	suite.Assert().Equal(healthv1.HealthCheckResponse_SERVING, suite.status(service+LivenessSuffix))
+	code, report = suite.serve(suite.prober.ReadyzHandler())
+	suite.Assert().Equal(http.StatusServiceUnavailable, code)
+	suite.Assert().Equal(Result{Name: "database", Error: "connection refused"}, report.Checks[0])
+
+	code, _ = suite.serve(suite.prober.LivezHandler())
+	suite.Assert().Equal(http.StatusOK, code)
+}
+
+func (suite *ProbeTestSuite) TestCheckTimeout() {
+	suite.prober.opts.Readiness = append(suite.prober.opts.Readiness, Check{Name: "stuck", Run: func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+
+	start := time.Now()
+	suite.prober.Check(context.Background())
+	suite.Assert().Less(time.Since(start), time.Second)
+
+	report := suite.prober.Readiness()
+	suite.Assert().False(report.OK)
+	suite.Assert().Equal(Result{Name: "database"}, report.Checks[0])
+	suite.Assert().Equal("stuck", report.Checks[1].Name)
+	suite.Assert().NotEmpty(report.Checks[1].Error)
+}
+
+func (suite *ProbeTestSuite) TestShutdown() {
+	suite.prober.Check(context.Background())
+	suite.prober.Shutdown()
+
+	suite.Assert().Equal(healthv1.HealthCheckResponse_NOT_SERVING, suite.status(service))
+	suite.Assert().Equal(healthv1.HealthCheckResponse_SERVING, suite.status(service+LivenessSuffix))
+
+	// The checks keep running while draining without making the service ready again
+	suite.prober.Check(context.Background())
+	report := suite.prober.Readiness()
+	suite.Assert().False(report.OK)
+	suite.Assert().Equal(Result{Name: "drain", Error: "draining"}, report.Checks[len(report.Checks)-1])
+	suite.Assert().True(suite.prober.Liveness().OK)
+}
+
+func (suite *ProbeTestSuite) TestLiveness_StaleChecks() {
+	suite.prober.Check(context.Background())
+	suite.prober.lastRun = time.Now().Add(-3 * time.Minute)
+
+	code, report := suite.serve(suite.prober.LivezHandler())
+	suite.Assert().Equal(http.StatusServiceUnavailable, code)
+	suite.Assert().Equal("checks", report.Checks[0].Name)
+	suite.Assert().Contains(report.Checks[0].Error, "last run")
+}
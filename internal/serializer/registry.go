@@ -0,0 +1,338 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat is returned by Lookup for the formats that are not registered.
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Encoder writes a stream of values. Close completes the stream, e.g. with the closing bracket of a
+// JSON array, without closing the underlying writer.
+type Encoder interface {
+	Encode(v any) error
+	Close() error
+}
+
+// Decoder reads a stream of values written by the Encoder of the same format, io.EOF ends the stream.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Codec reads and writes streams of values in a format. The values implementing JSON, YAML or CSV
+// are converted with their own methods.
+type Codec struct {
+	Format      Format
+	ContentType string
+	// Extension is the file extension of the format, without the dot.
+	Extension  string
+	NewEncoder func(w io.Writer) Encoder
+	NewDecoder func(r io.Reader) Decoder
+}
+
+var registry = struct {
+	sync.RWMutex
+	codecs map[Format]Codec
+}{codecs: make(map[Format]Codec)}
+
+func init() {
+	Register(Codec{Format: FormatJSON, ContentType: "application/json", Extension: "json", NewEncoder: newJSONEncoder, NewDecoder: newJSONDecoder})
+	Register(Codec{Format: FormatNDJSON, ContentType: "application/x-ndjson", Extension: "ndjson", NewEncoder: newNDJSONEncoder, NewDecoder: newNDJSONDecoder})
+	Register(Codec{Format: FormatYAML, ContentType: "application/yaml", Extension: "yaml", NewEncoder: newYAMLEncoder, NewDecoder: newYAMLDecoder})
+	Register(Codec{Format: FormatCSV, ContentType: "text/csv", Extension: "csv", NewEncoder: newCSVEncoder, NewDecoder: newCSVDecoder})
+}
+
+// Register makes a codec available by the name of its format, it panics if the format is registered twice.
+func Register(codec Codec) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.codecs[codec.Format]; ok {
+		panic(fmt.Sprintf("serializer: format %s registered twice", codec.Format))
+	}
+	registry.codecs[codec.Format] = codec
+}
+
+// Lookup returns the codec of a format by its case-insensitive name.
+func Lookup(name string) (Codec, error) {
+	registry.RLock()
+	codec, ok := registry.codecs[Format(strings.ToLower(name))]
+	registry.RUnlock()
+	if !ok {
+		return Codec{}, fmt.Errorf("%w %q, expected one of %s", ErrUnknownFormat, name, joinFormats(Formats()))
+	}
+	return codec, nil
+}
+
+// Formats returns the registered formats sorted by name.
+func Formats() []Format {
+	registry.RLock()
+	defer registry.RUnlock()
+	formats := make([]Format, 0, len(registry.codecs))
+	for format := range registry.codecs {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+func joinFormats(formats []Format) string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = string(format)
+	}
+	return strings.Join(names, ", ")
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	if j, ok := v.(JSON); ok {
+		return j.JSON()
+	}
+	return json.Marshal(v)
+}
+
+func unmarshalJSON(data []byte, v any) error {
+	if j, ok := v.(JSON); ok {
+		return j.FromJSON(data)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jsonEncoder writes the values as the elements of a JSON array, a line each.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONEncoder(w io.Writer) Encoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) Encode(v any) error {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if e.count == 0 {
+		separator = "[\n"
+	}
+	e.count++
+	_, err = e.w.Write(slices.Concat([]byte(separator), data))
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	closing := "\n]\n"
+	if e.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+type jsonDecoder struct {
+	decoder *json.Decoder
+	opened  bool
+}
+
+func newJSONDecoder(r io.Reader) Decoder {
+	return &jsonDecoder{decoder: json.NewDecoder(r)}
+}
+
+func (d *jsonDecoder) Decode(v any) error {
+	if !d.opened {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token != json.Delim('[') {
+			return errors.New("serializer: expected a JSON array")
+		}
+		d.opened = true
+	}
+	if !d.decoder.More() {
+		if _, err := d.decoder.Token(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	var raw json.RawMessage
+	if err := d.decoder.Decode(&raw); err != nil {
+		return err
+	}
+	return unmarshalJSON(raw, v)
+}
+
+// ndjsonEncoder writes a JSON document per line.
+type ndjsonEncoder struct {
+	w io.Writer
+}
+
+func newNDJSONEncoder(w io.Writer) Encoder {
+	return ndjsonEncoder{w: w}
+}
+
+func (e ndjsonEncoder) Encode(v any) error {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	// Line breaks are not significant in JSON, only the ones between the documents are kept
+	if bytes.ContainsAny(data, "\r\n") {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, data); err != nil {
+			return err
+		}
+		data = compact.Bytes()
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func (e ndjsonEncoder) Close() error {
+	return nil
+}
+
+type ndjsonDecoder struct {
+	decoder *json.Decoder
+}
+
+func newNDJSONDecoder(r io.Reader) Decoder {
+	return ndjsonDecoder{decoder: json.NewDecoder(r)}
+}
+
+func (d ndjsonDecoder) Decode(v any) error {
+	var raw json.RawMessage
+	if err := d.decoder.Decode(&raw); err != nil {
+		return err
+	}
+	return unmarshalJSON(raw, v)
+}
+
+// yamlEncoder writes a YAML document per value.
+type yamlEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newYAMLEncoder(w io.Writer) Encoder {
+	return &yamlEncoder{w: w}
+}
+
+func (e *yamlEncoder) Encode(v any) error {
+	var data []byte
+	var err error
+	if y, ok := v.(YAML); ok {
+		data, err = y.YAML()
+	} else {
+		data, err = yaml.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		data = slices.Concat([]byte("---\n"), data)
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *yamlEncoder) Close() error {
+	return nil
+}
+
+type yamlDecoder struct {
+	decoder *yaml.Decoder
+}
+
+func newYAMLDecoder(r io.Reader) Decoder {
+	return yamlDecoder{decoder: yaml.NewDecoder(r)}
+}
+
+func (d yamlDecoder) Decode(v any) error {
+	y, ok := v.(YAML)
+	if !ok {
+		return d.decoder.Decode(v)
+	}
+	var node yaml.Node
+	if err := d.decoder.Decode(&node); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return err
+	}
+	return y.FromYAML(data)
+}
+
+// csvEncoder writes the header of the first value and a row per value.
+type csvEncoder struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) Encoder {
+	return &csvEncoder{writer: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Encode(v any) error {
+	c, ok := v.(CSV)
+	if !ok {
+		return fmt.Errorf("serializer: %T cannot be written as CSV", v)
+	}
+	if !e.header {
+		if err := e.writer.Write(c.CSVHeader()); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	if err := e.writer.Write(c.CSV()); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	return nil
+}
+
+type csvDecoder struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVDecoder(r io.Reader) Decoder {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	return &csvDecoder{reader: reader}
+}
+
+func (d *csvDecoder) Decode(v any) error {
+	c, ok := v.(CSV)
+	if !ok {
+		return fmt.Errorf("serializer: %T cannot be read from CSV", v)
+	}
+	if d.header == nil {
+		header, err := d.reader.Read()
+		if err != nil {
+			return err
+		}
+		d.header = slices.Clone(header)
+	}
+	record, err := d.reader.Read()
+	if err != nil {
+		return err
+	}
+	return c.FromCSV(d.header, record)
+}
@@ -7,6 +7,10 @@ type Format string
 const (
 	FormatJSON Format = "json"
 	FormatYAML Format = "yaml"
+	// FormatCSV writes a header row naming the fields followed by a row per value.
+	FormatCSV Format = "csv"
+	// FormatNDJSON writes a JSON document per line.
+	FormatNDJSON Format = "ndjson"
 )
 
 // JSON holds a method to convert an underlying implementation to JSON format.
@@ -21,6 +25,14 @@ type YAML interface {
 	FromYAML(data []byte) error
 }
 
+// CSV holds the methods to convert an underlying implementation to a CSV row. FromCSV reads a row
+// whose columns are named by header, which may be in any order.
+type CSV interface {
+	CSVHeader() []string
+	CSV() []string
+	FromCSV(header, record []string) error
+}
+
 // API holds a method to convert an underlying implementation to its API counterpart.
 // This method uses generics to support different API entities.
 type API[T any] interface {
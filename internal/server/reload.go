@@ -0,0 +1,58 @@
+package server
+
+import (
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// reloadable lists the configuration keys applied by a running consumer and the sections it does not use.
+// Every other consumer setting requires a restart.
+var reloadable = conf.Reloadable{
+	Live: []string{
+		"consumerService.messageConsumptionRate",
+		"consumerService.workers",
+		"consumerService.logLevel",
+		"consumerService.handlerTimeout",
+		"namespaces.limits",
+	},
+	Ignored: []string{"producerService.", "client."},
+}
+
+// watchConfig applies the configuration changes made while the consumer is running.
+func (s *Server) watchConfig() {
+	current := s.cfg
+	conf.Watch(func(cfg *conf.Configuration, err error) {
+		if err != nil {
+			s.logger.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+			return
+		}
+		s.applyConfig(current, *cfg)
+		current = *cfg
+	})
+}
+
+func (s *Server) applyConfig(old, new conf.Configuration) {
+	applied, restart := reloadable.Split(old, new)
+
+	for _, key := range applied {
+		switch key {
+		case "consumerService.messageConsumptionRate", "consumerService.workers":
+			s.services.AdminService.SetBase(newSettingsFromConfig(new))
+		case "consumerService.logLevel":
+			level, _ := zapcore.ParseLevel(new.GetConsumerLogLevel())
+			s.logLevel.SetLevel(level)
+		case "consumerService.handlerTimeout":
+			s.services.TaskService.SetHandlerTimeout(new.ConsumerService.HandlerTimeout)
+		case "namespaces.limits":
+			s.services.TaskService.SetNamespaceLimits(new.Namespaces.Limits)
+		}
+	}
+
+	if len(applied) > 0 {
+		s.logger.Log(s.logger.Level(), "Configuration reloaded", zap.Strings("config.applied", applied))
+	}
+	if len(restart) > 0 {
+		s.logger.Warn("Configuration changes require a restart to take effect", zap.Strings("config.restart", restart))
+	}
+}
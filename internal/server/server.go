@@ -6,16 +6,17 @@ import (
 	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
 	"github.com/hasanhakkaev/yqapp-demo/internal/database"
 	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/outbox"
+	"github.com/hasanhakkaev/yqapp-demo/internal/probe"
 	"github.com/hasanhakkaev/yqapp-demo/internal/service"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
-	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
 	"io"
 	"net"
 	"net/http"
@@ -23,30 +24,29 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
-	"time"
 )
 
 // Services groups all the services exposed by a single gRPC Server.
 type Services struct {
-	TaskService *service.TaskService
-	Health      *health.Server
+	TaskService  *service.TaskService
+	AdminService *service.AdminService
+	Health       *health.Server
 }
 
-var serviceStatus = prometheus.NewGauge(prometheus.GaugeOpts{
-	Name: "service_up",                                // Metric name
-	Help: "Whether the service is up (1) or down (0)", // Metric description
-})
-
 // shutDowner holds a method to gracefully shut down a service or integration.
 type shutDowner interface {
 	// Shutdown releases any held computational resources.
 	Shutdown(ctx context.Context) error
 }
 
-// grpcServer holds the method to serve a gRPC server using a net.Listener.
+// grpcServer holds the methods to serve and stop a gRPC server using a net.Listener.
 type grpcServer interface {
 	// Serve serves a gRPC server through net.Listener until an error occurs.
 	Serve(net.Listener) error
+	// GracefulStop stops accepting new RPCs and blocks until the pending ones are finished.
+	GracefulStop()
+	// Stop closes all connections and cancels the pending RPCs.
+	Stop()
 }
 
 // Server abstracts all the functional components to be run by the server.
@@ -54,9 +54,11 @@ type Server struct {
 	grpc          grpcServer
 	listener      net.Listener
 	logger        *zap.Logger
-	db            *database.Postgres
+	logLevel      zap.AtomicLevel
+	store         store.Store
 	services      Services
 	meterProvider metric.MeterProvider
+	serviceStatus metric.Int64Gauge
 	shutdown      []shutDowner
 	closer        []io.Closer
 	cfg           conf.Configuration
@@ -64,19 +66,46 @@ type Server struct {
 	pprofServer   *http.Server
 	taskChannel   chan *domain.Task
 	taskLimiter   *rate.Limiter
+	partitioner   *database.Partitioner
+	relay         *outbox.Relay
+	prober        *probe.Prober
 }
 
 // Run serves the application services.
 func (s *Server) Run(ctx context.Context) error {
-	go s.checkHealth(ctx)
-
 	// Mark the service as up when starting
-	markServiceUp()
+	s.markServiceUp(ctx)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Report the liveness and readiness of the TaskService
+	go s.prober.Run(ctx)
+
+	// Apply the runtime settings changed through the AdminService of any replica
+	go s.services.AdminService.SyncSettings(ctx, s.cfg.GetConsumerSettingsSyncInterval())
+
+	// Claim the RECEIVED tasks left out of every backlog, e.g. by a drain
+	go s.services.TaskService.RecoverTasks(ctx, s.cfg.GetConsumerRecoveryInterval(), s.cfg.GetConsumerRecoveryAge())
+
+	// Create the partitions of the tasks table ahead of time and retire the expired ones
+	if s.partitioner != nil {
+		go s.partitioner.Run(ctx)
+	}
+
+	// Publish the task lifecycle events written to the outbox
+	if s.relay != nil {
+		go s.relay.Run(ctx)
+	}
+
+	// Apply the changes made to the configuration files
+	s.watchConfig()
+
 	s.logger.Log(s.logger.Level(), "Starting Metrics endpoint /metrics", zap.String("port", s.cfg.GetConsumerMetricsPort()))
+	if s.cfg.ConsumerService.Dashboard.Enabled {
+		s.logger.Log(s.logger.Level(), "Serving dashboard "+s.cfg.ConsumerService.Dashboard.GetEndpoint(), zap.String("port", s.cfg.GetConsumerMetricsPort()))
+	}
+	s.logger.Log(s.logger.Level(), "Serving health probes /livez and /readyz", zap.String("port", s.cfg.GetConsumerMetricsPort()), zap.Duration("interval", s.cfg.Server.Health.GetCheckInterval()))
 	go s.serveMetrics(ctx)
 
 	s.logger.Log(s.logger.Level(), "Starting Pprof endpoint /debug/pprof", zap.String("port", s.cfg.GetConsumerProfilingPort()))
@@ -94,18 +123,50 @@ func (s *Server) Run(ctx context.Context) error {
 		// Received shutdown signal (SIGINT or SIGTERM)
 		s.logger.Log(s.logger.Level(), "Received shutdown signal", zap.String("signal", sig.String()))
 
-		// Cancel the context to signal shutdown to goroutines
-		cancel()
 	}
 
-	markServiceDown()
+	s.markServiceDown(ctx)
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), s.cfg.Server.GetDrainTimeout())
+	defer cancelDrain()
+	drainErr := s.drain(drainCtx)
+
+	// Cancel the context to signal shutdown to goroutines
+	cancel()
 
 	err := s.Shutdown(ctx)
 	if err != nil {
-		return err
+		return multierr.Append(drainErr, err)
+	}
+
+	return drainErr
+}
+
+// drain stops the intake of new work and lets the in-flight work finish until ctx is done:
+//  1. the TaskService reports it is not ready so that load balancers stop routing new RPCs,
+//  2. the gRPC server stops accepting RPCs and waits for the in-flight handlers,
+//  3. the task workers finish the in-flight tasks and return unstarted tasks to RECEIVED.
+func (s *Server) drain(ctx context.Context) error {
+	s.logger.Log(s.logger.Level(), "Draining consumer", zap.Duration("timeout", s.cfg.Server.GetDrainTimeout()))
+
+	s.prober.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		s.logger.Log(s.logger.Level(), "Consumer service stopped accepting RPCs")
+	case <-ctx.Done():
+		s.logger.Warn("Drain deadline exceeded, cancelling pending RPCs")
+		s.grpc.Stop()
+		<-stopped
 	}
 
-	return nil
+	return s.services.TaskService.Drain(ctx)
 }
 
 // Shutdown releases any held resources by dependencies of this Server.
@@ -124,32 +185,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		err = multierr.Append(err, closer.Close())
 	}
 
-	defer func(db *pgxpool.Pool, ctx context.Context) {
-		db.Close()
-	}(s.db.DB, ctx)
-
-	return err
-}
-
-func (s *Server) checkHealth(ctx context.Context) {
-	s.logger.Log(s.logger.Level(), "Running health service")
-	for {
-		if ctx.Err() != nil {
-			return
-		}
-		s.services.Health.SetServingStatus("app.db", s.checkDatabaseHealth(ctx))
-		time.Sleep(10 * time.Second)
-	}
-}
-
-func (s *Server) checkDatabaseHealth(ctx context.Context) healthv1.HealthCheckResponse_ServingStatus {
-	state := healthv1.HealthCheckResponse_SERVING
-	err := s.db.DB.Ping(ctx)
-	if err != nil {
-		state = healthv1.HealthCheckResponse_NOT_SERVING
-	}
-
-	return state
+	return multierr.Append(err, s.store.Close())
 }
 
 func (s *Server) serveMetrics(ctx context.Context) {
@@ -171,18 +207,10 @@ func (s *Server) serveMetrics(ctx context.Context) {
 }
 
 func (s *Server) startService(ctx context.Context) {
-	go func() {
-		s.logger.Log(s.logger.Level(), "Running consumer service ", zap.String("port", strconv.Itoa(int(s.cfg.Server.Port))))
-		if err := s.grpc.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			s.logger.Error("failed to listen and serve consumer grpc server", zap.Error(err))
-		}
-	}()
-	<-ctx.Done()
-
-	// Gracefully shut down the metrics server
-	s.logger.Log(s.logger.Level(), "Shutting down consumer service...")
-	if err := s.metricsServer.Shutdown(ctx); err != nil {
-		s.logger.Error("Error during consumer service shutdown", zap.Error(err))
+	// The gRPC server is stopped by drain once a shutdown signal is received
+	s.logger.Log(s.logger.Level(), "Running consumer service ", zap.String("port", strconv.Itoa(int(s.cfg.Server.Port))))
+	if err := s.grpc.Serve(s.listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		s.logger.Error("failed to listen and serve consumer grpc server", zap.Error(err))
 	}
 }
 
@@ -204,10 +232,10 @@ func (s *Server) servePprof(ctx context.Context) {
 	}
 }
 
-func markServiceUp() {
-	serviceStatus.Set(1) // Set to 1 when the service is up
+func (s *Server) markServiceUp(ctx context.Context) {
+	s.serviceStatus.Record(ctx, 1) // Set to 1 when the service is up
 }
 
-func markServiceDown() {
-	serviceStatus.Set(0) // Set to 0 when the service is down
+func (s *Server) markServiceDown(ctx context.Context) {
+	s.serviceStatus.Record(ctx, 0) // Set to 0 when the service is down
 }
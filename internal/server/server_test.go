@@ -42,7 +42,7 @@ func (suite *ServerTestSuite) TestSetup() {
 	suite.Assert().NotNil(app.listener)
 	suite.Assert().NotNil(app.logger)
 	suite.Assert().NotNil(app.grpc)
-	suite.Assert().NotNil(app.db)
+	suite.Assert().NotNil(app.store)
 	suite.Assert().NotNil(app.services.Health)
 	suite.Assert().NotNil(app.services.TaskService)
 
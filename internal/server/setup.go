@@ -1,43 +1,73 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
 	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/dashboard"
 	"github.com/hasanhakkaev/yqapp-demo/internal/database"
 	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
 	"github.com/hasanhakkaev/yqapp-demo/internal/interceptors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/outbox"
+	"github.com/hasanhakkaev/yqapp-demo/internal/probe"
 	"github.com/hasanhakkaev/yqapp-demo/internal/service"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
 	"github.com/hasanhakkaev/yqapp-demo/internal/telemetry"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 	"io"
 	"net"
 	"net/http"
 	_ "net/http/pprof" // Import pprof
+	"os"
+	"strings"
 )
 
 func registerServices(srv *grpc.Server, svc Services) {
 	v1.RegisterTaskServiceServer(srv, svc.TaskService)
+	v1.RegisterAdminServiceServer(srv, svc.AdminService)
 	healthv1.RegisterHealthServer(srv, svc.Health)
 }
 
 // setupServices initializes the Server Services.
-func setupServices(queries *database.Queries, logger *zap.Logger, meterProvider metric.MeterProvider, taskChannel chan *domain.Task, taskLimiter *rate.Limiter) Services {
+func setupServices(cfg conf.Configuration, st store.Store, logger *zap.Logger, meterProvider metric.MeterProvider, authenticator *auth.Authenticator, taskChannel chan *domain.Task, taskLimiter *rate.Limiter) (Services, error) {
 	logger.Debug("Initializing services")
-	taskService := service.NewTaskService(logger, queries, meterProvider.Meter("task.service"), taskChannel, taskLimiter)
+	taskService, err := service.NewTaskService(logger, st, meterProvider.Meter("task.service"), taskChannel, taskLimiter)
+	if err != nil {
+		logger.Error("Failed to initialize task service", zap.Error(err))
+		return Services{}, err
+	}
+	replica, err := os.Hostname()
+	if err != nil {
+		replica = cfg.Server.Name
+	}
+	taskService.SetHandlerTimeout(cfg.ConsumerService.HandlerTimeout)
+	taskService.SetNamespaceLimits(cfg.Namespaces.Limits)
+	adminService := service.NewAdminService(logger, st, taskService, authenticator, replica, newSettingsFromConfig(cfg))
 	healthService := health.NewServer()
 	return Services{
-		TaskService: taskService,
-		Health:      healthService,
+		TaskService:  taskService,
+		AdminService: adminService,
+		Health:       healthService,
+	}, nil
+}
+
+// newSettingsFromConfig returns the task processing settings used when no runtime override is set.
+func newSettingsFromConfig(cfg conf.Configuration) service.Settings {
+	return service.Settings{
+		RateLimit: rate.Limit(cfg.ConsumerService.MessageConsumptionRate),
+		Burst:     1,
+		Workers:   cfg.GetConsumerWorkers(),
 	}
 }
 
@@ -55,24 +85,159 @@ func setupListener(cfg conf.Configuration, logger *zap.Logger) (net.Listener, er
 
 // setupDB initializes a new connection with a DB server.
 func setupDB(cfg conf.Configuration, logger *zap.Logger) (*database.Postgres, error) {
-	logger.Debug("Initializing DB connection", zap.String("db.engine", cfg.Database.Engine), zap.String("db.dsn", NewDSNFromConfig(cfg.Database)))
+	logger.Debug("Initializing DB connection", zap.String("db.engine", cfg.Database.Engine), zap.String("db.dsn", database.RedactConnString(database.ConnString(cfg.Database))))
 
-	db, err := database.NewPostgres(NewDSNFromConfig(cfg.Database))
+	db, err := database.NewPostgres(context.Background(), cfg.Database, logger)
 	if err != nil {
 		logger.Error("Failed to initialize DB connection", zap.Error(err))
 		return nil, err
 	}
-	err = database.MigrateModels(NewDSNFromConfig(cfg.Database))
+
+	if cfg.Database.SkipMigrations {
+		logger.Debug("Skipping DB migrations")
+		return db, nil
+	}
+	err = database.MigrateModels(db.DB.Config().ConnConfig)
 	if err != nil {
+		logger.Error("Failed to migrate DB", zap.Error(err))
+		db.DB.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func NewDSNFromConfig(db conf.Database) string {
-	return fmt.Sprintf("%s:%s@%s:%d/%s", db.Username, db.Password, db.Host, db.Port, db.Database)
+// setupStore initializes the Store selected by the database engine.
+func setupStore(cfg conf.Configuration, logger *zap.Logger) (store.Store, error) {
+	switch cfg.Database.Engine {
+	case store.EngineMemory:
+		logger.Debug("Initializing in-memory store")
+		st := store.NewMemory()
+		if cfg.Outbox.Enabled {
+			st.WithOutbox()
+		}
+		return st, nil
+	case store.EngineSQLite:
+		logger.Debug("Initializing SQLite store", zap.String("db.path", cfg.Database.GetPath()))
+		st, err := store.NewSQLite(context.Background(), cfg.Database.GetPath())
+		if err != nil {
+			logger.Error("Failed to initialize SQLite store", zap.Error(err))
+			return nil, err
+		}
+		if cfg.Outbox.Enabled {
+			st.WithOutbox()
+		}
+		return st, nil
+	default:
+		db, err := setupDB(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		replicas, err := setupReplicas(cfg, logger)
+		if err != nil {
+			db.DB.Close()
+			return nil, err
+		}
+		st := store.NewPostgres(db.DB).WithReplicas(replicas, store.ReplicaOptions{
+			MaxLag:        cfg.Database.GetMaxReplicaLag(),
+			CheckInterval: cfg.Database.GetReplicaCheckInterval(),
+			Logger:        logger,
+		})
+		if cfg.Outbox.Enabled {
+			st.WithOutbox()
+		}
+		return st, nil
+	}
+}
+
+// setupRelay returns the relay publishing the outbox events, nil when the outbox is disabled.
+func setupRelay(cfg conf.Configuration, st store.Store, logger *zap.Logger) (*outbox.Relay, outbox.Sink, error) {
+	if !cfg.Outbox.Enabled {
+		return nil, nil, nil
+	}
+	logger.Debug("Initializing outbox relay", zap.String("outbox.sink", cfg.Outbox.Sink))
+	sink, err := outbox.NewSink(cfg.Outbox)
+	if err != nil {
+		logger.Error("Failed to initialize outbox sink", zap.Error(err))
+		return nil, nil, err
+	}
+	return outbox.NewRelay(st, sink, cfg.Outbox, logger), sink, nil
+}
+
+// setupReplicas creates a connection pool per read replica. The pools connect lazily so that
+// an unavailable replica does not prevent the consumer from starting.
+func setupReplicas(cfg conf.Configuration, logger *zap.Logger) ([]store.Replica, error) {
+	replicas := make([]store.Replica, 0, len(cfg.Database.Replicas))
+	for _, r := range cfg.Database.Replicas {
+		replicaCfg := cfg.Database.ForReplica(r)
+		name := database.RedactConnString(database.ConnString(replicaCfg))
+		logger.Debug("Initializing read replica", zap.String("db.replica", name))
 
+		pool, err := database.NewPool(context.Background(), replicaCfg)
+		if err != nil {
+			logger.Error("Failed to initialize read replica", zap.String("db.replica", name), zap.Error(err))
+			for _, replica := range replicas {
+				replica.Pool.Close()
+			}
+			return nil, err
+		}
+		replicas = append(replicas, store.Replica{Name: name, Pool: pool})
+	}
+	return replicas, nil
+}
+
+// setupPartitioner returns the job maintaining the partitions of the tasks table, nil when
+// the store is not partitioned or the job is disabled.
+func setupPartitioner(cfg conf.Configuration, st store.Store, logger *zap.Logger) *database.Partitioner {
+	pg, ok := st.(*store.Postgres)
+	if !ok || !cfg.Database.Partitions.Enabled {
+		return nil
+	}
+	return database.NewPartitioner(pg.Pool(), cfg.Database.Partitions, logger)
+}
+
+// setupProber returns the prober reporting the liveness and readiness of the TaskService. The TaskService
+// is ready while the store can be reached, the database is migrated to the embedded migrations and the
+// backlog is below its saturation, the drain is reported by the prober itself.
+func setupProber(cfg conf.Configuration, st store.Store, svc Services, logger *zap.Logger) (*probe.Prober, error) {
+	readiness := []probe.Check{{Name: "database", Run: st.Ping}}
+	if pg, ok := st.(*store.Postgres); ok {
+		migrations, err := database.EmbeddedMigrations()
+		if err != nil {
+			logger.Error("Failed to read embedded migrations", zap.Error(err))
+			return nil, err
+		}
+		expected := migrations[len(migrations)-1].Version
+		readiness = append(readiness, probe.Check{Name: "migrations", Run: func(ctx context.Context) error {
+			version, dirty, err := database.AppliedMigration(ctx, pg.Pool())
+			switch {
+			case err != nil:
+				return err
+			case dirty:
+				return fmt.Errorf("migration %d is dirty", version)
+			case version < expected:
+				return fmt.Errorf("database at migration %d, %d expected", version, expected)
+			}
+			return nil
+		}})
+	}
+	saturation := cfg.Server.Health.GetBacklogSaturation()
+	readiness = append(readiness, probe.Check{Name: "backlog", Run: func(context.Context) error {
+		queued, capacity := svc.TaskService.Backlog()
+		if capacity > 0 && float64(queued) >= saturation*float64(capacity) {
+			return fmt.Errorf("backlog saturated, %d of %d tasks queued", queued, capacity)
+		}
+		return nil
+	}})
+
+	return probe.New(probe.Options{
+		Service:   v1.TaskService_ServiceDesc.ServiceName,
+		Interval:  cfg.Server.Health.GetCheckInterval(),
+		Timeout:   cfg.Server.Health.GetCheckTimeout(),
+		Readiness: readiness,
+		Health:    svc.Health,
+		Logger:    logger,
+	}), nil
 }
 
 // Setup creates a new application using the given ServerConfig.
@@ -86,37 +251,87 @@ func Setup(cfg conf.Configuration) (Server, error) {
 
 	telemeter.Logger.Debug("Initializing server", zap.String("server.name", cfg.Server.Name), zap.String("server.environment", cfg.Server.Environment))
 
-	db, err := setupDB(cfg, telemeter.Logger)
+	st, err := setupStore(cfg, telemeter.Logger)
 	if err != nil {
 		return Server{}, err
 	}
+	defer func() {
+		// The store is only owned by the server once it is returned
+		if err != nil {
+			_ = st.Close()
+		}
+	}()
 
-	queries := database.New(db.DB)
+	partitioner := setupPartitioner(cfg, st, telemeter.Logger)
 
-	limiter := rate.NewLimiter(rate.Limit(cfg.ConsumerService.MessageConsumptionRate), 1)
-
-	// Start consuming tasks in a separate goroutine
+	relay, sink, err := setupRelay(cfg, st, telemeter.Logger)
+	if err != nil {
+		return Server{}, err
+	}
+	defer func() {
+		if err != nil && sink != nil {
+			_ = sink.Close()
+		}
+	}()
 
 	l, err := setupListener(cfg, telemeter.Logger)
 	if err != nil {
 		return Server{}, err
 	}
+	defer func() {
+		if err != nil {
+			_ = l.Close()
+		}
+	}()
 
 	taskLimiter := rate.NewLimiter(rate.Limit(cfg.ConsumerService.MessageConsumptionRate), 1)
 
 	taskChannel := make(chan *domain.Task, cfg.ProducerService.MaxBacklog)
 
-	srv := grpc.NewServer(interceptors.NewServerInterceptors(telemeter)...)
+	authenticator := auth.NewAuthenticator(cfg.Auth)
+
+	serverOpts := append(interceptors.NewServerInterceptors(telemeter, authenticator.Authenticate),
+		// Let the producers keep their idle connections open with pings
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Server.GetKeepaliveMinTime(),
+			PermitWithoutStream: true,
+		}),
+	)
+	srv := grpc.NewServer(serverOpts...)
 	reflection.Register(srv)
 
-	svc := setupServices(queries, telemeter.Logger, telemeter.MeterProvider, taskChannel, taskLimiter)
+	svc, err := setupServices(cfg, st, telemeter.Logger, telemeter.MeterProvider, authenticator, taskChannel, taskLimiter)
+	if err != nil {
+		return Server{}, err
+	}
 	registerServices(srv, svc)
 
-	go svc.TaskService.ConsumeTasks(taskChannel, limiter)
+	serviceStatus, err := telemeter.MeterProvider.Meter("consumer").Int64Gauge("service_up",
+		metric.WithDescription("Whether the service is up (1) or down (0)"))
+	if err != nil {
+		return Server{}, err
+	}
+
+	prober, err := setupProber(cfg, st, svc, telemeter.Logger)
+	if err != nil {
+		return Server{}, err
+	}
+
+	// Start consuming tasks in separate goroutines
+	svc.TaskService.StartWorkers(cfg.GetConsumerWorkers())
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle(cfg.GetMetricsEndpoint(), telemetry.NewMetricsHandler(telemeter.Registry))
+	metricsMux.Handle("/livez", prober.LivezHandler())
+	metricsMux.Handle("/readyz", prober.ReadyzHandler())
+	if cfg.ConsumerService.Dashboard.Enabled {
+		endpoint := cfg.ConsumerService.Dashboard.GetEndpoint()
+		metricsMux.Handle(endpoint, http.StripPrefix(strings.TrimSuffix(endpoint, "/"), dashboard.NewHandler(svc.TaskService, svc.AdminService, telemeter.Logger)))
+	}
 
 	metricsServer := &http.Server{
 		Addr:    fmt.Sprintf("0.0.0.0:%s", cfg.GetConsumerMetricsPort()),
-		Handler: promhttp.Handler(),
+		Handler: metricsMux,
 	}
 
 	pprofServer := &http.Server{
@@ -128,19 +343,25 @@ func Setup(cfg conf.Configuration) (Server, error) {
 		grpc:          srv,
 		listener:      l,
 		logger:        telemeter.Logger,
-		db:            db,
+		logLevel:      telemeter.LogLevel,
+		store:         st,
 		services:      svc,
 		meterProvider: telemeter.MeterProvider,
+		serviceStatus: serviceStatus,
 		shutdown: []shutDowner{
-			telemeter.MeterExporter,
+			telemeter,
 		},
 		closer: []io.Closer{
 			metricsServer,
+			sink,
 		},
 		cfg:           cfg,
 		metricsServer: metricsServer,
 		pprofServer:   pprofServer,
 		taskChannel:   taskChannel,
 		taskLimiter:   taskLimiter,
+		partitioner:   partitioner,
+		relay:         relay,
+		prober:        prober,
 	}, nil
 }
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sync"
+	"time"
+)
+
+// maxWorkers bounds the size of the worker pool accepted by ResizeWorkerPool.
+const maxWorkers = 1024
+
+// Settings holds the runtime settings of the task processing.
+type Settings struct {
+	Paused    bool
+	RateLimit rate.Limit
+	Burst     int
+	Workers   int
+}
+
+// AdminService changes the task processing settings at runtime. Changes are persisted in the
+// settings store and picked up by every replica through SyncSettings.
+type AdminService struct {
+	v1.UnimplementedAdminServiceServer
+	logger   *zap.Logger
+	settings store.SettingsStore
+	tasks    *TaskService
+	auth     *auth.Authenticator
+	replica  string
+
+	mu        sync.Mutex
+	base      Settings
+	overrides store.Settings
+	version   int64
+}
+
+// NewAdminService initializes a new v1.AdminServiceServer implementation.
+// The base settings are applied for every setting that has not been overridden at runtime.
+func NewAdminService(logger *zap.Logger, settings store.SettingsStore, tasks *TaskService, authenticator *auth.Authenticator, replica string, base Settings) *AdminService {
+	return &AdminService{
+		logger:   logger,
+		settings: settings,
+		tasks:    tasks,
+		auth:     authenticator,
+		replica:  replica,
+		base:     base,
+	}
+}
+
+// AuthFuncOverride restricts every AdminService RPC to admin identities.
+func (svc *AdminService) AuthFuncOverride(ctx context.Context, _ string) (context.Context, error) {
+	return svc.auth.RequireAdmin(ctx)
+}
+
+// callerNamespace returns the namespace the caller is bound to, every namespace when empty. The dead
+// letters and in-flight tasks of a caller bound to a namespace are restricted to it, and it cannot
+// change the settings shared by every namespace.
+func callerNamespace(ctx context.Context) string {
+	identity, _ := auth.FromContext(ctx)
+	return identity.Namespace
+}
+
+func (svc *AdminService) GetSettings(_ context.Context, _ *v1.GetSettingsRequest) (*v1.ConsumerSettings, error) {
+	svc.mu.Lock()
+	version := svc.version
+	svc.mu.Unlock()
+	return svc.settingsToProto(version), nil
+}
+
+func (svc *AdminService) PauseProcessing(ctx context.Context, _ *v1.PauseProcessingRequest) (*v1.ConsumerSettings, error) {
+	paused := true
+	return svc.update(ctx, store.SettingsUpdate{Paused: &paused})
+}
+
+func (svc *AdminService) ResumeProcessing(ctx context.Context, _ *v1.ResumeProcessingRequest) (*v1.ConsumerSettings, error) {
+	paused := false
+	return svc.update(ctx, store.SettingsUpdate{Paused: &paused})
+}
+
+func (svc *AdminService) SetRateLimit(ctx context.Context, request *v1.SetRateLimitRequest) (*v1.ConsumerSettings, error) {
+	if request.GetLimit() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must be greater than zero")
+	}
+	if request.GetBurst() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "burst must be greater than zero")
+	}
+	limit, burst := request.GetLimit(), int32(request.GetBurst())
+	return svc.update(ctx, store.SettingsUpdate{RateLimit: &limit, Burst: &burst})
+}
+
+func (svc *AdminService) ResizeWorkerPool(ctx context.Context, request *v1.ResizeWorkerPoolRequest) (*v1.ConsumerSettings, error) {
+	if request.GetWorkers() == 0 || request.GetWorkers() > maxWorkers {
+		return nil, status.Errorf(codes.InvalidArgument, "workers must be between 1 and %d", maxWorkers)
+	}
+	workers := int32(request.GetWorkers())
+	return svc.update(ctx, store.SettingsUpdate{Workers: &workers})
+}
+
+// ListInFlightTasks lists the workers of the replica serving the call. The tasks of other namespaces
+// than the one of a caller bound to a namespace are left out, their workers are listed without a task.
+func (svc *AdminService) ListInFlightTasks(ctx context.Context, _ *v1.ListInFlightTasksRequest) (*v1.ListInFlightTasksResponse, error) {
+	ns := callerNamespace(ctx)
+	inFlight := svc.tasks.InFlight()
+	res := &v1.ListInFlightTasksResponse{
+		Replica: svc.replica,
+		Workers: make([]*v1.WorkerStatus, 0, len(inFlight)),
+	}
+	for _, w := range inFlight {
+		ws := &v1.WorkerStatus{Worker: w.Worker, Processed: w.Processed, Failed: w.Failed}
+		if w.Task != nil && inNamespace(w.Task, ns) {
+			ws.Task = domain.FromDomainToProto(w.Task)
+		}
+		if !w.LastActiveAt.IsZero() {
+			ws.LastActiveAt = timestamppb.New(w.LastActiveAt)
+		}
+		res.Workers = append(res.Workers, ws)
+	}
+	return res, nil
+}
+
+// ListDeadLetters lists the tasks dead-lettered by the replica serving the call, of the namespace of
+// a caller bound to one.
+func (svc *AdminService) ListDeadLetters(ctx context.Context, _ *v1.ListDeadLettersRequest) (*v1.ListDeadLettersResponse, error) {
+	letters := svc.tasks.DeadLetters(callerNamespace(ctx))
+	res := &v1.ListDeadLettersResponse{
+		Replica:     svc.replica,
+		DeadLetters: make([]*v1.DeadLetter, 0, len(letters)),
+	}
+	for _, letter := range letters {
+		res.DeadLetters = append(res.DeadLetters, &v1.DeadLetter{
+			Task:     domain.FromDomainToProto(letter.Task),
+			Reason:   letter.Reason,
+			FailedAt: timestamppb.New(letter.FailedAt),
+		})
+	}
+	return res, nil
+}
+
+// RequeueDeadLetter returns a task dead-lettered by the replica serving the call to the backlog. The
+// tasks of other namespaces than the one of a caller bound to a namespace are not found.
+func (svc *AdminService) RequeueDeadLetter(ctx context.Context, request *v1.RequeueDeadLetterRequest) (*v1.Task, error) {
+	task, err := svc.tasks.RequeueDeadLetter(ctx, callerNamespace(ctx), request.GetId())
+	switch {
+	case err == nil:
+		return domain.FromDomainToProto(task), nil
+	case errors.Is(err, store.ErrNotFound):
+		return nil, status.Errorf(codes.NotFound, "task %d is not dead-lettered by replica %s", request.GetId(), svc.replica)
+	case errors.Is(err, errDraining):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, status.FromContextError(err).Err()
+	default:
+		return nil, taskError(err, "failed to requeue task")
+	}
+}
+
+// SyncSettings applies the persisted settings every interval until ctx is done.
+func (svc *AdminService) SyncSettings(ctx context.Context, interval time.Duration) {
+	svc.syncSettings(ctx, true)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			svc.syncSettings(ctx, false)
+		}
+	}
+}
+
+func (svc *AdminService) syncSettings(ctx context.Context, force bool) {
+	overrides, err := svc.settings.GetSettings(ctx)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		// No runtime overrides, apply the base settings only
+	case err != nil:
+		svc.logger.Warn("Failed to read consumer settings", zap.Error(err))
+		return
+	}
+
+	svc.mu.Lock()
+	changed := overrides.Version != svc.version
+	svc.mu.Unlock()
+	if !changed && !force {
+		return
+	}
+
+	svc.apply(overrides)
+}
+
+func (svc *AdminService) update(ctx context.Context, update store.SettingsUpdate) (*v1.ConsumerSettings, error) {
+	if ns := callerNamespace(ctx); ns != "" {
+		return nil, status.Errorf(codes.PermissionDenied, "callers bound to namespace %q cannot change the settings of every namespace", ns)
+	}
+	overrides, err := svc.settings.UpdateSettings(ctx, update)
+	if err != nil {
+		svc.logger.Error("Failed to persist consumer settings", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to update settings")
+	}
+
+	svc.apply(overrides)
+	return svc.settingsToProto(overrides.Version), nil
+}
+
+// SetBase replaces the settings applied for every setting that has not been overridden at runtime,
+// e.g. after the configuration file has been reloaded.
+func (svc *AdminService) SetBase(base Settings) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	svc.base = base
+	svc.applyLocked()
+}
+
+// apply overlays the persisted overrides on the base settings and applies the result to the TaskService.
+func (svc *AdminService) apply(overrides store.Settings) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	svc.overrides = overrides
+	svc.version = overrides.Version
+	svc.applyLocked()
+}
+
+func (svc *AdminService) applyLocked() {
+	overrides := svc.overrides
+	settings := svc.base
+	settings.Paused = settings.Paused || overrides.Paused
+	if overrides.RateLimit != nil {
+		settings.RateLimit = rate.Limit(*overrides.RateLimit)
+	}
+	if overrides.Burst != nil {
+		settings.Burst = int(*overrides.Burst)
+	}
+	if overrides.Workers != nil {
+		settings.Workers = int(*overrides.Workers)
+	}
+
+	if settings.Paused {
+		svc.tasks.Pause()
+	} else {
+		svc.tasks.Resume()
+	}
+	if limit, burst := svc.tasks.RateLimit(); limit != settings.RateLimit || burst != settings.Burst {
+		svc.tasks.SetRateLimit(settings.RateLimit, settings.Burst)
+	}
+	svc.tasks.ResizeWorkers(settings.Workers)
+}
+
+func (svc *AdminService) settingsToProto(version int64) *v1.ConsumerSettings {
+	limit, burst := svc.tasks.RateLimit()
+	return &v1.ConsumerSettings{
+		Paused:    svc.tasks.Paused(),
+		RateLimit: float64(limit),
+		Burst:     uint32(burst),
+		Workers:   uint32(svc.tasks.Workers()),
+		Version:   version,
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestAdminSuite(t *testing.T) {
+	suite.Run(t, new(AdminTestSuite))
+}
+
+// AdminTestSuite runs the AdminService of replicas sharing an in-memory store, without workers
+// until the worker pool is resized.
+type AdminTestSuite struct {
+	suite.Suite
+	store         *store.Memory
+	authenticator *auth.Authenticator
+	tasks         *TaskService
+	admin         *AdminService
+}
+
+func (suite *AdminTestSuite) SetupTest() {
+	suite.store = store.NewMemory()
+	suite.authenticator = auth.NewAuthenticator(conf.Auth{Enabled: true, Tokens: []conf.Token{
+		{Name: "operator", Token: "admin-token", Admin: true},
+		{Name: "team-b-operator", Token: "team-b-admin-token", Admin: true, Namespace: "team-b"},
+		{Name: "producer", Token: "producer-token"},
+	}})
+	suite.tasks, suite.admin = suite.newReplica("replica-1")
+}
+
+func (suite *AdminTestSuite) TearDownTest() {
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.Require().NoError(suite.tasks.Drain(drainCtx))
+	suite.Require().NoError(suite.store.Close())
+}
+
+func (suite *AdminTestSuite) newReplica(replica string) (*TaskService, *AdminService) {
+	tasks, err := NewTaskService(zap.NewNop(), suite.store, noop.NewMeterProvider().Meter(""), make(chan *domain.Task, 10), rate.NewLimiter(rate.Inf, 1))
+	suite.Require().NoError(err)
+	admin := NewAdminService(zap.NewNop(), suite.store, tasks, suite.authenticator, replica, Settings{RateLimit: rate.Inf, Burst: 1})
+	admin.syncSettings(context.Background(), true)
+	return tasks, admin
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// authenticated returns the context of a call authenticated with the token.
+func (suite *AdminTestSuite) authenticated(token string) context.Context {
+	ctx, err := suite.admin.AuthFuncOverride(withToken(token), "")
+	suite.Require().NoError(err)
+	return ctx
+}
+
+func (suite *AdminTestSuite) TestAuthFuncOverride() {
+	ctx, err := suite.admin.AuthFuncOverride(withToken("admin-token"), v1.AdminService_GetSettings_FullMethodName)
+	suite.Require().NoError(err)
+	identity, ok := auth.FromContext(ctx)
+	suite.Require().True(ok)
+	suite.Assert().Equal("operator", identity.Name)
+
+	_, err = suite.admin.AuthFuncOverride(withToken("producer-token"), v1.AdminService_GetSettings_FullMethodName)
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.admin.AuthFuncOverride(withToken("unknown"), v1.AdminService_GetSettings_FullMethodName)
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+
+	_, err = suite.admin.AuthFuncOverride(context.Background(), v1.AdminService_GetSettings_FullMethodName)
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *AdminTestSuite) TestGetSettings() {
+	settings, err := suite.admin.GetSettings(context.Background(), &v1.GetSettingsRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().False(settings.GetPaused())
+	suite.Assert().Zero(settings.GetWorkers())
+	suite.Assert().Equal(uint32(1), settings.GetBurst())
+	suite.Assert().Zero(settings.GetVersion())
+}
+
+func (suite *AdminTestSuite) TestPauseAndResumeProcessing() {
+	settings, err := suite.admin.PauseProcessing(context.Background(), &v1.PauseProcessingRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().True(settings.GetPaused())
+	suite.Assert().True(suite.tasks.Paused())
+
+	settings, err = suite.admin.ResumeProcessing(context.Background(), &v1.ResumeProcessingRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().False(settings.GetPaused())
+	suite.Assert().False(suite.tasks.Paused())
+	suite.Assert().Equal(int64(2), settings.GetVersion())
+}
+
+func (suite *AdminTestSuite) TestSetRateLimit() {
+	_, err := suite.admin.SetRateLimit(context.Background(), &v1.SetRateLimitRequest{Limit: 0, Burst: 1})
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+	_, err = suite.admin.SetRateLimit(context.Background(), &v1.SetRateLimitRequest{Limit: 5, Burst: 0})
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+
+	settings, err := suite.admin.SetRateLimit(context.Background(), &v1.SetRateLimitRequest{Limit: 5, Burst: 2})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(5.0, settings.GetRateLimit())
+	suite.Assert().Equal(uint32(2), settings.GetBurst())
+	limit, burst := suite.tasks.RateLimit()
+	suite.Assert().Equal(rate.Limit(5), limit)
+	suite.Assert().Equal(2, burst)
+}
+
+func (suite *AdminTestSuite) TestResizeWorkerPool() {
+	_, err := suite.admin.ResizeWorkerPool(context.Background(), &v1.ResizeWorkerPoolRequest{Workers: 0})
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+	_, err = suite.admin.ResizeWorkerPool(context.Background(), &v1.ResizeWorkerPoolRequest{Workers: maxWorkers + 1})
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+
+	settings, err := suite.admin.ResizeWorkerPool(context.Background(), &v1.ResizeWorkerPoolRequest{Workers: 3})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(uint32(3), settings.GetWorkers())
+	suite.Assert().Equal(3, suite.tasks.Workers())
+}
+
+func (suite *AdminTestSuite) TestUpdate_NamespaceAdmin() {
+	ctx := suite.authenticated("team-b-admin-token")
+	for name, update := range map[string]func() (*v1.ConsumerSettings, error){
+		"PauseProcessing": func() (*v1.ConsumerSettings, error) {
+			return suite.admin.PauseProcessing(ctx, &v1.PauseProcessingRequest{})
+		},
+		"ResumeProcessing": func() (*v1.ConsumerSettings, error) {
+			return suite.admin.ResumeProcessing(ctx, &v1.ResumeProcessingRequest{})
+		},
+		"SetRateLimit": func() (*v1.ConsumerSettings, error) {
+			return suite.admin.SetRateLimit(ctx, &v1.SetRateLimitRequest{Limit: 5, Burst: 2})
+		},
+		"ResizeWorkerPool": func() (*v1.ConsumerSettings, error) {
+			return suite.admin.ResizeWorkerPool(ctx, &v1.ResizeWorkerPoolRequest{Workers: 3})
+		},
+	} {
+		_, err := update()
+		suite.Assert().Equal(codes.PermissionDenied, status.Code(err), name)
+	}
+
+	suite.Assert().False(suite.tasks.Paused())
+	suite.Assert().Zero(suite.tasks.Workers())
+	limit, _ := suite.tasks.RateLimit()
+	suite.Assert().Equal(rate.Inf, limit)
+	_, err := suite.store.GetSettings(context.Background())
+	suite.Assert().ErrorIs(err, store.ErrNotFound, "nothing is persisted")
+
+	settings, err := suite.admin.PauseProcessing(suite.authenticated("admin-token"), &v1.PauseProcessingRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().True(settings.GetPaused())
+}
+
+func (suite *AdminTestSuite) TestSyncSettings() {
+	tasks, admin := suite.newReplica("replica-2")
+	defer func() { suite.Require().NoError(tasks.Drain(context.Background())) }()
+
+	_, err := suite.admin.PauseProcessing(context.Background(), &v1.PauseProcessingRequest{})
+	suite.Require().NoError(err)
+	_, err = suite.admin.ResizeWorkerPool(context.Background(), &v1.ResizeWorkerPoolRequest{Workers: 2})
+	suite.Require().NoError(err)
+
+	admin.syncSettings(context.Background(), false)
+	suite.Assert().True(tasks.Paused())
+	suite.Assert().Equal(2, tasks.Workers())
+}
+
+func (suite *AdminTestSuite) TestSetBase() {
+	_, err := suite.admin.ResizeWorkerPool(context.Background(), &v1.ResizeWorkerPoolRequest{Workers: 3})
+	suite.Require().NoError(err)
+
+	// The runtime overrides take precedence over the base settings, a paused base pauses the processing
+	suite.admin.SetBase(Settings{Paused: true, RateLimit: 10, Burst: 5, Workers: 2})
+	suite.Assert().True(suite.tasks.Paused())
+	suite.Assert().Equal(3, suite.tasks.Workers())
+	limit, burst := suite.tasks.RateLimit()
+	suite.Assert().Equal(rate.Limit(10), limit)
+	suite.Assert().Equal(5, burst)
+}
+
+func (suite *AdminTestSuite) TestListInFlightTasks() {
+	suite.tasks.StartWorkers(2)
+
+	response, err := suite.admin.ListInFlightTasks(context.Background(), &v1.ListInFlightTasksRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal("replica-1", response.GetReplica())
+	suite.Require().Len(response.GetWorkers(), 2)
+	suite.Assert().Nil(response.GetWorkers()[0].GetTask())
+	suite.Assert().Nil(response.GetWorkers()[0].GetLastActiveAt())
+}
+
+func (suite *AdminTestSuite) TestListInFlightTasks_Namespace() {
+	suite.tasks.StartWorkers(1)
+	w := suite.tasks.pool[0]
+	w.current.Store(&domain.Task{ID: 7, Namespace: "team-a", State: domain.StatePROCESSING})
+
+	response, err := suite.admin.ListInFlightTasks(suite.authenticated("admin-token"), &v1.ListInFlightTasksRequest{})
+	suite.Require().NoError(err)
+	suite.Require().Len(response.GetWorkers(), 1)
+	suite.Assert().Equal(uint32(7), response.GetWorkers()[0].GetTask().GetId())
+
+	response, err = suite.admin.ListInFlightTasks(suite.authenticated("team-b-admin-token"), &v1.ListInFlightTasksRequest{})
+	suite.Require().NoError(err)
+	suite.Require().Len(response.GetWorkers(), 1, "the worker is listed without its task")
+	suite.Assert().Nil(response.GetWorkers()[0].GetTask())
+	w.current.Store(nil)
+}
+
+func (suite *AdminTestSuite) TestDeadLetters() {
+	now := time.Now()
+	task := &domain.Task{Namespace: "team-a", Type: 1, Value: 1, State: domain.StatePROCESSING, CreationTime: now, LastUpdateTime: now}
+	id, err := suite.store.CreateTask(context.Background(), task)
+	suite.Require().NoError(err)
+	task.ID = id
+	suite.tasks.deadLetter(task, errors.New("handler failed"))
+
+	response, err := suite.admin.ListDeadLetters(context.Background(), &v1.ListDeadLettersRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal("replica-1", response.GetReplica())
+	suite.Require().Len(response.GetDeadLetters(), 1)
+	suite.Assert().Equal(task.ID, response.GetDeadLetters()[0].GetTask().GetId())
+	suite.Assert().Equal("handler failed", response.GetDeadLetters()[0].GetReason())
+
+	requeued, err := suite.admin.RequeueDeadLetter(context.Background(), &v1.RequeueDeadLetterRequest{Id: task.ID})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(v1.TaskState_RECEIVED, requeued.GetState())
+	suite.Assert().Equal(task.ID, (<-suite.tasks.taskChannel).ID)
+
+	_, err = suite.admin.RequeueDeadLetter(context.Background(), &v1.RequeueDeadLetterRequest{Id: task.ID})
+	suite.Assert().Equal(codes.NotFound, status.Code(err))
+}
+
+func (suite *AdminTestSuite) TestDeadLetters_Namespace() {
+	now := time.Now()
+	task := &domain.Task{Namespace: "team-a", Type: 1, Value: 1, State: domain.StatePROCESSING, CreationTime: now, LastUpdateTime: now}
+	id, err := suite.store.CreateTask(context.Background(), task)
+	suite.Require().NoError(err)
+	task.ID = id
+	suite.tasks.deadLetter(task, errors.New("handler failed"))
+
+	// An admin bound to another namespace neither sees nor requeues the task
+	ctx := suite.authenticated("team-b-admin-token")
+	response, err := suite.admin.ListDeadLetters(ctx, &v1.ListDeadLettersRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(response.GetDeadLetters())
+	_, err = suite.admin.RequeueDeadLetter(ctx, &v1.RequeueDeadLetterRequest{Id: task.ID})
+	suite.Assert().Equal(codes.NotFound, status.Code(err))
+
+	response, err = suite.admin.ListDeadLetters(suite.authenticated("admin-token"), &v1.ListDeadLettersRequest{})
+	suite.Require().NoError(err)
+	suite.Require().Len(response.GetDeadLetters(), 1, "the rejected requeue keeps the dead letter")
+	_, err = suite.admin.RequeueDeadLetter(suite.authenticated("admin-token"), &v1.RequeueDeadLetterRequest{Id: task.ID})
+	suite.Require().NoError(err)
+}
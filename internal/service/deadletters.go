@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+	"slices"
+	"time"
+)
+
+// maxDeadLetters bounds the dead letters kept by a replica, the oldest ones are forgotten first.
+const maxDeadLetters = 1000
+
+// errDraining is returned when a task cannot be returned to the backlog of a draining replica.
+var errDraining = errors.New("consumer is draining")
+
+// DeadLetter holds a task whose processing failed. The task is left in its state, usually
+// PROCESSING, until it is requeued.
+type DeadLetter struct {
+	Task     *domain.Task
+	Reason   string
+	FailedAt time.Time
+}
+
+// deadLetter keeps the task that failed to be processed with the reason of the failure.
+func (svc *TaskService) deadLetter(task *domain.Task, err error) {
+	letter := DeadLetter{Task: task, Reason: status.Convert(err).Message(), FailedAt: time.Now()}
+
+	svc.deadLettersMu.Lock()
+	defer svc.deadLettersMu.Unlock()
+	if len(svc.deadLetters) == maxDeadLetters {
+		svc.deadLetters = slices.Delete(svc.deadLetters, 0, 1)
+	}
+	svc.deadLetters = append(svc.deadLetters, letter)
+}
+
+// DeadLetters returns the tasks of the namespace, every namespace when empty, that failed to be processed
+// by this replica, the most recent failures first.
+func (svc *TaskService) DeadLetters(namespace string) []DeadLetter {
+	svc.deadLettersMu.Lock()
+	defer svc.deadLettersMu.Unlock()
+
+	letters := slices.DeleteFunc(slices.Clone(svc.deadLetters), func(letter DeadLetter) bool {
+		return !inNamespace(letter.Task, namespace)
+	})
+	slices.Reverse(letters)
+	return letters
+}
+
+// RequeueDeadLetter returns a dead-lettered task of the namespace, any namespace when empty, to the
+// RECEIVED state and to the backlog. It returns store.ErrNotFound for the tasks not dead-lettered by
+// this replica or of another namespace and store.ErrFinished for the tasks that have been finished
+// or cancelled since, which are forgotten.
+func (svc *TaskService) RequeueDeadLetter(ctx context.Context, namespace string, id uint32) (*domain.Task, error) {
+	letter, ok := svc.takeDeadLetter(namespace, id)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	if svc.intake.Err() != nil {
+		svc.restoreDeadLetter(letter)
+		return nil, errDraining
+	}
+
+	now := time.Now().Truncate(time.Microsecond)
+	n, err := svc.store.RequeueTasks(ctx, []uint32{id}, now)
+	if err != nil {
+		svc.restoreDeadLetter(letter)
+		return nil, err
+	}
+	if n == 0 {
+		return nil, store.ErrFinished
+	}
+
+	task := *letter.Task
+	task.SetState(domain.StateRECEIVED, now)
+	task.ReceivedAt = now
+	select {
+	case svc.taskChannel <- &task:
+		svc.metrics.backlog.Add(ctx, 1)
+	case <-ctx.Done():
+		// The task is RECEIVED but not in the backlog, it can be requeued again
+		svc.restoreDeadLetter(letter)
+		return nil, ctx.Err()
+	}
+
+	svc.logger.Info("Dead-lettered task requeued", zap.Int("task.id", int(task.ID)), zap.String("task.namespace", task.Namespace))
+	return &task, nil
+}
+
+func (svc *TaskService) takeDeadLetter(namespace string, id uint32) (DeadLetter, bool) {
+	svc.deadLettersMu.Lock()
+	defer svc.deadLettersMu.Unlock()
+
+	i := slices.IndexFunc(svc.deadLetters, func(letter DeadLetter) bool {
+		return letter.Task.ID == id && inNamespace(letter.Task, namespace)
+	})
+	if i < 0 {
+		return DeadLetter{}, false
+	}
+	letter := svc.deadLetters[i]
+	svc.deadLetters = slices.Delete(svc.deadLetters, i, i+1)
+	return letter, true
+}
+
+// restoreDeadLetter keeps a dead letter taken by a failed requeue, in the order of the failures.
+func (svc *TaskService) restoreDeadLetter(letter DeadLetter) {
+	svc.deadLettersMu.Lock()
+	defer svc.deadLettersMu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(svc.deadLetters, letter.FailedAt, func(l DeadLetter, at time.Time) int {
+		return l.FailedAt.Compare(at)
+	})
+	svc.deadLetters = slices.Insert(svc.deadLetters, i, letter)
+}
+
+// inNamespace reports whether the task belongs to the namespace, every task belongs to the empty one.
+func inNamespace(task *domain.Task, namespace string) bool {
+	return namespace == "" || task.Namespace == namespace
+}
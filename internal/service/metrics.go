@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"strconv"
+	"time"
+)
+
+// Failure reasons used as the "reason" attribute of the failed tasks counter.
+const (
+	reasonStore            = "store"
+	reasonCanceled         = "canceled"
+	reasonDeadlineExceeded = "deadline_exceeded"
+)
+
+// Outcomes used as the "outcome" attribute of the latency histograms.
+const (
+	outcomeCompleted = "completed"
+	outcomeFailed    = "failed"
+)
+
+// latencyBuckets covers the range from a fast DB round trip up to a task
+// that waited in a long backlog.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// taskMetrics groups the instruments recorded by the TaskService.
+type taskMetrics struct {
+	created         metric.Int64Counter
+	completed       metric.Int64Counter
+	failed          metric.Int64Counter
+	value           metric.Int64Counter
+	endToEndLatency metric.Float64Histogram
+	queueWait       metric.Float64Histogram
+	handlerDuration metric.Float64Histogram
+	backlog         metric.Int64UpDownCounter
+	inFlight        metric.Int64UpDownCounter
+}
+
+// newTaskMetrics initializes the TaskService instruments using the given meter.
+func newTaskMetrics(meter metric.Meter) (*taskMetrics, error) {
+	var m taskMetrics
+	var err, errs error
+
+	m.created, err = meter.Int64Counter("tasks_created",
+		metric.WithDescription("The total number of tasks accepted and persisted by the consumer"))
+	errs = errors.Join(errs, err)
+
+	m.completed, err = meter.Int64Counter("tasks_completed",
+		metric.WithDescription("The total number of tasks that reached the DONE state"))
+	errs = errors.Join(errs, err)
+
+	m.failed, err = meter.Int64Counter("tasks_failed",
+		metric.WithDescription("The total number of tasks whose processing failed"))
+	errs = errors.Join(errs, err)
+
+	m.value, err = meter.Int64Counter("tasks_value",
+		metric.WithDescription("The total sum of values of completed tasks"))
+	errs = errors.Join(errs, err)
+
+	m.endToEndLatency, err = meter.Float64Histogram("task_end_to_end_latency",
+		metric.WithDescription("Time from task creation until processing finished"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...))
+	errs = errors.Join(errs, err)
+
+	m.queueWait, err = meter.Float64Histogram("task_queue_wait",
+		metric.WithDescription("Time a task spent in the backlog before processing started"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...))
+	errs = errors.Join(errs, err)
+
+	m.handlerDuration, err = meter.Float64Histogram("task_handler_duration",
+		metric.WithDescription("Time spent processing a single task"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...))
+	errs = errors.Join(errs, err)
+
+	m.backlog, err = meter.Int64UpDownCounter("tasks_backlog",
+		metric.WithDescription("The number of tasks waiting in the backlog to be processed"))
+	errs = errors.Join(errs, err)
+
+	m.inFlight, err = meter.Int64UpDownCounter("tasks_in_flight",
+		metric.WithDescription("The number of tasks currently being processed"))
+	errs = errors.Join(errs, err)
+
+	if errs != nil {
+		return nil, errs
+	}
+	return &m, nil
+}
+
+// taskAttrs returns the "type" and "namespace" attributes for the given task, followed by extra.
+func taskAttrs(task *domain.Task, extra ...attribute.KeyValue) metric.MeasurementOption {
+	return metric.WithAttributes(append([]attribute.KeyValue{
+		attribute.String("type", strconv.FormatUint(uint64(task.Type), 10)),
+		attribute.String("namespace", task.Namespace),
+	}, extra...)...)
+}
+
+// observeCreation records the metrics of a task accepted by CreateTask.
+func (m *taskMetrics) observeCreation(ctx context.Context, task *domain.Task) {
+	m.created.Add(ctx, 1, taskAttrs(task))
+}
+
+// observeQueueWait records the time the given task spent in the backlog.
+func (m *taskMetrics) observeQueueWait(ctx context.Context, task *domain.Task, startedAt time.Time) {
+	if task.ReceivedAt.IsZero() {
+		return
+	}
+	m.queueWait.Record(ctx, startedAt.Sub(task.ReceivedAt).Seconds(), taskAttrs(task))
+}
+
+// observeCompletion records the metrics of a task that reached the DONE state.
+func (m *taskMetrics) observeCompletion(ctx context.Context, task *domain.Task, startedAt time.Time) {
+	attrs := taskAttrs(task)
+	m.completed.Add(ctx, 1, attrs)
+	m.value.Add(ctx, int64(task.Value), attrs)
+	m.observeLatencies(ctx, task, startedAt, outcomeCompleted)
+}
+
+// observeFailure records the metrics of a task whose processing failed for the given reason.
+func (m *taskMetrics) observeFailure(ctx context.Context, task *domain.Task, startedAt time.Time, reason string) {
+	m.failed.Add(ctx, 1, taskAttrs(task, attribute.String("reason", reason)))
+	m.observeLatencies(ctx, task, startedAt, outcomeFailed)
+}
+
+func (m *taskMetrics) observeLatencies(ctx context.Context, task *domain.Task, startedAt time.Time, outcome string) {
+	attrs := taskAttrs(task, attribute.String("outcome", outcome))
+	m.handlerDuration.Record(ctx, time.Since(startedAt).Seconds(), attrs)
+	if !task.ReceivedAt.IsZero() {
+		m.endToEndLatency.Record(ctx, time.Since(task.ReceivedAt).Seconds(), attrs)
+	}
+}
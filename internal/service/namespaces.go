@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"golang.org/x/time/rate"
+	"math"
+	"sync"
+)
+
+// namespaceLimit holds the limits of a namespace, limiter is nil without a rate limit of its own.
+type namespaceLimit struct {
+	limiter *rate.Limiter
+	share   float64
+}
+
+// namespaceLimits applies the rate limits and worker shares of the namespaces. A task whose namespace
+// already occupies its share of the workers is parked until one of these workers is done, so that
+// it does not hold up the tasks of the other namespaces.
+type namespaceLimits struct {
+	mu     sync.Mutex
+	limits map[string]*namespaceLimit
+	active map[string]int
+	parked map[string][]*domain.Task
+	// parkedTasks counts the parked tasks of every namespace.
+	parkedTasks int
+	// freed is closed and replaced each time a worker is released or the limits change.
+	freed chan struct{}
+}
+
+func newNamespaceLimits() *namespaceLimits {
+	return &namespaceLimits{
+		limits: make(map[string]*namespaceLimit),
+		active: make(map[string]int),
+		parked: make(map[string][]*domain.Task),
+		freed:  make(chan struct{}),
+	}
+}
+
+// set replaces the configured limits, the limiters of the namespaces still limited are kept.
+func (n *namespaceLimits) set(limits []conf.NamespaceLimit) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	current := n.limits
+	n.limits = make(map[string]*namespaceLimit, len(limits))
+	for _, l := range limits {
+		limit := &namespaceLimit{share: l.WorkerShare}
+		if l.RateLimit > 0 {
+			limit.limiter = rate.NewLimiter(rate.Limit(l.RateLimit), l.GetBurst())
+			if previous, ok := current[l.Name]; ok && previous.limiter != nil {
+				limit.limiter = previous.limiter
+				limit.limiter.SetLimit(rate.Limit(l.RateLimit))
+				limit.limiter.SetBurst(l.GetBurst())
+			}
+		}
+		n.limits[l.Name] = limit
+	}
+	n.broadcastLocked()
+}
+
+// maxWorkersLocked returns the number of workers the namespace may occupy out of the given pool.
+func (n *namespaceLimits) maxWorkersLocked(namespace string, workers int) int {
+	limit, ok := n.limits[namespace]
+	if !ok || limit.share <= 0 {
+		return math.MaxInt
+	}
+	return max(1, int(limit.share*float64(workers)))
+}
+
+// acquire occupies a worker for the namespace, it returns false when the namespace already occupies its share.
+func (n *namespaceLimits) acquire(namespace string, workers int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.acquireLocked(namespace, workers)
+}
+
+func (n *namespaceLimits) acquireLocked(namespace string, workers int) bool {
+	if n.active[namespace] >= n.maxWorkersLocked(namespace, workers) {
+		return false
+	}
+	n.active[namespace]++
+	return true
+}
+
+// release frees a worker occupied by acquire.
+func (n *namespaceLimits) release(namespace string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.active[namespace]--; n.active[namespace] <= 0 {
+		delete(n.active, namespace)
+	}
+	n.broadcastLocked()
+}
+
+func (n *namespaceLimits) broadcastLocked() {
+	close(n.freed)
+	n.freed = make(chan struct{})
+}
+
+// park sets the task aside until its namespace has a free worker. It returns false when
+// the given number of tasks is already parked.
+func (n *namespaceLimits) park(task *domain.Task, limit int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.parkedTasks >= limit {
+		return false
+	}
+	n.parked[task.Namespace] = append(n.parked[task.Namespace], task)
+	n.parkedTasks++
+	return true
+}
+
+// unpark returns the oldest parked task of a namespace with a free worker, with the worker occupied.
+func (n *namespaceLimits) unpark(workers int) *domain.Task {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var next *domain.Task
+	for namespace, tasks := range n.parked {
+		if n.active[namespace] < n.maxWorkersLocked(namespace, workers) && (next == nil || tasks[0].ID < next.ID) {
+			next = tasks[0]
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	n.acquireLocked(next.Namespace, workers)
+	if n.parked[next.Namespace] = n.parked[next.Namespace][1:]; len(n.parked[next.Namespace]) == 0 {
+		delete(n.parked, next.Namespace)
+	}
+	n.parkedTasks--
+	return next
+}
+
+// takeParked removes every parked task.
+func (n *namespaceLimits) takeParked() []*domain.Task {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var tasks []*domain.Task
+	for _, parked := range n.parked {
+		tasks = append(tasks, parked...)
+	}
+	n.parked = make(map[string][]*domain.Task)
+	n.parkedTasks = 0
+	return tasks
+}
+
+// waitAcquire blocks until a worker is occupied for the namespace out of the current pool.
+// It returns false when stop or intake is closed first.
+func (n *namespaceLimits) waitAcquire(namespace string, workers func() int, stop, intake <-chan struct{}) bool {
+	for {
+		pool := workers()
+		n.mu.Lock()
+		if n.acquireLocked(namespace, pool) {
+			n.mu.Unlock()
+			return true
+		}
+		freed := n.freed
+		n.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-stop:
+			return false
+		case <-intake:
+			return false
+		}
+	}
+}
+
+// wait blocks until the rate limiter of the namespace, if any, allows a task.
+func (n *namespaceLimits) wait(ctx context.Context, namespace string) error {
+	n.mu.Lock()
+	limit, ok := n.limits[namespace]
+	n.mu.Unlock()
+
+	if !ok || limit.limiter == nil {
+		return nil
+	}
+	return limit.limiter.Wait(ctx)
+}
@@ -3,16 +3,16 @@ package service
 import (
 	"context"
 	"errors"
-	"fmt"
 	"github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
-	"github.com/hasanhakkaev/yqapp-demo/internal/database"
 	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
 	_ "github.com/lib/pq"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.opentelemetry.io/otel/metric"
 	"golang.org/x/time/rate"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -21,68 +21,79 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+const (
+	// maxIdempotencyKeyLength bounds the idempotency keys of the CreateTask requests.
+	maxIdempotencyKeyLength = 128
+	// maxBatchSize bounds the requests of a BatchCreateTasks call.
+	maxBatchSize = 1000
+	// defaultPageSize and maxPageSize bound the tasks returned by a ListTasks call.
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	// defaultWatchInterval is the interval at which WatchTask polls the store.
+	defaultWatchInterval = time.Second
+)
+
+// taskTypeKey identifies the tasks of a type within a namespace.
+type taskTypeKey struct {
+	namespace string
+	taskType  uint32
+}
+
 var (
-	taskTypeSums   = make(map[int]uint32)
+	taskTypeSums   = make(map[taskTypeKey]uint32)
 	taskTypeSumsMu sync.Mutex // Mutex to protect taskTypeSums map
-
-	receivedTasks = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "tasks_received_total",
-		Help: "The total number of received tasks",
-	})
-
-	processingTasks = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "tasks_processing_total",
-		Help: "The total number of tasks being processed",
-	})
-
-	doneTasks = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "tasks_done_total",
-		Help: "The total number of tasks completed",
-	})
-
-	taskTypeCount = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "tasks_per_type_total",
-			Help: "The number of tasks per task type",
-		},
-		[]string{"type"},
-	)
-
-	taskValueSum = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "task_value_sum_per_type",
-			Help: "The total sum of task values per task type",
-		},
-		[]string{"type"},
-	)
-
-	totalTasksByType = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "total_tasks_by_type",
-			Help: "The total number of tasks processed by type",
-		},
-		[]string{"type"},
-	)
 )
 
 type TaskService struct {
 	v1.UnimplementedTaskServiceServer
 	logger      *zap.Logger
-	queries     *database.Queries
+	store       store.TaskStore
 	meter       metric.Meter
+	metrics     *taskMetrics
 	taskChannel chan *domain.Task
 	taskLimiter *rate.Limiter
+	namespaces  *namespaceLimits
+
+	workers        sync.WaitGroup
+	poolMu         sync.Mutex
+	pool           []*worker
+	nextWorker     uint32
+	pauseMu        sync.Mutex
+	resume         chan struct{}
+	intake         context.Context
+	stopIntake     context.CancelFunc
+	processing     context.Context
+	stopProcessing context.CancelFunc
+	returnedMu     sync.Mutex
+	returned       []uint32
+	deadLettersMu  sync.Mutex
+	deadLetters    []DeadLetter
+	handlerTimeout atomic.Int64
+	watchInterval  time.Duration
 }
 
 // NewTaskService initializes a new v1.TaskProducerServiceServer implementation.
-func NewTaskService(logger *zap.Logger, queries *database.Queries, meter metric.Meter, taskChannel chan *domain.Task, taskLimiter *rate.Limiter) *TaskService {
-	return &TaskService{
-		logger:      logger,
-		queries:     queries,
-		meter:       meter,
-		taskChannel: taskChannel,
-		taskLimiter: taskLimiter,
+func NewTaskService(logger *zap.Logger, taskStore store.TaskStore, meter metric.Meter, taskChannel chan *domain.Task, taskLimiter *rate.Limiter) (*TaskService, error) {
+	metrics, err := newTaskMetrics(meter)
+	if err != nil {
+		return nil, err
 	}
+	intake, stopIntake := context.WithCancel(context.Background())
+	processing, stopProcessing := context.WithCancel(context.Background())
+	return &TaskService{
+		logger:         logger,
+		store:          taskStore,
+		meter:          meter,
+		metrics:        metrics,
+		taskChannel:    taskChannel,
+		taskLimiter:    taskLimiter,
+		namespaces:     newNamespaceLimits(),
+		intake:         intake,
+		stopIntake:     stopIntake,
+		processing:     processing,
+		stopProcessing: stopProcessing,
+		watchInterval:  defaultWatchInterval,
+	}, nil
 }
 
 func (svc *TaskService) CreateTask(ctx context.Context, request *v1.CreateTaskRequest) (*v1.Task, error) {
@@ -92,122 +103,284 @@ func (svc *TaskService) CreateTask(ctx context.Context, request *v1.CreateTaskRe
 
 	svc.logger.Log(svc.logger.Level(), "Parsing task from API request")
 
+	key := request.GetIdempotencyKey()
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, status.Errorf(codes.InvalidArgument, "idempotency key longer than %d bytes", maxIdempotencyKeyLength)
+	}
+
 	domainTask := domain.FromProtoToDomain(request.GetTask())
 
+	// The stores keep microseconds, the returned task has the times read back by GetTask and ListTasks
+	now := time.Now().Truncate(time.Microsecond)
 	domainTask.State = domain.StateRECEIVED
-	domainTask.CreationTime = float64(time.Now().Unix())
-	domainTask.LastUpdateTime = 0
+	domainTask.Namespace = namespace.FromContext(ctx)
+	domainTask.CreationTime = now
+	domainTask.ReceivedAt = now
+	domainTask.LastUpdateTime = now
 	svc.logger.Log(svc.logger.Level(), "Filling out task information")
 
-	taskParams := domainTask.ToTaskCreateParams()
-
 	svc.logger.Log(svc.logger.Level(), "Persisting task in the database")
 
-	dbTaskID, err := svc.queries.CreateTask(ctx, *taskParams)
+	var taskID uint32
+	var err error
+	created := true
+	if key == "" {
+		taskID, err = svc.store.CreateTask(ctx, domainTask)
+	} else {
+		taskID, created, err = svc.store.CreateTaskOnce(ctx, domainTask, key)
+	}
 	if err != nil {
 		svc.logger.Log(svc.logger.Level(), "Failed to persist task in the database", zap.Error(err))
 		return nil, status.Error(codes.Unavailable, "failed to create task")
 	}
 
-	domainTask.ID = uint32(dbTaskID)
+	if !created {
+		// A retry of a request already handled, its task is already in the backlog
+		existing, err := svc.store.GetTask(store.WithPrimary(ctx), domainTask.Namespace, taskID)
+		if err != nil {
+			return nil, taskError(err, "failed to get task")
+		}
+		svc.logger.Log(svc.logger.Level(), "Returning task of idempotency key", zap.Int("task.id", int(taskID)), zap.String("task.namespace", domainTask.Namespace))
+		return domain.FromDomainToProto(existing), nil
+	}
 
-	// After persisting task in DB
-	svc.taskChannel <- domainTask
+	domainTask.ID = taskID
 
-	receivedTasks.Inc()
+	svc.metrics.observeCreation(ctx, domainTask)
 
-	go svc.ConsumeTasks(svc.taskChannel, svc.taskLimiter)
+	// After persisting task in DB. A task left out of the backlog stays RECEIVED, the task recovery claims it
+	select {
+	case svc.taskChannel <- domainTask:
+		svc.metrics.backlog.Add(ctx, 1)
+	case <-svc.intake.Done():
+		svc.logger.Info("Task left for recovery by a draining consumer", zap.Int("task.id", int(taskID)), zap.String("task.namespace", domainTask.Namespace))
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
 
 	svc.logger.Log(svc.logger.Level(), "Task in the database persisted!")
 
-	svc.logger.Log(svc.logger.Level(), "Returning created task", zap.Int("task.id", int(dbTaskID)))
+	svc.logger.Log(svc.logger.Level(), "Returning created task", zap.Int("task.id", int(taskID)), zap.String("task.namespace", domainTask.Namespace))
 
 	return domain.FromDomainToProto(domainTask), nil
 
 }
 
+// BatchCreateTasks handles each request as a CreateTask call. The tasks created before a failure are
+// kept, retrying the batch with the same idempotency keys does not create them again.
+func (svc *TaskService) BatchCreateTasks(ctx context.Context, request *v1.BatchCreateTasksRequest) (*v1.BatchCreateTasksResponse, error) {
+	if len(request.GetRequests()) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "more than %d tasks in the batch", maxBatchSize)
+	}
+
+	response := &v1.BatchCreateTasksResponse{Tasks: make([]*v1.Task, 0, len(request.GetRequests()))}
+	for _, createRequest := range request.GetRequests() {
+		task, err := svc.CreateTask(ctx, createRequest)
+		if err != nil {
+			return nil, err
+		}
+		response.Tasks = append(response.Tasks, task)
+	}
+	return response, nil
+}
+
+// GetTask returns a task of the namespace of the caller.
+func (svc *TaskService) GetTask(ctx context.Context, request *v1.GetTaskRequest) (*v1.Task, error) {
+	task, err := svc.store.GetTask(ctx, namespace.FromContext(ctx), request.GetId())
+	if err != nil {
+		return nil, taskError(err, "failed to get task")
+	}
+	return domain.FromDomainToProto(task), nil
+}
+
+// ListTasks returns a page of the tasks of the namespace of the caller, the page token is the offset
+// of the next page.
+func (svc *TaskService) ListTasks(ctx context.Context, request *v1.ListTasksRequest) (*v1.ListTasksResponse, error) {
+	filter := store.ListFilter{Namespace: namespace.FromContext(ctx), Limit: defaultPageSize, Newest: request.GetNewestFirst()}
+	if request.State != nil {
+		filter.State = domain.MapGrpcStateToDomain(request.GetState())
+		if filter.State == "" {
+			return nil, status.Error(codes.InvalidArgument, "unknown task state")
+		}
+	}
+	if size := request.GetPageSize(); size > 0 {
+		filter.Limit = int32(min(size, maxPageSize))
+	}
+	if token := request.GetPageToken(); token != "" {
+		offset, err := strconv.ParseInt(token, 10, 32)
+		if err != nil || offset < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		filter.Offset = int32(offset)
+	}
+
+	// One more task tells whether there is a next page
+	filter.Limit++
+	tasks, err := svc.store.ListTasks(ctx, filter)
+	if err != nil {
+		svc.logger.Error("Failed to list tasks", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to list tasks")
+	}
+	filter.Limit--
+
+	response := &v1.ListTasksResponse{}
+	if len(tasks) > int(filter.Limit) {
+		tasks = tasks[:filter.Limit]
+		response.NextPageToken = strconv.Itoa(int(filter.Offset + filter.Limit))
+	}
+	for _, task := range tasks {
+		response.Tasks = append(response.Tasks, domain.FromDomainToProto(task))
+	}
+	return response, nil
+}
+
+// WatchTask polls the task and streams it whenever its state changes, until it is DONE or CANCELLED.
+func (svc *TaskService) WatchTask(request *v1.WatchTaskRequest, stream v1.TaskService_WatchTaskServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(svc.watchInterval)
+	defer ticker.Stop()
+
+	var sent *domain.Task
+	for {
+		task, err := svc.store.GetTask(ctx, namespace.FromContext(ctx), request.GetId())
+		if err != nil {
+			return taskError(err, "failed to get task")
+		}
+		if sent == nil || task.State != sent.State || !task.LastUpdateTime.Equal(sent.LastUpdateTime) {
+			if err := stream.Send(domain.FromDomainToProto(task)); err != nil {
+				return err
+			}
+			sent = task
+		}
+		if task.State == domain.StateDONE || task.State == domain.StateCANCELLED {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// CancelTask cancels a task of the namespace of the caller. A task already picked up by a worker is
+// not interrupted, but it is not moved to DONE.
+func (svc *TaskService) CancelTask(ctx context.Context, request *v1.CancelTaskRequest) (*v1.Task, error) {
+	task, err := svc.store.CancelTask(ctx, namespace.FromContext(ctx), request.GetId(), time.Now())
+	if err != nil {
+		return nil, taskError(err, "failed to cancel task")
+	}
+	svc.logger.Info("Task cancelled", zap.Int("task.id", int(task.ID)), zap.String("task.namespace", task.Namespace))
+	return domain.FromDomainToProto(task), nil
+}
+
+// GetTaskStats counts the tasks of the namespace of the caller per state and type and sums their values per type.
+func (svc *TaskService) GetTaskStats(ctx context.Context, _ *v1.GetTaskStatsRequest) (*v1.TaskStats, error) {
+	ns := namespace.FromContext(ctx)
+	counts, err := svc.store.CountByState(ctx, ns)
+	if err != nil {
+		svc.logger.Error("Failed to count tasks", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to count tasks")
+	}
+	typeCounts, err := svc.store.CountByType(ctx, ns)
+	if err != nil {
+		svc.logger.Error("Failed to count tasks", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to count tasks")
+	}
+	sums, err := svc.store.SumOfValues(ctx, ns)
+	if err != nil {
+		svc.logger.Error("Failed to sum task values", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "failed to sum task values")
+	}
+
+	stats := &v1.TaskStats{Counts: make(map[string]int64, len(counts)), ValueSums: sums, TypeCounts: typeCounts}
+	for state, count := range counts {
+		stats.Counts[string(state)] = count
+	}
+	return stats, nil
+}
+
+// taskError translates the errors of the store to gRPC errors, message describes the other errors.
+func taskError(err error, message string) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, "task not found")
+	case errors.Is(err, store.ErrFinished):
+		return status.Error(codes.FailedPrecondition, "task already finished")
+	default:
+		return status.Error(codes.Unavailable, message)
+	}
+}
+
 // ProcessTask processes a single task, updating its state and tracking metrics.
 func (svc *TaskService) ProcessTask(ctx context.Context, task *domain.Task) error {
 	svc.logger.Log(svc.logger.Level(), "Handling task", zap.Int("task.id", int(task.ID)))
 
+	startedAt := time.Now()
+	svc.metrics.observeQueueWait(ctx, task, startedAt)
+
+	svc.metrics.inFlight.Add(ctx, 1)
+	defer svc.metrics.inFlight.Add(ctx, -1)
+
 	// Update task state to "processing"
-	_, err := svc.queries.UpdateTaskState(ctx, database.UpdateTaskStateParams{
-		State:          database.StatePROCESSING,
-		LastUpdateTime: float64(time.Now().Unix()),
-		ID:             int32(task.ID),
-	})
+	_, err := svc.store.UpdateTaskState(ctx, task.ID, domain.StatePROCESSING, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		svc.logger.Info("Skipping task cancelled or claimed by another worker", zap.Int("task.id", int(task.ID)))
+		return nil
+	}
 	if err != nil {
 		svc.logger.Error("Failed to update task to processing", zap.Error(err))
+		svc.metrics.observeFailure(ctx, task, startedAt, reasonStore)
 		return status.Error(codes.Internal, "Failed to update task to processing")
 	}
 
-	// Increment processing tasks metric
-	processingTasks.Inc()
-
 	// Simulate processing by sleeping for task's value in milliseconds
-	time.Sleep(time.Duration(task.Value) * time.Millisecond)
+	select {
+	case <-time.After(time.Duration(task.Value) * time.Millisecond):
+	case <-ctx.Done():
+	}
 
 	if errors.Is(ctx.Err(), context.Canceled) {
 		svc.logger.Log(svc.logger.Level(), "Request is canceled")
+		svc.metrics.observeFailure(ctx, task, startedAt, reasonCanceled)
 		return status.Error(codes.Canceled, "Request is canceled")
 	}
 
 	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		svc.logger.Log(svc.logger.Level(), "Request deadline exceeded")
+		svc.metrics.observeFailure(ctx, task, startedAt, reasonDeadlineExceeded)
 		return status.Error(codes.DeadlineExceeded, "Request deadline exceeded")
 	}
 
 	// Update task state to "done"
-	_, err = svc.queries.UpdateTaskState(ctx, database.UpdateTaskStateParams{
-		State:          database.StateDONE,
-		LastUpdateTime: float64(time.Now().Unix()),
-		ID:             int32(task.ID),
-	})
+	_, err = svc.store.UpdateTaskState(ctx, task.ID, domain.StateDONE, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		svc.logger.Info("Task cancelled while processing", zap.Int("task.id", int(task.ID)))
+		return nil
+	}
 	if err != nil {
 		svc.logger.Error("Failed to update task to done", zap.Error(err))
+		svc.metrics.observeFailure(ctx, task, startedAt, reasonStore)
 		return status.Error(codes.Internal, "Failed to update task to done")
 	}
 
 	// Update metrics
-	receivedTasks.Dec()
-	processingTasks.Dec()
-
-	doneTasks.Inc()
-
-	taskTypeLabel := fmt.Sprintf("%d", task.Type)
-	totalTasksByType.WithLabelValues(taskTypeLabel).Inc()
-
-	taskTypeCount.WithLabelValues(fmt.Sprintf("%d", task.Type)).Inc()
-	taskValueSum.WithLabelValues(fmt.Sprintf("%d", task.Type)).Add(float64(task.Value))
+	svc.metrics.observeCompletion(ctx, task, startedAt)
 
 	// Use mutex to protect access to taskTypeSums
+	key := taskTypeKey{namespace: task.Namespace, taskType: task.Type}
 	taskTypeSumsMu.Lock()
-	taskTypeSums[int(task.Type)] += task.Value
+	taskTypeSums[key] += task.Value
+	sum := taskTypeSums[key]
 	taskTypeSumsMu.Unlock()
 
 	svc.logger.Log(svc.logger.Level(), "Task processed", zap.Int("id", int(task.ID)),
-		zap.Int("type", int(task.Type)), zap.Int("value", int(task.Value)))
+		zap.Int("type", int(task.Type)), zap.Int("value", int(task.Value)), zap.String("namespace", task.Namespace))
 
 	svc.logger.Log(svc.logger.Level(), "Task's content: ", zap.Any("task", task))
 
-	svc.logger.Log(svc.logger.Level(), "Sum of task values of type : ", zap.Int("type:", int(task.Type)), zap.Int("Sum", int(taskTypeSums[int(task.Type)])))
+	svc.logger.Log(svc.logger.Level(), "Sum of task values of type : ", zap.Int("type:", int(task.Type)), zap.String("namespace", task.Namespace), zap.Int("Sum", int(sum)))
 
 	return nil
 }
-
-// ConsumeTasks handles incoming tasks with a rate limiter.
-func (svc *TaskService) ConsumeTasks(taskChannel <-chan *domain.Task, limiter *rate.Limiter) {
-	for task := range taskChannel {
-		// Apply rate limiting
-		err := limiter.Wait(context.Background())
-		if err != nil {
-			svc.logger.Fatal("Rate limiter error", zap.Error(err))
-		}
-
-		// Process each task
-		err = svc.ProcessTask(context.Background(), task)
-		if err != nil {
-			return
-		}
-	}
-}
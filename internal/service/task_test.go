@@ -2,16 +2,20 @@ package service
 
 import (
 	"context"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
-	"github.com/hasanhakkaev/yqapp-demo/internal/database"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
 	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
-	_ "github.com/lib/pq"
-
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
 	"github.com/stretchr/testify/suite"
 	"go.opentelemetry.io/otel/metric/noop"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"testing"
+	"time"
 )
 
 func TestTasksServiceSuite(t *testing.T) {
@@ -20,9 +24,9 @@ func TestTasksServiceSuite(t *testing.T) {
 
 type TasksServiceTestSuite struct {
 	suite.Suite
-	service v1.TaskServiceServer
+	service *TaskService
 	logger  *zap.Logger
-	db      *database.Postgres
+	store   *store.Memory
 }
 
 func (suite *TasksServiceTestSuite) SetupSuite() {
@@ -35,23 +39,14 @@ func (suite *TasksServiceTestSuite) SetupTest() {
 	suite.logger, err = zap.NewDevelopment()
 	suite.Require().NoError(err)
 
-	err = database.MigrateModels("postgres:postgres@localhost:5432/postgres")
-	suite.Require().NoError(err)
-
-	suite.db, err = database.NewPostgres("postgres:postgres@localhost:5432/postgres")
-	suite.Require().NoError(err)
+	suite.store = store.NewMemory()
 
+	suite.service, err = NewTaskService(suite.logger, suite.store, noop.NewMeterProvider().Meter(""), make(chan *domain.Task, 10), nil)
 	suite.Require().NoError(err)
-	queries := database.New(suite.db.DB)
-
-	suite.service = NewTaskService(suite.logger, queries, noop.NewMeterProvider().Meter(""), nil, nil)
 }
 
 func (suite *TasksServiceTestSuite) TearDownTest() {
-	db := suite.db.DB
-	db.Close()
-	err := db.Ping(context.Background())
-	suite.Require().Errorf(err, "closed pool")
+	suite.Require().NoError(suite.store.Close())
 }
 
 func (suite *TasksServiceTestSuite) TearDownSuite() {
@@ -63,7 +58,7 @@ func (suite *TasksServiceTestSuite) TestCreate_Success() {
 	taskType := uint32(domain.RandomInt(0, 9))
 	taskValue := uint32(domain.RandomInt(0, 99))
 
-	res, err := suite.service.CreateTask(context.Background(), &v1.CreateTaskRequest{
+	res, err := suite.service.CreateTask(namespace.NewContext(context.Background(), "team-a"), &v1.CreateTaskRequest{
 		Task: &v1.Task{
 			Type:  taskType,
 			Value: taskValue,
@@ -73,4 +68,251 @@ func (suite *TasksServiceTestSuite) TestCreate_Success() {
 	suite.Assert().NoError(err)
 	suite.Assert().NotNil(res)
 
+	suite.Assert().Equal("team-a", res.GetNamespace())
+
+	stored, err := suite.store.GetTask(context.Background(), "team-a", res.GetId())
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateRECEIVED, stored.State)
+	suite.Assert().Equal(taskValue, stored.Value)
+}
+
+func (suite *TasksServiceTestSuite) TestProcess_Success() {
+	task := &domain.Task{Type: 3, Value: 1, State: domain.StateRECEIVED}
+	id, err := suite.store.CreateTask(context.Background(), task)
+	suite.Require().NoError(err)
+	task.ID = id
+
+	suite.Require().NoError(suite.service.ProcessTask(context.Background(), task))
+
+	stored, err := suite.store.GetTask(context.Background(), "", id)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateDONE, stored.State)
+}
+
+func (suite *TasksServiceTestSuite) TestCreate_IdempotencyKey() {
+	ctx := namespace.NewContext(context.Background(), "team-a")
+	request := &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 2}, IdempotencyKey: "key-1"}
+
+	first, err := suite.service.CreateTask(ctx, request)
+	suite.Require().NoError(err)
+	second, err := suite.service.CreateTask(ctx, request)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(first.GetId(), second.GetId())
+	suite.Assert().Len(suite.service.taskChannel, 1, "the retried task is not queued again")
+
+	batch, err := suite.service.BatchCreateTasks(ctx, &v1.BatchCreateTasksRequest{Requests: []*v1.CreateTaskRequest{
+		request,
+		{Task: &v1.Task{Type: 3, Value: 4}, IdempotencyKey: "key-2"},
+	}})
+	suite.Require().NoError(err)
+	suite.Require().Len(batch.GetTasks(), 2)
+	suite.Assert().Equal(first.GetId(), batch.GetTasks()[0].GetId())
+	suite.Assert().Equal(uint32(3), batch.GetTasks()[1].GetType())
+}
+
+func (suite *TasksServiceTestSuite) TestCreate_StoredTimes() {
+	sqlite, err := store.NewSQLite(context.Background(), ":memory:")
+	suite.Require().NoError(err)
+	defer func() { suite.Require().NoError(sqlite.Close()) }()
+	service, err := NewTaskService(suite.logger, sqlite, noop.NewMeterProvider().Meter(""), make(chan *domain.Task, 10), nil)
+	suite.Require().NoError(err)
+
+	created, err := service.CreateTask(context.Background(), &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 2}})
+	suite.Require().NoError(err)
+	stored, err := service.GetTask(context.Background(), &v1.GetTaskRequest{Id: created.GetId()})
+	suite.Require().NoError(err)
+	suite.Assert().True(proto.Equal(stored, created), "the created task is the stored one")
+}
+
+func (suite *TasksServiceTestSuite) TestCreate_FullBacklog() {
+	service, err := NewTaskService(suite.logger, suite.store, noop.NewMeterProvider().Meter(""), make(chan *domain.Task, 1), nil)
+	suite.Require().NoError(err)
+	request := &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 2}}
+	_, err = service.CreateTask(context.Background(), request)
+	suite.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = service.CreateTask(ctx, request)
+	suite.Assert().Equal(codes.DeadlineExceeded, status.Code(err))
+	stored, err := suite.store.GetTask(context.Background(), "", 2)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateRECEIVED, stored.State, "the task is left for recovery")
+
+	// A draining consumer does not wait for room in the backlog
+	suite.Require().NoError(service.Drain(context.Background()))
+	service.taskChannel <- &domain.Task{}
+	task, err := service.CreateTask(context.Background(), request)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(v1.TaskState_RECEIVED, task.GetState())
+}
+
+func (suite *TasksServiceTestSuite) TestListTasks() {
+	ctx := namespace.NewContext(context.Background(), "team-a")
+	for i := 0; i < 5; i++ {
+		_, err := suite.service.CreateTask(ctx, &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: uint32(i)}})
+		suite.Require().NoError(err)
+	}
+	_, err := suite.service.CreateTask(namespace.NewContext(context.Background(), "team-b"), &v1.CreateTaskRequest{Task: &v1.Task{}})
+	suite.Require().NoError(err)
+
+	var values []uint32
+	request := &v1.ListTasksRequest{PageSize: 2}
+	for pages := 1; ; pages++ {
+		page, err := suite.service.ListTasks(ctx, request)
+		suite.Require().NoError(err)
+		for _, task := range page.GetTasks() {
+			values = append(values, task.GetValue())
+		}
+		if page.GetNextPageToken() == "" {
+			suite.Assert().Equal(3, pages)
+			break
+		}
+		request.PageToken = page.GetNextPageToken()
+	}
+	suite.Assert().Equal([]uint32{0, 1, 2, 3, 4}, values, "the tasks of other namespaces are not listed")
+
+	state := v1.TaskState_DONE
+	page, err := suite.service.ListTasks(ctx, &v1.ListTasksRequest{State: &state})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(page.GetTasks())
+
+	_, err = suite.service.ListTasks(ctx, &v1.ListTasksRequest{PageToken: "next"})
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func (suite *TasksServiceTestSuite) TestCancelTask() {
+	ctx := namespace.NewContext(context.Background(), "team-a")
+	created, err := suite.service.CreateTask(ctx, &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 1}})
+	suite.Require().NoError(err)
+
+	_, err = suite.service.CancelTask(namespace.NewContext(context.Background(), "team-b"), &v1.CancelTaskRequest{Id: created.GetId()})
+	suite.Assert().Equal(codes.NotFound, status.Code(err))
+
+	cancelled, err := suite.service.CancelTask(ctx, &v1.CancelTaskRequest{Id: created.GetId()})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(v1.TaskState_CANCELLED, cancelled.GetState())
+
+	_, err = suite.service.CancelTask(ctx, &v1.CancelTaskRequest{Id: created.GetId()})
+	suite.Assert().Equal(codes.FailedPrecondition, status.Code(err))
+
+	// The worker picking up the cancelled task skips it
+	suite.Require().NoError(suite.service.ProcessTask(context.Background(), <-suite.service.taskChannel))
+	stored, err := suite.store.GetTask(context.Background(), "", created.GetId())
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateCANCELLED, stored.State)
+}
+
+func (suite *TasksServiceTestSuite) TestGetTaskStats() {
+	ctx := namespace.NewContext(context.Background(), "team-a")
+	for _, value := range []uint32{1, 2, 3} {
+		_, err := suite.service.CreateTask(ctx, &v1.CreateTaskRequest{Task: &v1.Task{Type: value % 2, Value: value}})
+		suite.Require().NoError(err)
+	}
+	_, err := suite.service.CancelTask(ctx, &v1.CancelTaskRequest{Id: 1})
+	suite.Require().NoError(err)
+	_, err = suite.service.CreateTask(namespace.NewContext(context.Background(), "team-b"), &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 10}})
+	suite.Require().NoError(err)
+
+	stats, err := suite.service.GetTaskStats(ctx, &v1.GetTaskStatsRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[string]int64{"RECEIVED": 2, "CANCELLED": 1}, stats.GetCounts())
+	suite.Assert().Equal(map[uint32]int64{0: 2, 1: 4}, stats.GetValueSums(), "the tasks of other namespaces are not counted")
+	suite.Assert().Equal(map[uint32]int64{0: 1, 1: 2}, stats.GetTypeCounts())
+}
+
+func (suite *TasksServiceTestSuite) TestDeadLetters() {
+	ctx := namespace.NewContext(context.Background(), "team-a")
+	for i := 0; i < 2; i++ {
+		_, err := suite.service.CreateTask(ctx, &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 1}})
+		suite.Require().NoError(err)
+		task := <-suite.service.taskChannel
+		_, err = suite.store.UpdateTaskState(context.Background(), task.ID, domain.StatePROCESSING, time.Now())
+		suite.Require().NoError(err)
+		suite.service.deadLetter(task, status.Error(codes.DeadlineExceeded, "Request deadline exceeded"))
+	}
+
+	letters := suite.service.DeadLetters("")
+	suite.Require().Len(letters, 2)
+	suite.Assert().Equal([]uint32{2, 1}, []uint32{letters[0].Task.ID, letters[1].Task.ID}, "the most recent failures first")
+	suite.Assert().Equal("Request deadline exceeded", letters[0].Reason)
+	suite.Assert().Len(suite.service.DeadLetters("team-a"), 2)
+	suite.Assert().Empty(suite.service.DeadLetters("team-b"))
+
+	_, err := suite.service.RequeueDeadLetter(context.Background(), "team-b", 1)
+	suite.Assert().ErrorIs(err, store.ErrNotFound, "the tasks of other namespaces are not found")
+	task, err := suite.service.RequeueDeadLetter(context.Background(), "team-a", 1)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateRECEIVED, task.State)
+	suite.Assert().Equal(uint32(1), (<-suite.service.taskChannel).ID, "the task is back in the backlog")
+	stored, err := suite.store.GetTask(context.Background(), "", 1)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateRECEIVED, stored.State)
+
+	_, err = suite.service.RequeueDeadLetter(context.Background(), "", 1)
+	suite.Assert().ErrorIs(err, store.ErrNotFound)
+
+	_, err = suite.service.CancelTask(ctx, &v1.CancelTaskRequest{Id: 2})
+	suite.Require().NoError(err)
+	_, err = suite.service.RequeueDeadLetter(context.Background(), "", 2)
+	suite.Assert().ErrorIs(err, store.ErrFinished)
+	suite.Assert().Empty(suite.service.DeadLetters(""), "the finished tasks are forgotten")
+}
+
+// watchStream collects the tasks sent by WatchTask.
+type watchStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	tasks chan *v1.Task
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(task *v1.Task) error {
+	s.tasks <- task
+	return nil
+}
+
+func (suite *TasksServiceTestSuite) TestWatchTask() {
+	suite.service.watchInterval = time.Millisecond
+	ctx := namespace.NewContext(context.Background(), "team-a")
+	created, err := suite.service.CreateTask(ctx, &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: 1}})
+	suite.Require().NoError(err)
+
+	stream := &watchStream{ctx: ctx, tasks: make(chan *v1.Task, 10)}
+	done := make(chan error, 1)
+	go func() { done <- suite.service.WatchTask(&v1.WatchTaskRequest{Id: created.GetId()}, stream) }()
+
+	suite.Assert().Equal(v1.TaskState_RECEIVED, (<-stream.tasks).GetState())
+	suite.Require().NoError(suite.service.ProcessTask(context.Background(), <-suite.service.taskChannel))
+	suite.Require().NoError(<-done, "the stream ends once the task is DONE")
+
+	var states []v1.TaskState
+	for len(stream.tasks) > 0 {
+		states = append(states, (<-stream.tasks).GetState())
+	}
+	suite.Assert().Equal(v1.TaskState_DONE, states[len(states)-1])
+}
+
+func (suite *TasksServiceTestSuite) TestNamespaceLimits() {
+	limits := newNamespaceLimits()
+	limits.set([]conf.NamespaceLimit{{Name: "team-a", WorkerShare: 0.5}})
+
+	// team-a may occupy 2 of the 4 workers, the other namespaces are not limited
+	suite.Assert().True(limits.acquire("team-a", 4))
+	suite.Assert().True(limits.acquire("team-a", 4))
+	suite.Assert().False(limits.acquire("team-a", 4))
+	suite.Assert().True(limits.acquire("team-b", 4))
+
+	parked := &domain.Task{ID: 7, Namespace: "team-a"}
+	suite.Assert().True(limits.park(parked, 1))
+	suite.Assert().False(limits.park(&domain.Task{ID: 8, Namespace: "team-a"}, 1), "the parked tasks are bounded")
+	suite.Assert().Nil(limits.unpark(4))
+
+	limits.release("team-a")
+	suite.Assert().Same(parked, limits.unpark(4))
+	suite.Assert().False(limits.acquire("team-a", 4), "the unparked task occupies the released worker")
+	suite.Assert().Empty(limits.takeParked())
 }
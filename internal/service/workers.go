@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// requeueTimeout bounds the time spent returning tasks to the RECEIVED state during a drain.
+	requeueTimeout = 5 * time.Second
+	// maxRecoveredTasks bounds the tasks claimed by a single recovery.
+	maxRecoveredTasks = 1000
+)
+
+// worker holds the state of a single goroutine consuming the backlog.
+type worker struct {
+	id       uint32
+	stop     chan struct{}
+	stopping bool
+	current  atomic.Pointer[domain.Task]
+	// processed and failed count the tasks handled by the worker, lastActive is the
+	// last time it picked up or finished a task in Unix nanoseconds.
+	processed  atomic.Uint64
+	failed     atomic.Uint64
+	lastActive atomic.Int64
+}
+
+// WorkerStatus holds the task a worker is processing, Task is nil for idle workers.
+type WorkerStatus struct {
+	Worker    uint32
+	Task      *domain.Task
+	Processed uint64
+	Failed    uint64
+	// LastActiveAt is zero for the workers that never picked up a task.
+	LastActiveAt time.Time
+}
+
+// StartWorkers starts the given number of workers consuming tasks from the backlog until Drain is called.
+func (svc *TaskService) StartWorkers(workers int) {
+	svc.ResizeWorkers(workers)
+}
+
+// ResizeWorkers starts or stops workers until the given number of workers is running.
+// Stopped workers finish their current task before exiting.
+func (svc *TaskService) ResizeWorkers(workers int) {
+	svc.poolMu.Lock()
+	defer svc.poolMu.Unlock()
+
+	if svc.intake.Err() != nil {
+		return
+	}
+
+	var active []*worker
+	for _, w := range svc.pool {
+		if !w.stopping {
+			active = append(active, w)
+		}
+	}
+
+	if len(active) == workers {
+		return
+	}
+	svc.logger.Log(svc.logger.Level(), "Resizing task workers", zap.Int("workers.from", len(active)), zap.Int("workers.to", workers))
+
+	for i := len(active); i < workers; i++ {
+		svc.nextWorker++
+		w := &worker{id: svc.nextWorker, stop: make(chan struct{})}
+		svc.pool = append(svc.pool, w)
+		svc.workers.Add(1)
+		go svc.ConsumeTasks(w)
+	}
+
+	for i := workers; i < len(active); i++ {
+		active[i].stopping = true
+		close(active[i].stop)
+	}
+}
+
+// Workers returns the number of running workers, excluding the ones finishing their last task.
+func (svc *TaskService) Workers() int {
+	svc.poolMu.Lock()
+	defer svc.poolMu.Unlock()
+
+	var n int
+	for _, w := range svc.pool {
+		if !w.stopping {
+			n++
+		}
+	}
+	return n
+}
+
+// Backlog returns the number of tasks waiting for a worker and the capacity of the backlog.
+// CreateTask blocks while the backlog is full.
+func (svc *TaskService) Backlog() (queued int, capacity int) {
+	return len(svc.taskChannel), cap(svc.taskChannel)
+}
+
+// InFlight returns the task processed by each worker and its activity.
+func (svc *TaskService) InFlight() []WorkerStatus {
+	svc.poolMu.Lock()
+	defer svc.poolMu.Unlock()
+
+	statuses := make([]WorkerStatus, 0, len(svc.pool))
+	for _, w := range svc.pool {
+		status := WorkerStatus{Worker: w.id, Task: w.current.Load(), Processed: w.processed.Load(), Failed: w.failed.Load()}
+		if lastActive := w.lastActive.Load(); lastActive != 0 {
+			status.LastActiveAt = time.Unix(0, lastActive)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Worker < statuses[j].Worker })
+	return statuses
+}
+
+// Pause stops the workers from picking up new tasks. In-flight tasks are finished.
+func (svc *TaskService) Pause() {
+	svc.pauseMu.Lock()
+	defer svc.pauseMu.Unlock()
+
+	if svc.resume == nil {
+		svc.logger.Log(svc.logger.Level(), "Pausing task processing")
+		svc.resume = make(chan struct{})
+	}
+}
+
+// Resume lets the workers pick up new tasks again after a Pause.
+func (svc *TaskService) Resume() {
+	svc.pauseMu.Lock()
+	defer svc.pauseMu.Unlock()
+
+	if svc.resume != nil {
+		svc.logger.Log(svc.logger.Level(), "Resuming task processing")
+		close(svc.resume)
+		svc.resume = nil
+	}
+}
+
+// Paused reports whether the task processing is paused.
+func (svc *TaskService) Paused() bool {
+	svc.pauseMu.Lock()
+	defer svc.pauseMu.Unlock()
+	return svc.resume != nil
+}
+
+// SetRateLimit changes the limit and burst of the task rate limiter.
+func (svc *TaskService) SetRateLimit(limit rate.Limit, burst int) {
+	svc.logger.Log(svc.logger.Level(), "Changing task rate limit", zap.Float64("limit", float64(limit)), zap.Int("burst", burst))
+	svc.taskLimiter.SetLimit(limit)
+	svc.taskLimiter.SetBurst(burst)
+}
+
+// RateLimit returns the limit and burst of the task rate limiter.
+func (svc *TaskService) RateLimit() (rate.Limit, int) {
+	return svc.taskLimiter.Limit(), svc.taskLimiter.Burst()
+}
+
+// ConsumeTasks handles incoming tasks with a rate limiter until the worker or the intake is stopped.
+func (svc *TaskService) ConsumeTasks(w *worker) {
+	defer svc.workers.Done()
+	defer svc.removeWorker(w)
+	logger := svc.logger.With(zap.Uint32("worker", w.id))
+
+	for {
+		if !svc.waitWhilePaused(w) {
+			return
+		}
+
+		task, ok := svc.nextTask(w)
+		if !ok {
+			return
+		}
+		svc.metrics.backlog.Add(context.Background(), -1)
+
+		// Apply rate limiting, a drain may interrupt the wait before the task has started
+		if err := svc.taskLimiter.Wait(svc.intake); err != nil {
+			svc.namespaces.release(task.Namespace)
+			svc.returnTask(task)
+			return
+		}
+		if err := svc.namespaces.wait(svc.intake, task.Namespace); err != nil {
+			svc.namespaces.release(task.Namespace)
+			svc.returnTask(task)
+			return
+		}
+
+		// Process each task
+		w.current.Store(task)
+		w.lastActive.Store(time.Now().UnixNano())
+		err := svc.processTask(task)
+		w.current.Store(nil)
+		w.lastActive.Store(time.Now().UnixNano())
+		svc.namespaces.release(task.Namespace)
+		if err != nil {
+			if svc.processing.Err() != nil {
+				svc.returnTask(task)
+				return
+			}
+			w.failed.Add(1)
+			logger.Error("Failed to process task", zap.Int("task.id", int(task.ID)), zap.Error(err))
+			svc.deadLetter(task, err)
+			continue
+		}
+		w.processed.Add(1)
+	}
+}
+
+// nextTask returns the next task whose namespace has a free worker, the worker is occupied for
+// the namespace. Tasks whose namespace occupies its share of the workers are parked, up to the
+// backlog size. It returns false when the worker must exit.
+func (svc *TaskService) nextTask(w *worker) (*domain.Task, bool) {
+	for {
+		if task := svc.namespaces.unpark(svc.Workers()); task != nil {
+			return task, true
+		}
+
+		select {
+		case <-svc.intake.Done():
+			return nil, false
+		case <-w.stop:
+			return nil, false
+		case task := <-svc.taskChannel:
+			if svc.namespaces.acquire(task.Namespace, svc.Workers()) {
+				return task, true
+			}
+			if svc.namespaces.park(task, cap(svc.taskChannel)) {
+				continue
+			}
+			if svc.namespaces.waitAcquire(task.Namespace, svc.Workers, w.stop, svc.intake.Done()) {
+				return task, true
+			}
+			svc.metrics.backlog.Add(context.Background(), -1)
+			svc.returnTask(task)
+			return nil, false
+		}
+	}
+}
+
+// SetNamespaceLimits replaces the rate limits and worker shares of the namespaces.
+func (svc *TaskService) SetNamespaceLimits(limits []conf.NamespaceLimit) {
+	svc.logger.Log(svc.logger.Level(), "Changing namespace limits", zap.Int("namespaces", len(limits)))
+	svc.namespaces.set(limits)
+}
+
+// SetHandlerTimeout bounds the time spent processing a single task, zero disables the timeout.
+func (svc *TaskService) SetHandlerTimeout(timeout time.Duration) {
+	svc.logger.Log(svc.logger.Level(), "Changing task handler timeout", zap.Duration("timeout", timeout))
+	svc.handlerTimeout.Store(int64(timeout))
+}
+
+// processTask processes the task within the handler timeout, if any.
+func (svc *TaskService) processTask(task *domain.Task) error {
+	ctx := svc.processing
+	if timeout := time.Duration(svc.handlerTimeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return svc.ProcessTask(ctx, task)
+}
+
+// waitWhilePaused blocks while the processing is paused. It returns false if the worker must exit instead.
+func (svc *TaskService) waitWhilePaused(w *worker) bool {
+	svc.pauseMu.Lock()
+	resume := svc.resume
+	svc.pauseMu.Unlock()
+
+	if resume == nil {
+		return true
+	}
+
+	select {
+	case <-resume:
+		return true
+	case <-w.stop:
+		return false
+	case <-svc.intake.Done():
+		return false
+	}
+}
+
+func (svc *TaskService) removeWorker(w *worker) {
+	svc.poolMu.Lock()
+	defer svc.poolMu.Unlock()
+
+	for i, candidate := range svc.pool {
+		if candidate == w {
+			svc.pool = append(svc.pool[:i], svc.pool[i+1:]...)
+			return
+		}
+	}
+}
+
+// RecoverTasks adds the RECEIVED tasks missing from the backlog of every replica to the backlog, e.g. the
+// tasks returned by a drain or imported. Every RECEIVED task is claimed on start, then every interval the
+// tasks left RECEIVED for longer than age, until ctx is done. A task still in the backlog of a busy replica
+// may be claimed as well, it is processed by the first worker picking it up and skipped by the other one.
+func (svc *TaskService) RecoverTasks(ctx context.Context, interval, age time.Duration) {
+	svc.recoverTasks(ctx, time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			svc.recoverTasks(ctx, time.Now().Add(-age))
+		}
+	}
+}
+
+// recoverTasks claims the RECEIVED tasks last updated before the given time, up to the free room of the
+// backlog, and adds them to the backlog. It returns the number of tasks added.
+func (svc *TaskService) recoverTasks(ctx context.Context, updatedBefore time.Time) int {
+	room := min(cap(svc.taskChannel)-len(svc.taskChannel), maxRecoveredTasks)
+	if room <= 0 || svc.intake.Err() != nil {
+		return 0
+	}
+
+	now := time.Now()
+	tasks, err := svc.store.ClaimReceivedTasks(ctx, updatedBefore, int32(room), now)
+	if err != nil {
+		svc.logger.Warn("Failed to claim received tasks", zap.Error(err))
+		return 0
+	}
+
+	var added int
+	for _, task := range tasks {
+		task.ReceivedAt = now
+		select {
+		case svc.taskChannel <- task:
+			svc.metrics.backlog.Add(ctx, 1)
+			added++
+		default:
+			// The backlog was filled by new tasks, the other ones are claimed again later
+		}
+	}
+	if added > 0 {
+		svc.logger.Info("Recovered received tasks", zap.Int("tasks", added))
+	}
+	return added
+}
+
+// Drain stops the workers from picking up new tasks and waits for the in-flight tasks to finish.
+// Tasks still in flight when ctx is done are interrupted. Interrupted tasks and tasks left in the
+// backlog are returned to the RECEIVED state so that RecoverTasks claims them again.
+func (svc *TaskService) Drain(ctx context.Context) error {
+	svc.logger.Log(svc.logger.Level(), "Draining task workers")
+	svc.poolMu.Lock()
+	svc.stopIntake()
+	svc.poolMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		svc.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		svc.logger.Warn("Drain deadline exceeded, interrupting in-flight tasks")
+		svc.stopProcessing()
+		<-done
+	}
+	svc.stopProcessing()
+
+	// Collect the tasks that were never started
+	for _, task := range svc.namespaces.takeParked() {
+		svc.metrics.backlog.Add(context.Background(), -1)
+		svc.returnTask(task)
+	}
+	for pending := true; pending; {
+		select {
+		case task := <-svc.taskChannel:
+			svc.metrics.backlog.Add(context.Background(), -1)
+			svc.returnTask(task)
+		default:
+			pending = false
+		}
+	}
+
+	svc.returnedMu.Lock()
+	ids := svc.returned
+	svc.returned = nil
+	svc.returnedMu.Unlock()
+
+	if len(ids) == 0 {
+		svc.logger.Log(svc.logger.Level(), "Task workers drained")
+		return nil
+	}
+
+	// The drain deadline may already be exceeded, use a fresh one to persist the returned tasks
+	requeueCtx, cancel := context.WithTimeout(context.Background(), requeueTimeout)
+	defer cancel()
+
+	n, err := svc.store.RequeueTasks(requeueCtx, ids, time.Now())
+	if err != nil {
+		svc.logger.Error("Failed to return tasks to the RECEIVED state", zap.Int("tasks", len(ids)), zap.Error(err))
+		return err
+	}
+
+	svc.logger.Log(svc.logger.Level(), "Task workers drained", zap.Int("tasks.returned", len(ids)), zap.Int64("tasks.requeued", n))
+	return nil
+}
+
+// returnTask marks the given task to be returned to the RECEIVED state once the workers are drained.
+func (svc *TaskService) returnTask(task *domain.Task) {
+	svc.returnedMu.Lock()
+	svc.returned = append(svc.returned, task.ID)
+	svc.returnedMu.Unlock()
+}
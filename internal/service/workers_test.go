@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"github.com/hasanhakkaev/yqapp-demo/internal/store"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestWorkersSuite(t *testing.T) {
+	suite.Run(t, new(WorkersTestSuite))
+}
+
+// WorkersTestSuite runs the worker pool of a TaskService against an in-memory store.
+type WorkersTestSuite struct {
+	suite.Suite
+	store   *store.Memory
+	service *TaskService
+}
+
+func (suite *WorkersTestSuite) SetupTest() {
+	suite.store = store.NewMemory().WithOutbox()
+	suite.service = suite.newService()
+}
+
+func (suite *WorkersTestSuite) TearDownTest() {
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	suite.Require().NoError(suite.service.Drain(drainCtx))
+	suite.Require().NoError(suite.store.Close())
+}
+
+// newService returns a TaskService of a new replica sharing the store of the suite.
+func (suite *WorkersTestSuite) newService() *TaskService {
+	svc, err := NewTaskService(zap.NewNop(), suite.store, noop.NewMeterProvider().Meter(""), make(chan *domain.Task, 10), rate.NewLimiter(rate.Inf, 1))
+	suite.Require().NoError(err)
+	return svc
+}
+
+func (suite *WorkersTestSuite) createTask(svc *TaskService, value uint32) uint32 {
+	created, err := svc.CreateTask(namespace.NewContext(context.Background(), "team-a"), &v1.CreateTaskRequest{Task: &v1.Task{Type: 1, Value: value}})
+	suite.Require().NoError(err)
+	return created.GetId()
+}
+
+func (suite *WorkersTestSuite) state(id uint32) domain.State {
+	task, err := suite.store.GetTask(context.Background(), "", id)
+	suite.Require().NoError(err)
+	return task.State
+}
+
+// inFlight returns the ids of the tasks processed by the workers of svc.
+func inFlight(svc *TaskService) []uint32 {
+	var ids []uint32
+	for _, status := range svc.InFlight() {
+		if status.Task != nil {
+			ids = append(ids, status.Task.ID)
+		}
+	}
+	return ids
+}
+
+func (suite *WorkersTestSuite) TestDrainAndRecover() {
+	drained := suite.service
+	drained.StartWorkers(1)
+
+	// The only worker holds the first task, the other ones wait in the backlog
+	busy := suite.createTask(drained, 500)
+	suite.Require().Eventually(func() bool { return len(inFlight(drained)) == 1 }, time.Second, time.Millisecond)
+	queued := []uint32{suite.createTask(drained, 1), suite.createTask(drained, 1)}
+	suite.Require().Equal(domain.StatePROCESSING, suite.state(busy))
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	suite.Require().NoError(drained.Drain(drainCtx))
+
+	for _, id := range append([]uint32{busy}, queued...) {
+		suite.Assert().Equal(domain.StateRECEIVED, suite.state(id), "task %d is returned to RECEIVED", id)
+	}
+
+	// Another replica claims the returned tasks on start and processes them
+	suite.service = suite.newService()
+	suite.service.StartWorkers(3)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go suite.service.RecoverTasks(ctx, time.Hour, time.Hour)
+
+	suite.Assert().Eventually(func() bool {
+		return suite.state(busy) == domain.StateDONE && suite.state(queued[0]) == domain.StateDONE && suite.state(queued[1]) == domain.StateDONE
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func (suite *WorkersTestSuite) TestRecoverTasks_ClaimedTwice() {
+	id := suite.createTask(suite.service, 1)
+
+	// A second replica claims the task still waiting in the backlog of the first one
+	other := suite.newService()
+	defer func() { suite.Require().NoError(other.Drain(context.Background())) }()
+	suite.Require().Equal(1, other.recoverTasks(context.Background(), time.Now().Add(time.Second)))
+
+	suite.Require().NoError(suite.service.ProcessTask(context.Background(), <-suite.service.taskChannel))
+	suite.Require().NoError(other.ProcessTask(context.Background(), <-other.taskChannel))
+
+	suite.Assert().Equal(domain.StateDONE, suite.state(id))
+
+	var events []string
+	_, err := suite.store.RelayEvents(context.Background(), 10, func(batch []store.OutboxEvent) (int, error) {
+		for _, event := range batch {
+			events = append(events, event.Type)
+		}
+		return len(batch), nil
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{store.EventTaskCreated, store.EventTaskProcessing, store.EventTaskDone}, events, "the task is processed once")
+}
+
+func (suite *WorkersTestSuite) TestResizeWorkers_Grow() {
+	suite.service.StartWorkers(1)
+	suite.service.ResizeWorkers(3)
+	suite.Assert().Equal(3, suite.service.Workers())
+
+	ids := []uint32{suite.createTask(suite.service, 200), suite.createTask(suite.service, 200), suite.createTask(suite.service, 200)}
+	suite.Assert().Eventually(func() bool { return len(inFlight(suite.service)) == 3 }, time.Second, time.Millisecond)
+	suite.Assert().ElementsMatch(ids, inFlight(suite.service))
+}
+
+func (suite *WorkersTestSuite) TestResizeWorkers_Shrink() {
+	suite.service.StartWorkers(3)
+	ids := []uint32{suite.createTask(suite.service, 200), suite.createTask(suite.service, 200), suite.createTask(suite.service, 200)}
+	suite.Require().Eventually(func() bool { return len(inFlight(suite.service)) == 3 }, time.Second, time.Millisecond)
+
+	// The stopped workers finish their current task before exiting
+	suite.service.ResizeWorkers(1)
+	suite.Assert().Equal(1, suite.service.Workers())
+	suite.Assert().Len(suite.service.InFlight(), 3)
+	suite.Assert().Eventually(func() bool {
+		for _, id := range ids {
+			if suite.state(id) != domain.StateDONE {
+				return false
+			}
+		}
+		return len(suite.service.InFlight()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The remaining worker keeps processing the backlog
+	id := suite.createTask(suite.service, 1)
+	suite.Assert().Eventually(func() bool { return suite.state(id) == domain.StateDONE }, time.Second, time.Millisecond)
+}
+
+func (suite *WorkersTestSuite) TestPauseAndResume() {
+	suite.service.Pause()
+	suite.Require().True(suite.service.Paused())
+	suite.service.StartWorkers(2)
+
+	id := suite.createTask(suite.service, 1)
+	suite.Assert().Never(func() bool { return suite.state(id) != domain.StateRECEIVED }, 50*time.Millisecond, 5*time.Millisecond)
+	queued, _ := suite.service.Backlog()
+	suite.Assert().Equal(1, queued)
+
+	suite.service.Resume()
+	suite.Assert().False(suite.service.Paused())
+	suite.Assert().Eventually(func() bool { return suite.state(id) == domain.StateDONE }, time.Second, time.Millisecond)
+}
+
+func (suite *WorkersTestSuite) TestSetRateLimit() {
+	suite.service.SetRateLimit(20, 1)
+	limit, burst := suite.service.RateLimit()
+	suite.Require().Equal(rate.Limit(20), limit)
+	suite.Require().Equal(1, burst)
+	suite.service.StartWorkers(3)
+
+	// The first task uses the burst, the next ones wait 50ms each
+	start := time.Now()
+	ids := []uint32{suite.createTask(suite.service, 0), suite.createTask(suite.service, 0), suite.createTask(suite.service, 0)}
+	suite.Require().Eventually(func() bool {
+		for _, id := range ids {
+			if suite.state(id) != domain.StateDONE {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	suite.Assert().GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+}
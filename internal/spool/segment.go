@@ -0,0 +1,215 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentExt = ".seg"
+	ackExt     = ".ack"
+	// headerSize is the size of the record header: the payload length and its CRC-32C checksum.
+	headerSize = 8
+	// maxRecordSize bounds the payload of a record, larger lengths are treated as corruption.
+	maxRecordSize = 1 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorrupt is returned when a record is torn or fails its checksum.
+var errCorrupt = errors.New("corrupt spool record")
+
+// segment is a file of records numbered from base. The acknowledged records are journaled
+// in an ack file next to it, the pair is removed once every record is acknowledged.
+type segment struct {
+	base    uint64
+	file    *os.File
+	acks    *os.File
+	size    int64
+	records uint64
+	// acked has a bit set for every acknowledged record, indexed from base.
+	acked      []uint64
+	ackedCount uint64
+}
+
+func segmentPath(dir string, base uint64, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, ext))
+}
+
+// listSegments returns the bases of the segment files of dir in ascending order.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var bases []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		base, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, base)
+	}
+	// The zero padded names are listed in ascending order by ReadDir
+	return bases, nil
+}
+
+// createSegment starts an empty segment.
+func createSegment(dir string, base uint64) (*segment, error) {
+	file, err := os.OpenFile(segmentPath(dir, base, segmentExt), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := os.OpenFile(segmentPath(dir, base, ackExt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+	return &segment{base: base, file: file, acks: acks}, nil
+}
+
+// openSegment opens an existing segment and counts its valid records. A torn or corrupt tail is
+// truncated when truncate is set, it is otherwise left out of the segment. It returns the number
+// of bytes left out.
+func openSegment(dir string, base uint64, truncate bool) (*segment, int64, error) {
+	file, err := os.OpenFile(segmentPath(dir, base, segmentExt), os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+	seg := &segment{base: base, file: file}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, errors.Join(err, file.Close())
+	}
+	for seg.size < info.Size() {
+		_, next, err := seg.read(seg.size)
+		if err != nil {
+			break
+		}
+		seg.size = next
+		seg.records++
+	}
+	lost := info.Size() - seg.size
+	if lost > 0 && truncate {
+		if err := file.Truncate(seg.size); err != nil {
+			return nil, 0, errors.Join(err, file.Close())
+		}
+	}
+
+	if err := seg.loadAcks(dir); err != nil {
+		return nil, 0, errors.Join(err, file.Close())
+	}
+	return seg, lost, nil
+}
+
+// loadAcks reads the ack journal and opens it for appending.
+func (s *segment) loadAcks(dir string) error {
+	path := segmentPath(dir, s.base, ackExt)
+	journal, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// A torn trailing ack is ignored, the record is sent again
+	for i := 0; i+8 <= len(journal); i += 8 {
+		s.ack(binary.LittleEndian.Uint64(journal[i:]))
+	}
+	s.acks, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	return err
+}
+
+// read returns the payload of the record at the given offset and the offset of the next record.
+func (s *segment) read(offset int64) ([]byte, int64, error) {
+	var header [headerSize]byte
+	if _, err := s.file.ReadAt(header[:], offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, errCorrupt
+		}
+		return nil, 0, err
+	}
+	length := binary.LittleEndian.Uint32(header[0:])
+	if length > maxRecordSize {
+		return nil, 0, errCorrupt
+	}
+	payload := make([]byte, length)
+	if _, err := s.file.ReadAt(payload, offset+headerSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, errCorrupt
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, 0, errCorrupt
+	}
+	return payload, offset + headerSize + int64(length), nil
+}
+
+// append writes a record at the end of the segment.
+func (s *segment) append(payload []byte) error {
+	record := make([]byte, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+	copy(record[headerSize:], payload)
+
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		return err
+	}
+	s.size += int64(len(record))
+	s.records++
+	return nil
+}
+
+// ack marks the record as acknowledged, it returns false when it already was.
+func (s *segment) ack(seq uint64) bool {
+	if seq < s.base {
+		return false
+	}
+	i := seq - s.base
+	word := int(i / 64)
+	if word >= len(s.acked) {
+		s.acked = append(s.acked, make([]uint64, word-len(s.acked)+1)...)
+	}
+	if s.acked[word]&(1<<(i%64)) != 0 {
+		return false
+	}
+	s.acked[word] |= 1 << (i % 64)
+	s.ackedCount++
+	return true
+}
+
+func (s *segment) isAcked(seq uint64) bool {
+	i := seq - s.base
+	word := int(i / 64)
+	return word < len(s.acked) && s.acked[word]&(1<<(i%64)) != 0
+}
+
+// journalAck appends the acknowledged sequence number to the ack file.
+func (s *segment) journalAck(seq uint64) error {
+	var entry [8]byte
+	binary.LittleEndian.PutUint64(entry[:], seq)
+	_, err := s.acks.Write(entry[:])
+	return err
+}
+
+func (s *segment) close() error {
+	return errors.Join(s.file.Close(), s.acks.Close())
+}
+
+// remove deletes the files of the segment.
+func (s *segment) remove(dir string) error {
+	return errors.Join(
+		s.close(),
+		os.Remove(segmentPath(dir, s.base, segmentExt)),
+		os.Remove(segmentPath(dir, s.base, ackExt)),
+	)
+}
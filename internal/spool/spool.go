@@ -0,0 +1,352 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by the operations of a closed Spool.
+var ErrClosed = errors.New("spool closed")
+
+// Entry is a spooled task, its sequence number and the idempotency key it was appended with.
+type Entry struct {
+	Seq  uint64
+	Task *domain.Task
+	// Key is empty for the tasks spooled without a key, e.g. by a previous version.
+	Key string
+}
+
+// record is the payload of a spooled task.
+type record struct {
+	Type      uint32 `json:"type"`
+	Value     uint32 `json:"value"`
+	Namespace string `json:"namespace,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// Recovery describes the state of the spool found on Open.
+type Recovery struct {
+	// Pending is the number of tasks left unacknowledged by the previous runs.
+	Pending int
+	// Lost is the number of bytes of torn or corrupt records left out.
+	Lost int64
+}
+
+// Spool is an append-only queue of tasks persisted in segment files. Every record carries a
+// checksum, the records handed out by Next stay on disk until they are acknowledged and the
+// unacknowledged records are handed out again after a restart.
+type Spool struct {
+	dir         string
+	segmentSize int64
+	syncEach    bool
+	// limit bounds the unacknowledged records, Append waits for an acknowledgement beyond it.
+	limit int
+
+	mu       sync.Mutex
+	segments []*segment
+	nextSeq  uint64
+	pending  int
+	// reader and readOffset locate the next record handed out by Next, readSeq is its sequence number.
+	reader     *segment
+	readOffset int64
+	readSeq    uint64
+	// appended and acked are closed and replaced after each append and acknowledgement.
+	appended chan struct{}
+	acked    chan struct{}
+	closed   bool
+	done     chan struct{}
+}
+
+// Open opens the spool stored in the configured directory, creating it when needed. At most
+// limit records are kept unacknowledged, zero for no limit.
+func Open(cfg conf.Spool, limit int) (*Spool, Recovery, error) {
+	s := &Spool{
+		dir:         cfg.GetDir(),
+		segmentSize: cfg.GetSegmentSize(),
+		syncEach:    cfg.SyncInterval <= 0,
+		limit:       limit,
+		appended:    make(chan struct{}),
+		acked:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	var recovery Recovery
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, recovery, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	bases, err := listSegments(s.dir)
+	if err != nil {
+		return nil, recovery, fmt.Errorf("failed to list spool segments: %w", err)
+	}
+
+	for i, base := range bases {
+		// Only the last segment may have been torn by a crash, it is truncated before appending to it
+		seg, lost, err := openSegment(s.dir, base, i == len(bases)-1)
+		if err != nil {
+			return nil, recovery, errors.Join(fmt.Errorf("failed to open spool segment %d: %w", base, err), s.closeSegments())
+		}
+		recovery.Lost += lost
+		s.nextSeq = seg.base + seg.records
+		if i < len(bases)-1 && seg.ackedCount >= seg.records {
+			if err := seg.remove(s.dir); err != nil {
+				return nil, recovery, errors.Join(err, s.closeSegments())
+			}
+			continue
+		}
+		s.pending += int(seg.records - seg.ackedCount)
+		s.segments = append(s.segments, seg)
+	}
+
+	if len(s.segments) == 0 {
+		seg, err := createSegment(s.dir, s.nextSeq)
+		if err != nil {
+			return nil, recovery, fmt.Errorf("failed to create spool segment: %w", err)
+		}
+		s.segments = append(s.segments, seg)
+	}
+	s.reader, s.readSeq = s.segments[0], s.segments[0].base
+	recovery.Pending = s.pending
+
+	if !s.syncEach {
+		go s.syncEvery(cfg.SyncInterval)
+	}
+	return s, recovery, nil
+}
+
+// Append persists the task with its idempotency key and returns its sequence number. The key is
+// handed out with the task, every attempt to send it can reuse it, including after a restart.
+// It waits while the spool holds its limit of unacknowledged records.
+func (s *Spool) Append(ctx context.Context, task *domain.Task, key string) (uint64, error) {
+	payload, err := json.Marshal(record{Type: task.Type, Value: task.Value, Namespace: task.Namespace, Key: key})
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	for s.limit > 0 && s.pending >= s.limit && !s.closed {
+		acked := s.acked
+		s.mu.Unlock()
+		select {
+		case <-acked:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+
+	active := s.segments[len(s.segments)-1]
+	if active.size >= s.segmentSize {
+		if active, err = s.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if err := active.append(payload); err != nil {
+		return 0, fmt.Errorf("failed to write spool record: %w", err)
+	}
+	if s.syncEach {
+		if err := active.file.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync spool segment: %w", err)
+		}
+	}
+
+	seq := s.nextSeq
+	s.nextSeq++
+	s.pending++
+	close(s.appended)
+	s.appended = make(chan struct{})
+	return seq, nil
+}
+
+// rotateLocked seals the active segment and starts a new one.
+func (s *Spool) rotateLocked() (*segment, error) {
+	sealed := s.segments[len(s.segments)-1]
+	if err := sealed.file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	seg, err := createSegment(s.dir, s.nextSeq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	s.segments = append(s.segments, seg)
+	return seg, s.removeAckedLocked(sealed)
+}
+
+// Next returns the next unacknowledged record, waiting for one to be appended.
+func (s *Spool) Next(ctx context.Context) (Entry, error) {
+	for {
+		entry, ok, err := s.TryNext()
+		if ok || err != nil {
+			return entry, err
+		}
+
+		s.mu.Lock()
+		appended := s.appended
+		s.mu.Unlock()
+		select {
+		case <-appended:
+		case <-s.done:
+			return Entry{}, ErrClosed
+		case <-ctx.Done():
+			return Entry{}, ctx.Err()
+		}
+	}
+}
+
+// TryNext returns the next unacknowledged record, ok is false when every record has been handed out.
+func (s *Spool) TryNext() (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Entry{}, false, ErrClosed
+	}
+
+	for {
+		if s.readOffset >= s.reader.size {
+			next := s.segmentAfterLocked(s.reader.base)
+			if next == nil {
+				return Entry{}, false, nil
+			}
+			s.reader, s.readOffset, s.readSeq = next, 0, next.base
+			continue
+		}
+
+		payload, offset, err := s.reader.read(s.readOffset)
+		if err != nil {
+			return Entry{}, false, fmt.Errorf("failed to read spool record %d: %w", s.readSeq, err)
+		}
+		seq := s.readSeq
+		s.readOffset, s.readSeq = offset, seq+1
+		// The records acknowledged before a restart are skipped
+		if s.reader.isAcked(seq) {
+			continue
+		}
+
+		var r record
+		if err := json.Unmarshal(payload, &r); err != nil {
+			return Entry{}, false, fmt.Errorf("failed to decode spool record %d: %w", seq, err)
+		}
+		return Entry{Seq: seq, Task: &domain.Task{
+			Type:      r.Type,
+			Value:     r.Value,
+			Namespace: r.Namespace,
+			State:     domain.StateRECEIVED,
+		}, Key: r.Key}, true, nil
+	}
+}
+
+func (s *Spool) segmentAfterLocked(base uint64) *segment {
+	for _, seg := range s.segments {
+		if seg.base > base {
+			return seg
+		}
+	}
+	return nil
+}
+
+// Ack acknowledges a record handed out by Next, it is removed from the spool.
+func (s *Spool) Ack(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	var seg *segment
+	for _, candidate := range s.segments {
+		if seq >= candidate.base && seq < candidate.base+candidate.records {
+			seg = candidate
+			break
+		}
+	}
+	if seg == nil || !seg.ack(seq) {
+		return nil
+	}
+	s.pending--
+	close(s.acked)
+	s.acked = make(chan struct{})
+
+	if err := seg.journalAck(seq); err != nil {
+		return fmt.Errorf("failed to journal spool ack: %w", err)
+	}
+	return s.removeAckedLocked(seg)
+}
+
+// removeAckedLocked removes the segment once it is sealed and every record is acknowledged.
+func (s *Spool) removeAckedLocked(seg *segment) error {
+	if seg == s.segments[len(s.segments)-1] || seg.ackedCount < seg.records {
+		return nil
+	}
+	for i, candidate := range s.segments {
+		if candidate == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	if s.reader == seg {
+		next := s.segmentAfterLocked(seg.base)
+		s.reader, s.readOffset, s.readSeq = next, 0, next.base
+	}
+	return seg.remove(s.dir)
+}
+
+// Pending returns the number of unacknowledged records.
+func (s *Spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Sync flushes the active segment to disk.
+func (s *Spool) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.segments[len(s.segments)-1].file.Sync()
+}
+
+func (s *Spool) syncEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.Sync()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close syncs and closes the segments, the unacknowledged records are handed out again by the next Open.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	close(s.acked)
+	return errors.Join(s.segments[len(s.segments)-1].file.Sync(), s.closeSegments())
+}
+
+func (s *Spool) closeSegments() error {
+	var err error
+	for _, seg := range s.segments {
+		err = errors.Join(err, seg.close())
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpoolSuite(t *testing.T) {
+	suite.Run(t, new(SpoolTestSuite))
+}
+
+type SpoolTestSuite struct {
+	suite.Suite
+	cfg conf.Spool
+}
+
+func (suite *SpoolTestSuite) SetupTest() {
+	suite.cfg = conf.Spool{Dir: suite.T().TempDir()}
+}
+
+func (suite *SpoolTestSuite) open(limit int) (*Spool, Recovery) {
+	s, recovery, err := Open(suite.cfg, limit)
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = s.Close() })
+	return s, recovery
+}
+
+func (suite *SpoolTestSuite) append(s *Spool, values ...uint32) {
+	for _, value := range values {
+		_, err := s.Append(context.Background(), &domain.Task{Type: 1, Value: value}, fmt.Sprintf("key-%d", value))
+		suite.Require().NoError(err)
+	}
+}
+
+// drain returns the values of the records left to hand out.
+func (suite *SpoolTestSuite) drain(s *Spool) ([]uint32, []uint64) {
+	var values []uint32
+	var seqs []uint64
+	for {
+		entry, ok, err := s.TryNext()
+		suite.Require().NoError(err)
+		if !ok {
+			return values, seqs
+		}
+		values = append(values, entry.Task.Value)
+		seqs = append(seqs, entry.Seq)
+	}
+}
+
+func (suite *SpoolTestSuite) segmentFiles() []string {
+	files, err := filepath.Glob(filepath.Join(suite.cfg.Dir, "*"+segmentExt))
+	suite.Require().NoError(err)
+	return files
+}
+
+func (suite *SpoolTestSuite) TestReplayUnacked() {
+	s, _ := suite.open(0)
+	suite.append(s, 10, 20, 30)
+
+	values, seqs := suite.drain(s)
+	suite.Assert().Equal([]uint32{10, 20, 30}, values)
+	suite.Require().NoError(s.Ack(seqs[1]))
+	suite.Assert().Equal(2, s.Pending())
+	suite.Require().NoError(s.Close())
+
+	s, recovery := suite.open(0)
+	suite.Assert().Equal(Recovery{Pending: 2}, recovery)
+	values, seqs = suite.drain(s)
+	suite.Assert().Equal([]uint32{10, 30}, values, "the acknowledged records are not replayed")
+	suite.Assert().Equal([]uint64{0, 2}, seqs)
+
+	suite.append(s, 40)
+	values, _ = suite.drain(s)
+	suite.Assert().Equal([]uint32{40}, values)
+}
+
+func (suite *SpoolTestSuite) TestReplayKeys() {
+	s, _ := suite.open(0)
+	suite.append(s, 10)
+	_, err := s.Append(context.Background(), &domain.Task{Type: 1, Value: 20}, "")
+	suite.Require().NoError(err)
+	suite.Require().NoError(s.Close())
+
+	// The idempotency keys are handed out again after a restart
+	s, _ = suite.open(0)
+	entry, err := s.Next(context.Background())
+	suite.Require().NoError(err)
+	suite.Assert().Equal("key-10", entry.Key)
+	entry, err = s.Next(context.Background())
+	suite.Require().NoError(err)
+	suite.Assert().Empty(entry.Key)
+}
+
+func (suite *SpoolTestSuite) TestTornTail() {
+	s, _ := suite.open(0)
+	suite.append(s, 10, 20)
+	suite.Require().NoError(s.Close())
+
+	// A crash in the middle of a write leaves a partial record behind
+	path := suite.segmentFiles()[0]
+	info, err := os.Stat(path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(os.Truncate(path, info.Size()-3))
+
+	s, recovery := suite.open(0)
+	suite.Assert().Equal(1, recovery.Pending)
+	suite.Assert().Positive(recovery.Lost)
+	suite.append(s, 30)
+	values, _ := suite.drain(s)
+	suite.Assert().Equal([]uint32{10, 30}, values, "the torn record is truncated before appending")
+}
+
+func (suite *SpoolTestSuite) TestChecksum() {
+	s, _ := suite.open(0)
+	suite.append(s, 10, 20)
+	suite.Require().NoError(s.Close())
+
+	path := suite.segmentFiles()[0]
+	data, err := os.ReadFile(path)
+	suite.Require().NoError(err)
+	data[len(data)-2] ^= 0xff
+	suite.Require().NoError(os.WriteFile(path, data, 0o600))
+
+	s, recovery := suite.open(0)
+	suite.Assert().Equal(1, recovery.Pending, "the corrupt record is left out")
+	values, _ := suite.drain(s)
+	suite.Assert().Equal([]uint32{10}, values)
+}
+
+func (suite *SpoolTestSuite) TestSegments() {
+	suite.cfg.SegmentSize = 1
+	s, _ := suite.open(0)
+	suite.append(s, 10, 20, 30)
+	suite.Assert().Len(suite.segmentFiles(), 3, "a segment is started once the previous one is full")
+
+	_, seqs := suite.drain(s)
+	suite.Require().NoError(s.Ack(seqs[0]))
+	suite.Require().NoError(s.Ack(seqs[2]))
+	suite.Assert().Len(suite.segmentFiles(), 2, "the sealed segments are removed once acknowledged")
+	suite.Require().NoError(s.Ack(seqs[1]))
+	suite.Assert().Len(suite.segmentFiles(), 1, "the active segment is kept")
+	suite.Require().NoError(s.Close())
+
+	s, recovery := suite.open(0)
+	suite.Assert().Zero(recovery.Pending)
+	suite.append(s, 40)
+	values, seqs := suite.drain(s)
+	suite.Assert().Equal([]uint32{40}, values)
+	suite.Assert().Equal([]uint64{3}, seqs, "the sequence numbers continue after a restart")
+}
+
+func (suite *SpoolTestSuite) TestLimit() {
+	s, _ := suite.open(1)
+	suite.append(s, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := s.Append(ctx, &domain.Task{Value: 20}, "")
+	suite.Assert().ErrorIs(err, context.DeadlineExceeded, "the spool is full")
+
+	entry, err := s.Next(context.Background())
+	suite.Require().NoError(err)
+	go func() { _ = s.Ack(entry.Seq) }()
+	_, err = s.Append(context.Background(), &domain.Task{Value: 20}, "")
+	suite.Assert().NoError(err, "the acknowledgement frees a slot")
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a Store keeping every record in memory. It is meant for tests and local runs.
+type Memory struct {
+	mu     sync.Mutex
+	tasks  map[uint32]domain.Task
+	nextID uint32
+	// keys maps the idempotency keys of every namespace to the id of their task.
+	keys     map[[2]string]uint32
+	settings *Settings
+	// outbox enables the lifecycle events, relayMu serializes their relay.
+	outbox      bool
+	events      []OutboxEvent
+	nextEventID int64
+	relayMu     sync.Mutex
+}
+
+// NewMemory initializes a new empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{tasks: make(map[uint32]domain.Task), keys: make(map[[2]string]uint32)}
+}
+
+// WithOutbox writes a lifecycle event to the outbox on every task state change.
+func (m *Memory) WithOutbox() *Memory {
+	m.outbox = true
+	return m
+}
+
+// addEvent appends an event about the task to the outbox, the caller holds mu.
+func (m *Memory) addEvent(eventType string, task *domain.Task) error {
+	if !m.outbox {
+		return nil
+	}
+	data, err := eventData(task)
+	if err != nil {
+		return err
+	}
+	m.nextEventID++
+	m.events = append(m.events, OutboxEvent{
+		ID:     m.nextEventID,
+		Type:   eventType,
+		TaskID: task.ID,
+		Data:   data,
+		Time:   time.Now(),
+	})
+	return nil
+}
+
+func (m *Memory) CreateTask(_ context.Context, task *domain.Task) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createTaskLocked(task)
+}
+
+func (m *Memory) CreateTaskOnce(_ context.Context, task *domain.Task, key string) (uint32, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.keys[[2]string{task.Namespace, key}]; ok {
+		return id, false, nil
+	}
+	id, err := m.createTaskLocked(task)
+	if err != nil {
+		return 0, false, err
+	}
+	m.keys[[2]string{task.Namespace, key}] = id
+	return id, true, nil
+}
+
+func (m *Memory) createTaskLocked(task *domain.Task) (uint32, error) {
+	stored := *task
+	stored.ID = m.nextID + 1
+	if err := m.addEvent(EventTaskCreated, &stored); err != nil {
+		return 0, err
+	}
+	m.nextID++
+	m.tasks[stored.ID] = stored
+	return stored.ID, nil
+}
+
+func (m *Memory) UpdateTaskState(_ context.Context, id uint32, state domain.State, at time.Time) (*domain.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok || task.State == domain.StateCANCELLED || (state == domain.StatePROCESSING && task.State != domain.StateRECEIVED) {
+		return nil, ErrNotFound
+	}
+	task.SetState(state, at)
+	if err := m.addEvent(stateEvent(state), &task); err != nil {
+		return nil, err
+	}
+	m.tasks[id] = task
+	return &task, nil
+}
+
+func (m *Memory) ClaimReceivedTasks(_ context.Context, updatedBefore time.Time, limit int32, at time.Time) ([]*domain.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []uint32
+	for id, task := range m.tasks {
+		if task.State == domain.StateRECEIVED && task.LastUpdateTime.Before(updatedBefore) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > int(limit) {
+		ids = ids[:limit]
+	}
+
+	tasks := make([]*domain.Task, 0, len(ids))
+	for _, id := range ids {
+		task := m.tasks[id]
+		task.LastUpdateTime = at
+		m.tasks[id] = task
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+func (m *Memory) RequeueTasks(_ context.Context, ids []uint32, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for _, id := range ids {
+		task, ok := m.tasks[id]
+		if !ok || task.State == domain.StateDONE || task.State == domain.StateCANCELLED {
+			continue
+		}
+		task.SetState(domain.StateRECEIVED, at)
+		if err := m.addEvent(EventTaskRequeued, &task); err != nil {
+			return n, err
+		}
+		m.tasks[id] = task
+		n++
+	}
+	return n, nil
+}
+
+func (m *Memory) CancelTask(_ context.Context, namespace string, id uint32, at time.Time) (*domain.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok || !inNamespace(&task, namespace) {
+		return nil, ErrNotFound
+	}
+	if task.State == domain.StateDONE || task.State == domain.StateCANCELLED {
+		return nil, ErrFinished
+	}
+	task.SetState(domain.StateCANCELLED, at)
+	if err := m.addEvent(EventTaskCancelled, &task); err != nil {
+		return nil, err
+	}
+	m.tasks[id] = task
+	return &task, nil
+}
+
+func (m *Memory) GetTask(_ context.Context, namespace string, id uint32) (*domain.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok || !inNamespace(&task, namespace) {
+		return nil, ErrNotFound
+	}
+	return &task, nil
+}
+
+func (m *Memory) ListTasks(_ context.Context, filter ListFilter) ([]*domain.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tasks := make([]*domain.Task, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		if (filter.State != "" && task.State != filter.State) || !inNamespace(&task, filter.Namespace) {
+			continue
+		}
+		task := task
+		tasks = append(tasks, &task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if filter.Newest {
+			return tasks[i].ID > tasks[j].ID
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+
+	if int(filter.Offset) >= len(tasks) {
+		return nil, nil
+	}
+	tasks = tasks[filter.Offset:]
+	if filter.Limit > 0 && int(filter.Limit) < len(tasks) {
+		tasks = tasks[:filter.Limit]
+	}
+	return tasks, nil
+}
+
+func (m *Memory) SumOfValues(_ context.Context, namespace string) (map[uint32]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sums := make(map[uint32]int64)
+	for _, task := range m.tasks {
+		if !inNamespace(&task, namespace) {
+			continue
+		}
+		sums[task.Type] += int64(task.Value)
+	}
+	return sums, nil
+}
+
+func (m *Memory) CountByState(_ context.Context, namespace string) (map[domain.State]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[domain.State]int64)
+	for _, task := range m.tasks {
+		if !inNamespace(&task, namespace) {
+			continue
+		}
+		counts[task.State]++
+	}
+	return counts, nil
+}
+
+func (m *Memory) CountByType(_ context.Context, namespace string) (map[uint32]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[uint32]int64)
+	for _, task := range m.tasks {
+		if !inNamespace(&task, namespace) {
+			continue
+		}
+		counts[task.Type]++
+	}
+	return counts, nil
+}
+
+func (m *Memory) GetSettings(_ context.Context) (Settings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.settings == nil {
+		return Settings{}, ErrNotFound
+	}
+	return *m.settings, nil
+}
+
+func (m *Memory) UpdateSettings(_ context.Context, update SettingsUpdate) (Settings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current Settings
+	if m.settings != nil {
+		current = *m.settings
+	}
+	settings := current.apply(update)
+	m.settings = &settings
+	return settings, nil
+}
+
+func (m *Memory) RelayEvents(_ context.Context, limit int, publish func([]OutboxEvent) (int, error)) (int, error) {
+	m.relayMu.Lock()
+	defer m.relayMu.Unlock()
+
+	// Publish without holding mu, the events are only removed by the relay
+	m.mu.Lock()
+	events := append([]OutboxEvent(nil), m.events[:min(limit, len(m.events))]...)
+	m.mu.Unlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	n, err := publish(events)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = m.events[n:]
+	if err != nil && n < len(events) {
+		m.events[0].Attempts++
+	}
+	return n, err
+}
+
+func (m *Memory) Ping(_ context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,436 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/database"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"math"
+	"time"
+)
+
+// Postgres is a Store backed by the sqlc queries on a PostgreSQL connection pool.
+// The reads can be served by read replicas, see WithReplicas.
+type Postgres struct {
+	pool     *pgxpool.Pool
+	queries  *database.Queries
+	replicas *replicaSet
+	// outbox enables the lifecycle events.
+	outbox bool
+}
+
+// NewPostgres initializes a new Postgres store using the given connection pool.
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{
+		pool:    pool,
+		queries: database.New(pool),
+	}
+}
+
+// Pool returns the connection pool of the primary database.
+func (p *Postgres) Pool() *pgxpool.Pool {
+	return p.pool
+}
+
+// WithOutbox writes a lifecycle event to the outbox on every task state change.
+func (p *Postgres) WithOutbox() *Postgres {
+	p.outbox = true
+	return p
+}
+
+// write runs a state change in a transaction shared with its outbox events when the outbox is enabled.
+func (p *Postgres) write(ctx context.Context, change func(*database.Queries) error) error {
+	if !p.outbox {
+		return change(p.queries)
+	}
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		return change(p.queries.WithTx(tx))
+	})
+}
+
+// inTx runs a change in a transaction, whether the outbox is enabled or not.
+func (p *Postgres) inTx(ctx context.Context, change func(*database.Queries) error) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		return change(p.queries.WithTx(tx))
+	})
+}
+
+// addEvent writes an event about the task to the outbox with the given queries.
+func (p *Postgres) addEvent(ctx context.Context, queries *database.Queries, eventType string, task *domain.Task) error {
+	if !p.outbox {
+		return nil
+	}
+	data, err := eventData(task)
+	if err != nil {
+		return err
+	}
+	return queries.InsertOutboxEvent(ctx, database.InsertOutboxEventParams{
+		EventType: eventType,
+		TaskID:    int32(task.ID),
+		Data:      data,
+	})
+}
+
+func (p *Postgres) CreateTask(ctx context.Context, task *domain.Task) (uint32, error) {
+	var id uint32
+	err := p.write(ctx, func(queries *database.Queries) (err error) {
+		id, err = p.createTask(ctx, queries, task)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (p *Postgres) createTask(ctx context.Context, queries *database.Queries, task *domain.Task) (uint32, error) {
+	id, err := queries.CreateTask(ctx, *task.ToTaskCreateParams())
+	if err != nil {
+		return 0, err
+	}
+	created := *task
+	created.ID = uint32(id)
+	return created.ID, p.addEvent(ctx, queries, EventTaskCreated, &created)
+}
+
+func (p *Postgres) CreateTaskOnce(ctx context.Context, task *domain.Task, key string) (uint32, bool, error) {
+	keyParams := database.GetIdempotencyKeyParams{Namespace: task.Namespace, Key: key}
+	var id uint32
+	var created bool
+	err := p.inTx(ctx, func(queries *database.Queries) error {
+		existing, err := queries.GetIdempotencyKey(ctx, keyParams)
+		if err == nil {
+			id = uint32(existing)
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if id, err = p.createTask(ctx, queries, task); err != nil {
+			return err
+		}
+		created = true
+		return queries.CreateIdempotencyKey(ctx, database.CreateIdempotencyKeyParams{Namespace: task.Namespace, Key: key, TaskID: int32(id)})
+	})
+
+	// A concurrent request with the same key committed first, its task is returned
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		existing, err := p.queries.GetIdempotencyKey(ctx, keyParams)
+		return uint32(existing), false, err
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, created, nil
+}
+
+func (p *Postgres) UpdateTaskState(ctx context.Context, id uint32, state domain.State, at time.Time) (*domain.Task, error) {
+	var task *domain.Task
+	err := p.write(ctx, func(queries *database.Queries) error {
+		row, err := queries.UpdateTaskState(ctx, database.UpdateTaskStateParams{
+			State:          database.State(state),
+			LastUpdateTime: at,
+			ID:             int32(id),
+		})
+		if err != nil {
+			return err
+		}
+		task = domain.FromDBToDomain(&row)
+		return p.addEvent(ctx, queries, stateEvent(state), task)
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return task, nil
+}
+
+func (p *Postgres) ClaimReceivedTasks(ctx context.Context, updatedBefore time.Time, limit int32, at time.Time) ([]*domain.Task, error) {
+	var tasks []*domain.Task
+	err := p.write(ctx, func(queries *database.Queries) error {
+		rows, err := queries.ClaimReceivedTasks(ctx, database.ClaimReceivedTasksParams{
+			LastUpdateTime: at,
+			UpdatedBefore:  updatedBefore,
+			RowLimit:       limit,
+		})
+		if err != nil {
+			return err
+		}
+		tasks = make([]*domain.Task, 0, len(rows))
+		for i := range rows {
+			tasks = append(tasks, domain.FromDBToDomain(&rows[i]))
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+func (p *Postgres) RequeueTasks(ctx context.Context, ids []uint32, at time.Time) (int64, error) {
+	dbIDs := make([]int32, 0, len(ids))
+	for _, id := range ids {
+		dbIDs = append(dbIDs, int32(id))
+	}
+
+	var requeued int64
+	err := p.write(ctx, func(queries *database.Queries) error {
+		rows, err := queries.RequeueTasks(ctx, database.RequeueTasksParams{
+			LastUpdateTime: at,
+			Ids:            dbIDs,
+		})
+		if err != nil {
+			return err
+		}
+		for i := range rows {
+			if err := p.addEvent(ctx, queries, EventTaskRequeued, domain.FromDBToDomain(&rows[i])); err != nil {
+				return err
+			}
+		}
+		requeued = int64(len(rows))
+		return nil
+	})
+	return requeued, err
+}
+
+func (p *Postgres) CancelTask(ctx context.Context, namespace string, id uint32, at time.Time) (*domain.Task, error) {
+	var task *domain.Task
+	err := p.write(ctx, func(queries *database.Queries) error {
+		row, err := queries.CancelTask(ctx, database.CancelTaskParams{
+			LastUpdateTime: at,
+			ID:             int32(id),
+			Namespace:      namespaceParam(namespace),
+		})
+		if err != nil {
+			return err
+		}
+		task = domain.FromDBToDomain(&row)
+		return p.addEvent(ctx, queries, EventTaskCancelled, task)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The task is either missing or finished
+		if _, err := p.GetTask(WithPrimary(ctx), namespace, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (p *Postgres) GetTask(ctx context.Context, namespace string, id uint32) (*domain.Task, error) {
+	var task database.Task
+	err := p.read(ctx, func(queries *database.Queries) (err error) {
+		task, err = queries.GetTask(ctx, database.GetTaskParams{ID: int32(id), Namespace: namespaceParam(namespace)})
+		return err
+	})
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return domain.FromDBToDomain(&task), nil
+}
+
+func (p *Postgres) ListTasks(ctx context.Context, filter ListFilter) ([]*domain.Task, error) {
+	params := database.ListTasksParams{
+		State:     pgtype.Text{String: string(filter.State), Valid: filter.State != ""},
+		Namespace: namespaceParam(filter.Namespace),
+		RowLimit:  filter.Limit,
+		RowOffset: filter.Offset,
+	}
+	if params.RowLimit <= 0 {
+		params.RowLimit = math.MaxInt32
+	}
+
+	var rows []database.Task
+	err := p.read(ctx, func(queries *database.Queries) (err error) {
+		if filter.Newest {
+			rows, err = queries.ListRecentTasks(ctx, database.ListRecentTasksParams(params))
+		} else {
+			rows, err = queries.ListTasks(ctx, params)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*domain.Task, 0, len(rows))
+	for i := range rows {
+		tasks = append(tasks, domain.FromDBToDomain(&rows[i]))
+	}
+	return tasks, nil
+}
+
+func (p *Postgres) SumOfValues(ctx context.Context, namespace string) (map[uint32]int64, error) {
+	var rows []database.GetSumOfValuesRow
+	err := p.read(ctx, func(queries *database.Queries) (err error) {
+		rows, err = queries.GetSumOfValues(ctx, namespaceParam(namespace))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[uint32]int64, len(rows))
+	for _, row := range rows {
+		sums[row.Type] = row.TotalValue
+	}
+	return sums, nil
+}
+
+func (p *Postgres) CountByState(ctx context.Context, namespace string) (map[domain.State]int64, error) {
+	var rows []database.GetSumOfTasksByStateRow
+	err := p.read(ctx, func(queries *database.Queries) (err error) {
+		rows, err = queries.GetSumOfTasksByState(ctx, namespaceParam(namespace))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[domain.State]int64, len(rows))
+	for _, row := range rows {
+		counts[domain.State(row.State)] = row.TaskCount
+	}
+	return counts, nil
+}
+
+func (p *Postgres) CountByType(ctx context.Context, namespace string) (map[uint32]int64, error) {
+	var rows []database.GetSumOfTasksByTypeRow
+	err := p.read(ctx, func(queries *database.Queries) (err error) {
+		rows, err = queries.GetSumOfTasksByType(ctx, namespaceParam(namespace))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint32]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.TaskCount
+	}
+	return counts, nil
+}
+
+func (p *Postgres) GetSettings(ctx context.Context) (Settings, error) {
+	row, err := p.queries.GetConsumerSettings(ctx)
+	if err != nil {
+		return Settings{}, notFound(err)
+	}
+	return settingsFromRow(database.UpdateConsumerSettingsRow(row)), nil
+}
+
+func (p *Postgres) UpdateSettings(ctx context.Context, update SettingsUpdate) (Settings, error) {
+	var params database.UpdateConsumerSettingsParams
+	if update.Paused != nil {
+		params.Paused = pgtype.Bool{Bool: *update.Paused, Valid: true}
+	}
+	if update.RateLimit != nil {
+		params.RateLimit = pgtype.Float8{Float64: *update.RateLimit, Valid: true}
+	}
+	if update.Burst != nil {
+		params.Burst = pgtype.Int4{Int32: *update.Burst, Valid: true}
+	}
+	if update.Workers != nil {
+		params.Workers = pgtype.Int4{Int32: *update.Workers, Valid: true}
+	}
+
+	row, err := p.queries.UpdateConsumerSettings(ctx, params)
+	if err != nil {
+		return Settings{}, err
+	}
+	return settingsFromRow(row), nil
+}
+
+// RelayEvents holds the events in a transaction while they are published, so that
+// the relays of the other consumer replicas skip them.
+func (p *Postgres) RelayEvents(ctx context.Context, limit int, publish func([]OutboxEvent) (int, error)) (int, error) {
+	var (
+		n          int
+		publishErr error
+	)
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		queries := p.queries.WithTx(tx)
+		rows, err := queries.ClaimOutboxEvents(ctx, int32(min(limit, math.MaxInt32)))
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+
+		events := make([]OutboxEvent, 0, len(rows))
+		for _, row := range rows {
+			events = append(events, OutboxEvent{
+				ID:       row.ID,
+				Type:     row.EventType,
+				TaskID:   uint32(row.TaskID),
+				Data:     row.Data,
+				Time:     row.CreatedAt,
+				Attempts: row.Attempts,
+			})
+		}
+
+		n, publishErr = publish(events)
+		if n > 0 {
+			published := make([]int64, 0, n)
+			for _, event := range events[:n] {
+				published = append(published, event.ID)
+			}
+			if err := queries.DeleteOutboxEvents(ctx, published); err != nil {
+				return err
+			}
+		}
+		if publishErr != nil && n < len(events) {
+			return queries.RecordOutboxFailure(ctx, database.RecordOutboxFailureParams{
+				ID:        events[n].ID,
+				LastError: pgtype.Text{String: publishErr.Error(), Valid: true},
+			})
+		}
+		return nil
+	})
+	return n, errors.Join(publishErr, err)
+}
+
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+func (p *Postgres) Close() error {
+	if p.replicas != nil {
+		p.replicas.close()
+	}
+	p.pool.Close()
+	return nil
+}
+
+func settingsFromRow(row database.UpdateConsumerSettingsRow) Settings {
+	settings := Settings{
+		Paused:  row.Paused,
+		Version: row.Version,
+	}
+	if row.RateLimit.Valid {
+		settings.RateLimit = &row.RateLimit.Float64
+	}
+	if row.Burst.Valid {
+		settings.Burst = &row.Burst.Int32
+	}
+	if row.Workers.Valid {
+		settings.Workers = &row.Workers.Int32
+	}
+	return settings
+}
+
+// uniqueViolation is the PostgreSQL error code of a duplicate key.
+const uniqueViolation = "23505"
+
+// notFound translates pgx.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// namespaceParam returns the namespace filter of a query, NULL matches every namespace.
+func namespaceParam(namespace string) pgtype.Text {
+	return pgtype.Text{String: namespace, Valid: namespace != ""}
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaLagQuery returns the replication lag of a replica in seconds: 0 when it replayed
+// everything it received, -1 when the lag is unknown, e.g. nothing was replayed yet.
+const replicaLagQuery = `
+SELECT CASE
+    WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+    ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), -1)
+END::float8`
+
+// Replica is a read replica of the primary database.
+type Replica struct {
+	// Name identifies the replica in the logs.
+	Name string
+	Pool *pgxpool.Pool
+}
+
+// ReplicaOptions configures how the read replicas are monitored.
+type ReplicaOptions struct {
+	// MaxLag is the replication lag above which reads fall back to the primary.
+	MaxLag time.Duration
+	// CheckInterval is the time between two checks of the replication lag.
+	CheckInterval time.Duration
+	Logger        *zap.Logger
+}
+
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads are served by the primary database, so that
+// they observe every write made before them.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsePrimary reports whether the reads made with the context must be served by the primary database.
+func UsePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	queries *database.Queries
+	// eligible is set when the replica is reachable and its lag is within the limit.
+	eligible atomic.Bool
+}
+
+// replicaSet routes the reads to the eligible replicas in turn.
+type replicaSet struct {
+	replicas []*replica
+	options  ReplicaOptions
+	next     atomic.Uint32
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func newReplicaSet(replicas []Replica, options ReplicaOptions) *replicaSet {
+	if options.Logger == nil {
+		options.Logger = zap.NewNop()
+	}
+	set := &replicaSet{options: options}
+	for _, r := range replicas {
+		set.replicas = append(set.replicas, &replica{
+			name:    r.Name,
+			pool:    r.Pool,
+			queries: database.New(r.Pool),
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	set.stop = cancel
+	set.wg.Add(1)
+	go set.monitor(ctx)
+	return set
+}
+
+// pick returns the next eligible replica or nil if the read must be served by the primary.
+func (s *replicaSet) pick(ctx context.Context) *replica {
+	if s == nil || UsePrimary(ctx) {
+		return nil
+	}
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(int(start)+i)%len(s.replicas)]
+		if r.eligible.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// monitor checks the replicas until the set is closed. Replicas are not used before their first check.
+func (s *replicaSet) monitor(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.options.CheckInterval)
+	defer ticker.Stop()
+	for {
+		for _, r := range s.replicas {
+			s.check(ctx, r)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *replicaSet) check(ctx context.Context, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, s.options.CheckInterval)
+	defer cancel()
+
+	var seconds float64
+	if err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+		if ctx.Err() == nil || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			s.markIneligible(r, "Read replica is unreachable", zap.Error(err))
+		}
+		return
+	}
+
+	lag := time.Duration(seconds * float64(time.Second))
+	switch {
+	case seconds < 0:
+		s.markIneligible(r, "Read replica lag is unknown")
+	case lag > s.options.MaxLag:
+		s.markIneligible(r, "Read replica is lagging behind", zap.Duration("lag", lag), zap.Duration("max_lag", s.options.MaxLag))
+	case !r.eligible.Swap(true):
+		s.options.Logger.Info("Read replica is available", zap.String("replica", r.name), zap.Duration("lag", lag))
+	}
+}
+
+// markIneligible routes the reads away from the replica until its next successful check.
+func (s *replicaSet) markIneligible(r *replica, msg string, fields ...zap.Field) {
+	if r.eligible.Swap(false) {
+		s.options.Logger.Warn(msg+", reading from the primary", append(fields, zap.String("replica", r.name))...)
+	}
+}
+
+func (s *replicaSet) close() {
+	s.stop()
+	s.wg.Wait()
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
+
+// WithReplicas routes the reads of the store to the given replicas. A replica is used only while
+// it is reachable and its replication lag stays within opts.MaxLag, otherwise the primary serves the read.
+func (p *Postgres) WithReplicas(replicas []Replica, opts ReplicaOptions) *Postgres {
+	if len(replicas) > 0 {
+		p.replicas = newReplicaSet(replicas, opts)
+	}
+	return p
+}
+
+// read runs a read-only query on an eligible replica and falls back to the primary
+// when there is none or the replica fails.
+func (p *Postgres) read(ctx context.Context, query func(*database.Queries) error) error {
+	if r := p.replicas.pick(ctx); r != nil {
+		err := query(r.queries)
+		if err == nil || errors.Is(err, pgx.ErrNoRows) || ctx.Err() != nil {
+			return err
+		}
+		p.replicas.markIneligible(r, "Read replica query failed", zap.Error(err))
+	}
+	return query(p.queries)
+}
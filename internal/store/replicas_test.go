@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+func TestReplicasSuite(t *testing.T) {
+	suite.Run(t, new(ReplicasTestSuite))
+}
+
+type ReplicasTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ReplicasTestSuite) TestPick() {
+	first, second := &replica{name: "first"}, &replica{name: "second"}
+	set := &replicaSet{replicas: []*replica{first, second}}
+	ctx := context.Background()
+
+	suite.Nil(set.pick(ctx), "replicas are not used before their first check")
+
+	first.eligible.Store(true)
+	second.eligible.Store(true)
+	picked := map[string]int{}
+	for range 4 {
+		picked[set.pick(ctx).name]++
+	}
+	suite.Equal(map[string]int{"first": 2, "second": 2}, picked)
+
+	first.eligible.Store(false)
+	suite.Same(second, set.pick(ctx))
+	suite.Nil(set.pick(WithPrimary(ctx)), "read your writes uses the primary")
+
+	var none *replicaSet
+	suite.Nil(none.pick(ctx))
+}
@@ -0,0 +1,604 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"math"
+	_ "modernc.org/sqlite" // Pure Go SQLite driver
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sqliteTasksTable creates the tasks table, also used to rebuild the tables of older versions.
+const sqliteTasksTable = `
+CREATE TABLE IF NOT EXISTS tasks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type INTEGER NOT NULL CHECK (type BETWEEN 0 AND 9),
+    value INTEGER NOT NULL CHECK (value BETWEEN 0 AND 99),
+    state TEXT NOT NULL CHECK (state IN ('RECEIVED', 'PROCESSING', 'DONE', 'CANCELLED')),
+    creation_time REAL NOT NULL,
+    last_update_time REAL NOT NULL,
+    started_at REAL,
+    finished_at REAL,
+    namespace TEXT NOT NULL DEFAULT 'default'
+);
+`
+
+// sqliteTasksIndexes creates the indexes of the tasks table.
+const sqliteTasksIndexes = `
+CREATE INDEX IF NOT EXISTS idx_task_state ON tasks(state);
+
+CREATE INDEX IF NOT EXISTS idx_task_type ON tasks(type);
+`
+
+// sqliteSchema mirrors sql/schema.sql using the SQLite types.
+const sqliteSchema = sqliteTasksTable + sqliteTasksIndexes + `
+
+CREATE TABLE IF NOT EXISTS consumer_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    paused INTEGER NOT NULL DEFAULT 0,
+    rate_limit REAL CHECK (rate_limit > 0),
+    burst INTEGER CHECK (burst > 0),
+    workers INTEGER CHECK (workers > 0),
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_type TEXT NOT NULL,
+    task_id INTEGER NOT NULL,
+    data TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    namespace TEXT NOT NULL,
+    key TEXT NOT NULL,
+    task_id INTEGER NOT NULL,
+    created_at REAL NOT NULL,
+    PRIMARY KEY (namespace, key)
+);
+`
+
+// SQLite is a Store backed by an embedded SQLite database.
+type SQLite struct {
+	db *sql.DB
+	// outbox enables the lifecycle events, relayMu serializes their relay.
+	outbox  bool
+	relayMu sync.Mutex
+}
+
+// NewSQLite opens the SQLite database at the given path and creates the schema if needed.
+// Use ":memory:" for a database living as long as the store.
+func NewSQLite(ctx context.Context, path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite serializes the writes, a single connection also keeps ":memory:" databases alive
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("creating sqlite schema: %w", err)
+	}
+	if err = upgradeSQLite(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("upgrading sqlite schema: %w", err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// upgradeSQLite adds the columns and the states missing from the databases created by older versions.
+func upgradeSQLite(ctx context.Context, db *sql.DB) error {
+	for _, column := range []struct{ name, definition string }{
+		{"started_at", "REAL"},
+		{"finished_at", "REAL"},
+		{"namespace", "TEXT NOT NULL DEFAULT 'default'"},
+	} {
+		var exists bool
+		err := db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM pragma_table_info('tasks') WHERE name = ?)`, column.name,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := db.ExecContext(ctx, `ALTER TABLE tasks ADD COLUMN `+column.name+` `+column.definition); err != nil {
+				return err
+			}
+		}
+	}
+	if err := allowCancelledState(ctx, db); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_task_namespace_state ON tasks(namespace, state)`)
+	return err
+}
+
+// allowCancelledState rebuilds a tasks table whose state constraint predates the CANCELLED state,
+// SQLite cannot alter the constraints of a table.
+func allowCancelledState(ctx context.Context, db *sql.DB) error {
+	var definition string
+	err := db.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'tasks'`).Scan(&definition)
+	if err != nil || strings.Contains(definition, "'CANCELLED'") {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range []string{
+		`DROP INDEX IF EXISTS idx_task_state`,
+		`DROP INDEX IF EXISTS idx_task_type`,
+		`DROP INDEX IF EXISTS idx_task_namespace_state`,
+		`ALTER TABLE tasks RENAME TO tasks_old`,
+		sqliteTasksTable,
+		`INSERT INTO tasks (` + sqliteTaskColumns + `) SELECT ` + sqliteTaskColumns + ` FROM tasks_old`,
+		// The ids of the removed tasks are not handed out again
+		`UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'tasks_old') WHERE name = 'tasks'`,
+		`DROP TABLE tasks_old`,
+		sqliteTasksIndexes,
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const sqliteTaskColumns = `id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace`
+
+// The task times are stored as seconds since the Unix epoch with a microsecond precision.
+func toSQLiteTime(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+func fromSQLiteTime(seconds float64) time.Time {
+	return time.UnixMicro(int64(math.Round(seconds * 1e6))).UTC()
+}
+
+// WithOutbox writes a lifecycle event to the outbox on every task state change.
+func (s *SQLite) WithOutbox() *SQLite {
+	s.outbox = true
+	return s
+}
+
+// inTx runs fn in a transaction committed when fn succeeds.
+func (s *SQLite) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// addEvent writes an event about the task to the outbox within tx.
+func (s *SQLite) addEvent(ctx context.Context, tx *sql.Tx, eventType string, task *domain.Task) error {
+	if !s.outbox {
+		return nil
+	}
+	data, err := eventData(task)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox (event_type, task_id, data, created_at) VALUES (?, ?, ?, ?)`,
+		eventType, task.ID, string(data), time.Now().UnixMicro(),
+	)
+	return err
+}
+
+func (s *SQLite) CreateTask(ctx context.Context, task *domain.Task) (uint32, error) {
+	var id uint32
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO tasks (type, value, state, creation_time, last_update_time, namespace) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+			task.Type, task.Value, string(task.State), toSQLiteTime(task.CreationTime), toSQLiteTime(task.LastUpdateTime), task.Namespace,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		created := *task
+		created.ID = id
+		return s.addEvent(ctx, tx, EventTaskCreated, &created)
+	})
+	return id, err
+}
+
+func (s *SQLite) CreateTaskOnce(ctx context.Context, task *domain.Task, key string) (uint32, bool, error) {
+	var id uint32
+	var created bool
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`SELECT task_id FROM idempotency_keys WHERE namespace = ? AND key = ?`, task.Namespace, key,
+		).Scan(&id)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO tasks (type, value, state, creation_time, last_update_time, namespace) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+			task.Type, task.Value, string(task.State), toSQLiteTime(task.CreationTime), toSQLiteTime(task.LastUpdateTime), task.Namespace,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO idempotency_keys (namespace, key, task_id, created_at) VALUES (?, ?, ?, ?)`,
+			task.Namespace, key, id, toSQLiteTime(time.Now()),
+		); err != nil {
+			return err
+		}
+		created = true
+		stored := *task
+		stored.ID = id
+		return s.addEvent(ctx, tx, EventTaskCreated, &stored)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return id, created, nil
+}
+
+func (s *SQLite) UpdateTaskState(ctx context.Context, id uint32, state domain.State, at time.Time) (*domain.Task, error) {
+	var task *domain.Task
+	err := s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		task, err = scanTask(tx.QueryRowContext(ctx,
+			`UPDATE tasks
+SET state            = ?1,
+    last_update_time = ?2,
+    started_at       = CASE WHEN ?1 = 'PROCESSING' THEN ?2 ELSE started_at END,
+    finished_at      = CASE WHEN ?1 = 'DONE' THEN ?2 ELSE finished_at END
+WHERE id = ?3 AND state <> 'CANCELLED' AND (?1 <> 'PROCESSING' OR state = 'RECEIVED')
+RETURNING `+sqliteTaskColumns,
+			string(state), toSQLiteTime(at), id,
+		))
+		if err != nil {
+			return err
+		}
+		return s.addEvent(ctx, tx, stateEvent(state), task)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *SQLite) ClaimReceivedTasks(ctx context.Context, updatedBefore time.Time, limit int32, at time.Time) ([]*domain.Task, error) {
+	var tasks []*domain.Task
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// The writes of SQLite are serialized, the claimed tasks cannot be claimed concurrently
+		rows, err := tx.QueryContext(ctx,
+			`UPDATE tasks SET last_update_time = ? WHERE id IN (SELECT id FROM tasks WHERE state = 'RECEIVED' AND last_update_time < ? ORDER BY id LIMIT ?) RETURNING `+sqliteTaskColumns,
+			toSQLiteTime(at), toSQLiteTime(updatedBefore), limit,
+		)
+		if err != nil {
+			return err
+		}
+		tasks, err = scanTasks(rows)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+func (s *SQLite) RequeueTasks(ctx context.Context, ids []uint32, at time.Time) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, toSQLiteTime(at))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	var requeued []*domain.Task
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`UPDATE tasks SET state = 'RECEIVED', last_update_time = ?, started_at = NULL WHERE id IN (`+placeholders+`) AND state NOT IN ('DONE', 'CANCELLED') RETURNING `+sqliteTaskColumns,
+			args...,
+		)
+		if err != nil {
+			return err
+		}
+		requeued, err = scanTasks(rows)
+		if err != nil {
+			return err
+		}
+		for _, task := range requeued {
+			if err := s.addEvent(ctx, tx, EventTaskRequeued, task); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(requeued)), nil
+}
+
+func (s *SQLite) CancelTask(ctx context.Context, namespace string, id uint32, at time.Time) (*domain.Task, error) {
+	var task *domain.Task
+	err := s.inTx(ctx, func(tx *sql.Tx) (err error) {
+		task, err = scanTask(tx.QueryRowContext(ctx,
+			`UPDATE tasks SET state = 'CANCELLED', last_update_time = ?1, finished_at = ?1
+WHERE id = ?2 AND (?3 = '' OR namespace = ?3) AND state IN ('RECEIVED', 'PROCESSING')
+RETURNING `+sqliteTaskColumns,
+			toSQLiteTime(at), id, namespace,
+		))
+		if err != nil {
+			return err
+		}
+		return s.addEvent(ctx, tx, EventTaskCancelled, task)
+	})
+	if errors.Is(err, ErrNotFound) {
+		// The task is either missing or finished
+		if _, err := s.GetTask(ctx, namespace, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (s *SQLite) GetTask(ctx context.Context, namespace string, id uint32) (*domain.Task, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+sqliteTaskColumns+` FROM tasks WHERE id = ?1 AND (?2 = '' OR namespace = ?2)`, id, namespace)
+	return scanTask(row)
+}
+
+func (s *SQLite) ListTasks(ctx context.Context, filter ListFilter) ([]*domain.Task, error) {
+	limit := int64(filter.Limit)
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	order := "id"
+	if filter.Newest {
+		order = "id DESC"
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+sqliteTaskColumns+` FROM tasks WHERE (?1 = '' OR state = ?1) AND (?2 = '' OR namespace = ?2) ORDER BY `+order+` LIMIT ?3 OFFSET ?4`,
+		string(filter.State), filter.Namespace, limit, filter.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanTasks(rows)
+}
+
+func (s *SQLite) SumOfValues(ctx context.Context, namespace string) (map[uint32]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT type, SUM(value) FROM tasks WHERE ?1 = '' OR namespace = ?1 GROUP BY type`, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := make(map[uint32]int64)
+	for rows.Next() {
+		var taskType uint32
+		var total int64
+		if err := rows.Scan(&taskType, &total); err != nil {
+			return nil, err
+		}
+		sums[taskType] = total
+	}
+	return sums, rows.Err()
+}
+
+func (s *SQLite) CountByState(ctx context.Context, namespace string) (map[domain.State]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT state, COUNT(*) FROM tasks WHERE ?1 = '' OR namespace = ?1 GROUP BY state`, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[domain.State]int64)
+	for rows.Next() {
+		var state string
+		var count int64
+		if err := rows.Scan(&state, &count); err != nil {
+			return nil, err
+		}
+		counts[domain.State(state)] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLite) CountByType(ctx context.Context, namespace string) (map[uint32]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT type, COUNT(*) FROM tasks WHERE ?1 = '' OR namespace = ?1 GROUP BY type`, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[uint32]int64)
+	for rows.Next() {
+		var taskType uint32
+		var count int64
+		if err := rows.Scan(&taskType, &count); err != nil {
+			return nil, err
+		}
+		counts[taskType] = count
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLite) GetSettings(ctx context.Context) (Settings, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT paused, rate_limit, burst, workers, version FROM consumer_settings WHERE id = 1`)
+	return scanSettings(row)
+}
+
+func (s *SQLite) UpdateSettings(ctx context.Context, update SettingsUpdate) (Settings, error) {
+	var paused sql.NullBool
+	if update.Paused != nil {
+		paused = sql.NullBool{Bool: *update.Paused, Valid: true}
+	}
+	row := s.db.QueryRowContext(ctx, `
+INSERT INTO consumer_settings (id, paused, rate_limit, burst, workers)
+VALUES (1, COALESCE(?1, 0), ?2, ?3, ?4)
+ON CONFLICT (id) DO UPDATE
+SET paused     = COALESCE(?1, consumer_settings.paused),
+    rate_limit = COALESCE(?2, consumer_settings.rate_limit),
+    burst      = COALESCE(?3, consumer_settings.burst),
+    workers    = COALESCE(?4, consumer_settings.workers),
+    version    = consumer_settings.version + 1,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING paused, rate_limit, burst, workers, version`,
+		paused, update.RateLimit, update.Burst, update.Workers,
+	)
+	return scanSettings(row)
+}
+
+func (s *SQLite) RelayEvents(ctx context.Context, limit int, publish func([]OutboxEvent) (int, error)) (int, error) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+
+	// Publish outside of a transaction, which would block every write of the single connection
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, event_type, task_id, data, created_at, attempts FROM outbox ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return 0, err
+	}
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		var data string
+		var createdAt int64
+		if err := rows.Scan(&event.ID, &event.Type, &event.TaskID, &data, &createdAt, &event.Attempts); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		event.Data = []byte(data)
+		event.Time = time.UnixMicro(createdAt)
+		events = append(events, event)
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	n, publishErr := publish(events)
+
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		if n > 0 {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id <= ?`, events[n-1].ID); err != nil {
+				return err
+			}
+		}
+		if publishErr != nil && n < len(events) {
+			_, err := tx.ExecContext(ctx, `UPDATE outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?`,
+				publishErr.Error(), events[n].ID)
+			return err
+		}
+		return nil
+	})
+	return n, errors.Join(publishErr, err)
+}
+
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(row scanner) (*domain.Task, error) {
+	var (
+		task                     domain.Task
+		state                    string
+		creationTime, updateTime float64
+		startedAt, finishedAt    sql.NullFloat64
+	)
+	err := row.Scan(&task.ID, &task.Type, &task.Value, &state, &creationTime, &updateTime, &startedAt, &finishedAt, &task.Namespace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	task.State = domain.State(state)
+	task.CreationTime = fromSQLiteTime(creationTime)
+	task.LastUpdateTime = fromSQLiteTime(updateTime)
+	if startedAt.Valid {
+		t := fromSQLiteTime(startedAt.Float64)
+		task.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := fromSQLiteTime(finishedAt.Float64)
+		task.FinishedAt = &t
+	}
+	return &task, nil
+}
+
+func scanTasks(rows *sql.Rows) ([]*domain.Task, error) {
+	defer rows.Close()
+
+	var tasks []*domain.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func scanSettings(row scanner) (Settings, error) {
+	var (
+		settings  Settings
+		rateLimit sql.NullFloat64
+		burst     sql.NullInt32
+		workers   sql.NullInt32
+	)
+	err := row.Scan(&settings.Paused, &rateLimit, &burst, &workers, &settings.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Settings{}, ErrNotFound
+	}
+	if err != nil {
+		return Settings{}, err
+	}
+	if rateLimit.Valid {
+		settings.RateLimit = &rateLimit.Float64
+	}
+	if burst.Valid {
+		settings.Burst = &burst.Int32
+	}
+	if workers.Valid {
+		settings.Workers = &workers.Int32
+	}
+	return settings, nil
+}
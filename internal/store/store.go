@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"strings"
+	"time"
+)
+
+// Supported values of conf.Database.Engine.
+const (
+	EnginePostgres = "postgres"
+	EngineSQLite   = "sqlite"
+	EngineMemory   = "memory"
+)
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("store: not found")
+
+// ErrFinished is returned when cancelling a task that is already DONE or CANCELLED.
+var ErrFinished = errors.New("store: task already finished")
+
+// ListFilter narrows the tasks returned by TaskStore.ListTasks. Zero values are ignored.
+type ListFilter struct {
+	Namespace string
+	State     domain.State
+	Limit     int32
+	Offset    int32
+	// Newest lists the most recently created tasks first.
+	Newest bool
+}
+
+// TaskStore persists the tasks handled by the TaskService. The reads are restricted to a namespace,
+// an empty namespace matches the tasks of every namespace.
+type TaskStore interface {
+	// CreateTask persists a new task and returns its id.
+	CreateTask(ctx context.Context, task *domain.Task) (uint32, error)
+	// CreateTaskOnce persists a new task unless the idempotency key was already used in the namespace
+	// of the task. It returns the id of the task created with the key and whether it was created now.
+	CreateTaskOnce(ctx context.Context, task *domain.Task, key string) (uint32, bool, error)
+	// UpdateTaskState changes the state of a task at the given time and returns the updated task.
+	// The time is recorded as the start of a PROCESSING task and the end of a DONE task. The state
+	// of a CANCELLED task is final, ErrNotFound is returned for it. Only RECEIVED tasks move to
+	// PROCESSING, so that a task claimed by two workers is processed once, ErrNotFound is returned
+	// for the other ones.
+	UpdateTaskState(ctx context.Context, id uint32, state domain.State, at time.Time) (*domain.Task, error)
+	// ClaimReceivedTasks returns up to limit RECEIVED tasks last updated before the given time, ordered
+	// by id, and sets their update time to at so that they are not claimed again right away. The tasks
+	// claimed by a concurrent call are skipped.
+	ClaimReceivedTasks(ctx context.Context, updatedBefore time.Time, limit int32, at time.Time) ([]*domain.Task, error)
+	// RequeueTasks returns the given tasks to the RECEIVED state unless they are DONE or CANCELLED,
+	// clearing their start time.
+	RequeueTasks(ctx context.Context, ids []uint32, at time.Time) (int64, error)
+	// CancelTask moves a RECEIVED or PROCESSING task of the namespace to CANCELLED at the given time.
+	// ErrFinished is returned for the DONE and CANCELLED tasks.
+	CancelTask(ctx context.Context, namespace string, id uint32, at time.Time) (*domain.Task, error)
+	// GetTask returns a single task of the namespace.
+	GetTask(ctx context.Context, namespace string, id uint32) (*domain.Task, error)
+	// ListTasks returns the tasks matching the filter ordered by id, descending for the Newest filters.
+	ListTasks(ctx context.Context, filter ListFilter) ([]*domain.Task, error)
+	// SumOfValues returns the sum of the task values of the namespace per task type.
+	SumOfValues(ctx context.Context, namespace string) (map[uint32]int64, error)
+	// CountByState returns the number of tasks of the namespace per state.
+	CountByState(ctx context.Context, namespace string) (map[domain.State]int64, error)
+	// CountByType returns the number of tasks of the namespace per task type.
+	CountByType(ctx context.Context, namespace string) (map[uint32]int64, error)
+}
+
+// Settings holds the runtime overrides of the consumer settings, nil fields are not overridden.
+type Settings struct {
+	Paused    bool
+	RateLimit *float64
+	Burst     *int32
+	Workers   *int32
+	Version   int64
+}
+
+// SettingsUpdate holds the consumer settings to override, nil fields are left unchanged.
+type SettingsUpdate struct {
+	Paused    *bool
+	RateLimit *float64
+	Burst     *int32
+	Workers   *int32
+}
+
+// SettingsStore persists the consumer settings shared by every replica.
+type SettingsStore interface {
+	// GetSettings returns the current overrides or ErrNotFound if none has been set.
+	GetSettings(ctx context.Context) (Settings, error)
+	// UpdateSettings applies the update and returns the resulting overrides.
+	UpdateSettings(ctx context.Context, update SettingsUpdate) (Settings, error)
+}
+
+// Types of the task lifecycle events written to the outbox.
+const (
+	EventTaskCreated    = "yqapp.task.created"
+	EventTaskProcessing = "yqapp.task.processing"
+	EventTaskDone       = "yqapp.task.done"
+	EventTaskRequeued   = "yqapp.task.requeued"
+	EventTaskCancelled  = "yqapp.task.cancelled"
+)
+
+// OutboxEvent is a task lifecycle event waiting in the outbox to be published.
+type OutboxEvent struct {
+	ID     int64
+	Type   string
+	TaskID uint32
+	// Data is the JSON snapshot of the task after the change.
+	Data []byte
+	Time time.Time
+	// Attempts counts the failed attempts to publish the event.
+	Attempts int32
+}
+
+// OutboxStore holds the task lifecycle events, written in the same transaction as the task state
+// changes once the outbox is enabled, until they are published.
+type OutboxStore interface {
+	// RelayEvents passes up to limit unpublished events ordered by id to publish, which returns
+	// the number of leading events it published. These are removed from the outbox, and a failure
+	// is recorded on the next one. Events passed to a concurrent call are skipped.
+	RelayEvents(ctx context.Context, limit int, publish func([]OutboxEvent) (int, error)) (int, error)
+}
+
+// Store groups every store used by the consumer.
+type Store interface {
+	TaskStore
+	SettingsStore
+	OutboxStore
+	// Ping checks that the store can be reached.
+	Ping(ctx context.Context) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// apply overlays the update on the current settings.
+func (s Settings) apply(update SettingsUpdate) Settings {
+	if update.Paused != nil {
+		s.Paused = *update.Paused
+	}
+	if update.RateLimit != nil {
+		s.RateLimit = update.RateLimit
+	}
+	if update.Burst != nil {
+		s.Burst = update.Burst
+	}
+	if update.Workers != nil {
+		s.Workers = update.Workers
+	}
+	s.Version++
+	return s
+}
+
+// eventData returns the data of an outbox event about the given task, its JSON snapshot.
+func eventData(task *domain.Task) ([]byte, error) {
+	return task.JSON()
+}
+
+// stateEvent returns the type of the event emitted when a task moves to the given state.
+func stateEvent(state domain.State) string {
+	return "yqapp.task." + strings.ToLower(string(state))
+}
+
+// inNamespace reports whether the task matches the namespace of a read.
+func inNamespace(task *domain.Task, namespace string) bool {
+	return namespace == "" || task.Namespace == namespace
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreSuite(t *testing.T) {
+	suite.Run(t, &StoreTestSuite{open: func() (Store, error) {
+		return NewMemory().WithOutbox(), nil
+	}})
+}
+
+func TestSQLiteStoreSuite(t *testing.T) {
+	suite.Run(t, &StoreTestSuite{open: func() (Store, error) {
+		st, err := NewSQLite(context.Background(), ":memory:")
+		if err != nil {
+			return nil, err
+		}
+		return st.WithOutbox(), nil
+	}})
+}
+
+// StoreTestSuite runs the same cases against every Store backend not requiring a server.
+type StoreTestSuite struct {
+	suite.Suite
+	open  func() (Store, error)
+	store Store
+}
+
+func (suite *StoreTestSuite) SetupTest() {
+	var err error
+	suite.store, err = suite.open()
+	suite.Require().NoError(err)
+}
+
+func (suite *StoreTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.store.Close())
+}
+
+func (suite *StoreTestSuite) createTasks(tasks ...domain.Task) []uint32 {
+	ids := make([]uint32, 0, len(tasks))
+	for _, task := range tasks {
+		id, err := suite.store.CreateTask(context.Background(), &task)
+		suite.Require().NoError(err)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (suite *StoreTestSuite) TestCreateAndGet() {
+	created := time.UnixMicro(10_000_001).UTC()
+	ids := suite.createTasks(domain.Task{Type: 4, Value: 42, State: domain.StateRECEIVED, CreationTime: created, LastUpdateTime: created})
+
+	task, err := suite.store.GetTask(context.Background(), "", ids[0])
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.Task{ID: ids[0], Type: 4, Value: 42, State: domain.StateRECEIVED, CreationTime: created, LastUpdateTime: created}, *task)
+
+	_, err = suite.store.GetTask(context.Background(), "", ids[0]+1)
+	suite.Assert().ErrorIs(err, ErrNotFound)
+}
+
+func (suite *StoreTestSuite) TestUpdateAndRequeue() {
+	ids := suite.createTasks(
+		domain.Task{Type: 1, Value: 1, State: domain.StateRECEIVED},
+		domain.Task{Type: 1, Value: 2, State: domain.StateRECEIVED},
+	)
+
+	task, err := suite.store.UpdateTaskState(context.Background(), ids[0], domain.StatePROCESSING, unix(20))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StatePROCESSING, task.State)
+	suite.Assert().Equal(unix(20), task.LastUpdateTime)
+	suite.Assert().Equal(unix(20), *task.StartedAt)
+	suite.Assert().Nil(task.FinishedAt)
+
+	task, err = suite.store.UpdateTaskState(context.Background(), ids[1], domain.StateDONE, unix(25))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(unix(25), *task.FinishedAt)
+
+	n, err := suite.store.RequeueTasks(context.Background(), ids, unix(30))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), n)
+
+	task, err = suite.store.GetTask(context.Background(), "", ids[0])
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateRECEIVED, task.State)
+	suite.Assert().Equal(unix(30), task.LastUpdateTime)
+	suite.Assert().Nil(task.StartedAt, "the start time is cleared by a requeue")
+
+	_, err = suite.store.UpdateTaskState(context.Background(), 1000, domain.StateDONE, unix(20))
+	suite.Assert().ErrorIs(err, ErrNotFound)
+}
+
+func (suite *StoreTestSuite) TestClaimReceivedTasks() {
+	ids := suite.createTasks(
+		domain.Task{Type: 1, Value: 1, State: domain.StateRECEIVED, CreationTime: unix(10), LastUpdateTime: unix(10)},
+		domain.Task{Type: 1, Value: 2, State: domain.StateRECEIVED, CreationTime: unix(10), LastUpdateTime: unix(10)},
+		domain.Task{Type: 1, Value: 3, State: domain.StateRECEIVED, CreationTime: unix(10), LastUpdateTime: unix(10)},
+		domain.Task{Type: 1, Value: 4, State: domain.StateRECEIVED, CreationTime: unix(30), LastUpdateTime: unix(30)},
+	)
+	_, err := suite.store.UpdateTaskState(context.Background(), ids[1], domain.StatePROCESSING, unix(15))
+	suite.Require().NoError(err)
+
+	tasks, err := suite.store.ClaimReceivedTasks(context.Background(), unix(20), 10, unix(40))
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 2, "only the RECEIVED tasks last updated before the given time are claimed")
+	suite.Assert().Equal([]uint32{ids[0], ids[2]}, []uint32{tasks[0].ID, tasks[1].ID})
+	suite.Assert().Equal(unix(40), tasks[0].LastUpdateTime)
+
+	tasks, err = suite.store.ClaimReceivedTasks(context.Background(), unix(35), 10, unix(50))
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 1, "the claimed tasks are not claimed again right away")
+	suite.Assert().Equal(ids[3], tasks[0].ID)
+
+	tasks, err = suite.store.ClaimReceivedTasks(context.Background(), unix(60), 1, unix(60))
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 1)
+	suite.Assert().Equal(ids[0], tasks[0].ID)
+
+	_, err = suite.store.UpdateTaskState(context.Background(), ids[1], domain.StatePROCESSING, unix(70))
+	suite.Assert().ErrorIs(err, ErrNotFound, "a task moves to PROCESSING once")
+}
+
+func (suite *StoreTestSuite) TestCancel() {
+	ids := suite.createTasks(
+		domain.Task{Type: 1, Value: 1, State: domain.StateRECEIVED, Namespace: "team-a"},
+		domain.Task{Type: 1, Value: 2, State: domain.StateRECEIVED, Namespace: "team-a"},
+	)
+	_, err := suite.store.UpdateTaskState(context.Background(), ids[1], domain.StateDONE, unix(20))
+	suite.Require().NoError(err)
+
+	_, err = suite.store.CancelTask(context.Background(), "team-b", ids[0], unix(30))
+	suite.Assert().ErrorIs(err, ErrNotFound, "the tasks of other namespaces cannot be cancelled")
+
+	task, err := suite.store.CancelTask(context.Background(), "team-a", ids[0], unix(30))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(domain.StateCANCELLED, task.State)
+	suite.Assert().Equal(unix(30), *task.FinishedAt)
+
+	_, err = suite.store.CancelTask(context.Background(), "team-a", ids[0], unix(40))
+	suite.Assert().ErrorIs(err, ErrFinished)
+	_, err = suite.store.CancelTask(context.Background(), "team-a", ids[1], unix(40))
+	suite.Assert().ErrorIs(err, ErrFinished)
+	_, err = suite.store.CancelTask(context.Background(), "team-a", 1000, unix(40))
+	suite.Assert().ErrorIs(err, ErrNotFound)
+
+	_, err = suite.store.UpdateTaskState(context.Background(), ids[0], domain.StatePROCESSING, unix(50))
+	suite.Assert().ErrorIs(err, ErrNotFound, "the state of a cancelled task is final")
+	n, err := suite.store.RequeueTasks(context.Background(), ids, unix(50))
+	suite.Require().NoError(err)
+	suite.Assert().Zero(n)
+}
+
+func (suite *StoreTestSuite) TestCreateTaskOnce() {
+	task := domain.Task{Type: 1, Value: 1, State: domain.StateRECEIVED, Namespace: "team-a"}
+
+	id, created, err := suite.store.CreateTaskOnce(context.Background(), &task, "key-1")
+	suite.Require().NoError(err)
+	suite.Assert().True(created)
+
+	again, created, err := suite.store.CreateTaskOnce(context.Background(), &task, "key-1")
+	suite.Require().NoError(err)
+	suite.Assert().False(created)
+	suite.Assert().Equal(id, again)
+
+	task.Namespace = "team-b"
+	other, created, err := suite.store.CreateTaskOnce(context.Background(), &task, "key-1")
+	suite.Require().NoError(err)
+	suite.Assert().True(created, "the keys are scoped to a namespace")
+	suite.Assert().NotEqual(id, other)
+}
+
+func (suite *StoreTestSuite) TestListAndAggregate() {
+	ids := suite.createTasks(
+		domain.Task{Type: 1, Value: 10, State: domain.StateRECEIVED},
+		domain.Task{Type: 1, Value: 20, State: domain.StateDONE},
+		domain.Task{Type: 2, Value: 5, State: domain.StateDONE},
+	)
+
+	tasks, err := suite.store.ListTasks(context.Background(), ListFilter{State: domain.StateDONE})
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 2)
+	suite.Assert().Equal(ids[1], tasks[0].ID)
+	suite.Assert().Equal(ids[2], tasks[1].ID)
+
+	tasks, err = suite.store.ListTasks(context.Background(), ListFilter{Limit: 1, Offset: 1})
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 1)
+	suite.Assert().Equal(ids[1], tasks[0].ID)
+
+	tasks, err = suite.store.ListTasks(context.Background(), ListFilter{Limit: 2, Newest: true})
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 2)
+	suite.Assert().Equal([]uint32{ids[2], ids[1]}, []uint32{tasks[0].ID, tasks[1].ID})
+
+	sums, err := suite.store.SumOfValues(context.Background(), "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[uint32]int64{1: 30, 2: 5}, sums)
+
+	counts, err := suite.store.CountByState(context.Background(), "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[domain.State]int64{domain.StateRECEIVED: 1, domain.StateDONE: 2}, counts)
+
+	typeCounts, err := suite.store.CountByType(context.Background(), "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[uint32]int64{1: 2, 2: 1}, typeCounts)
+}
+
+func (suite *StoreTestSuite) TestNamespaces() {
+	ids := suite.createTasks(
+		domain.Task{Type: 1, Value: 10, State: domain.StateRECEIVED, Namespace: "team-a"},
+		domain.Task{Type: 1, Value: 20, State: domain.StateDONE, Namespace: "team-b"},
+	)
+
+	task, err := suite.store.GetTask(context.Background(), "team-a", ids[0])
+	suite.Require().NoError(err)
+	suite.Assert().Equal("team-a", task.Namespace)
+	_, err = suite.store.GetTask(context.Background(), "team-a", ids[1])
+	suite.Assert().ErrorIs(err, ErrNotFound, "the task of another namespace is not found")
+
+	tasks, err := suite.store.ListTasks(context.Background(), ListFilter{Namespace: "team-b"})
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 1)
+	suite.Assert().Equal(ids[1], tasks[0].ID)
+
+	sums, err := suite.store.SumOfValues(context.Background(), "team-a")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[uint32]int64{1: 10}, sums)
+
+	counts, err := suite.store.CountByState(context.Background(), "team-b")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[domain.State]int64{domain.StateDONE: 1}, counts)
+}
+
+func (suite *StoreTestSuite) TestSettings() {
+	_, err := suite.store.GetSettings(context.Background())
+	suite.Assert().ErrorIs(err, ErrNotFound)
+
+	paused, workers := true, int32(8)
+	settings, err := suite.store.UpdateSettings(context.Background(), SettingsUpdate{Paused: &paused, Workers: &workers})
+	suite.Require().NoError(err)
+	suite.Assert().True(settings.Paused)
+	suite.Assert().Nil(settings.RateLimit)
+	suite.Assert().Equal(int32(8), *settings.Workers)
+
+	limit := 50.0
+	updated, err := suite.store.UpdateSettings(context.Background(), SettingsUpdate{RateLimit: &limit})
+	suite.Require().NoError(err)
+	suite.Assert().True(updated.Paused)
+	suite.Assert().Equal(50.0, *updated.RateLimit)
+	suite.Assert().Equal(int32(8), *updated.Workers)
+	suite.Assert().Greater(updated.Version, settings.Version)
+
+	current, err := suite.store.GetSettings(context.Background())
+	suite.Require().NoError(err)
+	suite.Assert().Equal(updated, current)
+}
+
+func (suite *StoreTestSuite) TestOutbox() {
+	ids := suite.createTasks(domain.Task{Type: 3, Value: 7, State: domain.StateRECEIVED, CreationTime: unix(10), LastUpdateTime: unix(10), Namespace: "team-a"})
+	_, err := suite.store.UpdateTaskState(context.Background(), ids[0], domain.StatePROCESSING, unix(20))
+	suite.Require().NoError(err)
+	_, err = suite.store.RequeueTasks(context.Background(), ids, unix(30))
+	suite.Require().NoError(err)
+
+	// The first event is published, the second fails
+	failure := errors.New("sink unavailable")
+	n, err := suite.store.RelayEvents(context.Background(), 10, func(events []OutboxEvent) (int, error) {
+		suite.Require().Len(events, 3)
+		suite.Assert().Equal([]string{EventTaskCreated, EventTaskProcessing, EventTaskRequeued},
+			[]string{events[0].Type, events[1].Type, events[2].Type})
+		suite.Assert().Equal(ids[0], events[0].TaskID)
+		suite.Assert().JSONEq(fmt.Sprintf(`{"id":%d,"type":3,"value":7,"state":"RECEIVED","creation_time":"1970-01-01T00:00:10Z","last_update_time":"1970-01-01T00:00:10Z","namespace":"team-a"}`, ids[0]), string(events[0].Data))
+		return 1, failure
+	})
+	suite.Assert().ErrorIs(err, failure)
+	suite.Assert().Equal(1, n)
+
+	var published []OutboxEvent
+	n, err = suite.store.RelayEvents(context.Background(), 10, func(events []OutboxEvent) (int, error) {
+		published = events
+		return len(events), nil
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(2, n)
+	suite.Require().Len(published, 2)
+	suite.Assert().Equal(EventTaskProcessing, published[0].Type)
+	suite.Assert().Equal(int32(1), published[0].Attempts)
+
+	n, err = suite.store.RelayEvents(context.Background(), 10, func(events []OutboxEvent) (int, error) {
+		suite.Fail("the outbox is empty")
+		return 0, nil
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Zero(n)
+}
+
+func unix(seconds int64) time.Time {
+	return time.Unix(seconds, 0).UTC()
+}
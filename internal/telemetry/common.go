@@ -2,11 +2,8 @@ package telemetry
 
 import (
 	"context"
-	"fmt"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 func newResource(ctx context.Context, serviceName, serviceEnvironment string) (*resource.Resource, error) {
@@ -17,13 +14,3 @@ func newResource(ctx context.Context, serviceName, serviceEnvironment string) (*
 		),
 	)
 }
-
-func newClient(addr string) (*grpc.ClientConn, error) {
-	conn, err := grpc.NewClient(addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC connection to collector: %w", err)
-	}
-	return conn, nil
-}
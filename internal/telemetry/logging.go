@@ -7,7 +7,8 @@ import (
 )
 
 // SetupLogger initializes a new Zap Logger with the parameters specified by the given ServerConfig.
-func SetupLogger(cfg conf.Configuration, targetService string) (*zap.Logger, error) {
+// The returned level can be changed at runtime.
+func SetupLogger(cfg conf.Configuration, targetService string) (*zap.Logger, zap.AtomicLevel, error) {
 	var (
 		encoderCfg    zapcore.EncoderConfig
 		isDevelopment bool
@@ -16,7 +17,7 @@ func SetupLogger(cfg conf.Configuration, targetService string) (*zap.Logger, err
 	)
 
 	if !cfg.Logger.Enabled {
-		return zap.NewNop(), nil
+		return zap.NewNop(), zap.NewAtomicLevel(), nil
 	}
 
 	switch targetService {
@@ -30,7 +31,7 @@ func SetupLogger(cfg conf.Configuration, targetService string) (*zap.Logger, err
 
 	level, err := zap.ParseAtomicLevel(logLevel)
 	if err != nil {
-		return nil, err
+		return nil, zap.AtomicLevel{}, err
 	}
 
 	switch cfg.Logger.Environment {
@@ -61,6 +62,6 @@ func SetupLogger(cfg conf.Configuration, targetService string) (*zap.Logger, err
 		},
 	}
 
-	return zap.Must(config.Build()), nil
+	return zap.Must(config.Build()), level, nil
 
 }
@@ -4,59 +4,91 @@ import (
 	"context"
 	"fmt"
 	"github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/noop"
 	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"net/http"
 )
 
-func SetupMetrics(conf conf.Configuration, targetService string) (metric.MeterProvider, metricsdk.Exporter, error) {
+// SetupMetrics initializes a meter provider whose instruments are exposed through a Prometheus exporter
+// writing to a per-process registry and, when a collector endpoint is configured, pushed through OTLP.
+func SetupMetrics(conf conf.Configuration, targetService string) (metric.MeterProvider, *prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
 	if !conf.Metrics.Enabled {
-		return noop.NewMeterProvider(), nil, nil
+		return noop.NewMeterProvider(), registry, nil
 	}
 
-	var meterProvider metric.MeterProvider
-	var meterExporter metricsdk.Exporter
-
-	switch conf.Metrics.Environment {
-	case "production", "staging":
-		var err error
-		meterProvider, meterExporter, err = newMetrics(conf, targetService)
-		if err != nil {
-			return nil, nil, err
-		}
-	default:
-		meterProvider = noop.NewMeterProvider()
+	meterProvider, err := newMetrics(conf, targetService, registry)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return meterProvider, meterExporter, nil
+	return meterProvider, registry, nil
 }
 
-func newMetrics(conf conf.Configuration, targetService string) (metric.MeterProvider, metricsdk.Exporter, error) {
+func newMetrics(conf conf.Configuration, targetService string, registry *prometheus.Registry) (*metricsdk.MeterProvider, error) {
 	ctx := context.Background()
-	res, err := newResource(ctx, "metrics", conf.Metrics.Environment)
+	res, err := newResource(ctx, targetService, conf.Metrics.Environment)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	var address string
-	switch targetService {
-	case "producer":
-		address = fmt.Sprintf("%s:%s", "0.0.0.0", conf.GetProducerMetricsPort())
 
-	default:
-		address = fmt.Sprintf("%s:%s", "0.0.0.0", conf.GetConsumerMetricsPort())
+	if err = registry.Register(collectors.NewGoCollector()); err != nil {
+		return nil, fmt.Errorf("failed to register go collector: %w", err)
 	}
-	conn, err := newClient(address)
-	if err != nil {
-		return nil, nil, err
+	if err = registry.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return nil, fmt.Errorf("failed to register process collector: %w", err)
 	}
-	meterExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn), otlpmetricgrpc.WithInsecure())
+
+	promExporter, err := otelprometheus.New(
+		otelprometheus.WithRegisterer(registry),
+		otelprometheus.WithoutScopeInfo(),
+	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create metrics exporter: %w", err)
+		return nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
 	}
-	meterProvider := metricsdk.NewMeterProvider(
-		metricsdk.WithReader(metricsdk.NewPeriodicReader(meterExporter)),
+
+	opts := []metricsdk.Option{
+		metricsdk.WithReader(promExporter),
 		metricsdk.WithResource(res),
-	)
-	return meterProvider, meterExporter, nil
+	}
+
+	if conf.Metrics.Collector.Endpoint != "" {
+		otlpExporter, err := newOTLPExporter(ctx, conf.Metrics.Collector)
+		if err != nil {
+			return nil, err
+		}
+		var readerOpts []metricsdk.PeriodicReaderOption
+		if conf.Metrics.Collector.Interval > 0 {
+			readerOpts = append(readerOpts, metricsdk.WithInterval(conf.Metrics.Collector.Interval))
+		}
+		opts = append(opts, metricsdk.WithReader(metricsdk.NewPeriodicReader(otlpExporter, readerOpts...)))
+	}
+
+	return metricsdk.NewMeterProvider(opts...), nil
+}
+
+// newOTLPExporter initializes an exporter pushing metrics to the given OpenTelemetry collector.
+func newOTLPExporter(ctx context.Context, collector conf.Collector) (metricsdk.Exporter, error) {
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(collector.Endpoint),
+	}
+	if collector.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	exporter, err := otlpmetricgrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// NewMetricsHandler returns the HTTP handler serving the metrics of the given registry.
+func NewMetricsHandler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
 }
@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+func TestMetricsSuite(t *testing.T) {
+	t.Parallel()
+	suite.Run(t, new(MetricsTestSuite))
+}
+
+type MetricsTestSuite struct {
+	suite.Suite
+	cfg conf.Configuration
+}
+
+func (suite *MetricsTestSuite) SetupTest() {
+	suite.cfg = conf.Configuration{
+		Metrics: conf.Metrics{
+			Enabled:     true,
+			Endpoint:    "/metrics",
+			Environment: "test",
+		},
+	}
+}
+
+func (suite *MetricsTestSuite) TestSetupMetrics_IsolatedRegistries() {
+	ctx := context.Background()
+
+	first, firstRegistry, err := SetupMetrics(suite.cfg, "consumer")
+	suite.Require().NoError(err)
+	second, secondRegistry, err := SetupMetrics(suite.cfg, "consumer")
+	suite.Require().NoError(err)
+	suite.Require().NotSame(firstRegistry, secondRegistry)
+
+	counter, err := first.Meter("test").Int64Counter("tasks_created")
+	suite.Require().NoError(err)
+	counter.Add(ctx, 3)
+
+	counter, err = second.Meter("test").Int64Counter("tasks_created")
+	suite.Require().NoError(err)
+	counter.Add(ctx, 5)
+
+	expected := `
+# HELP tasks_created_total
+# TYPE tasks_created_total counter
+tasks_created_total %d
+`
+	suite.Assert().NoError(testutil.GatherAndCompare(firstRegistry, strings.NewReader(fmt.Sprintf(expected, 3)), "tasks_created_total"))
+	suite.Assert().NoError(testutil.GatherAndCompare(secondRegistry, strings.NewReader(fmt.Sprintf(expected, 5)), "tasks_created_total"))
+}
+
+func (suite *MetricsTestSuite) TestSetupMetrics_Disabled() {
+	suite.cfg.Metrics.Enabled = false
+
+	meterProvider, registry, err := SetupMetrics(suite.cfg, "producer")
+	suite.Require().NoError(err)
+	suite.Assert().NotNil(meterProvider)
+	suite.Assert().NotNil(registry)
+
+	families, err := registry.Gather()
+	suite.Assert().NoError(err)
+	suite.Assert().Empty(families)
+}
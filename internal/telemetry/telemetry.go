@@ -1,19 +1,21 @@
 package telemetry
 
 import (
+	"context"
 	"github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
-	metricsdk "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type Telemetry struct {
 	Logger         *zap.Logger
+	LogLevel       zap.AtomicLevel
 	TracerProvider trace.TracerProvider
 	MeterProvider  metric.MeterProvider
-	MeterExporter  metricsdk.Exporter
+	Registry       *prometheus.Registry
 	Propagator     propagation.TextMapPropagator
 }
 
@@ -21,12 +23,12 @@ func SetupTelemetry(cfg conf.Configuration, targetService string) (Telemetry, er
 	var t Telemetry
 	var err error
 
-	t.Logger, err = SetupLogger(cfg, targetService)
+	t.Logger, t.LogLevel, err = SetupLogger(cfg, targetService)
 	if err != nil {
 		return Telemetry{}, err
 	}
 
-	t.MeterProvider, t.MeterExporter, err = SetupMetrics(cfg, targetService)
+	t.MeterProvider, t.Registry, err = SetupMetrics(cfg, targetService)
 	if err != nil {
 		return Telemetry{}, err
 	}
@@ -37,3 +39,13 @@ func SetupTelemetry(cfg conf.Configuration, targetService string) (Telemetry, er
 	)
 	return t, nil
 }
+
+// Shutdown flushes and releases the exporters held by the meter provider.
+func (t Telemetry) Shutdown(ctx context.Context) error {
+	if mp, ok := t.MeterProvider.(interface {
+		Shutdown(ctx context.Context) error
+	}); ok {
+		return mp.Shutdown(ctx)
+	}
+	return nil
+}
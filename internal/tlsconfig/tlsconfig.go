@@ -0,0 +1,22 @@
+package tlsconfig
+
+import (
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TransportCredentials returns the credentials of the connections to the consumers, plaintext unless
+// TLS is enabled.
+func TransportCredentials(cfg conf.TLS) (credentials.TransportCredentials, error) {
+	if !cfg.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+	config, err := taskclient.TLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ServerName = cfg.ServerName
+	return credentials.NewTLS(config), nil
+}
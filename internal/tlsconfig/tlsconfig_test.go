@@ -0,0 +1,37 @@
+package tlsconfig
+
+import (
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/stretchr/testify/suite"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSConfigSuite(t *testing.T) {
+	suite.Run(t, new(TLSConfigTestSuite))
+}
+
+type TLSConfigTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TLSConfigTestSuite) TestTransportCredentials_Disabled() {
+	creds, err := TransportCredentials(conf.TLS{CAFile: "missing.pem"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal("insecure", creds.Info().SecurityProtocol)
+}
+
+func (suite *TLSConfigTestSuite) TestTransportCredentials_Enabled() {
+	creds, err := TransportCredentials(conf.TLS{Enabled: true, ServerName: "consumer"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal("tls", creds.Info().SecurityProtocol)
+	suite.Assert().Equal("consumer", creds.Info().ServerName)
+}
+
+func (suite *TLSConfigTestSuite) TestTransportCredentials_MissingFiles() {
+	_, err := TransportCredentials(conf.TLS{Enabled: true, CAFile: filepath.Join(suite.T().TempDir(), "ca.pem")})
+	suite.Assert().ErrorContains(err, "reading CA")
+
+	_, err = TransportCredentials(conf.TLS{Enabled: true, CertFile: filepath.Join(suite.T().TempDir(), "client.pem")})
+	suite.Assert().ErrorContains(err, "loading client certificate")
+}
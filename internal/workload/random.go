@@ -0,0 +1,88 @@
+package workload
+
+import (
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// sampler draws the values of a task field.
+type sampler func() uint32
+
+// Random draws the type and the value of the tasks from the configured distributions.
+// The same seed always produces the same tasks.
+type Random struct {
+	taskType sampler
+	value    sampler
+}
+
+// NewRandom returns a Random generator drawing from a source initialized with seed.
+func NewRandom(cfg conf.Workload, seed int64) *Random {
+	r := rand.New(rand.NewSource(seed))
+	random := &Random{
+		taskType: newSampler(r, cfg.GetType()),
+		value:    newSampler(r, cfg.GetValue()),
+	}
+	if len(cfg.TypeMix) > 0 {
+		random.taskType = newMixSampler(r, cfg.TypeMix)
+	}
+	return random
+}
+
+// Next implements Generator.
+func (g *Random) Next(context.Context) (*domain.Task, error) {
+	return &domain.Task{
+		Type:  g.taskType(),
+		Value: g.value(),
+		State: domain.StateRECEIVED,
+	}, nil
+}
+
+// Paced implements Generator, the random tasks are produced at the producer rate.
+func (g *Random) Paced() bool {
+	return false
+}
+
+// Close implements Generator.
+func (g *Random) Close() error {
+	return nil
+}
+
+func newSampler(r *rand.Rand, d conf.Distribution) sampler {
+	switch d.Kind {
+	case "constant":
+		return func() uint32 { return d.Constant }
+	case "zipf":
+		zipf := rand.NewZipf(r, d.Skew, 1, uint64(d.Max-d.Min))
+		return func() uint32 { return d.Min + uint32(zipf.Uint64()) }
+	case "normal":
+		return func() uint32 {
+			drawn := math.Round(d.Mean + d.StdDev*r.NormFloat64())
+			return uint32(math.Min(math.Max(drawn, float64(d.Min)), float64(d.Max)))
+		}
+	default:
+		span := int64(d.Max-d.Min) + 1
+		return func() uint32 { return d.Min + uint32(r.Int63n(span)) }
+	}
+}
+
+// newMixSampler draws the task types in proportion to their weights.
+func newMixSampler(r *rand.Rand, mix []conf.TypeWeight) sampler {
+	cumulative := make([]float64, len(mix))
+	var total float64
+	for i, weight := range mix {
+		total += weight.Weight
+		cumulative[i] = total
+	}
+	return func() uint32 {
+		drawn := r.Float64() * total
+		i := sort.SearchFloat64s(cumulative, drawn)
+		if i < len(mix) && cumulative[i] == drawn {
+			i++
+		}
+		return mix[min(i, len(mix)-1)].Type
+	}
+}
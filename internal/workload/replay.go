@@ -0,0 +1,183 @@
+package workload
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayedTask is a task read from a replayed file, the columns match the task archives.
+type replayedTask struct {
+	Type         uint32    `json:"type"`
+	Value        uint32    `json:"value"`
+	CreationTime time.Time `json:"creation_time"`
+}
+
+// Replay sends the tasks of a JSONL or CSV file, spaced by the differences between their creation times.
+type Replay struct {
+	cfg    conf.Replay
+	file   *os.File
+	reader func() (replayedTask, error)
+	// last is the creation time of the previously replayed task, zero at the start of the file.
+	last time.Time
+	// wait blocks for the inter-arrival time of the next task.
+	wait func(ctx context.Context, d time.Duration) error
+}
+
+// NewReplay opens the file replayed by cfg.
+func NewReplay(cfg conf.Replay) (*Replay, error) {
+	replay := &Replay{cfg: cfg, wait: sleep}
+	if err := replay.open(); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+func (g *Replay) open() error {
+	file, err := os.Open(g.cfg.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file: %w", err)
+	}
+
+	var reader io.Reader = bufio.NewReader(file)
+	if strings.HasSuffix(g.cfg.Path, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return errors.Join(fmt.Errorf("failed to read replay file: %w", err), file.Close())
+		}
+	}
+
+	switch g.cfg.GetFormat() {
+	case "csv":
+		g.reader, err = csvReader(reader)
+	default:
+		g.reader = jsonlReader(reader)
+	}
+	if err != nil {
+		return errors.Join(err, file.Close())
+	}
+	g.file = file
+	g.last = time.Time{}
+	return nil
+}
+
+// Next implements Generator. It waits for the original inter-arrival time of the task, divided by the speed.
+func (g *Replay) Next(ctx context.Context) (*domain.Task, error) {
+	record, err := g.reader()
+	if errors.Is(err, io.EOF) && g.cfg.Loop {
+		if err = errors.Join(g.file.Close(), g.open()); err != nil {
+			return nil, err
+		}
+		record, err = g.reader()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !g.last.IsZero() && !record.CreationTime.IsZero() {
+		delay := time.Duration(float64(record.CreationTime.Sub(g.last)) / g.cfg.GetSpeed())
+		if err := g.wait(ctx, max(delay, 0)); err != nil {
+			return nil, err
+		}
+	}
+	if !record.CreationTime.IsZero() {
+		g.last = record.CreationTime
+	}
+
+	return &domain.Task{
+		Type:  record.Type,
+		Value: record.Value,
+		State: domain.StateRECEIVED,
+	}, nil
+}
+
+// Paced implements Generator, the replayed tasks keep their original pace.
+func (g *Replay) Paced() bool {
+	return true
+}
+
+// Close implements Generator.
+func (g *Replay) Close() error {
+	return g.file.Close()
+}
+
+func jsonlReader(r io.Reader) func() (replayedTask, error) {
+	decoder := json.NewDecoder(r)
+	return func() (replayedTask, error) {
+		var record replayedTask
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return record, io.EOF
+			}
+			return record, fmt.Errorf("failed to decode replayed task: %w", err)
+		}
+		return record, nil
+	}
+}
+
+// csvReader reads the type, value and optional creation_time columns named by the header of the file.
+func csvReader(r io.Reader) (func() (replayedTask, error), error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"type", "value"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column in the CSV header", name)
+		}
+	}
+
+	return func() (replayedTask, error) {
+		var record replayedTask
+		row, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return record, io.EOF
+			}
+			return record, fmt.Errorf("failed to read replayed task: %w", err)
+		}
+
+		taskType, err := strconv.ParseUint(row[columns["type"]], 10, 32)
+		if err != nil {
+			return record, fmt.Errorf("invalid type %q: %w", row[columns["type"]], err)
+		}
+		value, err := strconv.ParseUint(row[columns["value"]], 10, 32)
+		if err != nil {
+			return record, fmt.Errorf("invalid value %q: %w", row[columns["value"]], err)
+		}
+		record.Type, record.Value = uint32(taskType), uint32(value)
+
+		if i, ok := columns["creation_time"]; ok && row[i] != "" {
+			if record.CreationTime, err = time.Parse(time.RFC3339Nano, row[i]); err != nil {
+				return record, fmt.Errorf("invalid creation_time %q: %w", row[i], err)
+			}
+		}
+		return record, nil
+	}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,38 @@
+package workload
+
+import (
+	"context"
+	"fmt"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"time"
+)
+
+// Generator produces the tasks sent by the producer.
+type Generator interface {
+	// Next returns the next task, io.EOF once the workload is exhausted.
+	Next(ctx context.Context) (*domain.Task, error)
+	// Paced reports whether the generator spaces the tasks itself, in which case
+	// the producer does not apply its own production rate.
+	Paced() bool
+	// Close releases the resources held by the generator.
+	Close() error
+}
+
+// New returns the Generator of the configured workload. The seed of a random workload is
+// returned so that the run can be reproduced, it is zero for a replay.
+func New(cfg conf.Workload) (Generator, int64, error) {
+	switch cfg.GetMode() {
+	case "random":
+		seed := cfg.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		return NewRandom(cfg, seed), seed, nil
+	case "replay":
+		replay, err := NewReplay(cfg.Replay)
+		return replay, 0, err
+	default:
+		return nil, 0, fmt.Errorf("unknown workload mode %q", cfg.Mode)
+	}
+}
@@ -0,0 +1,118 @@
+package workload
+
+import (
+	"compress/gzip"
+	"context"
+	conf "github.com/hasanhakkaev/yqapp-demo/internal/config"
+	"github.com/hasanhakkaev/yqapp-demo/internal/domain"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWorkloadSuite(t *testing.T) {
+	suite.Run(t, new(WorkloadTestSuite))
+}
+
+type WorkloadTestSuite struct {
+	suite.Suite
+}
+
+func (suite *WorkloadTestSuite) draw(g Generator, n int) []*domain.Task {
+	tasks := make([]*domain.Task, n)
+	for i := range tasks {
+		task, err := g.Next(context.Background())
+		suite.Require().NoError(err)
+		tasks[i] = task
+	}
+	return tasks
+}
+
+func (suite *WorkloadTestSuite) TestRandom_Seed() {
+	cfg := conf.Workload{Value: conf.Distribution{Kind: "zipf", Min: 10, Max: 1000, Skew: 1.5}}
+
+	first := suite.draw(NewRandom(cfg, 42), 100)
+	suite.Assert().Equal(first, suite.draw(NewRandom(cfg, 42), 100), "the same seed produces the same tasks")
+	suite.Assert().NotEqual(first, suite.draw(NewRandom(cfg, 43), 100))
+}
+
+func (suite *WorkloadTestSuite) TestRandom_Distributions() {
+	cfg := conf.Workload{
+		Type:  conf.Distribution{Kind: "constant", Constant: 4},
+		Value: conf.Distribution{Kind: "normal", Min: 0, Max: 100, Mean: 50, StdDev: 40},
+	}
+	for _, task := range suite.draw(NewRandom(cfg, 1), 1000) {
+		suite.Assert().Equal(uint32(4), task.Type)
+		suite.Assert().LessOrEqual(task.Value, uint32(100), "normal values are clamped")
+		suite.Assert().Equal(domain.StateRECEIVED, task.State)
+	}
+
+	for _, task := range suite.draw(NewRandom(conf.Workload{}, 1), 1000) {
+		suite.Assert().LessOrEqual(task.Type, uint32(9))
+		suite.Assert().LessOrEqual(task.Value, uint32(99))
+	}
+}
+
+func (suite *WorkloadTestSuite) TestRandom_TypeMix() {
+	cfg := conf.Workload{TypeMix: []conf.TypeWeight{{Type: 1, Weight: 9}, {Type: 7, Weight: 1}}}
+
+	counts := make(map[uint32]int)
+	for _, task := range suite.draw(NewRandom(cfg, 1), 10000) {
+		counts[task.Type]++
+	}
+	suite.Assert().Len(counts, 2)
+	suite.Assert().InDelta(9000, counts[1], 300)
+	suite.Assert().InDelta(1000, counts[7], 300)
+}
+
+func (suite *WorkloadTestSuite) replay(cfg conf.Replay) (*Replay, *[]time.Duration) {
+	replay, err := NewReplay(cfg)
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = replay.Close() })
+
+	var delays []time.Duration
+	replay.wait = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return replay, &delays
+}
+
+func (suite *WorkloadTestSuite) TestReplay_JSONL() {
+	path := filepath.Join(suite.T().TempDir(), "tasks.jsonl.gz")
+	file, err := os.Create(path)
+	suite.Require().NoError(err)
+	writer := gzip.NewWriter(file)
+	_, err = io.WriteString(writer, `{"id":1,"type":2,"value":30,"state":"DONE","creation_time":"2024-01-01T00:00:00Z"}
+{"id":2,"type":9,"value":99,"state":"DONE","creation_time":"2024-01-01T00:00:02Z"}
+{"id":3,"type":5,"value":1,"state":"DONE","creation_time":"2024-01-01T00:00:03Z"}
+`)
+	suite.Require().NoError(err)
+	suite.Require().NoError(writer.Close())
+	suite.Require().NoError(file.Close())
+
+	replay, delays := suite.replay(conf.Replay{Path: path, Speed: 2})
+	tasks := suite.draw(replay, 3)
+	suite.Assert().Equal([]uint32{2, 9, 5}, []uint32{tasks[0].Type, tasks[1].Type, tasks[2].Type})
+	suite.Assert().Equal([]uint32{30, 99, 1}, []uint32{tasks[0].Value, tasks[1].Value, tasks[2].Value})
+	suite.Assert().Equal([]time.Duration{time.Second, 500 * time.Millisecond}, *delays, "the inter-arrival times are divided by the speed")
+
+	_, err = replay.Next(context.Background())
+	suite.Assert().ErrorIs(err, io.EOF)
+}
+
+func (suite *WorkloadTestSuite) TestReplay_CSVLoop() {
+	path := filepath.Join(suite.T().TempDir(), "tasks.csv")
+	suite.Require().NoError(os.WriteFile(path, []byte("value,type,creation_time\n"+
+		"10,1,2024-01-01T00:00:00Z\n"+
+		"20,2,2024-01-01T00:00:01.5Z\n"), 0o600))
+
+	replay, delays := suite.replay(conf.Replay{Path: path, Loop: true})
+	tasks := suite.draw(replay, 3)
+	suite.Assert().Equal([]uint32{1, 2, 1}, []uint32{tasks[0].Type, tasks[1].Type, tasks[2].Type})
+	suite.Assert().Equal([]uint32{10, 20, 10}, []uint32{tasks[0].Value, tasks[1].Value, tasks[2].Value})
+	suite.Assert().Equal([]time.Duration{1500 * time.Millisecond}, *delays, "the loop restarts without a delay")
+}
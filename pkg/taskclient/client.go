@@ -0,0 +1,241 @@
+// Package taskclient is the Go client of the TaskService of the consumer.
+//
+// The calls failing with a transient error are retried, see RetryPolicy. Tasks are created with an
+// idempotency key so that a retried creation does not create the task twice. The package
+// taskclienttest provides an in-memory TaskService for the tests of the applications using it.
+package taskclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io"
+)
+
+// Client calls the TaskService, it is safe for concurrent use.
+type Client struct {
+	tasks    v1.TaskServiceClient
+	retry    RetryPolicy
+	callOpts []grpc.CallOption
+	// conn is the connection created by New, nil for NewFromConn.
+	conn *grpc.ClientConn
+}
+
+// New connects to the consumer at target, e.g. "localhost:50051" or "dns:///consumer:50051".
+func New(target string, opts ...Option) (*Client, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := o.transport
+	if transport == nil {
+		transport = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.NewClient(target, append([]grpc.DialOption{grpc.WithTransportCredentials(transport)}, o.dialOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	client := newClient(conn, o)
+	client.conn = conn
+	return client, nil
+}
+
+// NewFromConn calls the TaskService over an existing connection, which is left open by Close.
+// The TLS and dial options do not apply to it.
+func NewFromConn(cc grpc.ClientConnInterface, opts ...Option) (*Client, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(cc, o), nil
+}
+
+func newClient(cc grpc.ClientConnInterface, o *options) *Client {
+	return &Client{tasks: v1.NewTaskServiceClient(cc), retry: o.retry, callOpts: o.callOpts}
+}
+
+// NewIdempotencyKey returns a random idempotency key.
+func NewIdempotencyKey() string {
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+func createRequest(task NewTask) *v1.CreateTaskRequest {
+	if task.IdempotencyKey == "" {
+		task.IdempotencyKey = NewIdempotencyKey()
+	}
+	return &v1.CreateTaskRequest{
+		Task:           &v1.Task{Type: task.Type, Value: task.Value},
+		IdempotencyKey: task.IdempotencyKey,
+	}
+}
+
+// Create creates a task, the retries do not create it twice.
+func (c *Client) Create(ctx context.Context, task NewTask) (*Task, error) {
+	request := createRequest(task)
+	var created *v1.Task
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		created, err = c.tasks.CreateTask(ctx, request, c.callOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromProto(created), nil
+}
+
+// CreateBatch creates several tasks in a single call and returns them in the same order. The tasks
+// created before a failure are kept, the retries do not create them twice.
+func (c *Client) CreateBatch(ctx context.Context, tasks []NewTask) ([]*Task, error) {
+	request := &v1.BatchCreateTasksRequest{Requests: make([]*v1.CreateTaskRequest, 0, len(tasks))}
+	for _, task := range tasks {
+		request.Requests = append(request.Requests, createRequest(task))
+	}
+
+	var response *v1.BatchCreateTasksResponse
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		response, err = c.tasks.BatchCreateTasks(ctx, request, c.callOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := make([]*Task, 0, len(response.GetTasks()))
+	for _, task := range response.GetTasks() {
+		created = append(created, fromProto(task))
+	}
+	return created, nil
+}
+
+// Get returns a task, ErrNotFound when it does not exist.
+func (c *Client) Get(ctx context.Context, id uint32) (*Task, error) {
+	var task *v1.Task
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		task, err = c.tasks.GetTask(ctx, &v1.GetTaskRequest{Id: id}, c.callOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromProto(task), nil
+}
+
+// List returns a page of tasks ordered by id.
+func (c *Client) List(ctx context.Context, opts ListOptions) (*Page, error) {
+	request := &v1.ListTasksRequest{PageSize: uint32(max(opts.PageSize, 0)), PageToken: opts.PageToken}
+	if opts.State != "" {
+		state, ok := stateToProto(opts.State)
+		if !ok {
+			return nil, errors.New("taskclient: unknown state " + string(opts.State))
+		}
+		request.State = &state
+	}
+
+	var response *v1.ListTasksResponse
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		response, err = c.tasks.ListTasks(ctx, request, c.callOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{NextPageToken: response.GetNextPageToken()}
+	for _, task := range response.GetTasks() {
+		page.Tasks = append(page.Tasks, fromProto(task))
+	}
+	return page, nil
+}
+
+// ListAll calls fn with the tasks of every page, starting at opts.PageToken, until fn fails.
+func (c *Client) ListAll(ctx context.Context, opts ListOptions, fn func(*Task) error) error {
+	for {
+		page, err := c.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, task := range page.Tasks {
+			if err := fn(task); err != nil {
+				return err
+			}
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		opts.PageToken = page.NextPageToken
+	}
+}
+
+// Watch calls fn with the task and then whenever it changes, until it is DONE or CANCELLED, fn fails
+// or ctx is done. The stream is opened again after a transient error.
+func (c *Client) Watch(ctx context.Context, id uint32, fn func(*Task) error) error {
+	var last *Task
+	return c.retry.do(ctx, func(ctx context.Context) error {
+		stream, err := c.tasks.WatchTask(ctx, &v1.WatchTaskRequest{Id: id}, c.callOpts...)
+		if err != nil {
+			return err
+		}
+		for {
+			pbTask, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			// A reopened stream starts with the current task, which may be known already
+			task := fromProto(pbTask)
+			if last != nil && last.State == task.State && last.UpdatedAt.Equal(task.UpdatedAt) {
+				continue
+			}
+			last = task
+			if err := fn(task); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// Cancel cancels a task, ErrFinished when it is already DONE or CANCELLED.
+func (c *Client) Cancel(ctx context.Context, id uint32) (*Task, error) {
+	var task *v1.Task
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		task, err = c.tasks.CancelTask(ctx, &v1.CancelTaskRequest{Id: id}, c.callOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromProto(task), nil
+}
+
+// Stats counts the tasks per state and type and sums their values per type.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var pbStats *v1.TaskStats
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		pbStats, err = c.tasks.GetTaskStats(ctx, &v1.GetTaskStatsRequest{}, c.callOpts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{Counts: make(map[State]int64, len(pbStats.GetCounts())), ValueSums: pbStats.GetValueSums(), TypeCounts: pbStats.GetTypeCounts()}
+	for state, count := range pbStats.GetCounts() {
+		stats.Counts[State(state)] = count
+	}
+	return stats, nil
+}
+
+// Close closes the connection created by New.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
@@ -0,0 +1,137 @@
+package taskclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/hasanhakkaev/yqapp-demo/internal/auth"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"maps"
+	"os"
+	"slices"
+)
+
+// Option configures a Client.
+type Option func(*options) error
+
+type options struct {
+	transport credentials.TransportCredentials
+	retry     RetryPolicy
+	dialOpts  []grpc.DialOption
+	callOpts  []grpc.CallOption
+	// creds are sent together, a call only keeps the last grpc.PerRPCCredentials option.
+	creds perRPCCredentials
+}
+
+// WithTLS secures the connection with the given TLS configuration. Connections are in plaintext
+// without it, like the demo stack.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) error {
+		o.transport = credentials.NewTLS(config)
+		return nil
+	}
+}
+
+// WithTLSFiles secures the connection with the PEM files of a CA and optionally of a client
+// certificate for mutual TLS, see TLSConfig.
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(o *options) error {
+		config, err := TLSConfig(caFile, certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		o.transport = credentials.NewTLS(config)
+		return nil
+	}
+}
+
+// TLSConfig loads the PEM files of a CA and optionally of a client certificate for mutual TLS.
+// An empty caFile trusts the system roots.
+func TLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("taskclient: reading CA: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("taskclient: no certificate found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("taskclient: loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// WithToken authenticates the calls with a bearer token of the consumer auth configuration.
+func WithToken(token string) Option {
+	return func(o *options) error {
+		o.creds = append(o.creds, auth.NewTokenCredentials(token))
+		return nil
+	}
+}
+
+// WithNamespace sends the calls on behalf of a namespace, tokens bound to a namespace ignore it.
+func WithNamespace(ns string) Option {
+	return func(o *options) error {
+		o.creds = append(o.creds, namespace.NewCredentials(ns))
+		return nil
+	}
+}
+
+// WithRetry replaces DefaultRetryPolicy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) error {
+		o.retry = policy
+		return nil
+	}
+}
+
+// WithDialOptions adds options to the connection created by New, e.g. interceptors.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) error {
+		o.dialOpts = append(o.dialOpts, opts...)
+		return nil
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{retry: DefaultRetryPolicy}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.creds) > 0 {
+		o.callOpts = append(o.callOpts, grpc.PerRPCCredentials(o.creds))
+	}
+	return o, nil
+}
+
+// perRPCCredentials merges the metadata of several credentials.
+type perRPCCredentials []credentials.PerRPCCredentials
+
+func (c perRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := make(map[string]string)
+	for _, creds := range c {
+		values, err := creds.GetRequestMetadata(ctx, uri...)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(md, values)
+	}
+	return md, nil
+}
+
+func (c perRPCCredentials) RequireTransportSecurity() bool {
+	return slices.ContainsFunc(c, credentials.PerRPCCredentials.RequireTransportSecurity)
+}
@@ -0,0 +1,100 @@
+package taskclient
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand/v2"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for the tasks missing from the namespace of the client.
+	ErrNotFound = errors.New("taskclient: task not found")
+	// ErrFinished is returned when cancelling a task that is already DONE or CANCELLED.
+	ErrFinished = errors.New("taskclient: task already finished")
+)
+
+// RetryPolicy retries the calls failing with a transient error, Unavailable, ResourceExhausted or
+// Aborted, with an exponential backoff and full jitter.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a call, 1 disables the retries.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a client created without WithRetry.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// NoRetry sends every call once.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// backoff returns the wait before the given retry, starting at 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	ceiling := p.InitialBackoff
+	for i := 1; i < retry && ceiling < p.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if p.MaxBackoff > 0 {
+		ceiling = min(ceiling, p.MaxBackoff)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// do runs call until it succeeds, fails with a permanent error or the attempts are exhausted.
+func (p RetryPolicy) do(ctx context.Context, call func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := call(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return translate(err)
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return translate(err)
+		}
+	}
+}
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusError keeps the gRPC status of an error matching one of the errors of the package.
+type statusError struct {
+	sentinel error
+	err      error
+}
+
+func (e statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e statusError) Unwrap() []error {
+	return []error{e.sentinel, e.err}
+}
+
+// translate makes the errors of the service match ErrNotFound and ErrFinished.
+func translate(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return statusError{sentinel: ErrNotFound, err: err}
+	case codes.FailedPrecondition:
+		return statusError{sentinel: ErrFinished, err: err}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,115 @@
+package taskclient
+
+import (
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"time"
+)
+
+// State is the state of a task.
+type State string
+
+const (
+	StateReceived   State = "RECEIVED"
+	StateProcessing State = "PROCESSING"
+	StateDone       State = "DONE"
+	StateCancelled  State = "CANCELLED"
+)
+
+// Final reports whether the state of a task can no longer change.
+func (s State) Final() bool {
+	return s == StateDone || s == StateCancelled
+}
+
+// Task is a task handled by the TaskService. It is encoded with the field names of the task archives.
+type Task struct {
+	ID        uint32    `json:"id" yaml:"id"`
+	Type      uint32    `json:"type" yaml:"type"`
+	Value     uint32    `json:"value" yaml:"value"`
+	State     State     `json:"state" yaml:"state"`
+	Namespace string    `json:"namespace" yaml:"namespace"`
+	CreatedAt time.Time `json:"creation_time" yaml:"creation_time"`
+	UpdatedAt time.Time `json:"last_update_time" yaml:"last_update_time"`
+	// StartedAt is set once a worker picked up the task.
+	StartedAt *time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	// FinishedAt is set once the task is DONE or CANCELLED.
+	FinishedAt *time.Time `json:"finished_at,omitempty" yaml:"finished_at,omitempty"`
+}
+
+// NewTask describes a task to create.
+type NewTask struct {
+	Type  uint32
+	Value uint32
+	// IdempotencyKey identifies the task within its namespace, the task created by an earlier call
+	// with the same key is returned instead of a new one. A key is generated when empty.
+	IdempotencyKey string
+}
+
+// ListOptions narrows the tasks returned by Client.List, zero values are ignored.
+type ListOptions struct {
+	State State
+	// PageSize is the maximum number of tasks of a page, the service defaults to 100.
+	PageSize int
+	// PageToken is the NextPageToken of the previous page.
+	PageToken string
+}
+
+// Page is a page of tasks ordered by id.
+type Page struct {
+	Tasks []*Task
+	// NextPageToken is empty on the last page.
+	NextPageToken string
+}
+
+// Stats holds the aggregates of the tasks of the namespace of the client.
+type Stats struct {
+	// Counts is the number of tasks per state.
+	Counts map[State]int64 `json:"counts" yaml:"counts"`
+	// ValueSums is the sum of the task values per task type.
+	ValueSums map[uint32]int64 `json:"value_sums" yaml:"value_sums"`
+	// TypeCounts is the number of tasks per task type.
+	TypeCounts map[uint32]int64 `json:"type_counts" yaml:"type_counts"`
+}
+
+var states = map[v1.TaskState]State{
+	v1.TaskState_RECEIVED:   StateReceived,
+	v1.TaskState_PROCESSING: StateProcessing,
+	v1.TaskState_DONE:       StateDone,
+	v1.TaskState_CANCELLED:  StateCancelled,
+}
+
+func stateToProto(state State) (v1.TaskState, bool) {
+	for pbState, s := range states {
+		if s == state {
+			return pbState, true
+		}
+	}
+	return v1.TaskState_UNKNOWN, false
+}
+
+func fromProto(pbTask *v1.Task) *Task {
+	task := &Task{
+		ID:        pbTask.GetId(),
+		Type:      pbTask.GetType(),
+		Value:     pbTask.GetValue(),
+		State:     states[pbTask.GetState()],
+		Namespace: pbTask.GetNamespace(),
+	}
+	if task.State == "" {
+		task.State = State(pbTask.GetState().String())
+	}
+	if pbTask.GetCreationTime() != nil {
+		task.CreatedAt = pbTask.GetCreationTime().AsTime()
+	}
+	if pbTask.GetLastUpdateTime() != nil {
+		task.UpdatedAt = pbTask.GetLastUpdateTime().AsTime()
+	}
+	if pbTask.GetStartedAt() != nil {
+		startedAt := pbTask.GetStartedAt().AsTime()
+		task.StartedAt = &startedAt
+	}
+	if pbTask.GetFinishedAt() != nil {
+		finishedAt := pbTask.GetFinishedAt().AsTime()
+		task.FinishedAt = &finishedAt
+	}
+	return task
+}
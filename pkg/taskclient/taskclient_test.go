@@ -0,0 +1,143 @@
+package taskclient_test
+
+import (
+	"context"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient/taskclienttest"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestTaskClientSuite(t *testing.T) {
+	suite.Run(t, new(TaskClientTestSuite))
+}
+
+type TaskClientTestSuite struct {
+	suite.Suite
+	server *taskclienttest.Server
+	client *taskclient.Client
+	ctx    context.Context
+}
+
+func (suite *TaskClientTestSuite) SetupTest() {
+	suite.server = taskclienttest.NewServer()
+	suite.client = suite.newClient(taskclient.WithNamespace("team-a"))
+
+	var cancel context.CancelFunc
+	suite.ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	suite.T().Cleanup(cancel)
+}
+
+func (suite *TaskClientTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *TaskClientTestSuite) newClient(opts ...taskclient.Option) *taskclient.Client {
+	opts = append(opts, taskclient.WithRetry(taskclient.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	client, err := suite.server.Client(opts...)
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func (suite *TaskClientTestSuite) TestCreateAndGet() {
+	created, err := suite.client.Create(suite.ctx, taskclient.NewTask{Type: 3, Value: 42})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(taskclient.StateReceived, created.State)
+	suite.Assert().Equal("team-a", created.Namespace)
+	suite.Assert().False(created.CreatedAt.IsZero())
+
+	task, err := suite.client.Get(suite.ctx, created.ID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(created, task)
+
+	suite.server.RequireToken("secret")
+	_, err = suite.client.Get(suite.ctx, created.ID)
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+	_, err = suite.newClient(taskclient.WithToken("secret"), taskclient.WithNamespace("team-a")).Get(suite.ctx, created.ID)
+	suite.Assert().NoError(err, "the token and the namespace are both sent")
+
+	_, err = suite.newClient(taskclient.WithToken("secret"), taskclient.WithNamespace("team-b")).Get(suite.ctx, created.ID)
+	suite.Assert().ErrorIs(err, taskclient.ErrNotFound, "the tasks of other namespaces are not visible")
+	suite.Assert().Equal(codes.NotFound, status.Code(err), "the gRPC status is kept")
+}
+
+func (suite *TaskClientTestSuite) TestRetries() {
+	suite.server.FailNext(codes.Unavailable, codes.ResourceExhausted)
+	created, err := suite.client.Create(suite.ctx, taskclient.NewTask{Type: 1, Value: 1, IdempotencyKey: "key-1"})
+	suite.Require().NoError(err)
+
+	again, err := suite.client.Create(suite.ctx, taskclient.NewTask{Type: 1, Value: 1, IdempotencyKey: "key-1"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(created.ID, again.ID)
+	suite.Assert().Len(suite.server.Tasks(), 1, "the same key does not create the task twice")
+
+	suite.server.FailNext(codes.Unavailable, codes.Unavailable, codes.Unavailable)
+	_, err = suite.client.Get(suite.ctx, created.ID)
+	suite.Assert().Equal(codes.Unavailable, status.Code(err), "the attempts are exhausted")
+
+	suite.server.FailNext(codes.InvalidArgument)
+	_, err = suite.client.Get(suite.ctx, created.ID)
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(err), "the permanent errors are not retried")
+	_, err = suite.client.Get(suite.ctx, created.ID)
+	suite.Assert().NoError(err)
+}
+
+func (suite *TaskClientTestSuite) TestBatchAndList() {
+	tasks := make([]taskclient.NewTask, 5)
+	for i := range tasks {
+		tasks[i] = taskclient.NewTask{Type: 1, Value: uint32(i)}
+	}
+	created, err := suite.client.CreateBatch(suite.ctx, tasks)
+	suite.Require().NoError(err)
+	suite.Require().Len(created, 5)
+	suite.Require().NoError(suite.server.SetState(created[4].ID, taskclient.StateDone))
+
+	page, err := suite.client.List(suite.ctx, taskclient.ListOptions{PageSize: 2})
+	suite.Require().NoError(err)
+	suite.Assert().Len(page.Tasks, 2)
+	suite.Assert().NotEmpty(page.NextPageToken)
+
+	var values []uint32
+	err = suite.client.ListAll(suite.ctx, taskclient.ListOptions{State: taskclient.StateReceived, PageSize: 2}, func(task *taskclient.Task) error {
+		values = append(values, task.Value)
+		return nil
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]uint32{0, 1, 2, 3}, values)
+
+	_, err = suite.client.List(suite.ctx, taskclient.ListOptions{State: "LOST"})
+	suite.Assert().Error(err)
+
+	stats, err := suite.client.Stats(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[taskclient.State]int64{taskclient.StateReceived: 4, taskclient.StateDone: 1}, stats.Counts)
+	suite.Assert().Equal(map[uint32]int64{1: 10}, stats.ValueSums)
+	suite.Assert().Equal(map[uint32]int64{1: 5}, stats.TypeCounts)
+}
+
+func (suite *TaskClientTestSuite) TestWatchAndCancel() {
+	created, err := suite.client.Create(suite.ctx, taskclient.NewTask{Type: 1, Value: 1})
+	suite.Require().NoError(err)
+
+	var states []taskclient.State
+	err = suite.client.Watch(suite.ctx, created.ID, func(task *taskclient.Task) error {
+		states = append(states, task.State)
+		switch task.State {
+		case taskclient.StateReceived:
+			return suite.server.SetState(task.ID, taskclient.StateProcessing)
+		case taskclient.StateProcessing:
+			_, err := suite.client.Cancel(suite.ctx, task.ID)
+			return err
+		}
+		return nil
+	})
+	suite.Require().NoError(err, "the watch ends once the task is final")
+	suite.Assert().Equal([]taskclient.State{taskclient.StateReceived, taskclient.StateProcessing, taskclient.StateCancelled}, states)
+
+	_, err = suite.client.Cancel(suite.ctx, created.ID)
+	suite.Assert().ErrorIs(err, taskclient.ErrFinished)
+}
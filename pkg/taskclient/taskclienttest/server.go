@@ -0,0 +1,336 @@
+// Package taskclienttest provides an in-memory TaskService for the tests of the applications using
+// the taskclient package.
+package taskclienttest
+
+import (
+	"context"
+	"fmt"
+	v1 "github.com/hasanhakkaev/yqapp-demo/api/tasks/v1"
+	"github.com/hasanhakkaev/yqapp-demo/internal/namespace"
+	"github.com/hasanhakkaev/yqapp-demo/pkg/taskclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory TaskService served over an in-process connection. Tasks stay in the state
+// they are created in until SetState changes it, there are no workers.
+type Server struct {
+	v1.UnimplementedTaskServiceServer
+
+	listener *bufconn.Listener
+	srv      *grpc.Server
+
+	mu     sync.Mutex
+	tasks  map[uint32]*v1.Task
+	keys   map[[2]string]uint32
+	nextID uint32
+	// token is required from the calls when set.
+	token string
+	// failures are returned by the next calls, before they are handled.
+	failures []error
+	// changed is closed and replaced whenever a task changes.
+	changed chan struct{}
+}
+
+var _ v1.TaskServiceServer = (*Server)(nil)
+
+// NewServer starts an empty server, it must be closed.
+func NewServer() *Server {
+	s := &Server{
+		listener: bufconn.Listen(1 << 20),
+		srv:      grpc.NewServer(),
+		tasks:    make(map[uint32]*v1.Task),
+		keys:     make(map[[2]string]uint32),
+		changed:  make(chan struct{}),
+	}
+	v1.RegisterTaskServiceServer(s.srv, s)
+	go func() { _ = s.srv.Serve(s.listener) }()
+	return s
+}
+
+// Client returns a client of the server, it must be closed.
+func (s *Server) Client(opts ...taskclient.Option) (*taskclient.Client, error) {
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return s.listener.DialContext(ctx)
+	}
+	opts = append(opts, taskclient.WithDialOptions(
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	))
+	return taskclient.New("passthrough:///taskclienttest", opts...)
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.srv.Stop()
+}
+
+// FailNext makes the next calls fail with the given codes, in order.
+func (s *Server) FailNext(codes ...codes.Code) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, code := range codes {
+		s.failures = append(s.failures, status.Error(code, "injected failure"))
+	}
+}
+
+// RequireToken rejects the calls without the given bearer token as Unauthenticated.
+func (s *Server) RequireToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// SetState changes the state of a task, e.g. to simulate its processing.
+func (s *Server) SetState(id uint32, state taskclient.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok {
+		return fmt.Errorf("taskclienttest: task %d not found", id)
+	}
+	pbState, ok := v1.TaskState_value[string(state)]
+	if !ok {
+		return fmt.Errorf("taskclienttest: unknown state %s", state)
+	}
+	s.setStateLocked(task, v1.TaskState(pbState))
+	return nil
+}
+
+// Tasks returns the tasks of every namespace ordered by id.
+func (s *Server) Tasks() []*v1.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]*v1.Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, proto.Clone(task).(*v1.Task))
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].GetId() < tasks[j].GetId() })
+	return tasks
+}
+
+func (s *Server) setStateLocked(task *v1.Task, state v1.TaskState) {
+	now := timestamppb.Now()
+	task.State = state
+	task.LastUpdateTime = now
+	switch state {
+	case v1.TaskState_PROCESSING:
+		task.StartedAt = now
+	case v1.TaskState_DONE, v1.TaskState_CANCELLED:
+		task.FinishedAt = now
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// begin returns the namespace of the call or the next injected failure, with the mutex held on success.
+func (s *Server) begin(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+		return "", err
+	}
+	if s.token != "" && !slices.Contains(metadata.ValueFromIncomingContext(ctx, "authorization"), "bearer "+s.token) {
+		s.mu.Unlock()
+		return "", status.Error(codes.Unauthenticated, "invalid auth token")
+	}
+
+	ns := namespace.Default
+	if values := metadata.ValueFromIncomingContext(ctx, namespace.Header); len(values) > 0 && values[0] != "" {
+		ns = values[0]
+	}
+	return ns, nil
+}
+
+// getLocked returns a task of the namespace.
+func (s *Server) getLocked(ns string, id uint32) (*v1.Task, error) {
+	task, ok := s.tasks[id]
+	if !ok || task.GetNamespace() != ns {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+	return task, nil
+}
+
+func (s *Server) CreateTask(ctx context.Context, request *v1.CreateTaskRequest) (*v1.Task, error) {
+	ns, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	return s.createLocked(ns, request), nil
+}
+
+func (s *Server) createLocked(ns string, request *v1.CreateTaskRequest) *v1.Task {
+	key := [2]string{ns, request.GetIdempotencyKey()}
+	if id, ok := s.keys[key]; ok && key[1] != "" {
+		return proto.Clone(s.tasks[id]).(*v1.Task)
+	}
+
+	s.nextID++
+	now := timestamppb.New(time.Now())
+	task := &v1.Task{
+		Id:             s.nextID,
+		Type:           request.GetTask().GetType(),
+		Value:          request.GetTask().GetValue(),
+		State:          v1.TaskState_RECEIVED,
+		CreationTime:   now,
+		LastUpdateTime: now,
+		Namespace:      ns,
+	}
+	s.tasks[task.Id] = task
+	if key[1] != "" {
+		s.keys[key] = task.Id
+	}
+	return proto.Clone(task).(*v1.Task)
+}
+
+func (s *Server) BatchCreateTasks(ctx context.Context, request *v1.BatchCreateTasksRequest) (*v1.BatchCreateTasksResponse, error) {
+	ns, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	response := &v1.BatchCreateTasksResponse{}
+	for _, createRequest := range request.GetRequests() {
+		response.Tasks = append(response.Tasks, s.createLocked(ns, createRequest))
+	}
+	return response, nil
+}
+
+func (s *Server) GetTask(ctx context.Context, request *v1.GetTaskRequest) (*v1.Task, error) {
+	ns, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	task, err := s.getLocked(ns, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(task).(*v1.Task), nil
+}
+
+func (s *Server) ListTasks(ctx context.Context, request *v1.ListTasksRequest) (*v1.ListTasksResponse, error) {
+	ns, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	offset := 0
+	if token := request.GetPageToken(); token != "" {
+		if offset, err = strconv.Atoi(token); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+	pageSize := int(request.GetPageSize())
+	if pageSize == 0 {
+		pageSize = 100
+	}
+
+	var matching []*v1.Task
+	for _, task := range s.tasks {
+		if task.GetNamespace() == ns && (request.State == nil || task.GetState() == request.GetState()) {
+			matching = append(matching, task)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].GetId() < matching[j].GetId() })
+
+	response := &v1.ListTasksResponse{}
+	for i := offset; i < len(matching) && i < offset+pageSize; i++ {
+		response.Tasks = append(response.Tasks, proto.Clone(matching[i]).(*v1.Task))
+	}
+	if offset+pageSize < len(matching) {
+		response.NextPageToken = strconv.Itoa(offset + pageSize)
+	}
+	return response, nil
+}
+
+func (s *Server) WatchTask(request *v1.WatchTaskRequest, stream v1.TaskService_WatchTaskServer) error {
+	ns, err := s.begin(stream.Context())
+	if err != nil {
+		return err
+	}
+	var sent *v1.Task
+	for {
+		task, err := s.getLocked(ns, request.GetId())
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		task = proto.Clone(task).(*v1.Task)
+		changed := s.changed
+		s.mu.Unlock()
+
+		// Like the service, the task is only sent again once it changed
+		if sent == nil || !proto.Equal(sent, task) {
+			if err := stream.Send(task); err != nil {
+				return err
+			}
+			sent = task
+		}
+		if task.GetState() == v1.TaskState_DONE || task.GetState() == v1.TaskState_CANCELLED {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		s.mu.Lock()
+	}
+}
+
+func (s *Server) CancelTask(ctx context.Context, request *v1.CancelTaskRequest) (*v1.Task, error) {
+	ns, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	task, err := s.getLocked(ns, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if task.GetState() == v1.TaskState_DONE || task.GetState() == v1.TaskState_CANCELLED {
+		return nil, status.Error(codes.FailedPrecondition, "task already finished")
+	}
+	s.setStateLocked(task, v1.TaskState_CANCELLED)
+	return proto.Clone(task).(*v1.Task), nil
+}
+
+func (s *Server) GetTaskStats(ctx context.Context, _ *v1.GetTaskStatsRequest) (*v1.TaskStats, error) {
+	ns, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	stats := &v1.TaskStats{Counts: make(map[string]int64), ValueSums: make(map[uint32]int64), TypeCounts: make(map[uint32]int64)}
+	for _, task := range s.tasks {
+		if task.GetNamespace() == ns {
+			stats.Counts[task.GetState().String()]++
+			stats.ValueSums[task.GetType()] += int64(task.GetValue())
+			stats.TypeCounts[task.GetType()]++
+		}
+	}
+	return stats, nil
+}
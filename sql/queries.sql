@@ -1,25 +1,130 @@
 -- name: CreateTask :one
-INSERT INTO tasks (type, value, state, creation_time, last_update_time)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO tasks (type, value, state, creation_time, last_update_time, namespace)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING id;
 
 -- name: UpdateTaskState :one
 UPDATE tasks
-SET state = $1, last_update_time = $2
-WHERE id = $3
-RETURNING id, type, value, state, creation_time, last_update_time;
+SET state            = $1,
+    last_update_time = $2,
+    started_at       = CASE WHEN $1 = 'PROCESSING' THEN $2 ELSE started_at END,
+    finished_at      = CASE WHEN $1 = 'DONE' THEN $2 ELSE finished_at END
+WHERE id = $3 AND state <> 'CANCELLED' AND ($1 <> 'PROCESSING' OR state = 'RECEIVED')
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace;
 
 -- name: GetTasksByState :many
-SELECT id, type, value, state, creation_time, last_update_time
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
 FROM tasks
 WHERE state = $1;
 
 -- name: GetSumOfTasksByState :many
 SELECT state, COUNT(*) AS task_count
 FROM tasks
+WHERE sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text
 GROUP BY state;
 
+-- name: GetSumOfTasksByType :many
+SELECT type, COUNT(*) AS task_count
+FROM tasks
+WHERE sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text
+GROUP BY type;
+
 -- name: GetSumOfValues :many
 SELECT type, SUM(value) AS total_value
 FROM tasks
+WHERE sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text
 GROUP BY type;
+
+-- name: RequeueTasks :many
+UPDATE tasks
+SET state = 'RECEIVED', last_update_time = sqlc.arg(last_update_time), started_at = NULL
+WHERE id = ANY(sqlc.arg(ids)::int[]) AND state NOT IN ('DONE', 'CANCELLED')
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace;
+
+-- name: ClaimReceivedTasks :many
+UPDATE tasks
+SET last_update_time = sqlc.arg(last_update_time)
+WHERE id IN (
+    SELECT id
+    FROM tasks
+    WHERE state = 'RECEIVED' AND last_update_time < sqlc.arg(updated_before)
+    ORDER BY id
+    LIMIT sqlc.arg(row_limit)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace;
+
+-- name: GetConsumerSettings :one
+SELECT paused, rate_limit, burst, workers, version
+FROM consumer_settings
+WHERE id = 1;
+
+-- name: UpdateConsumerSettings :one
+INSERT INTO consumer_settings (id, paused, rate_limit, burst, workers)
+VALUES (1, COALESCE(sqlc.narg(paused)::boolean, FALSE), sqlc.narg(rate_limit), sqlc.narg(burst), sqlc.narg(workers))
+ON CONFLICT (id) DO UPDATE
+SET paused     = COALESCE(sqlc.narg(paused)::boolean, consumer_settings.paused),
+    rate_limit = COALESCE(sqlc.narg(rate_limit), consumer_settings.rate_limit),
+    burst      = COALESCE(sqlc.narg(burst), consumer_settings.burst),
+    workers    = COALESCE(sqlc.narg(workers), consumer_settings.workers),
+    version    = consumer_settings.version + 1,
+    updated_at = now()
+RETURNING paused, rate_limit, burst, workers, version;
+
+-- name: GetTask :one
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+FROM tasks
+WHERE id = sqlc.arg(id) AND (sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text);
+
+-- name: ListTasks :many
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+FROM tasks
+WHERE (sqlc.narg(state)::text IS NULL OR state::text = sqlc.narg(state)::text)
+  AND (sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text)
+ORDER BY id
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: ListRecentTasks :many
+SELECT id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace
+FROM tasks
+WHERE (sqlc.narg(state)::text IS NULL OR state::text = sqlc.narg(state)::text)
+  AND (sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text)
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: InsertOutboxEvent :exec
+INSERT INTO outbox (event_type, task_id, data)
+VALUES ($1, $2, $3);
+
+-- name: ClaimOutboxEvents :many
+SELECT id, event_type, task_id, data, created_at, attempts, last_error
+FROM outbox
+ORDER BY id
+LIMIT sqlc.arg(row_limit)
+FOR UPDATE SKIP LOCKED;
+
+-- name: DeleteOutboxEvents :exec
+DELETE FROM outbox
+WHERE id = ANY(sqlc.arg(ids)::bigint[]);
+
+-- name: RecordOutboxFailure :exec
+UPDATE outbox
+SET attempts = attempts + 1, last_error = $2
+WHERE id = $1;
+
+-- name: CancelTask :one
+UPDATE tasks
+SET state = 'CANCELLED', last_update_time = sqlc.arg(last_update_time), finished_at = sqlc.arg(last_update_time)
+WHERE id = sqlc.arg(id)
+  AND (sqlc.narg(namespace)::text IS NULL OR namespace = sqlc.narg(namespace)::text)
+  AND state IN ('RECEIVED', 'PROCESSING')
+RETURNING id, type, value, state, creation_time, last_update_time, started_at, finished_at, namespace;
+
+-- name: GetIdempotencyKey :one
+SELECT task_id
+FROM idempotency_keys
+WHERE namespace = $1 AND key = $2;
+
+-- name: CreateIdempotencyKey :exec
+INSERT INTO idempotency_keys (namespace, key, task_id)
+VALUES ($1, $2, $3);
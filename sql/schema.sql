@@ -1,18 +1,61 @@
+-- Mirrors the result of assets/migrations, checked by internal/database/migrate_test.go
+DROP TABLE if EXISTS tasks;
 DROP TYPE if EXISTS state;
-CREATE TYPE state AS ENUM('RECEIVED','PROCESSING','DONE');
+CREATE TYPE state AS ENUM('RECEIVED','PROCESSING','DONE','CANCELLED');
 
-DROP TABLE if EXISTS tasks;
 CREATE TABLE IF NOT EXISTS tasks (
-                                     id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+                                     id SERIAL,                           -- Unique identifier for the task (auto-incrementing integer)
                                      type INT NOT NULL CHECK (type BETWEEN 0 AND 9), -- Task type (between 0 and 9)
                                      value INT NOT NULL CHECK (value BETWEEN 0 AND 99), -- Task value (between 0 and 99)
-                                     state STATE NOT NULL,            -- Task state (enum with values 'RECEIVED', 'PROCESSING', 'DONE')
-                                     creation_time FLOAT NOT NULL,         -- Creation time as a Unix timestamp (float)
-                                     last_update_time FLOAT NOT NULL       -- Last update time as a Unix timestamp (float)              -- Timestamp for the last update to the task
-);
+                                     state STATE NOT NULL,            -- Task state (enum with values 'RECEIVED', 'PROCESSING', 'DONE', 'CANCELLED')
+                                     creation_time TIMESTAMPTZ NOT NULL,   -- Time the consumer accepted the task
+                                     last_update_time TIMESTAMPTZ NOT NULL, -- Time of the last state change
+                                     started_at TIMESTAMPTZ,               -- Time a worker started processing the task, NULL until then
+                                     finished_at TIMESTAMPTZ,              -- Time the task became DONE or CANCELLED, NULL until then
+                                     namespace TEXT NOT NULL DEFAULT 'default', -- Tenant owning the task
+                                     PRIMARY KEY (id, creation_time)       -- The primary key of a partitioned table includes the partition key
+) PARTITION BY RANGE (creation_time);   -- Partitions are created and retired by the consumer, see internal/database/partitions.go
 
 
 CREATE INDEX IF NOT EXISTS idx_task_state ON tasks(state);
 
 CREATE INDEX IF NOT EXISTS idx_task_type ON tasks(type);
 
+CREATE INDEX IF NOT EXISTS idx_task_namespace_state ON tasks(namespace, state);
+
+-- Holds the tasks outside of every partition until the consumer moves them to their partition
+CREATE TABLE IF NOT EXISTS tasks_default PARTITION OF tasks DEFAULT;
+
+
+DROP TABLE if EXISTS consumer_settings;
+CREATE TABLE IF NOT EXISTS consumer_settings (
+                                     id INT PRIMARY KEY CHECK (id = 1),   -- Single row shared by every replica
+                                     paused BOOLEAN NOT NULL DEFAULT FALSE,
+                                     rate_limit DOUBLE PRECISION CHECK (rate_limit > 0), -- NULL falls back to the configuration
+                                     burst INT CHECK (burst > 0),
+                                     workers INT CHECK (workers > 0),
+                                     version BIGINT NOT NULL DEFAULT 1,  -- Incremented on every change
+                                     updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+
+DROP TABLE if EXISTS outbox;
+CREATE TABLE IF NOT EXISTS outbox (
+                                     id BIGSERIAL PRIMARY KEY,            -- Publication order of the events
+                                     event_type TEXT NOT NULL,            -- CloudEvents type, e.g. yqapp.task.done
+                                     task_id INT NOT NULL,
+                                     data JSONB NOT NULL,                 -- Snapshot of the task after the change
+                                     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                     attempts INT NOT NULL DEFAULT 0,     -- Failed attempts to publish the event
+                                     last_error TEXT
+);
+
+
+DROP TABLE if EXISTS idempotency_keys;
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+                                     namespace TEXT NOT NULL,
+                                     key TEXT NOT NULL,
+                                     task_id INT NOT NULL,                -- Task created by the first request with the key
+                                     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                     PRIMARY KEY (namespace, key)
+);